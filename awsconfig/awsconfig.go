@@ -0,0 +1,164 @@
+// Package awsconfig builds the aws.Config shared by the AWS backed clients of
+// this module (DynamoDB in db, KMS in crypto) from functional options.
+package awsconfig
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-xray-sdk-go/instrumentation/awsv2"
+)
+
+// HTTPTimeouts configures the HTTP client of the AWS SDK. Zero values keep
+// the SDK defaults.
+type HTTPTimeouts struct {
+	// Timeout bounds a whole request, including reading the response body.
+	Timeout               time.Duration
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	IdleConnTimeout       time.Duration
+}
+
+// Options holds the settings applied by Load.
+type Options struct {
+	Region       string
+	Endpoint     string
+	Config       *aws.Config
+	Retryer      func() aws.Retryer
+	MaxAttempts  int
+	HTTPTimeouts *HTTPTimeouts
+	Tracing      bool
+}
+
+type Option func(*Options)
+
+// WithRegion sets the region, overriding the one of an injected aws.Config.
+func WithRegion(region string) Option {
+	return func(o *Options) {
+		o.Region = region
+	}
+}
+
+// WithEndpoint sends every request to endpoint, e.g. DynamoDB Local at
+// http://localhost:8000 or LocalStack.
+func WithEndpoint(endpoint string) Option {
+	return func(o *Options) {
+		o.Endpoint = endpoint
+	}
+}
+
+// WithConfig uses cfg instead of loading the default configuration. cfg is
+// copied, the other options never modify the caller's value.
+func WithConfig(cfg aws.Config) Option {
+	return func(o *Options) {
+		o.Config = &cfg
+	}
+}
+
+// WithRetryer replaces the retryer of the SDK clients.
+func WithRetryer(retryer func() aws.Retryer) Option {
+	return func(o *Options) {
+		o.Retryer = retryer
+	}
+}
+
+// WithMaxAttempts sets the maximum number of attempts of every request,
+// including the first one. It also applies to a retryer set by WithRetryer.
+func WithMaxAttempts(maxAttempts int) Option {
+	return func(o *Options) {
+		o.MaxAttempts = maxAttempts
+	}
+}
+
+// WithHTTPTimeouts replaces the HTTP client with one using timeouts.
+func WithHTTPTimeouts(timeouts HTTPTimeouts) Option {
+	return func(o *Options) {
+		o.HTTPTimeouts = &timeouts
+	}
+}
+
+// WithTracing turns the AWS X-Ray instrumentation of the SDK clients on or off.
+func WithTracing(enabled bool) Option {
+	return func(o *Options) {
+		o.Tracing = enabled
+	}
+}
+
+// Load returns the aws.Config described by options. Without WithConfig the
+// default configuration chain of the SDK is loaded.
+func Load(ctx context.Context, options ...Option) (aws.Config, error) {
+	var o Options
+	for _, option := range options {
+		option(&o)
+	}
+
+	var cfg aws.Config
+	if o.Config != nil {
+		cfg = o.Config.Copy()
+		cfg.APIOptions = slices.Clone(cfg.APIOptions)
+	} else {
+		loaded, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			return aws.Config{}, err
+		}
+		cfg = loaded
+	}
+
+	if o.Region != "" {
+		cfg.Region = o.Region
+	}
+	if o.Endpoint != "" {
+		cfg.BaseEndpoint = aws.String(o.Endpoint)
+	}
+	if o.Retryer != nil {
+		cfg.Retryer = o.Retryer
+	}
+	if o.MaxAttempts > 0 {
+		cfg.RetryMaxAttempts = o.MaxAttempts
+		// RetryMaxAttempts is ignored by the clients once a Retryer is set.
+		if retryer := cfg.Retryer; retryer != nil {
+			maxAttempts := o.MaxAttempts
+			cfg.Retryer = func() aws.Retryer {
+				return retry.AddWithMaxAttempts(retryer(), maxAttempts)
+			}
+		}
+	}
+	if o.HTTPTimeouts != nil {
+		cfg.HTTPClient = newHTTPClient(*o.HTTPTimeouts)
+	}
+	if o.Tracing {
+		awsv2.AWSV2Instrumentor(&cfg.APIOptions)
+	}
+	return cfg, nil
+}
+
+func newHTTPClient(timeouts HTTPTimeouts) *awshttp.BuildableClient {
+	client := awshttp.NewBuildableClient().WithTransportOptions(func(transport *http.Transport) {
+		if timeouts.TLSHandshakeTimeout > 0 {
+			transport.TLSHandshakeTimeout = timeouts.TLSHandshakeTimeout
+		}
+		if timeouts.ResponseHeaderTimeout > 0 {
+			transport.ResponseHeaderTimeout = timeouts.ResponseHeaderTimeout
+		}
+		if timeouts.IdleConnTimeout > 0 {
+			transport.IdleConnTimeout = timeouts.IdleConnTimeout
+		}
+	})
+	if timeouts.DialTimeout > 0 {
+		client = client.WithDialerOptions(func(dialer *net.Dialer) {
+			dialer.Timeout = timeouts.DialTimeout
+		})
+	}
+	if timeouts.Timeout > 0 {
+		client = client.WithTimeout(timeouts.Timeout)
+	}
+	return client
+}
@@ -0,0 +1,60 @@
+package awsconfig
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+)
+
+func TestLoadWithConfig(t *testing.T) {
+	base := aws.Config{Region: "us-east-1"}
+
+	cfg, err := Load(context.Background(),
+		WithConfig(base),
+		WithRegion("eu-west-1"),
+		WithEndpoint("http://localhost:8000"),
+		WithRetryer(func() aws.Retryer { return retry.NewStandard() }),
+		WithMaxAttempts(7),
+		WithHTTPTimeouts(HTTPTimeouts{Timeout: time.Second}),
+		WithTracing(true),
+	)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Region != "eu-west-1" {
+		t.Errorf("Region -> Expected: eu-west-1 // Returned: %v", cfg.Region)
+	}
+	if aws.ToString(cfg.BaseEndpoint) != "http://localhost:8000" {
+		t.Errorf("BaseEndpoint -> Expected: http://localhost:8000 // Returned: %v", aws.ToString(cfg.BaseEndpoint))
+	}
+	if attempts := cfg.Retryer().MaxAttempts(); attempts != 7 {
+		t.Errorf("MaxAttempts -> Expected: 7 // Returned: %v", attempts)
+	}
+	client, ok := cfg.HTTPClient.(*awshttp.BuildableClient)
+	if !ok || client.GetTimeout() != time.Second {
+		t.Errorf("HTTPClient -> Expected: 1s timeout // Returned: %T", cfg.HTTPClient)
+	}
+	if len(cfg.APIOptions) == 0 {
+		t.Errorf("APIOptions -> Expected: X-Ray instrumentation // Returned: none")
+	}
+	if base.Region != "us-east-1" || len(base.APIOptions) != 0 {
+		t.Errorf("WithConfig -> Expected: caller config unchanged // Returned: %v %d", base.Region, len(base.APIOptions))
+	}
+}
+
+func TestLoadWithoutTracing(t *testing.T) {
+	cfg, err := Load(context.Background(), WithConfig(aws.Config{}), WithMaxAttempts(2))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(cfg.APIOptions) != 0 {
+		t.Errorf("APIOptions -> Expected: none // Returned: %d", len(cfg.APIOptions))
+	}
+	if cfg.RetryMaxAttempts != 2 {
+		t.Errorf("RetryMaxAttempts -> Expected: 2 // Returned: %v", cfg.RetryMaxAttempts)
+	}
+}
@@ -15,6 +15,7 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/techvuya/vuya-go-utils/awsconfig"
 )
 
 // DataKeyInfo represents information about a data key
@@ -36,9 +37,9 @@ type EnvelopeService struct {
 }
 
 // NewEnvelopeService creates a new instance of EnvelopeService
-func NewEnvelopeService(ctx context.Context, masterKeyID string) (*EnvelopeService, error) {
+func NewEnvelopeService(ctx context.Context, masterKeyID string, options ...awsconfig.Option) (*EnvelopeService, error) {
 	// Create KMS client
-	kmsClient, err := generateKmsClient()
+	kmsClient, err := generateKmsClient(ctx, options...)
 	if err != nil {
 		return nil, err
 	}
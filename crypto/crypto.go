@@ -19,6 +19,21 @@ import (
 //   - []byte: The nonce-prepended ciphertext.
 //   - error: An error if key initialization or encryption fails.
 func EncryptBytes(key []byte, plainData []byte) ([]byte, error) {
+	return EncryptBytesWithAAD(key, plainData, nil)
+}
+
+// EncryptBytesWithAAD is EncryptBytes with additional authenticated data. The aad is not stored in
+// the result but is authenticated with it, so the ciphertext only decrypts with the same aad.
+//
+// Parameters:
+//   - key: A 32-byte secret key for encryption. It must be of length chacha20poly1305.KeySizeX.
+//   - plainData: The plaintext data to encrypt.
+//   - aad: The additional data the ciphertext is bound to, e.g. the record it belongs to. It may be nil.
+//
+// Returns:
+//   - []byte: The nonce-prepended ciphertext.
+//   - error: An error if key initialization or encryption fails.
+func EncryptBytesWithAAD(key []byte, plainData []byte, aad []byte) ([]byte, error) {
 	// Create an AEAD instance for XChaCha20-Poly1305 using the provided key.
 	aead, err := chacha20poly1305.NewX(key)
 	if err != nil {
@@ -32,7 +47,7 @@ func EncryptBytes(key []byte, plainData []byte) ([]byte, error) {
 	}
 
 	// Seal encrypts and authenticates the plaintext, appending the result to the nonce slice.
-	encryptedMsg := aead.Seal(nonce, nonce, plainData, nil)
+	encryptedMsg := aead.Seal(nonce, nonce, plainData, aad)
 
 	return encryptedMsg, nil
 }
@@ -48,6 +63,21 @@ func EncryptBytes(key []byte, plainData []byte) ([]byte, error) {
 //   - []byte: The decrypted plaintext.
 //   - error: An error if key initialization, data length, or authentication fails.
 func DecryptBytes(key []byte, encryptedData []byte) ([]byte, error) {
+	return DecryptBytesWithAAD(key, encryptedData, nil)
+}
+
+// DecryptBytesWithAAD decrypts data produced by EncryptBytesWithAAD. Authentication fails unless aad
+// is the one the data was encrypted with.
+//
+// Parameters:
+//   - key: A 32-byte secret key for decryption. Must match the key used for encryption.
+//   - encryptedData: The nonce-prepended ciphertext returned by EncryptBytesWithAAD.
+//   - aad: The additional data passed to EncryptBytesWithAAD.
+//
+// Returns:
+//   - []byte: The decrypted plaintext.
+//   - error: An error if key initialization, data length, or authentication fails.
+func DecryptBytesWithAAD(key []byte, encryptedData []byte, aad []byte) ([]byte, error) {
 	// Initialize the AEAD instance with the provided key.
 	aead, err := chacha20poly1305.NewX(key)
 	if err != nil {
@@ -64,7 +94,7 @@ func DecryptBytes(key []byte, encryptedData []byte) ([]byte, error) {
 	ciphertext := encryptedData[aead.NonceSize():]
 
 	// Open decrypts and authenticates the ciphertext, returning the plaintext or an error.
-	plainData, err := aead.Open(nil, nonce, ciphertext, nil)
+	plainData, err := aead.Open(nil, nonce, ciphertext, aad)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decrypt or authenticate data: %w", err)
 	}
@@ -22,3 +22,37 @@ func TestEncryptDecrypt(t *testing.T) {
 		t.Errorf("Decrypt: plaintext mismatch, got %s, want %s", decryptedPlaintext, plaintext)
 	}
 }
+
+func TestEncryptDecryptWithAAD(t *testing.T) {
+	key := []byte("supersecretkey32byteslong1234567")
+	plaintext := "Hello, World!"
+
+	ciphertext, err := EncryptBytesWithAAD(key, []byte(plaintext), []byte("users/user-1"))
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+
+	testCases := []struct {
+		description string
+		aad         []byte
+		expectedErr bool
+	}{
+		{"same aad", []byte("users/user-1"), false},
+		{"other aad", []byte("users/user-2"), true},
+		{"no aad", nil, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			decryptedPlaintext, err := DecryptBytesWithAAD(key, ciphertext, tc.aad)
+			if tc.expectedErr {
+				if err == nil {
+					t.Errorf("Decrypt: expected an authentication error, got %s", decryptedPlaintext)
+				}
+				return
+			}
+			if err != nil || string(decryptedPlaintext) != plaintext {
+				t.Errorf("Decrypt: plaintext mismatch, got %s (%v), want %s", decryptedPlaintext, err, plaintext)
+			}
+		})
+	}
+}
@@ -4,7 +4,8 @@ import (
 	"context"
 	b64 "encoding/base64"
 
-	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/techvuya/vuya-go-utils/awsconfig"
+
 	"github.com/aws/aws-sdk-go-v2/service/kms"
 	"github.com/aws/aws-sdk-go-v2/service/kms/types"
 )
@@ -13,8 +14,8 @@ type AgEncryption struct {
 	kmsClient *kms.Client
 }
 
-func BuildAgEncryption() (*AgEncryption, error) {
-	kmsClient, err := generateKmsClient()
+func BuildAgEncryption(options ...awsconfig.Option) (*AgEncryption, error) {
+	kmsClient, err := generateKmsClient(context.TODO(), options...)
 	if err != nil {
 		return nil, err
 	}
@@ -54,8 +55,8 @@ func (a *AgEncryption) DecryptText(ctx context.Context, keyId, encryptedText str
 	return string(outputDecryption.Plaintext), nil
 }
 
-func generateKmsClient() (*kms.Client, error) {
-	cfg, err := config.LoadDefaultConfig(context.TODO())
+func generateKmsClient(ctx context.Context, options ...awsconfig.Option) (*kms.Client, error) {
+	cfg, err := awsconfig.Load(ctx, options...)
 	if err != nil {
 		return nil, err
 	}
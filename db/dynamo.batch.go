@@ -0,0 +1,375 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var ErrBatchUnprocessedKeys = errors.New("ErrBatchUnprocessedKeys")
+
+const batchGetMaxKeys = 100
+
+// BatchGetOptions tunes how batch reads are split and retried. The zero
+// value uses the defaults below.
+type BatchGetOptions struct {
+	// Concurrency is the number of BatchGetItem calls in flight (default 4).
+	Concurrency int
+	// MaxRetries bounds the retries of UnprocessedKeys for each chunk (default 8).
+	MaxRetries int
+	// BaseDelay and MaxDelay bound the exponential backoff with full jitter
+	// between retries (defaults 50ms and 2s).
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// PreserveOrder returns items in the order of the requested keys.
+	// Keys without an item are skipped.
+	PreserveOrder  bool
+	ConsistentRead bool
+	// Attributes limits the read to these attributes or document paths.
+	// Key attributes are always read.
+	Attributes []string
+	// ProjectStruct limits the read to the fields of the result struct.
+	ProjectStruct bool
+}
+
+func (o BatchGetOptions) withDefaults() BatchGetOptions {
+	if o.Concurrency <= 0 {
+		o.Concurrency = 4
+	}
+	if o.MaxRetries <= 0 {
+		o.MaxRetries = 8
+	}
+	if o.BaseDelay <= 0 {
+		o.BaseDelay = 50 * time.Millisecond
+	}
+	if o.MaxDelay <= 0 {
+		o.MaxDelay = 2 * time.Second
+	}
+	return o
+}
+
+// BatchGetRequest describes the keys to read from one table in a
+// multi-table batch read.
+type BatchGetRequest struct {
+	TableName         string
+	Keys              []map[string]types.AttributeValue
+	ResultDataPointer interface{}
+}
+
+// batchGetGroup is the keys read from one table with one projection.
+// Requests on the same table with the same projection share a group, so
+// their common keys are read once.
+type batchGetGroup struct {
+	tableUrl   string
+	projection readProjection
+	keys       map[string]bool
+}
+
+type batchGetEntry struct {
+	group int
+	key   map[string]types.AttributeValue
+}
+
+// batchGetRequestKeys is a request resolved against its group: the key
+// signatures it asked for, in order, and the expiry attribute of its type.
+type batchGetRequestKeys struct {
+	group    int
+	keyNames []string
+	order    map[string]int
+	expiry   string
+}
+
+// GetBatchTables reads keys from several tables, splitting them into
+// BatchGetItem calls of at most 100 keys and retrying UnprocessedKeys.
+// Each ResultDataPointer receives the items of its own keys, projected and
+// filtered for its own type; requests without any matching item get an
+// empty slice.
+func (c DynamoDatabaseClient) GetBatchTables(ctx context.Context, requests []BatchGetRequest, options BatchGetOptions) error {
+	responses, err := c.batchGetItems(ctx, requests, options)
+	if err != nil {
+		return err
+	}
+	for i, request := range requests {
+		items := responses[i]
+		if items == nil {
+			items = []map[string]types.AttributeValue{}
+		}
+		if err := c.openItems(ctx, request.TableName, request.ResultDataPointer, items, nil); err != nil {
+			return err
+		}
+		if err := attributevalue.UnmarshalListOfMaps(items, request.ResultDataPointer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetBatchWithOptions is GetBatch with explicit chunking, retry and ordering
+// options.
+func (c DynamoDatabaseClient) GetBatchWithOptions(ctx context.Context, tableName string, keys []map[string]types.AttributeValue, resultDataPointer interface{}, options BatchGetOptions) error {
+	responses, err := c.batchGetItems(ctx, []BatchGetRequest{{TableName: tableName, Keys: keys, ResultDataPointer: resultDataPointer}}, options)
+	if err != nil {
+		return err
+	}
+	if len(responses[0]) == 0 {
+		return ErrQueryNoData
+	}
+	if err := c.openItems(ctx, tableName, resultDataPointer, responses[0], nil); err != nil {
+		return err
+	}
+	return attributevalue.UnmarshalListOfMaps(responses[0], resultDataPointer)
+}
+
+// batchGetItems returns the items of each request, in the order of requests.
+func (c DynamoDatabaseClient) batchGetItems(ctx context.Context, requests []BatchGetRequest, options BatchGetOptions) ([][]map[string]types.AttributeValue, error) {
+	options = options.withDefaults()
+
+	var groups []batchGetGroup
+	var entries []batchGetEntry
+	groupIDs := make(map[string]int)
+	resolved := make([]batchGetRequestKeys, len(requests))
+	for i, request := range requests {
+		if len(request.Keys) == 0 {
+			resolved[i].group = -1
+			continue
+		}
+		tableUrl := c.GetTableUrl(request.TableName)
+		keyNames := attributeNames(request.Keys[0])
+		expiry := expiryAttribute(ctx, request.ResultDataPointer)
+		projected := keyNames
+		if expiry != "" {
+			projected = append(projected[:len(projected):len(projected)], expiry)
+		}
+		projection, err := buildReadProjection(options.Attributes, options.ProjectStruct, request.ResultDataPointer, projected)
+		if err != nil {
+			return nil, err
+		}
+		groupID := fmt.Sprint(tableUrl, aws.ToString(projection.expression), projection.names)
+		group, ok := groupIDs[groupID]
+		if !ok {
+			group = len(groups)
+			groupIDs[groupID] = group
+			groups = append(groups, batchGetGroup{tableUrl: tableUrl, projection: projection, keys: make(map[string]bool)})
+		}
+
+		resolved[i] = batchGetRequestKeys{group: group, keyNames: keyNames, order: make(map[string]int, len(request.Keys)), expiry: expiry}
+		for _, key := range request.Keys {
+			signature := attributeKeySignature(key, keyNames)
+			if _, duplicated := resolved[i].order[signature]; !duplicated {
+				resolved[i].order[signature] = len(resolved[i].order)
+			}
+			if !groups[group].keys[signature] {
+				groups[group].keys[signature] = true
+				entries = append(entries, batchGetEntry{group: group, key: key})
+			}
+		}
+	}
+
+	groupItems := make([][]map[string]types.AttributeValue, len(groups))
+	if len(entries) > 0 {
+		if err := c.batchGetGroups(ctx, groups, entries, groupItems, options); err != nil {
+			return nil, err
+		}
+	}
+
+	responses := make([][]map[string]types.AttributeValue, len(requests))
+	for i, request := range resolved {
+		if request.group < 0 {
+			continue
+		}
+		for _, item := range groupItems[request.group] {
+			if _, requested := request.order[attributeKeySignature(item, request.keyNames)]; !requested {
+				continue
+			}
+			if request.expiry != "" && isExpired(request.expiry, item) {
+				continue
+			}
+			responses[i] = append(responses[i], item)
+		}
+		if options.PreserveOrder {
+			items, names, order := responses[i], request.keyNames, request.order
+			sort.SliceStable(items, func(i, j int) bool {
+				return order[attributeKeySignature(items[i], names)] < order[attributeKeySignature(items[j], names)]
+			})
+		}
+	}
+	return responses, nil
+}
+
+// batchGetGroups reads the entries into groupItems, concurrently.
+func (c DynamoDatabaseClient) batchGetGroups(ctx context.Context, groups []batchGetGroup, entries []batchGetEntry, groupItems [][]map[string]types.AttributeValue, options BatchGetOptions) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+	)
+	semaphore := make(chan struct{}, options.Concurrency)
+	for _, chunk := range batchGetChunks(groups, entries) {
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(chunk []batchGetEntry) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			items, err := c.batchGetChunk(ctx, groups, chunk, options)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				return
+			}
+			for group, chunkItems := range items {
+				groupItems[group] = append(groupItems[group], chunkItems...)
+			}
+		}(chunk)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// batchGetChunks splits entries into BatchGetItem calls of at most 100 keys.
+// A call reads a table with a single projection, so a call never mixes two
+// groups of the same table.
+func batchGetChunks(groups []batchGetGroup, entries []batchGetEntry) [][]batchGetEntry {
+	var chunks [][]batchGetEntry
+	var chunk []batchGetEntry
+	tableGroups := make(map[string]int)
+	for _, entry := range entries {
+		tableUrl := groups[entry.group].tableUrl
+		if group, ok := tableGroups[tableUrl]; len(chunk) == batchGetMaxKeys || (ok && group != entry.group) {
+			chunks = append(chunks, chunk)
+			chunk = nil
+			clear(tableGroups)
+		}
+		tableGroups[tableUrl] = entry.group
+		chunk = append(chunk, entry)
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// batchGetChunk reads one chunk and returns its items by group.
+func (c DynamoDatabaseClient) batchGetChunk(ctx context.Context, groups []batchGetGroup, chunk []batchGetEntry, options BatchGetOptions) (map[int][]map[string]types.AttributeValue, error) {
+	requestItems := make(map[string]types.KeysAndAttributes)
+	tableGroups := make(map[string]int)
+	for _, entry := range chunk {
+		group := groups[entry.group]
+		tableGroups[group.tableUrl] = entry.group
+		request := requestItems[group.tableUrl]
+		request.Keys = append(request.Keys, entry.key)
+		if options.ConsistentRead {
+			request.ConsistentRead = aws.Bool(true)
+		}
+		request.ProjectionExpression = group.projection.expression
+		request.ExpressionAttributeNames = group.projection.names
+		requestItems[group.tableUrl] = request
+	}
+
+	items := make(map[int][]map[string]types.AttributeValue)
+	for attempt := 0; ; attempt++ {
+		result, err := c.dynamoClient.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+			RequestItems:           requestItems,
+			ReturnConsumedCapacity: types.ReturnConsumedCapacityTotal,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for tableUrl, tableItems := range result.Responses {
+			group := tableGroups[tableUrl]
+			items[group] = append(items[group], tableItems...)
+		}
+		if len(result.UnprocessedKeys) == 0 {
+			return items, nil
+		}
+		if attempt >= options.MaxRetries {
+			pending := 0
+			for _, request := range result.UnprocessedKeys {
+				pending += len(request.Keys)
+			}
+			return nil, fmt.Errorf("%w: %d keys still unprocessed after %d retries", ErrBatchUnprocessedKeys, pending, options.MaxRetries)
+		}
+		if err := sleepWithContext(ctx, backoffDelay(attempt, options.BaseDelay, options.MaxDelay)); err != nil {
+			return nil, err
+		}
+		requestItems = result.UnprocessedKeys
+	}
+}
+
+// backoffDelay returns an exponential backoff with full jitter.
+func backoffDelay(attempt int, baseDelay, maxDelay time.Duration) time.Duration {
+	delay := maxDelay
+	if attempt < 32 {
+		if scaled := baseDelay << attempt; scaled > 0 && scaled < maxDelay {
+			delay = scaled
+		}
+	}
+	return time.Duration(rand.Int64N(int64(delay) + 1))
+}
+
+func sleepWithContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func attributeNames(item map[string]types.AttributeValue) []string {
+	names := make([]string, 0, len(item))
+	for name := range item {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// attributeKeySignature identifies an item by the given key attributes.
+func attributeKeySignature(item map[string]types.AttributeValue, names []string) string {
+	var sb strings.Builder
+	for _, name := range names {
+		sb.WriteString(name)
+		sb.WriteString("=")
+		switch v := item[name].(type) {
+		case *types.AttributeValueMemberS:
+			sb.WriteString("S:" + v.Value)
+		case *types.AttributeValueMemberN:
+			if canonical, err := canonicalNumberString(v.Value); err == nil {
+				sb.WriteString("N:" + canonical)
+			} else {
+				sb.WriteString("N:" + v.Value)
+			}
+		case *types.AttributeValueMemberB:
+			sb.WriteString(fmt.Sprintf("B:%x", v.Value))
+		}
+		sb.WriteString(";")
+	}
+	return sb.String()
+}
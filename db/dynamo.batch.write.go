@@ -0,0 +1,323 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	arrayutils "github.com/techvuya/vuya-go-utils/array"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var ErrBatchUnprocessedItems = errors.New("ErrBatchUnprocessedItems")
+var ErrVersionedBatchWrite = errors.New("ErrVersionedBatchWrite")
+
+const batchWriteMaxItems = 25
+
+// BatchWriteOptions tunes how batch writes are split and retried. The zero
+// value uses the defaults below.
+type BatchWriteOptions struct {
+	// Concurrency is the number of BatchWriteItem calls in flight (default 4).
+	Concurrency int
+	// MaxRetries bounds the retries of UnprocessedItems for each chunk (default 8).
+	MaxRetries int
+	// BaseDelay and MaxDelay bound the exponential backoff with full jitter
+	// between retries (defaults 50ms and 2s).
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+func (o BatchWriteOptions) withDefaults() BatchWriteOptions {
+	if o.Concurrency <= 0 {
+		o.Concurrency = 4
+	}
+	if o.MaxRetries <= 0 {
+		o.MaxRetries = 8
+	}
+	if o.BaseDelay <= 0 {
+		o.BaseDelay = 50 * time.Millisecond
+	}
+	if o.MaxDelay <= 0 {
+		o.MaxDelay = 2 * time.Second
+	}
+	return o
+}
+
+// BatchWriteRequest lists the puts and deletes for one table in a
+// multi-table batch write.
+type BatchWriteRequest struct {
+	TableName string
+	Puts      []interface{}
+	Deletes   []map[string]types.AttributeValue
+}
+
+// BatchWriteFailure describes one put or delete that could not be written.
+// Index is the position of the item in the Puts or Deletes of its request.
+type BatchWriteFailure struct {
+	TableName string
+	Index     int
+	Delete    bool
+	Err       error
+}
+
+// BatchWriteError is returned when some writes of a batch failed. Every
+// write not listed in Failures was applied.
+type BatchWriteError struct {
+	Total    int
+	Failures []BatchWriteFailure
+}
+
+func (e *BatchWriteError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "batch write: %d of %d writes failed", len(e.Failures), e.Total)
+	for i, failure := range e.Failures {
+		if i == 3 {
+			fmt.Fprintf(&sb, "; ...")
+			break
+		}
+		operation := "put"
+		if failure.Delete {
+			operation = "delete"
+		}
+		fmt.Fprintf(&sb, "; %s %s[%d]: %v", failure.TableName, operation, failure.Index, failure.Err)
+	}
+	return sb.String()
+}
+
+// Unwrap exposes the distinct causes so errors.Is works on the summary,
+// e.g. errors.Is(err, ErrBatchUnprocessedItems).
+func (e *BatchWriteError) Unwrap() []error {
+	var causes []error
+	for _, failure := range e.Failures {
+		duplicated := false
+		for _, cause := range causes {
+			if cause == failure.Err {
+				duplicated = true
+				break
+			}
+		}
+		if !duplicated {
+			causes = append(causes, failure.Err)
+		}
+	}
+	return causes
+}
+
+type batchWriteEntry struct {
+	order     int
+	tableName string
+	tableUrl  string
+	index     int
+	delete    bool
+	request   types.WriteRequest
+	signature string
+}
+
+func writeRequestSignature(tableUrl string, request types.WriteRequest) string {
+	if request.DeleteRequest != nil {
+		key := request.DeleteRequest.Key
+		return tableUrl + "/delete/" + attributeKeySignature(key, attributeNames(key))
+	}
+	item := request.PutRequest.Item
+	return tableUrl + "/put/" + attributeKeySignature(item, attributeNames(item))
+}
+
+// PutBatch writes items to one table with BatchWriteItem, 25 at a time.
+func (c DynamoDatabaseClient) PutBatch(ctx context.Context, tableName string, items []interface{}) error {
+	return c.WriteBatch(ctx, []BatchWriteRequest{{TableName: tableName, Puts: items}}, BatchWriteOptions{})
+}
+
+// DeleteBatch deletes keys from one table with BatchWriteItem, 25 at a time.
+func (c DynamoDatabaseClient) DeleteBatch(ctx context.Context, tableName string, keys []map[string]types.AttributeValue) error {
+	return c.WriteBatch(ctx, []BatchWriteRequest{{TableName: tableName, Deletes: keys}}, BatchWriteOptions{})
+}
+
+// WriteBatch applies puts and deletes across one or more tables. Writes are
+// sent in groups of 25 and UnprocessedItems are re-sent with jittered
+// backoff. When some writes fail the returned *BatchWriteError lists them;
+// the remaining writes are still applied. Puts of items with a version field
+// fail with ErrVersionedBatchWrite, as their version cannot be checked.
+func (c DynamoDatabaseClient) WriteBatch(ctx context.Context, requests []BatchWriteRequest, options BatchWriteOptions) error {
+	options = options.withDefaults()
+
+	var entries []batchWriteEntry
+	var failures []BatchWriteFailure
+	total := 0
+	for _, request := range requests {
+		tableUrl := c.GetTableUrl(request.TableName)
+		for i, item := range request.Puts {
+			total++
+			if err := checkUnversioned(item); err != nil {
+				failures = append(failures, BatchWriteFailure{TableName: request.TableName, Index: i, Err: err})
+				continue
+			}
+			av, err := attributevalue.MarshalMap(item)
+			if err != nil {
+				failures = append(failures, BatchWriteFailure{TableName: request.TableName, Index: i, Err: err})
+				continue
+			}
+			applyItemTTL(item, av)
+			if err := c.sealItem(ctx, request.TableName, item, av); err != nil {
+				failures = append(failures, BatchWriteFailure{TableName: request.TableName, Index: i, Err: err})
+				continue
+			}
+			writeRequest := types.WriteRequest{PutRequest: &types.PutRequest{Item: av}}
+			entries = append(entries, batchWriteEntry{
+				order:     total,
+				tableName: request.TableName,
+				tableUrl:  tableUrl,
+				index:     i,
+				request:   writeRequest,
+				signature: writeRequestSignature(tableUrl, writeRequest),
+			})
+		}
+		for i, key := range request.Deletes {
+			total++
+			writeRequest := types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: key}}
+			entries = append(entries, batchWriteEntry{
+				order:     total,
+				tableName: request.TableName,
+				tableUrl:  tableUrl,
+				index:     i,
+				delete:    true,
+				request:   writeRequest,
+				signature: writeRequestSignature(tableUrl, writeRequest),
+			})
+		}
+	}
+
+	var (
+		mu         sync.Mutex
+		wg         sync.WaitGroup
+		failedByID = make(map[int]BatchWriteFailure)
+	)
+	semaphore := make(chan struct{}, options.Concurrency)
+	for _, chunk := range arrayutils.ArrayChunk(entries, batchWriteMaxItems) {
+		semaphore <- struct{}{}
+		wg.Add(1)
+		go func(chunk []batchWriteEntry) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			failed := c.batchWriteChunk(ctx, chunk, options)
+			mu.Lock()
+			defer mu.Unlock()
+			for order, failure := range failed {
+				failedByID[order] = failure
+			}
+		}(chunk)
+	}
+	wg.Wait()
+
+	orders := make([]int, 0, len(failedByID))
+	for order := range failedByID {
+		orders = append(orders, order)
+	}
+	sort.Ints(orders)
+	for _, order := range orders {
+		failures = append(failures, failedByID[order])
+	}
+	if len(failures) > 0 {
+		return &BatchWriteError{Total: total, Failures: failures}
+	}
+	return nil
+}
+
+// batchWriteChunk writes up to 25 entries and returns the failed ones keyed
+// by their order in the batch.
+func (c DynamoDatabaseClient) batchWriteChunk(ctx context.Context, chunk []batchWriteEntry, options BatchWriteOptions) map[int]BatchWriteFailure {
+	pending := make(map[string]batchWriteEntry, len(chunk))
+	requestItems := make(map[string][]types.WriteRequest)
+	for _, entry := range chunk {
+		pending[entry.signature] = entry
+		requestItems[entry.tableUrl] = append(requestItems[entry.tableUrl], entry.request)
+	}
+
+	failAll := func(err error) map[int]BatchWriteFailure {
+		failed := make(map[int]BatchWriteFailure, len(pending))
+		for _, entry := range pending {
+			failed[entry.order] = BatchWriteFailure{TableName: entry.tableName, Index: entry.index, Delete: entry.delete, Err: err}
+		}
+		return failed
+	}
+
+	for attempt := 0; ; attempt++ {
+		result, err := c.dynamoClient.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems:           requestItems,
+			ReturnConsumedCapacity: types.ReturnConsumedCapacityTotal,
+		})
+		if err != nil {
+			return failAll(err)
+		}
+		if len(result.UnprocessedItems) == 0 {
+			return nil
+		}
+		remaining := make(map[string]batchWriteEntry)
+		for tableUrl, writeRequests := range result.UnprocessedItems {
+			for _, writeRequest := range writeRequests {
+				signature := writeRequestSignature(tableUrl, writeRequest)
+				if entry, ok := pending[signature]; ok {
+					remaining[signature] = entry
+				}
+			}
+		}
+		pending = remaining
+		if attempt >= options.MaxRetries {
+			return failAll(ErrBatchUnprocessedItems)
+		}
+		if err := sleepWithContext(ctx, backoffDelay(attempt, options.BaseDelay, options.MaxDelay)); err != nil {
+			return failAll(err)
+		}
+		requestItems = result.UnprocessedItems
+	}
+}
+
+// checkUnversioned rejects items with a version field, as BatchWriteItem
+// takes no condition to check it.
+func checkUnversioned(data interface{}) error {
+	info, err := itemStructInfo(data)
+	if err != nil {
+		return err
+	}
+	if info != nil && info.version != nil {
+		return fmt.Errorf("%w: %T has the version field %s, write it with PutItem or a transaction", ErrVersionedBatchWrite, data, info.version.name)
+	}
+	return nil
+}
+
+// PutBatch writes typed items to one table with BatchWriteItem. Types with a
+// version field return ErrVersionedBatchWrite.
+func PutBatch[T any](ctx context.Context, dbClient *DynamoDatabaseClient, tableName string, items []T, options BatchWriteOptions) error {
+	if err := checkUnversioned(new(T)); err != nil {
+		return err
+	}
+	puts := make([]interface{}, len(items))
+	for i, item := range items {
+		puts[i] = item
+	}
+	return dbClient.WriteBatch(ctx, []BatchWriteRequest{{TableName: tableName, Puts: puts}}, options)
+}
+
+// PutBatch writes items with BatchWriteItem, 25 at a time.
+func (t *Table[T]) PutBatch(ctx context.Context, items []T) error {
+	return PutBatch(ctx, t.client, t.tableName, items, BatchWriteOptions{})
+}
+
+// DeleteBatch deletes the items with the keys of items, 25 at a time.
+func (t *Table[T]) DeleteBatch(ctx context.Context, items []T) error {
+	keys := make([]map[string]types.AttributeValue, len(items))
+	for i, item := range items {
+		key, err := t.KeyOf(item)
+		if err != nil {
+			return err
+		}
+		keys[i] = key
+	}
+	return t.client.DeleteBatch(ctx, t.tableName, keys)
+}
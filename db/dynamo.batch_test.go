@@ -0,0 +1,188 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type testUser struct {
+	UserID string `dynamodbav:"userId"`
+	Name   string `dynamodbav:"name"`
+}
+
+func createTestUsersTable(t *testing.T, client *DynamoDatabaseClient) {
+	t.Helper()
+	_, err := client.GetApiClient().(*MemoryDynamoClient).CreateTable(context.Background(), &dynamodb.CreateTableInput{
+		TableName: aws.String(client.GetTableUrl("users")),
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String("userId"), AttributeType: types.ScalarAttributeTypeS},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("userId"), KeyType: types.KeyTypeHash},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateTable failed: %v", err)
+	}
+}
+
+func testEventKey(eventID string) map[string]types.AttributeValue {
+	key, _ := attributevalue.MarshalMap(map[string]string{"orgId": "org-1", "eventId": eventID})
+	return key
+}
+
+func TestGetBatchChunksAndRetriesUnprocessedKeys(t *testing.T) {
+	client := createTestDynamoClient(t)
+	seedTestEvents(t, client, 99)
+	client.GetApiClient().(*MemoryDynamoClient).SetBatchProcessingLimit(30)
+
+	var keys []map[string]types.AttributeValue
+	for i := 98; i >= 0; i-- {
+		keys = append(keys, testEventKey(fmt.Sprintf("evt-%02d", i)))
+	}
+	for i := 0; i < 150; i++ {
+		keys = append(keys, testEventKey(fmt.Sprintf("missing-%03d", i)))
+	}
+	keys = append(keys, testEventKey("evt-10"))
+
+	var events []testEvent
+	options := BatchGetOptions{Concurrency: 2, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond, PreserveOrder: true}
+	if err := client.GetBatchWithOptions(context.Background(), "events", keys, &events, options); err != nil {
+		t.Fatalf("GetBatchWithOptions failed: %v", err)
+	}
+	if len(events) != 99 {
+		t.Fatalf("GetBatchWithOptions items -> Expected: 99 // Returned: %d", len(events))
+	}
+	for i, event := range events {
+		expected := fmt.Sprintf("evt-%02d", 98-i)
+		if event.EventID != expected {
+			t.Fatalf("GetBatchWithOptions order at %d -> Expected: %s // Returned: %s", i, expected, event.EventID)
+		}
+	}
+
+	options.MaxRetries = 1
+	err := client.GetBatchWithOptions(context.Background(), "events", keys, &events, options)
+	if !errors.Is(err, ErrBatchUnprocessedKeys) {
+		t.Errorf("GetBatchWithOptions with exhausted retries -> Expected: ErrBatchUnprocessedKeys // Returned: %v", err)
+	}
+}
+
+func TestGetBatchTables(t *testing.T) {
+	client := createTestDynamoClient(t)
+	createTestUsersTable(t, client)
+	seedTestEvents(t, client, 3)
+	if err := client.PutItem(context.Background(), "users", testUser{UserID: "user-1", Name: "Ana"}); err != nil {
+		t.Fatalf("PutItem failed: %v", err)
+	}
+
+	userKey, _ := attributevalue.MarshalMap(map[string]string{"userId": "user-1"})
+	var events []testEvent
+	var users []testUser
+	err := client.GetBatchTables(context.Background(), []BatchGetRequest{
+		{TableName: "events", Keys: []map[string]types.AttributeValue{testEventKey("evt-00"), testEventKey("evt-02")}, ResultDataPointer: &events},
+		{TableName: "users", Keys: []map[string]types.AttributeValue{userKey}, ResultDataPointer: &users},
+	}, BatchGetOptions{})
+	if err != nil {
+		t.Fatalf("GetBatchTables failed: %v", err)
+	}
+	if len(events) != 2 || len(users) != 1 || users[0].Name != "Ana" {
+		t.Errorf("GetBatchTables returned events: %+v users: %+v", events, users)
+	}
+}
+
+func TestGetBatchTablesSameTable(t *testing.T) {
+	ctx := context.Background()
+	client := createTestDynamoClient(t)
+	seedTestEvents(t, client, 3)
+	expired := testSession{OrgID: "org-1", EventID: "evt-02", Status: "open", ExpiresAt: time.Now().Add(-time.Minute).Unix()}
+	if err := client.PutItem(ctx, "events", expired); err != nil {
+		t.Fatalf("PutItem failed: %v", err)
+	}
+
+	var events []testEvent
+	var sessions []testSession
+	err := client.GetBatchTables(ctx, []BatchGetRequest{
+		{TableName: "events", Keys: []map[string]types.AttributeValue{testEventKey("evt-00"), testEventKey("evt-02")}, ResultDataPointer: &events},
+		{TableName: "events", Keys: []map[string]types.AttributeValue{testEventKey("evt-01"), testEventKey("evt-02")}, ResultDataPointer: &sessions},
+	}, BatchGetOptions{PreserveOrder: true, ProjectStruct: true})
+	if err != nil {
+		t.Fatalf("GetBatchTables failed: %v", err)
+	}
+	var eventIDs []string
+	for _, event := range events {
+		eventIDs = append(eventIDs, event.EventID)
+	}
+	if !reflect.DeepEqual(eventIDs, []string{"evt-00", "evt-02"}) {
+		t.Errorf("Events -> Expected: [evt-00 evt-02] // Returned: %v", eventIDs)
+	}
+	if ids := testSessionIDs(sessions); len(ids) != 1 || ids[0] != "evt-01" {
+		t.Errorf("Sessions -> Expected: [evt-01] // Returned: %v", ids)
+	}
+}
+
+func TestWriteBatchAcrossTablesWithUnprocessedItems(t *testing.T) {
+	client := createTestDynamoClient(t)
+	createTestUsersTable(t, client)
+	seedTestEvents(t, client, 5)
+	client.GetApiClient().(*MemoryDynamoClient).SetBatchProcessingLimit(7)
+
+	var events []testEvent
+	for i := 10; i < 70; i++ {
+		events = append(events, testEvent{OrgID: "org-1", EventID: fmt.Sprintf("evt-%02d", i), Status: "open"})
+	}
+	puts := make([]interface{}, len(events))
+	for i := range events {
+		puts[i] = events[i]
+	}
+	userKey, _ := attributevalue.MarshalMap(map[string]string{"userId": "user-1"})
+	err := client.WriteBatch(context.Background(), []BatchWriteRequest{
+		{TableName: "events", Puts: puts, Deletes: []map[string]types.AttributeValue{testEventKey("evt-00"), testEventKey("evt-01")}},
+		{TableName: "users", Puts: []interface{}{testUser{UserID: "user-1", Name: "Ana"}}},
+	}, BatchWriteOptions{BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("WriteBatch failed: %v", err)
+	}
+
+	count, err := client.QueryCount(context.Background(), "events", "", testOrgKeyCondition(t))
+	if err != nil {
+		t.Fatalf("QueryCount failed: %v", err)
+	}
+	if count != 63 {
+		t.Errorf("Items after WriteBatch -> Expected: 63 // Returned: %d", count)
+	}
+	var user testUser
+	if err := client.Get(context.Background(), "users", userKey, &user); err != nil || user.Name != "Ana" {
+		t.Errorf("Get user after WriteBatch returned %+v, %v", user, err)
+	}
+
+	err = client.WriteBatch(context.Background(), []BatchWriteRequest{
+		{TableName: "events", Puts: puts},
+	}, BatchWriteOptions{MaxRetries: 1, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	var batchErr *BatchWriteError
+	if !errors.As(err, &batchErr) || !errors.Is(err, ErrBatchUnprocessedItems) {
+		t.Fatalf("WriteBatch with exhausted retries -> Expected: BatchWriteError // Returned: %v", err)
+	}
+	// Every chunk of 25 writes 7 items per call, so two calls leave 11 unprocessed per full chunk.
+	if batchErr.Total != 60 || len(batchErr.Failures) != 22 {
+		t.Errorf("BatchWriteError -> Total: %d Failures: %d", batchErr.Total, len(batchErr.Failures))
+	}
+}
+
+func testOrgKeyCondition(t *testing.T) expression.Expression {
+	t.Helper()
+	expr, err := expression.NewBuilder().WithKeyCondition(expression.Key("orgId").Equal(expression.Value("org-1"))).Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	return expr
+}
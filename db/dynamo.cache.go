@@ -0,0 +1,570 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var ErrCacheInvalidation = errors.New("ErrCacheInvalidation")
+
+// CachePolicy configures the caching of one table.
+type CachePolicy struct {
+	// Keys names the key attributes of the table, used to find the cached
+	// item of every write.
+	Keys TableKeySchema
+	// TTL is how long items and query results are cached (default 5m).
+	TTL time.Duration
+	// NegativeTTL is how long lookups that found nothing are cached
+	// (default 30s). Use a negative value to not cache them.
+	NegativeTTL time.Duration
+	// WriteThrough caches the items written by PutItem instead of only
+	// invalidating them.
+	WriteThrough bool
+}
+
+func (p CachePolicy) withDefaults() CachePolicy {
+	if p.TTL <= 0 {
+		p.TTL = 5 * time.Minute
+	}
+	if p.NegativeTTL == 0 {
+		p.NegativeTTL = 30 * time.Second
+	}
+	return p
+}
+
+// CacheOptions configures CreateCachedDynamoClient.
+type CacheOptions struct {
+	// KeyPrefix namespaces the cache keys (default "dynamo").
+	KeyPrefix string
+	// Tables holds the policy of every cached table, by unprefixed name.
+	// Other tables are read from and written to DynamoDB directly.
+	Tables map[string]CachePolicy
+}
+
+func (o CacheOptions) withDefaults() CacheOptions {
+	if o.KeyPrefix == "" {
+		o.KeyPrefix = "dynamo"
+	}
+	tables := make(map[string]CachePolicy, len(o.Tables))
+	for tableName, policy := range o.Tables {
+		tables[tableName] = policy.withDefaults()
+	}
+	o.Tables = tables
+	return o
+}
+
+// CachedDynamoClient is a DynamoDatabaseClient that serves Get and QueryOne
+// from a cache, filling it on a miss. Lookups that find nothing are cached
+// too. Writes made through it invalidate, or with WriteThrough refresh, the
+// cached items they change, and every write to a table invalidates its
+// cached query results. Items are cached as stored, so encrypted attributes
+// stay sealed in the cache.
+//
+// Writes made with another client, by a Table or by the generic helpers
+// such as QueryAll that take the underlying client, are only seen when the
+// cached entries expire. A miss is not cached when the table was written to
+// while it was read, though a write that lands between that check and the
+// fill can still leave the previous item cached until it expires.
+//
+// Cache failures on reads fall back to DynamoDB; on writes they are returned
+// as ErrCacheInvalidation after the write was applied.
+type CachedDynamoClient struct {
+	*DynamoDatabaseClient
+	cache   CacheClientInterface
+	options CacheOptions
+}
+
+// CreateCachedDynamoClient wraps client with cache, caching the tables of
+// options.
+func CreateCachedDynamoClient(client *DynamoDatabaseClient, cache CacheClientInterface, options CacheOptions) *CachedDynamoClient {
+	return &CachedDynamoClient{
+		DynamoDatabaseClient: client,
+		cache:                cache,
+		options:              options.withDefaults(),
+	}
+}
+
+// Get reads the item stored under keys from the cache or, on a miss, from
+// DynamoDB.
+func (c *CachedDynamoClient) Get(ctx context.Context, tableName string, keys map[string]types.AttributeValue, resultDataPointer interface{}) error {
+	policy, cached := c.options.Tables[tableName]
+	cacheKey, ok := c.itemCacheKey(tableName, keys)
+	if !cached || !ok {
+		return c.DynamoDatabaseClient.Get(ctx, tableName, keys, resultDataPointer)
+	}
+	generation, err := c.cacheGeneration(ctx, tableName)
+	if err != nil {
+		return c.DynamoDatabaseClient.Get(ctx, tableName, keys, resultDataPointer)
+	}
+	items, hit := c.cachedItems(ctx, cacheKey)
+	if !hit {
+		result, err := c.dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName:              aws.String(c.GetTableUrl(tableName)),
+			Key:                    keys,
+			ReturnConsumedCapacity: types.ReturnConsumedCapacityTotal,
+		})
+		if err != nil {
+			return err
+		}
+		if result.Item != nil {
+			items = []map[string]types.AttributeValue{result.Item}
+		}
+		c.storeItems(ctx, tableName, generation, cacheKey, items, policy)
+	}
+	if len(items) == 0 {
+		return ErrQueryNoData
+	}
+	return c.unmarshalItem(ctx, tableName, keys, items[0], resultDataPointer)
+}
+
+// QueryOne runs the query of QueryOne from the cache or, on a miss, against
+// DynamoDB. Results are cached by query and dropped on every write to the
+// table.
+func (c *CachedDynamoClient) QueryOne(ctx context.Context, tableName, index string, expr expression.Expression, resultDataPointer interface{}) error {
+	policy, cached := c.options.Tables[tableName]
+	if !cached {
+		return c.DynamoDatabaseClient.QueryOne(ctx, tableName, index, expr, resultDataPointer)
+	}
+	expiry := expiryAttribute(ctx, resultDataPointer)
+	generation, err := c.cacheGeneration(ctx, tableName)
+	if err != nil {
+		return c.DynamoDatabaseClient.QueryOne(ctx, tableName, index, expr, resultDataPointer)
+	}
+	cacheKey, err := c.queryCacheKey(tableName, generation, index, expr, expiry)
+	if err != nil {
+		return c.DynamoDatabaseClient.QueryOne(ctx, tableName, index, expr, resultDataPointer)
+	}
+	items, hit := c.cachedItems(ctx, cacheKey)
+	if !hit {
+		items, err = c.queryOneItems(ctx, tableName, index, expr, resultDataPointer)
+		if err != nil && !errors.Is(err, ErrQueryNoData) {
+			return err
+		}
+		c.storeItems(ctx, tableName, generation, cacheKey, items, policy)
+	}
+	items = slices.DeleteFunc(items, func(item map[string]types.AttributeValue) bool {
+		return isExpired(expiry, item)
+	})
+	if len(items) == 0 {
+		return ErrQueryNoData
+	}
+	return c.unmarshalItems(ctx, tableName, items, resultDataPointer)
+}
+
+// PutItem writes data and refreshes or invalidates its cached item.
+func (c *CachedDynamoClient) PutItem(ctx context.Context, tableName string, data interface{}) error {
+	policy, cached := c.options.Tables[tableName]
+	if !cached {
+		return c.DynamoDatabaseClient.PutItem(ctx, tableName, data)
+	}
+	var stored map[string]types.AttributeValue
+	_, err := c.putItem(ctx, tableName, data, expression.ConditionBuilder{}, func(input *dynamodb.PutItemInput) {
+		stored = input.Item
+	})
+	if err != nil {
+		return err
+	}
+	if !policy.WriteThrough {
+		return c.invalidate(ctx, tableName, stored)
+	}
+	if cacheKey, ok := c.itemCacheKey(tableName, stored); ok {
+		if err := c.cache.Set(ctx, cacheKey, encodeCachedItems([]map[string]types.AttributeValue{stored}), policy.TTL); err != nil {
+			return fmt.Errorf("%w: %v", ErrCacheInvalidation, err)
+		}
+	}
+	return c.invalidateQueries(ctx, tableName)
+}
+
+func (c *CachedDynamoClient) PutItemReturning(ctx context.Context, tableName string, data interface{}, condition expression.ConditionBuilder, options ReturnOptions, resultDataPointer interface{}) (bool, error) {
+	replaced, err := c.DynamoDatabaseClient.PutItemReturning(ctx, tableName, data, condition, options, resultDataPointer)
+	if err != nil {
+		return replaced, err
+	}
+	stored, err := attributevalue.MarshalMap(data)
+	if err != nil {
+		return replaced, c.invalidate(ctx, tableName)
+	}
+	return replaced, c.invalidate(ctx, tableName, stored)
+}
+
+func (c *CachedDynamoClient) UpdateItem(ctx context.Context, tableName string, key map[string]types.AttributeValue, updateExpression string, expressionAttributeValues map[string]types.AttributeValue, conditionExpression string) error {
+	if err := c.DynamoDatabaseClient.UpdateItem(ctx, tableName, key, updateExpression, expressionAttributeValues, conditionExpression); err != nil {
+		return err
+	}
+	return c.invalidate(ctx, tableName, key)
+}
+
+func (c *CachedDynamoClient) UpdateItemExpr(ctx context.Context, tableName string, key map[string]types.AttributeValue, expr expression.Expression) error {
+	if err := c.DynamoDatabaseClient.UpdateItemExpr(ctx, tableName, key, expr); err != nil {
+		return err
+	}
+	return c.invalidate(ctx, tableName, key)
+}
+
+func (c *CachedDynamoClient) UpdateItemVersioned(ctx context.Context, tableName string, key map[string]types.AttributeValue, item interface{}, update expression.UpdateBuilder, condition expression.ConditionBuilder) error {
+	if err := c.DynamoDatabaseClient.UpdateItemVersioned(ctx, tableName, key, item, update, condition); err != nil {
+		return err
+	}
+	return c.invalidate(ctx, tableName, key)
+}
+
+func (c *CachedDynamoClient) UpdateItemPatch(ctx context.Context, tableName string, key map[string]types.AttributeValue, patch *UpdatePatch, condition expression.ConditionBuilder) error {
+	if err := c.DynamoDatabaseClient.UpdateItemPatch(ctx, tableName, key, patch, condition); err != nil {
+		return err
+	}
+	return c.invalidate(ctx, tableName, key)
+}
+
+func (c *CachedDynamoClient) UpdateItemReturning(ctx context.Context, tableName string, key map[string]types.AttributeValue, expr expression.Expression, options ReturnOptions, resultDataPointer interface{}) (bool, error) {
+	returned, err := c.DynamoDatabaseClient.UpdateItemReturning(ctx, tableName, key, expr, options, resultDataPointer)
+	if err != nil {
+		return returned, err
+	}
+	return returned, c.invalidate(ctx, tableName, key)
+}
+
+func (c *CachedDynamoClient) DeleteItem(ctx context.Context, tableName string, key map[string]types.AttributeValue) error {
+	if err := c.DynamoDatabaseClient.DeleteItem(ctx, tableName, key); err != nil {
+		return err
+	}
+	return c.invalidate(ctx, tableName, key)
+}
+
+func (c *CachedDynamoClient) PutBatch(ctx context.Context, tableName string, items []interface{}) error {
+	return c.WriteBatch(ctx, []BatchWriteRequest{{TableName: tableName, Puts: items}}, BatchWriteOptions{})
+}
+
+func (c *CachedDynamoClient) DeleteBatch(ctx context.Context, tableName string, keys []map[string]types.AttributeValue) error {
+	return c.WriteBatch(ctx, []BatchWriteRequest{{TableName: tableName, Deletes: keys}}, BatchWriteOptions{})
+}
+
+// WriteBatch applies the writes of requests and invalidates every item they
+// touch, including when only some of them were applied.
+func (c *CachedDynamoClient) WriteBatch(ctx context.Context, requests []BatchWriteRequest, options BatchWriteOptions) error {
+	err := c.DynamoDatabaseClient.WriteBatch(ctx, requests, options)
+	var invalidationErrs []error
+	for _, request := range requests {
+		keys := slices.Clone(request.Deletes)
+		for _, item := range request.Puts {
+			if stored, marshalErr := attributevalue.MarshalMap(item); marshalErr == nil {
+				keys = append(keys, stored)
+			}
+		}
+		invalidationErrs = append(invalidationErrs, c.invalidate(ctx, request.TableName, keys...))
+	}
+	if err != nil {
+		return err
+	}
+	return errors.Join(invalidationErrs...)
+}
+
+// ExecuteTransaction applies the writes of params and, once committed,
+// invalidates every item they touch.
+func (c *CachedDynamoClient) ExecuteTransaction(ctx context.Context, params *NoSqlTransaction) error {
+	if err := c.DynamoDatabaseClient.ExecuteTransaction(ctx, params); err != nil {
+		return err
+	}
+	tablesByUrl := make(map[string]string, len(c.options.Tables))
+	for tableName := range c.options.Tables {
+		tablesByUrl[c.GetTableUrl(tableName)] = tableName
+	}
+	keysByTable := make(map[string][]map[string]types.AttributeValue)
+	for _, item := range params.items {
+		var tableUrl *string
+		var key map[string]types.AttributeValue
+		switch {
+		case item.Put != nil:
+			tableUrl, key = item.Put.TableName, item.Put.Item
+		case item.Update != nil:
+			tableUrl, key = item.Update.TableName, item.Update.Key
+		case item.Delete != nil:
+			tableUrl, key = item.Delete.TableName, item.Delete.Key
+		default:
+			continue
+		}
+		if tableName, cached := tablesByUrl[aws.ToString(tableUrl)]; cached {
+			keysByTable[tableName] = append(keysByTable[tableName], key)
+		}
+	}
+	var invalidationErrs []error
+	for tableName, keys := range keysByTable {
+		invalidationErrs = append(invalidationErrs, c.invalidate(ctx, tableName, keys...))
+	}
+	return errors.Join(invalidationErrs...)
+}
+
+// invalidate drops the cached queries of the table and the cached items
+// stored under keys, which may also be whole items. The generation changes
+// first, so reads racing the write do not cache what they read.
+func (c *CachedDynamoClient) invalidate(ctx context.Context, tableName string, keys ...map[string]types.AttributeValue) error {
+	if _, cached := c.options.Tables[tableName]; !cached {
+		return nil
+	}
+	if err := c.invalidateQueries(ctx, tableName); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		cacheKey, ok := c.itemCacheKey(tableName, key)
+		if !ok {
+			continue
+		}
+		if err := c.cache.Delete(ctx, cacheKey); err != nil {
+			return fmt.Errorf("%w: %v", ErrCacheInvalidation, err)
+		}
+	}
+	return nil
+}
+
+// invalidateQueries starts a new generation of the cached queries of the
+// table, so the previous ones are no longer found and expire.
+func (c *CachedDynamoClient) invalidateQueries(ctx context.Context, tableName string) error {
+	if err := c.cache.Set(ctx, c.generationCacheKey(tableName), newCacheGeneration(), 0); err != nil {
+		return fmt.Errorf("%w: %v", ErrCacheInvalidation, err)
+	}
+	return nil
+}
+
+func (c *CachedDynamoClient) itemCacheKey(tableName string, key map[string]types.AttributeValue) (string, bool) {
+	policy, cached := c.options.Tables[tableName]
+	if !cached || policy.Keys.PartitionKey == "" {
+		return "", false
+	}
+	_, partitionKey, ok := keyAttributeString(key[policy.Keys.PartitionKey])
+	if !ok {
+		return "", false
+	}
+	cacheKey := fmt.Sprintf("%s:%s:item:%q", c.options.KeyPrefix, c.GetTableUrl(tableName), partitionKey)
+	if policy.Keys.SortKey != "" {
+		_, sortKey, ok := keyAttributeString(key[policy.Keys.SortKey])
+		if !ok {
+			return "", false
+		}
+		cacheKey += fmt.Sprintf(":%q", sortKey)
+	}
+	return cacheKey, true
+}
+
+func (c *CachedDynamoClient) generationCacheKey(tableName string) string {
+	return fmt.Sprintf("%s:%s:generation", c.options.KeyPrefix, c.GetTableUrl(tableName))
+}
+
+// cacheGeneration returns the current generation of the table, starting
+// one when there is none. Every write to the table changes it.
+func (c *CachedDynamoClient) cacheGeneration(ctx context.Context, tableName string) (string, error) {
+	generationKey := c.generationCacheKey(tableName)
+	generation, err := c.cache.Get(ctx, generationKey)
+	if errors.Is(err, ErrQueryNoData) {
+		generation = newCacheGeneration()
+		err = c.cache.Set(ctx, generationKey, generation, 0)
+	}
+	return generation, err
+}
+
+// queryCacheKey returns the key of a query in the given generation of the
+// cached queries of the table.
+func (c *CachedDynamoClient) queryCacheKey(tableName, generation, index string, expr expression.Expression, expiry string) (string, error) {
+	values, err := encodeCachedAttributes(expr.Values())
+	if err != nil {
+		return "", err
+	}
+	query, err := json.Marshal(struct {
+		Index        string                     `json:"i,omitempty"`
+		KeyCondition *string                    `json:"k,omitempty"`
+		Projection   *string                    `json:"p,omitempty"`
+		Names        map[string]string          `json:"n,omitempty"`
+		Values       map[string]cachedAttribute `json:"v,omitempty"`
+		Expiry       string                     `json:"e,omitempty"`
+	}{index, expr.KeyCondition(), expr.Projection(), expr.Names(), values, expiry})
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(query)
+	return fmt.Sprintf("%s:%s:query:%s:%s", c.options.KeyPrefix, c.GetTableUrl(tableName), generation, hex.EncodeToString(hash[:])), nil
+}
+
+// cachedItems returns the items cached under cacheKey and whether there was
+// an entry; an entry without items is a cached miss.
+func (c *CachedDynamoClient) cachedItems(ctx context.Context, cacheKey string) ([]map[string]types.AttributeValue, bool) {
+	data, err := c.cache.Get(ctx, cacheKey)
+	if err != nil {
+		return nil, false
+	}
+	var encoded []map[string]cachedAttribute
+	if err := json.Unmarshal([]byte(data), &encoded); err != nil {
+		return nil, false
+	}
+	items := make([]map[string]types.AttributeValue, len(encoded))
+	for i, item := range encoded {
+		if items[i], err = decodeCachedAttributes(item); err != nil {
+			return nil, false
+		}
+	}
+	return items, true
+}
+
+// storeItems caches items, read in the given generation of the table, under
+// cacheKey. They are not cached when the table was written to since. Failures
+// are ignored, the next read goes to DynamoDB again.
+func (c *CachedDynamoClient) storeItems(ctx context.Context, tableName, generation, cacheKey string, items []map[string]types.AttributeValue, policy CachePolicy) {
+	if current, err := c.cache.Get(ctx, c.generationCacheKey(tableName)); err != nil || current != generation {
+		return
+	}
+	ttl := policy.TTL
+	if len(items) == 0 {
+		ttl = policy.NegativeTTL
+	}
+	if ttl < 0 {
+		return
+	}
+	if data := encodeCachedItems(items); data != "" {
+		_ = c.cache.Set(ctx, cacheKey, data, ttl)
+	}
+}
+
+func newCacheGeneration() string {
+	generation := make([]byte, 8)
+	_, _ = rand.Read(generation)
+	return hex.EncodeToString(generation)
+}
+
+// cachedAttribute is the JSON form of an attribute value in the cache.
+type cachedAttribute struct {
+	S    *string                     `json:"S,omitempty"`
+	N    *string                     `json:"N,omitempty"`
+	B    *[]byte                     `json:"B,omitempty"`
+	BOOL *bool                       `json:"BOOL,omitempty"`
+	NULL bool                        `json:"NULL,omitempty"`
+	M    *map[string]cachedAttribute `json:"M,omitempty"`
+	L    *[]cachedAttribute          `json:"L,omitempty"`
+	SS   []string                    `json:"SS,omitempty"`
+	NS   []string                    `json:"NS,omitempty"`
+	BS   [][]byte                    `json:"BS,omitempty"`
+}
+
+// encodeCachedItems returns the cache entry of items, or "" when they
+// cannot be encoded.
+func encodeCachedItems(items []map[string]types.AttributeValue) string {
+	encoded := make([]map[string]cachedAttribute, len(items))
+	for i, item := range items {
+		var err error
+		if encoded[i], err = encodeCachedAttributes(item); err != nil {
+			return ""
+		}
+	}
+	data, err := json.Marshal(encoded)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func encodeCachedAttributes(item map[string]types.AttributeValue) (map[string]cachedAttribute, error) {
+	if item == nil {
+		return nil, nil
+	}
+	encoded := make(map[string]cachedAttribute, len(item))
+	for name, value := range item {
+		attribute, err := encodeCachedAttribute(value)
+		if err != nil {
+			return nil, err
+		}
+		encoded[name] = attribute
+	}
+	return encoded, nil
+}
+
+func encodeCachedAttribute(value types.AttributeValue) (cachedAttribute, error) {
+	switch v := value.(type) {
+	case *types.AttributeValueMemberS:
+		return cachedAttribute{S: &v.Value}, nil
+	case *types.AttributeValueMemberN:
+		return cachedAttribute{N: &v.Value}, nil
+	case *types.AttributeValueMemberB:
+		return cachedAttribute{B: &v.Value}, nil
+	case *types.AttributeValueMemberBOOL:
+		return cachedAttribute{BOOL: &v.Value}, nil
+	case *types.AttributeValueMemberNULL:
+		return cachedAttribute{NULL: true}, nil
+	case *types.AttributeValueMemberM:
+		m, err := encodeCachedAttributes(v.Value)
+		if m == nil {
+			m = map[string]cachedAttribute{}
+		}
+		return cachedAttribute{M: &m}, err
+	case *types.AttributeValueMemberL:
+		l := make([]cachedAttribute, len(v.Value))
+		for i, element := range v.Value {
+			var err error
+			if l[i], err = encodeCachedAttribute(element); err != nil {
+				return cachedAttribute{}, err
+			}
+		}
+		return cachedAttribute{L: &l}, nil
+	case *types.AttributeValueMemberSS:
+		return cachedAttribute{SS: v.Value}, nil
+	case *types.AttributeValueMemberNS:
+		return cachedAttribute{NS: v.Value}, nil
+	case *types.AttributeValueMemberBS:
+		return cachedAttribute{BS: v.Value}, nil
+	}
+	return cachedAttribute{}, fmt.Errorf("dynamo: cannot cache attribute value %T", value)
+}
+
+func decodeCachedAttributes(encoded map[string]cachedAttribute) (map[string]types.AttributeValue, error) {
+	item := make(map[string]types.AttributeValue, len(encoded))
+	for name, attribute := range encoded {
+		value, err := decodeCachedAttribute(attribute)
+		if err != nil {
+			return nil, err
+		}
+		item[name] = value
+	}
+	return item, nil
+}
+
+func decodeCachedAttribute(attribute cachedAttribute) (types.AttributeValue, error) {
+	switch {
+	case attribute.S != nil:
+		return &types.AttributeValueMemberS{Value: *attribute.S}, nil
+	case attribute.N != nil:
+		return &types.AttributeValueMemberN{Value: *attribute.N}, nil
+	case attribute.B != nil:
+		return &types.AttributeValueMemberB{Value: *attribute.B}, nil
+	case attribute.BOOL != nil:
+		return &types.AttributeValueMemberBOOL{Value: *attribute.BOOL}, nil
+	case attribute.NULL:
+		return &types.AttributeValueMemberNULL{Value: true}, nil
+	case attribute.M != nil:
+		m, err := decodeCachedAttributes(*attribute.M)
+		return &types.AttributeValueMemberM{Value: m}, err
+	case attribute.L != nil:
+		l := make([]types.AttributeValue, len(*attribute.L))
+		for i, element := range *attribute.L {
+			var err error
+			if l[i], err = decodeCachedAttribute(element); err != nil {
+				return nil, err
+			}
+		}
+		return &types.AttributeValueMemberL{Value: l}, nil
+	case attribute.SS != nil:
+		return &types.AttributeValueMemberSS{Value: attribute.SS}, nil
+	case attribute.NS != nil:
+		return &types.AttributeValueMemberNS{Value: attribute.NS}, nil
+	case attribute.BS != nil:
+		return &types.AttributeValueMemberBS{Value: attribute.BS}, nil
+	}
+	return nil, fmt.Errorf("dynamo: empty cached attribute value")
+}
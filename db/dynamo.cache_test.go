@@ -0,0 +1,305 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// memoryCache is a CacheClientInterface kept in a map. Expirations are
+// recorded but not enforced.
+type memoryCache struct {
+	mu      sync.Mutex
+	entries map[string]string
+	ttls    map[string]time.Duration
+	err     error
+}
+
+func (m *memoryCache) Set(ctx context.Context, key, data string, expireData time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	if m.entries == nil {
+		m.entries, m.ttls = make(map[string]string), make(map[string]time.Duration)
+	}
+	m.entries[key], m.ttls[key] = data, expireData
+	return nil
+}
+
+func (m *memoryCache) Get(ctx context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return "", m.err
+	}
+	data, ok := m.entries[key]
+	if !ok {
+		return "", ErrQueryNoData
+	}
+	return data, nil
+}
+
+func (m *memoryCache) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	delete(m.entries, key)
+	return nil
+}
+
+// racingDynamoClient runs race once, after the next GetItem read the item
+// and before it is returned.
+type racingDynamoClient struct {
+	DynamoApiClient
+	race func()
+}
+
+func (r *racingDynamoClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	result, err := r.DynamoApiClient.GetItem(ctx, params, optFns...)
+	if race := r.race; race != nil {
+		r.race = nil
+		race()
+	}
+	return result, err
+}
+
+func createCachedTestDynamoClient(t *testing.T, policy CachePolicy) (*CachedDynamoClient, *memoryCache) {
+	t.Helper()
+	policy.Keys = TableKeySchema{PartitionKey: "orgId", SortKey: "eventId"}
+	cache := &memoryCache{}
+	client := CreateCachedDynamoClient(createTestDynamoClient(t), cache, CacheOptions{Tables: map[string]CachePolicy{"events": policy}})
+	return client, cache
+}
+
+// countDynamoCalls returns the number of DynamoDB calls made by read.
+func countDynamoCalls(t *testing.T, read func(ctx context.Context) error) (int, error) {
+	t.Helper()
+	aggregator := CreateCapacityAggregator()
+	err := read(WithCapacityAggregator(context.Background(), aggregator))
+	calls := 0
+	for _, total := range aggregator.Totals() {
+		calls += total.Calls
+	}
+	return calls, err
+}
+
+func TestCachedGet(t *testing.T) {
+	ctx := context.Background()
+	client, cache := createCachedTestDynamoClient(t, CachePolicy{TTL: time.Minute})
+	var _ DynamoDatabaseClientInterface = client
+	seedTestEvents(t, client.DynamoDatabaseClient, 2)
+
+	get := func(eventID string, expected int) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			var event testEvent
+			if err := client.Get(ctx, "events", testEventKey(eventID), &event); err != nil {
+				return err
+			}
+			if event.Amount != expected {
+				t.Errorf("Get %s -> Expected amount: %d // Returned: %d", eventID, expected, event.Amount)
+			}
+			return nil
+		}
+	}
+	update := func(ctx context.Context) error {
+		expr, err := expression.NewBuilder().WithUpdate(expression.Set(expression.Name("amount"), expression.Value(99))).Build()
+		if err != nil {
+			return err
+		}
+		return client.UpdateItemExpr(ctx, "events", testEventKey("evt-01"), expr)
+	}
+
+	testCases := []struct {
+		description   string
+		run           func(ctx context.Context) error
+		expectedCalls int
+		expectedErr   error
+	}{
+		{"miss", get("evt-01", 10), 1, nil},
+		{"hit", get("evt-01", 10), 0, nil},
+		{"update", update, 1, nil},
+		{"miss after update", get("evt-01", 99), 1, nil},
+		{"negative miss", get("evt-07", 0), 1, ErrQueryNoData},
+		{"negative hit", get("evt-07", 0), 0, ErrQueryNoData},
+		{"put", func(ctx context.Context) error {
+			return client.PutItem(ctx, "events", testEvent{OrgID: "org-1", EventID: "evt-07", Status: "open", Amount: 70})
+		}, 1, nil},
+		{"miss after put", get("evt-07", 70), 1, nil},
+		{"delete", func(ctx context.Context) error {
+			return client.DeleteItem(ctx, "events", testEventKey("evt-07"))
+		}, 1, nil},
+		{"miss after delete", get("evt-07", 0), 1, ErrQueryNoData},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			calls, err := countDynamoCalls(t, tc.run)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("Error -> Expected: %v // Returned: %v", tc.expectedErr, err)
+			}
+			if calls != tc.expectedCalls {
+				t.Errorf("DynamoDB calls -> Expected: %d // Returned: %d", tc.expectedCalls, calls)
+			}
+		})
+	}
+
+	for key, ttl := range cache.ttls {
+		expected := time.Minute
+		if strings.HasSuffix(key, ":generation") {
+			expected = 0
+		} else if cache.entries[key] == "[]" {
+			expected = 30 * time.Second
+		}
+		if ttl != expected {
+			t.Errorf("TTL of %s -> Expected: %v // Returned: %v", key, expected, ttl)
+		}
+	}
+
+	cache.err = errors.New("connection refused")
+	if calls, err := countDynamoCalls(t, get("evt-00", 0)); err != nil || calls != 1 {
+		t.Errorf("Get with the cache down -> Expected: 1 call // Returned: %d calls %v", calls, err)
+	}
+	if err := update(ctx); !errors.Is(err, ErrCacheInvalidation) {
+		t.Errorf("Update with the cache down -> Expected: %v // Returned: %v", ErrCacheInvalidation, err)
+	}
+}
+
+func TestCachedGetRacingAWrite(t *testing.T) {
+	ctx := context.Background()
+	racing := &racingDynamoClient{DynamoApiClient: createTestDynamoClient(t).GetApiClient()}
+	client := CreateCachedDynamoClient(CreateDynamoDatabaseClientWithApi(racing, "test"), &memoryCache{}, CacheOptions{
+		Tables: map[string]CachePolicy{"events": {Keys: TableKeySchema{PartitionKey: "orgId", SortKey: "eventId"}}},
+	})
+	seedTestEvents(t, client.DynamoDatabaseClient, 2)
+	expr, err := expression.NewBuilder().WithUpdate(expression.Set(expression.Name("amount"), expression.Value(99))).Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	racing.race = func() {
+		if err := client.UpdateItemExpr(ctx, "events", testEventKey("evt-01"), expr); err != nil {
+			t.Errorf("UpdateItemExpr failed: %v", err)
+		}
+	}
+
+	var event testEvent
+	if err := client.Get(ctx, "events", testEventKey("evt-01"), &event); err != nil || event.Amount != 10 {
+		t.Errorf("Get racing the update -> Expected: amount 10 // Returned: %+v %v", event, err)
+	}
+	if err := client.Get(ctx, "events", testEventKey("evt-01"), &event); err != nil || event.Amount != 99 {
+		t.Errorf("Get after the update -> Expected: amount 99 // Returned: %+v %v", event, err)
+	}
+}
+
+func TestCachedWriteThrough(t *testing.T) {
+	client, cache := createCachedTestDynamoClient(t, CachePolicy{WriteThrough: true, NegativeTTL: -1})
+	calls, err := countDynamoCalls(t, func(ctx context.Context) error {
+		var event testEvent
+		if err := client.Get(ctx, "events", testEventKey("evt-01"), &event); !errors.Is(err, ErrQueryNoData) {
+			t.Errorf("Get missing -> Expected: %v // Returned: %v", ErrQueryNoData, err)
+		}
+		if err := client.PutItem(ctx, "events", testEvent{OrgID: "org-1", EventID: "evt-01", Status: "open", Amount: 10}); err != nil {
+			return err
+		}
+		if err := client.Get(ctx, "events", testEventKey("evt-01"), &event); err != nil || event.Amount != 10 {
+			t.Errorf("Get after put -> Expected: amount 10 // Returned: %+v %v", event, err)
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Errorf("DynamoDB calls -> Expected: 2 // Returned: %d %v", calls, err)
+	}
+	for key, data := range cache.entries {
+		if data == "[]" {
+			t.Errorf("Negative entry %s -> Expected: not cached // Returned: %s", key, data)
+		}
+	}
+}
+
+func TestCachedQueryOne(t *testing.T) {
+	client, _ := createCachedTestDynamoClient(t, CachePolicy{})
+	seedTestEvents(t, client.DynamoDatabaseClient, 2)
+	expr, err := expression.NewBuilder().
+		WithKeyCondition(expression.Key("orgId").Equal(expression.Value("org-1")).And(expression.Key("eventId").Equal(expression.Value("evt-01")))).
+		Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	other, err := expression.NewBuilder().WithKeyCondition(expression.Key("orgId").Equal(expression.Value("org-2"))).Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	queryOne := func(expr expression.Expression, expected int) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			var events []testEvent
+			if err := client.QueryOne(ctx, "events", "", expr, &events); err != nil {
+				return err
+			}
+			if len(events) != 1 || events[0].Amount != expected {
+				t.Errorf("QueryOne -> Expected amount: %d // Returned: %+v", expected, events)
+			}
+			return nil
+		}
+	}
+
+	testCases := []struct {
+		description   string
+		run           func(ctx context.Context) error
+		expectedCalls int
+		expectedErr   error
+	}{
+		{"miss", queryOne(expr, 10), 1, nil},
+		{"hit", queryOne(expr, 10), 0, nil},
+		{"negative miss", queryOne(other, 0), 1, ErrQueryNoData},
+		{"negative hit", queryOne(other, 0), 0, ErrQueryNoData},
+		{"transaction", func(ctx context.Context) error {
+			transaction := CreateNoSqlTransaction(client.DynamoDatabaseClient)
+			transaction.AddTransactionPut("events", testEvent{OrgID: "org-1", EventID: "evt-01", Status: "open", Amount: 15})
+			return client.ExecuteTransaction(ctx, transaction)
+		}, 1, nil},
+		{"miss after transaction", queryOne(expr, 15), 1, nil},
+		{"hit after transaction", queryOne(expr, 15), 0, nil},
+		{"batch write", func(ctx context.Context) error {
+			return client.PutBatch(ctx, "events", []interface{}{testEvent{OrgID: "org-2", EventID: "evt-01", Status: "open", Amount: 20}})
+		}, 1, nil},
+		{"miss after batch write", queryOne(other, 20), 1, nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			calls, err := countDynamoCalls(t, tc.run)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("Error -> Expected: %v // Returned: %v", tc.expectedErr, err)
+			}
+			if calls != tc.expectedCalls {
+				t.Errorf("DynamoDB calls -> Expected: %d // Returned: %d", tc.expectedCalls, calls)
+			}
+		})
+	}
+}
+
+func TestCachedEncryptedItems(t *testing.T) {
+	ctx := context.Background()
+	client, cache := createCachedTestDynamoClient(t, CachePolicy{WriteThrough: true})
+	client.SetEncryptionKeyProvider(&testKeyProvider{})
+	customer := testCustomer{OrgID: "org-1", EventID: "cus-1", Status: "open", Email: "ana@example.com"}
+	if err := client.PutItem(ctx, "events", customer); err != nil {
+		t.Fatalf("PutItem failed: %v", err)
+	}
+	var cached testCustomer
+	if err := client.Get(ctx, "events", testEventKey("cus-1"), &cached); err != nil || cached.Email != customer.Email {
+		t.Errorf("Get -> Expected: %s // Returned: %+v %v", customer.Email, cached, err)
+	}
+	for key, data := range cache.entries {
+		if strings.Contains(data, customer.Email) {
+			t.Errorf("Cache entry %s -> Expected: sealed email // Returned: %s", key, data)
+		}
+	}
+}
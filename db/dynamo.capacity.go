@@ -0,0 +1,340 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// CapacityUsage is the capacity consumed by one DynamoDB call on one table or
+// index. TableName is the full table name, including the environment prefix,
+// and IndexName is empty for the base table.
+type CapacityUsage struct {
+	Operation          string
+	TableName          string
+	IndexName          string
+	ReadCapacityUnits  float64
+	WriteCapacityUnits float64
+}
+
+// CapacityObserver receives the consumed capacity of every call made by a
+// DynamoDatabaseClient. It is called synchronously from the calling
+// goroutine, so implementations must be safe for concurrent use.
+type CapacityObserver interface {
+	ObserveCapacity(ctx context.Context, usage CapacityUsage)
+}
+
+// SetCapacityObserver configures the observer notified of the consumed
+// capacity of every call. Use nil to disable it.
+func (c *DynamoDatabaseClient) SetCapacityObserver(observer CapacityObserver) {
+	observed, ok := c.dynamoClient.(*capacityObservingClient)
+	if !ok {
+		observed = &capacityObservingClient{DynamoApiClient: c.dynamoClient}
+		c.dynamoClient = observed
+	}
+	observed.observer = observer
+}
+
+type capacityAggregatorContextKey struct{}
+
+// WithCapacityAggregator attaches aggregator to ctx so the capacity of every
+// call made with the returned context is also added to it. Creating one
+// aggregator per incoming request gives a per-request capacity report.
+func WithCapacityAggregator(ctx context.Context, aggregator *CapacityAggregator) context.Context {
+	return context.WithValue(ctx, capacityAggregatorContextKey{}, aggregator)
+}
+
+func capacityAggregatorFromContext(ctx context.Context) *CapacityAggregator {
+	aggregator, _ := ctx.Value(capacityAggregatorContextKey{}).(*CapacityAggregator)
+	return aggregator
+}
+
+// CapacityTotal is the aggregated capacity of one operation on one table or
+// index.
+type CapacityTotal struct {
+	Operation          string
+	TableName          string
+	IndexName          string
+	Calls              int
+	ReadCapacityUnits  float64
+	WriteCapacityUnits float64
+}
+
+type capacityTotalKey struct {
+	operation string
+	tableName string
+	indexName string
+}
+
+// CapacityAggregator is an in-memory CapacityObserver that sums the consumed
+// capacity per operation, table and index.
+type CapacityAggregator struct {
+	mu     sync.Mutex
+	totals map[capacityTotalKey]*CapacityTotal
+}
+
+func CreateCapacityAggregator() *CapacityAggregator {
+	return &CapacityAggregator{totals: make(map[capacityTotalKey]*CapacityTotal)}
+}
+
+func (a *CapacityAggregator) ObserveCapacity(ctx context.Context, usage CapacityUsage) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	key := capacityTotalKey{operation: usage.Operation, tableName: usage.TableName, indexName: usage.IndexName}
+	total, ok := a.totals[key]
+	if !ok {
+		total = &CapacityTotal{Operation: usage.Operation, TableName: usage.TableName, IndexName: usage.IndexName}
+		a.totals[key] = total
+	}
+	total.Calls++
+	total.ReadCapacityUnits += usage.ReadCapacityUnits
+	total.WriteCapacityUnits += usage.WriteCapacityUnits
+}
+
+// Totals returns the aggregated capacity, most expensive access pattern first.
+func (a *CapacityAggregator) Totals() []CapacityTotal {
+	a.mu.Lock()
+	totals := make([]CapacityTotal, 0, len(a.totals))
+	for _, total := range a.totals {
+		totals = append(totals, *total)
+	}
+	a.mu.Unlock()
+	sort.Slice(totals, func(i, j int) bool {
+		unitsI := totals[i].ReadCapacityUnits + totals[i].WriteCapacityUnits
+		unitsJ := totals[j].ReadCapacityUnits + totals[j].WriteCapacityUnits
+		if unitsI != unitsJ {
+			return unitsI > unitsJ
+		}
+		if totals[i].TableName != totals[j].TableName {
+			return totals[i].TableName < totals[j].TableName
+		}
+		if totals[i].IndexName != totals[j].IndexName {
+			return totals[i].IndexName < totals[j].IndexName
+		}
+		return totals[i].Operation < totals[j].Operation
+	})
+	return totals
+}
+
+// Reset clears the aggregated capacity.
+func (a *CapacityAggregator) Reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.totals = make(map[capacityTotalKey]*CapacityTotal)
+}
+
+// Dump formats the totals one access pattern per line, e.g.
+//
+//	Query prod.events#status-createdAt calls=3 rcu=1.5 wcu=0
+func (a *CapacityAggregator) Dump() string {
+	var sb strings.Builder
+	for _, total := range a.Totals() {
+		target := total.TableName
+		if total.IndexName != "" {
+			target += "#" + total.IndexName
+		}
+		fmt.Fprintf(&sb, "%s %s calls=%d rcu=%g wcu=%g\n", total.Operation, target, total.Calls, total.ReadCapacityUnits, total.WriteCapacityUnits)
+	}
+	return sb.String()
+}
+
+// capacityObservingClient wraps the API client and reports the consumed
+// capacity of every call to the client observer and to the aggregator of the
+// call context. When anyone is listening it asks DynamoDB for the per index
+// breakdown.
+type capacityObservingClient struct {
+	DynamoApiClient
+	observer CapacityObserver
+}
+
+func (o *capacityObservingClient) observing(ctx context.Context) bool {
+	return o.observer != nil || capacityAggregatorFromContext(ctx) != nil
+}
+
+func (o *capacityObservingClient) report(ctx context.Context, operation string, indexName *string, read bool, capacities ...types.ConsumedCapacity) {
+	aggregator := capacityAggregatorFromContext(ctx)
+	for _, capacity := range capacities {
+		for _, usage := range capacityUsages(operation, indexName, read, capacity) {
+			if o.observer != nil {
+				o.observer.ObserveCapacity(ctx, usage)
+			}
+			if aggregator != nil {
+				aggregator.ObserveCapacity(ctx, usage)
+			}
+		}
+	}
+}
+
+// capacityUsages splits a ConsumedCapacity into one usage per table or index.
+// Without a breakdown the total is attributed to indexName.
+func capacityUsages(operation string, indexName *string, read bool, capacity types.ConsumedCapacity) []CapacityUsage {
+	tableName := aws.ToString(capacity.TableName)
+	newUsage := func(index string, units, readUnits, writeUnits *float64) CapacityUsage {
+		usage := CapacityUsage{Operation: operation, TableName: tableName, IndexName: index}
+		if readUnits != nil || writeUnits != nil {
+			usage.ReadCapacityUnits = aws.ToFloat64(readUnits)
+			usage.WriteCapacityUnits = aws.ToFloat64(writeUnits)
+		} else if read {
+			usage.ReadCapacityUnits = aws.ToFloat64(units)
+		} else {
+			usage.WriteCapacityUnits = aws.ToFloat64(units)
+		}
+		return usage
+	}
+
+	var usages []CapacityUsage
+	if capacity.Table != nil {
+		usages = append(usages, newUsage("", capacity.Table.CapacityUnits, capacity.Table.ReadCapacityUnits, capacity.Table.WriteCapacityUnits))
+	}
+	for _, indexes := range []map[string]types.Capacity{capacity.GlobalSecondaryIndexes, capacity.LocalSecondaryIndexes} {
+		names := make([]string, 0, len(indexes))
+		for name := range indexes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			index := indexes[name]
+			usages = append(usages, newUsage(name, index.CapacityUnits, index.ReadCapacityUnits, index.WriteCapacityUnits))
+		}
+	}
+	if len(usages) == 0 {
+		usages = append(usages, newUsage(aws.ToString(indexName), capacity.CapacityUnits, capacity.ReadCapacityUnits, capacity.WriteCapacityUnits))
+	}
+	return usages
+}
+
+func (o *capacityObservingClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if !o.observing(ctx) {
+		return o.DynamoApiClient.GetItem(ctx, params, optFns...)
+	}
+	input := *params
+	input.ReturnConsumedCapacity = types.ReturnConsumedCapacityIndexes
+	output, err := o.DynamoApiClient.GetItem(ctx, &input, optFns...)
+	if err == nil && output.ConsumedCapacity != nil {
+		o.report(ctx, "GetItem", nil, true, *output.ConsumedCapacity)
+	}
+	return output, err
+}
+
+func (o *capacityObservingClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	if !o.observing(ctx) {
+		return o.DynamoApiClient.PutItem(ctx, params, optFns...)
+	}
+	input := *params
+	input.ReturnConsumedCapacity = types.ReturnConsumedCapacityIndexes
+	output, err := o.DynamoApiClient.PutItem(ctx, &input, optFns...)
+	if err == nil && output.ConsumedCapacity != nil {
+		o.report(ctx, "PutItem", nil, false, *output.ConsumedCapacity)
+	}
+	return output, err
+}
+
+func (o *capacityObservingClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	if !o.observing(ctx) {
+		return o.DynamoApiClient.UpdateItem(ctx, params, optFns...)
+	}
+	input := *params
+	input.ReturnConsumedCapacity = types.ReturnConsumedCapacityIndexes
+	output, err := o.DynamoApiClient.UpdateItem(ctx, &input, optFns...)
+	if err == nil && output.ConsumedCapacity != nil {
+		o.report(ctx, "UpdateItem", nil, false, *output.ConsumedCapacity)
+	}
+	return output, err
+}
+
+func (o *capacityObservingClient) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	if !o.observing(ctx) {
+		return o.DynamoApiClient.DeleteItem(ctx, params, optFns...)
+	}
+	input := *params
+	input.ReturnConsumedCapacity = types.ReturnConsumedCapacityIndexes
+	output, err := o.DynamoApiClient.DeleteItem(ctx, &input, optFns...)
+	if err == nil && output.ConsumedCapacity != nil {
+		o.report(ctx, "DeleteItem", nil, false, *output.ConsumedCapacity)
+	}
+	return output, err
+}
+
+func (o *capacityObservingClient) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	if !o.observing(ctx) {
+		return o.DynamoApiClient.Query(ctx, params, optFns...)
+	}
+	input := *params
+	input.ReturnConsumedCapacity = types.ReturnConsumedCapacityIndexes
+	output, err := o.DynamoApiClient.Query(ctx, &input, optFns...)
+	if err == nil && output.ConsumedCapacity != nil {
+		o.report(ctx, "Query", input.IndexName, true, *output.ConsumedCapacity)
+	}
+	return output, err
+}
+
+func (o *capacityObservingClient) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	if !o.observing(ctx) {
+		return o.DynamoApiClient.Scan(ctx, params, optFns...)
+	}
+	input := *params
+	input.ReturnConsumedCapacity = types.ReturnConsumedCapacityIndexes
+	output, err := o.DynamoApiClient.Scan(ctx, &input, optFns...)
+	if err == nil && output.ConsumedCapacity != nil {
+		o.report(ctx, "Scan", input.IndexName, true, *output.ConsumedCapacity)
+	}
+	return output, err
+}
+
+func (o *capacityObservingClient) BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	if !o.observing(ctx) {
+		return o.DynamoApiClient.BatchGetItem(ctx, params, optFns...)
+	}
+	input := *params
+	input.ReturnConsumedCapacity = types.ReturnConsumedCapacityIndexes
+	output, err := o.DynamoApiClient.BatchGetItem(ctx, &input, optFns...)
+	if err == nil {
+		o.report(ctx, "BatchGetItem", nil, true, output.ConsumedCapacity...)
+	}
+	return output, err
+}
+
+func (o *capacityObservingClient) BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	if !o.observing(ctx) {
+		return o.DynamoApiClient.BatchWriteItem(ctx, params, optFns...)
+	}
+	input := *params
+	input.ReturnConsumedCapacity = types.ReturnConsumedCapacityIndexes
+	output, err := o.DynamoApiClient.BatchWriteItem(ctx, &input, optFns...)
+	if err == nil {
+		o.report(ctx, "BatchWriteItem", nil, false, output.ConsumedCapacity...)
+	}
+	return output, err
+}
+
+func (o *capacityObservingClient) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	if !o.observing(ctx) {
+		return o.DynamoApiClient.TransactWriteItems(ctx, params, optFns...)
+	}
+	input := *params
+	input.ReturnConsumedCapacity = types.ReturnConsumedCapacityIndexes
+	output, err := o.DynamoApiClient.TransactWriteItems(ctx, &input, optFns...)
+	if err == nil {
+		o.report(ctx, "TransactWriteItems", nil, false, output.ConsumedCapacity...)
+	}
+	return output, err
+}
+
+func (o *capacityObservingClient) TransactGetItems(ctx context.Context, params *dynamodb.TransactGetItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactGetItemsOutput, error) {
+	if !o.observing(ctx) {
+		return o.DynamoApiClient.TransactGetItems(ctx, params, optFns...)
+	}
+	input := *params
+	input.ReturnConsumedCapacity = types.ReturnConsumedCapacityIndexes
+	output, err := o.DynamoApiClient.TransactGetItems(ctx, &input, optFns...)
+	if err == nil {
+		o.report(ctx, "TransactGetItems", nil, true, output.ConsumedCapacity...)
+	}
+	return output, err
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	paginate "github.com/techvuya/vuya-go-utils/paginate"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+)
+
+func TestCapacityObserverAndRequestAggregator(t *testing.T) {
+	client := createTestDynamoClient(t)
+	clientTotals := CreateCapacityAggregator()
+	client.SetCapacityObserver(clientTotals)
+	seedTestEvents(t, client, 4)
+
+	requestTotals := CreateCapacityAggregator()
+	ctx := WithCapacityAggregator(context.Background(), requestTotals)
+	expr, _ := expression.NewBuilder().WithKeyCondition(expression.Key("status").Equal(expression.Value("open"))).Build()
+	var events []testEvent
+	if _, err := client.QueryPage(ctx, "events", "status-createdAt", expr, nil, &events, paginate.AgPaginateOptionsRequest{}); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	var event testEvent
+	if err := client.Get(ctx, "events", testEventKey("evt-01"), &event); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+
+	testCases := []struct {
+		description string
+		aggregator  *CapacityAggregator
+		operation   string
+		indexName   string
+		calls       int
+		read        bool
+	}{
+		{"Client puts", clientTotals, "PutItem", "", 4, false},
+		{"Client index query", clientTotals, "Query", "status-createdAt", 1, true},
+		{"Request index query", requestTotals, "Query", "status-createdAt", 1, true},
+		{"Request get", requestTotals, "GetItem", "", 1, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			for _, total := range tc.aggregator.Totals() {
+				if total.Operation != tc.operation || total.IndexName != tc.indexName {
+					continue
+				}
+				if total.TableName != "test.events" || total.Calls != tc.calls {
+					t.Errorf("Total -> Expected: %d calls on test.events // Returned: %+v", tc.calls, total)
+				}
+				if tc.read && (total.ReadCapacityUnits <= 0 || total.WriteCapacityUnits != 0) {
+					t.Errorf("Read total -> Expected: only RCU // Returned: %+v", total)
+				}
+				if !tc.read && (total.WriteCapacityUnits <= 0 || total.ReadCapacityUnits != 0) {
+					t.Errorf("Write total -> Expected: only WCU // Returned: %+v", total)
+				}
+				return
+			}
+			t.Errorf("Totals -> Expected: %s on %q // Returned: %+v", tc.operation, tc.indexName, tc.aggregator.Totals())
+		})
+	}
+
+	if len(requestTotals.Totals()) != 2 {
+		t.Errorf("Request totals -> Expected: 2 // Returned: %+v", requestTotals.Totals())
+	}
+	if dump := requestTotals.Dump(); !strings.Contains(dump, "Query test.events#status-createdAt calls=1") {
+		t.Errorf("Dump -> Expected: index query line // Returned: %s", dump)
+	}
+	requestTotals.Reset()
+	if len(requestTotals.Totals()) != 0 {
+		t.Errorf("Totals after Reset -> Expected: none // Returned: %+v", requestTotals.Totals())
+	}
+}
@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// CountOptions configures Count. The zero value counts the base table.
+type CountOptions struct {
+	// IndexName counts a secondary index instead of the base table.
+	IndexName string
+	// Segments splits a scan count into parallel segments (default 1).
+	// Queries always run as a single segment.
+	Segments       int32
+	ConsistentRead bool
+}
+
+// Count returns the number of items that match expr, using Select=COUNT so
+// no item is transferred. With a key condition it queries, otherwise it scans
+// the whole table or index; the filter of expr applies in both cases.
+func (c DynamoDatabaseClient) Count(ctx context.Context, tableName string, expr expression.Expression, options CountOptions) (int64, error) {
+	tableUrl := c.GetTableUrl(tableName)
+	var indexName *string
+	if options.IndexName != "" {
+		indexName = aws.String(options.IndexName)
+	}
+	var consistentRead *bool
+	if options.ConsistentRead {
+		consistentRead = aws.Bool(true)
+	}
+
+	if expr.KeyCondition() != nil {
+		input := &dynamodb.QueryInput{
+			TableName:                 aws.String(tableUrl),
+			IndexName:                 indexName,
+			Select:                    types.SelectCount,
+			KeyConditionExpression:    expr.KeyCondition(),
+			FilterExpression:          expr.Filter(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			ConsistentRead:            consistentRead,
+			ReturnConsumedCapacity:    types.ReturnConsumedCapacityTotal,
+		}
+		var count int64
+		for {
+			result, err := c.dynamoClient.Query(ctx, input)
+			if err != nil {
+				return 0, err
+			}
+			count += int64(result.Count)
+			if len(result.LastEvaluatedKey) == 0 {
+				return count, nil
+			}
+			input.ExclusiveStartKey = result.LastEvaluatedKey
+		}
+	}
+
+	segments := max(options.Segments, 1)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		count    int64
+		firstErr error
+	)
+	for segment := int32(0); segment < segments; segment++ {
+		input := &dynamodb.ScanInput{
+			TableName:                 aws.String(tableUrl),
+			IndexName:                 indexName,
+			Select:                    types.SelectCount,
+			FilterExpression:          expr.Filter(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			ConsistentRead:            consistentRead,
+			ReturnConsumedCapacity:    types.ReturnConsumedCapacityTotal,
+		}
+		if segments > 1 {
+			input.Segment = aws.Int32(segment)
+			input.TotalSegments = aws.Int32(segments)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var segmentCount int64
+			for {
+				result, err := c.dynamoClient.Scan(ctx, input)
+				if err != nil {
+					mu.Lock()
+					defer mu.Unlock()
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+					return
+				}
+				segmentCount += int64(result.Count)
+				if len(result.LastEvaluatedKey) == 0 {
+					break
+				}
+				input.ExclusiveStartKey = result.LastEvaluatedKey
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			count += segmentCount
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return 0, firstErr
+	}
+	return count, nil
+}
@@ -0,0 +1,87 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+)
+
+func TestCount(t *testing.T) {
+	client := createTestDynamoClient(t)
+	seedTestEvents(t, client, 12)
+
+	orgKey := expression.Key("orgId").Equal(expression.Value("org-1"))
+	open := expression.Name("status").Equal(expression.Value("open"))
+	expensive := expression.Name("amount").GreaterThanEqual(expression.Value(50))
+
+	testCases := []struct {
+		description   string
+		builder       expression.Builder
+		options       CountOptions
+		expected      int64
+		expectedCalls int
+	}{
+		{"query", expression.NewBuilder().WithKeyCondition(orgKey), CountOptions{}, 12, 1},
+		{"query with filter", expression.NewBuilder().WithKeyCondition(orgKey).WithFilter(open), CountOptions{}, 6, 1},
+		{"query on an index", expression.NewBuilder().WithKeyCondition(expression.Key("status").Equal(expression.Value("closed"))), CountOptions{IndexName: "status-createdAt"}, 6, 1},
+		{"scan with filter", expression.NewBuilder().WithFilter(expensive), CountOptions{}, 7, 1},
+		{"parallel scan", expression.NewBuilder().WithFilter(expensive), CountOptions{Segments: 4}, 7, 4},
+		{"scan on an index", expression.NewBuilder().WithFilter(expensive), CountOptions{IndexName: "status-createdAt", Segments: 2}, 7, 2},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			expr, err := tc.builder.Build()
+			if err != nil {
+				t.Fatalf("Build failed: %v", err)
+			}
+			aggregator := CreateCapacityAggregator()
+			count, err := client.Count(WithCapacityAggregator(context.Background(), aggregator), "events", expr, tc.options)
+			if err != nil {
+				t.Fatalf("Count failed: %v", err)
+			}
+			if count != tc.expected {
+				t.Errorf("Count -> Expected: %d // Returned: %d", tc.expected, count)
+			}
+			calls := 0
+			for _, total := range aggregator.Totals() {
+				calls += total.Calls
+			}
+			if calls != tc.expectedCalls {
+				t.Errorf("Calls -> Expected: %d // Returned: %d", tc.expectedCalls, calls)
+			}
+		})
+	}
+
+	expr, _ := expression.NewBuilder().WithKeyCondition(orgKey).WithFilter(open).Build()
+	if count, err := client.QueryCount(context.Background(), "events", "", expr); err != nil || count != 6 {
+		t.Errorf("QueryCount with filter -> Expected: 6 // Returned: %d %v", count, err)
+	}
+}
+
+func TestSelectCount(t *testing.T) {
+	client := createTestDynamoClient(t)
+	seedTestEvents(t, client, 12)
+
+	testCases := []struct {
+		description string
+		params      SelectCountParams
+		expected    int64
+	}{
+		{"whole table", SelectCountParams{TableName: "events"}, 12},
+		{"filter", SelectCountParams{TableName: "events", FilterExpression: expression.Name("status").Equal(expression.Value("closed"))}, 6},
+		{"index", SelectCountParams{TableName: "events", IndexName: aws.String("status-createdAt"), FilterExpression: expression.Name("createdAt").LessThan(expression.Value(95))}, 6},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			count, err := client.SelectCount(context.Background(), tc.params)
+			if err != nil {
+				t.Fatalf("SelectCount failed: %v", err)
+			}
+			if count != tc.expected {
+				t.Errorf("SelectCount -> Expected: %d // Returned: %d", tc.expected, count)
+			}
+		})
+	}
+}
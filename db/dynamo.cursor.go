@@ -0,0 +1,195 @@
+package db
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	paginate "github.com/techvuya/vuya-go-utils/paginate"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var ErrInvalidCursor = errors.New("ErrInvalidCursor")
+var ErrCursorCodecNotConfigured = errors.New("ErrCursorCodecNotConfigured")
+
+const cursorTokenVersion byte = 1
+
+// CursorCodec turns a complete LastEvaluatedKey into an opaque, signed token
+// and back. Tokens carry the table and index they were issued for, so a
+// cursor from one query cannot be replayed against another, and every key
+// attribute keeps its type (string, number or binary).
+type CursorCodec struct {
+	secret []byte
+}
+
+type cursorPayload struct {
+	Table string                     `json:"t"`
+	Index string                     `json:"i,omitempty"`
+	Key   map[string]cursorAttribute `json:"k"`
+}
+
+type cursorAttribute struct {
+	S *string `json:"S,omitempty"`
+	N *string `json:"N,omitempty"`
+	B []byte  `json:"B,omitempty"`
+}
+
+// CreateCursorCodec returns a codec that signs tokens with HMAC-SHA256 using
+// secret. All instances serving the same API must share the secret.
+func CreateCursorCodec(secret []byte) (*CursorCodec, error) {
+	if len(secret) < 16 {
+		return nil, errors.New("cursor secret must be at least 16 bytes")
+	}
+	return &CursorCodec{secret: append([]byte{}, secret...)}, nil
+}
+
+// Encode returns the token for lastEvaluatedKey, or an empty string when
+// there are no more pages.
+func (c *CursorCodec) Encode(tableName, indexName string, lastEvaluatedKey map[string]types.AttributeValue) (string, error) {
+	if len(lastEvaluatedKey) == 0 {
+		return "", nil
+	}
+	key, err := marshalKeyAttributes(lastEvaluatedKey)
+	if err != nil {
+		return "", err
+	}
+	payload := cursorPayload{
+		Table: tableName,
+		Index: indexName,
+		Key:   key,
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	message := append([]byte{cursorTokenVersion}, data...)
+	return base64.RawURLEncoding.EncodeToString(append(message, c.sign(message)...)), nil
+}
+
+// Decode verifies token and returns the ExclusiveStartKey it holds. It fails
+// with ErrInvalidCursor when the token was altered or was issued for another
+// table or index.
+func (c *CursorCodec) Decode(token, tableName, indexName string) (map[string]types.AttributeValue, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(raw) <= sha256.Size+1 {
+		return nil, ErrInvalidCursor
+	}
+	message, signature := raw[:len(raw)-sha256.Size], raw[len(raw)-sha256.Size:]
+	if !hmac.Equal(signature, c.sign(message)) || message[0] != cursorTokenVersion {
+		return nil, ErrInvalidCursor
+	}
+	var payload cursorPayload
+	if err := json.Unmarshal(message[1:], &payload); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if payload.Table != tableName || payload.Index != indexName || len(payload.Key) == 0 {
+		return nil, ErrInvalidCursor
+	}
+	key, err := unmarshalKeyAttributes(payload.Key)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return key, nil
+}
+
+// marshalKeyAttributes converts a key to its JSON form, keeping the type of
+// every attribute.
+func marshalKeyAttributes(key map[string]types.AttributeValue) (map[string]cursorAttribute, error) {
+	attributes := make(map[string]cursorAttribute, len(key))
+	for name, value := range key {
+		switch v := value.(type) {
+		case *types.AttributeValueMemberS:
+			attributes[name] = cursorAttribute{S: aws.String(v.Value)}
+		case *types.AttributeValueMemberN:
+			attributes[name] = cursorAttribute{N: aws.String(v.Value)}
+		case *types.AttributeValueMemberB:
+			attributes[name] = cursorAttribute{B: v.Value}
+		default:
+			return nil, fmt.Errorf("unsupported cursor key attribute type for %s", name)
+		}
+	}
+	return attributes, nil
+}
+
+func unmarshalKeyAttributes(attributes map[string]cursorAttribute) (map[string]types.AttributeValue, error) {
+	key := make(map[string]types.AttributeValue, len(attributes))
+	for name, attribute := range attributes {
+		switch {
+		case attribute.S != nil:
+			key[name] = &types.AttributeValueMemberS{Value: *attribute.S}
+		case attribute.N != nil:
+			key[name] = &types.AttributeValueMemberN{Value: *attribute.N}
+		case attribute.B != nil:
+			key[name] = &types.AttributeValueMemberB{Value: attribute.B}
+		default:
+			return nil, fmt.Errorf("unsupported cursor key attribute for %s", name)
+		}
+	}
+	return key, nil
+}
+
+func (c *CursorCodec) sign(message []byte) []byte {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write(message)
+	return mac.Sum(nil)
+}
+
+// SetCursorCodec configures the codec of the cursors read and returned by
+// QueryPage and QueryPaginatePage. Without a codec they return an empty
+// cursor and fail with ErrCursorCodecNotConfigured when given one.
+func (c *DynamoDatabaseClient) SetCursorCodec(codec *CursorCodec) {
+	c.cursorCodec = codec
+}
+
+// applyCursor sets the ExclusiveStartKey of queryParams to the key held by
+// the cursor of paginateParams.
+func (c DynamoDatabaseClient) applyCursor(queryParams *dynamodb.QueryInput, paginateParams paginate.AgPaginateOptionsRequest) error {
+	if !paginateParams.HasCursor() {
+		return nil
+	}
+	if c.cursorCodec == nil {
+		return ErrCursorCodecNotConfigured
+	}
+	startKey, err := c.cursorCodec.Decode(paginateParams.GetCursor(), aws.ToString(queryParams.TableName), aws.ToString(queryParams.IndexName))
+	if err != nil {
+		return err
+	}
+	queryParams.ExclusiveStartKey = startKey
+	return nil
+}
+
+// encodeCursor returns the cursor of a page of tableName or its index that
+// ended at lastEvaluatedKey, or an empty string on the last page or without
+// a codec.
+func (c DynamoDatabaseClient) encodeCursor(tableName, index string, lastEvaluatedKey map[string]types.AttributeValue) (string, error) {
+	if c.cursorCodec == nil {
+		return "", nil
+	}
+	return c.cursorCodec.Encode(c.GetTableUrl(tableName), index, lastEvaluatedKey)
+}
+
+// trimPage cuts items read with a Limit of limitItems+1 down to limitItems.
+// When an item is cut, the page ends at its last item, whose key is made of
+// the attributes of lastEvaluatedKey; otherwise lastEvaluatedKey is kept.
+func trimPage(items []map[string]types.AttributeValue, limitItems int32, lastEvaluatedKey map[string]types.AttributeValue) ([]map[string]types.AttributeValue, map[string]types.AttributeValue, error) {
+	if limitItems <= 0 || int32(len(items)) <= limitItems {
+		return items, lastEvaluatedKey, nil
+	}
+	items = items[:limitItems]
+	last := items[len(items)-1]
+	key := make(map[string]types.AttributeValue, len(lastEvaluatedKey))
+	for name := range lastEvaluatedKey {
+		value, ok := last[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("dynamo: the projection of a paginated query must include the key attribute %s", name)
+		}
+		key[name] = value
+	}
+	return items, key, nil
+}
@@ -0,0 +1,151 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	paginate "github.com/techvuya/vuya-go-utils/paginate"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestCursorCodecRoundTrip(t *testing.T) {
+	codec, err := CreateCursorCodec([]byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatalf("CreateCursorCodec failed: %v", err)
+	}
+	lastEvaluatedKey := map[string]types.AttributeValue{
+		"orgId":     &types.AttributeValueMemberS{Value: "org-1"},
+		"eventId":   &types.AttributeValueMemberS{Value: "evt-1"},
+		"createdAt": &types.AttributeValueMemberN{Value: "1700000000"},
+		"hash":      &types.AttributeValueMemberB{Value: []byte{0x00, 0xff}},
+	}
+	token, err := codec.Encode("test.events", "status-createdAt", lastEvaluatedKey)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	decoded, err := codec.Decode(token, "test.events", "status-createdAt")
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	for name, value := range lastEvaluatedKey {
+		if !attributeValuesEqual(value, decoded[name]) {
+			t.Errorf("Decode attribute %s -> Expected: %v // Returned: %v", name, value, decoded[name])
+		}
+	}
+
+	testCases := []struct {
+		description string
+		token       string
+		table       string
+		index       string
+	}{
+		{"Other index", token, "test.events", ""},
+		{"Other table", token, "test.orders", "status-createdAt"},
+		{"Tampered token", token[:len(token)-2] + "AA", "test.events", "status-createdAt"},
+		{"Garbage token", "not-a-cursor", "test.events", "status-createdAt"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			if _, err := codec.Decode(tc.token, tc.table, tc.index); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("Decode -> Expected: ErrInvalidCursor // Returned: %v", err)
+			}
+		})
+	}
+}
+
+func TestQueryCursorsOnIndexWithNumericSortKey(t *testing.T) {
+	client := createTestDynamoClient(t)
+	seedTestEvents(t, client, 9)
+	keyCondition := expression.Key("status").Equal(expression.Value("open"))
+	expr, _ := expression.NewBuilder().WithKeyCondition(keyCondition).Build()
+	paginateParams := paginate.AgPaginateOptionsRequest{Order: "DESC"}
+
+	var events []testEvent
+	if cursor, err := client.QueryPage(context.Background(), "events", "status-createdAt", expr, aws.Int32(2), &events, paginateParams); err != nil || cursor != "" || len(events) != 2 {
+		t.Errorf("QueryPage without codec -> Expected: 2 items and no cursor // Returned: %d items %q %v", len(events), cursor, err)
+	}
+	if _, err := client.QueryPage(context.Background(), "events", "status-createdAt", expr, aws.Int32(2), &events, paginate.AgPaginateOptionsRequest{Cursor: "token"}); !errors.Is(err, ErrCursorCodecNotConfigured) {
+		t.Errorf("QueryPage with a cursor without codec -> Expected: ErrCursorCodecNotConfigured // Returned: %v", err)
+	}
+	events = nil
+	if cursor, err := client.Query(context.Background(), "events", "status-createdAt", expr, aws.Int32(2), &events, "eventId", paginate.AgPaginateOptionsRequest{Order: "DESC", Cursor: "ignored"}); err != nil || cursor != "evt-02" {
+		t.Errorf("Deprecated Query without codec -> Expected: evt-02 // Returned: %q %v", cursor, err)
+	}
+	events = nil
+	if cursor, err := QueryPaginate(context.Background(), client, "events", "status-createdAt", expr, 2, &events, "eventId", paginateParams); err != nil || cursor != events[1].GetCursorID() {
+		t.Errorf("Deprecated QueryPaginate without codec -> Expected: %s // Returned: %q %v", events[1].GetCursorID(), cursor, err)
+	}
+	codec, _ := CreateCursorCodec([]byte("0123456789abcdef0123456789abcdef"))
+	client.SetCursorCodec(codec)
+
+	testCases := []struct {
+		description string
+		read        func(params paginate.AgPaginateOptionsRequest) ([]testEvent, string, error)
+		maxPages    int
+	}{
+		{"QueryPage", func(params paginate.AgPaginateOptionsRequest) ([]testEvent, string, error) {
+			var events []testEvent
+			cursor, err := client.QueryPage(context.Background(), "events", "status-createdAt", expr, aws.Int32(2), &events, params)
+			return events, cursor, err
+		}, 4},
+		{"QueryPaginatePage", func(params paginate.AgPaginateOptionsRequest) ([]testEvent, string, error) {
+			var events []testEvent
+			cursor, err := QueryPaginatePage(context.Background(), client, "events", "status-createdAt", expr, 2, &events, params)
+			return events, cursor, err
+		}, 3},
+		{"deprecated Query", func(params paginate.AgPaginateOptionsRequest) ([]testEvent, string, error) {
+			var events []testEvent
+			cursor, err := client.Query(context.Background(), "events", "status-createdAt", expr, aws.Int32(2), &events, "eventId", params)
+			return events, cursor, err
+		}, 4},
+		{"deprecated QueryPaginate", func(params paginate.AgPaginateOptionsRequest) ([]testEvent, string, error) {
+			var events []testEvent
+			cursor, err := QueryPaginate(context.Background(), client, "events", "status-createdAt", expr, 2, &events, "eventId", params)
+			return events, cursor, err
+		}, 3},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			params := paginateParams
+			var seen []string
+			pages := 0
+			for ; pages < 10; pages++ {
+				events, cursor, err := tc.read(params)
+				if errors.Is(err, ErrQueryNoData) {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Read failed: %v", err)
+				}
+				for _, event := range events {
+					seen = append(seen, event.EventID)
+				}
+				if cursor == "" {
+					pages++
+					break
+				}
+				params.Cursor = cursor
+			}
+			// createdAt decreases with the event number, so DESC on createdAt yields ascending ids.
+			expected := []string{"evt-00", "evt-02", "evt-04", "evt-06", "evt-08"}
+			if !reflect.DeepEqual(seen, expected) {
+				t.Errorf("Items -> Expected: %v // Returned: %v", expected, seen)
+			}
+			if pages > tc.maxPages {
+				t.Errorf("Pages -> Expected: at most %d // Returned: %d", tc.maxPages, pages)
+			}
+		})
+	}
+
+	other, _ := expression.NewBuilder().WithKeyCondition(expression.Key("orgId").Equal(expression.Value("org-1"))).Build()
+	_, cursor, _ := testCases[0].read(paginateParams)
+	if _, err := client.QueryPage(context.Background(), "events", "", other, aws.Int32(2), &events, paginate.AgPaginateOptionsRequest{Cursor: cursor}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("QueryPage with the cursor of another index -> Expected: ErrInvalidCursor // Returned: %v", err)
+	}
+}
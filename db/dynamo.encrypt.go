@@ -0,0 +1,283 @@
+package db
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"maps"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	utilsCrypto "github.com/techvuya/vuya-go-utils/crypto"
+)
+
+var ErrNoEncryptionKeyProvider = errors.New("ErrNoEncryptionKeyProvider")
+var ErrAttributeDecryption = errors.New("ErrAttributeDecryption")
+
+// encryptedAttributeVersion is the first byte of every encrypted attribute,
+// so the format can change without breaking stored items.
+const encryptedAttributeVersion byte = 1
+
+// Kind of the plaintext of an encrypted attribute, stored with it so the
+// attribute is restored as it was marshalled.
+const (
+	encryptedKindString byte = 'S'
+	encryptedKindBinary byte = 'B'
+)
+
+// EncryptionKeyRequest identifies the key of an encrypted attribute.
+type EncryptionKeyRequest struct {
+	// Scope is the value of the encrypt tag of the field, e.g. "tenant".
+	Scope string
+	// TableName is the table of the item, without the environment prefix.
+	TableName string
+	// PartitionKey is the partition key value of the item, e.g. the ID of
+	// the tenant that owns it.
+	PartitionKey string
+}
+
+// EncryptionKeyProvider returns the 32 byte keys that encrypt the fields
+// tagged encrypt:"<scope>". Keys are requested on every read and write, so
+// providers backed by KMS should cache them, as EnvelopeService does.
+type EncryptionKeyProvider interface {
+	EncryptionKey(ctx context.Context, request EncryptionKeyRequest) ([]byte, error)
+}
+
+// EncryptionKeyProviderFunc adapts a function to EncryptionKeyProvider, e.g.
+//
+//	db.EncryptionKeyProviderFunc(func(ctx context.Context, request db.EncryptionKeyRequest) ([]byte, error) {
+//		return envelope.FetchDataKey(ctx, request.PartitionKey)
+//	})
+type EncryptionKeyProviderFunc func(ctx context.Context, request EncryptionKeyRequest) ([]byte, error)
+
+func (f EncryptionKeyProviderFunc) EncryptionKey(ctx context.Context, request EncryptionKeyRequest) ([]byte, error) {
+	return f(ctx, request)
+}
+
+// SetEncryptionKeyProvider configures the keys of the fields tagged
+// encrypt:"<scope>". They are sealed with XChaCha20-Poly1305 when items are
+// put and opened when they are read into a struct. Every value is bound to
+// its table, attribute and item key, so it cannot be moved to another item.
+// Without a provider, writing or reading an encrypted field returns
+// ErrNoEncryptionKeyProvider.
+func (c *DynamoDatabaseClient) SetEncryptionKeyProvider(provider EncryptionKeyProvider) {
+	c.encryption = provider
+}
+
+// attributeCipher seals and opens the encrypted attributes of the items of
+// one table and struct type. A nil *attributeCipher leaves items unchanged.
+type attributeCipher struct {
+	provider  EncryptionKeyProvider
+	tableName string
+	info      *dynamoStructInfo
+	keys      map[EncryptionKeyRequest][]byte
+}
+
+// createAttributeCipher returns the cipher of the items behind data, or nil
+// when they have no encrypted field.
+func createAttributeCipher(provider EncryptionKeyProvider, tableName string, data interface{}) (*attributeCipher, error) {
+	info, err := itemStructInfo(data)
+	if err != nil {
+		return nil, err
+	}
+	if info == nil || len(info.encrypted) == 0 {
+		return nil, nil
+	}
+	return &attributeCipher{
+		provider:  provider,
+		tableName: tableName,
+		info:      info,
+		keys:      make(map[EncryptionKeyRequest][]byte),
+	}, nil
+}
+
+func (c DynamoDatabaseClient) attributeCipher(tableName string, data interface{}) (*attributeCipher, error) {
+	return createAttributeCipher(c.encryption, tableName, data)
+}
+
+// sealItem encrypts the encrypted attributes of a marshalled item about to
+// be written.
+func (c DynamoDatabaseClient) sealItem(ctx context.Context, tableName string, data interface{}, item map[string]types.AttributeValue) error {
+	cipher, err := c.attributeCipher(tableName, data)
+	if err != nil {
+		return err
+	}
+	return cipher.seal(ctx, item)
+}
+
+// openItems decrypts the encrypted attributes of items about to be
+// unmarshalled into resultDataPointer. key, when set, is the key the items
+// were read by, for items returned without their key attributes.
+func (c DynamoDatabaseClient) openItems(ctx context.Context, tableName string, resultDataPointer interface{}, items []map[string]types.AttributeValue, key map[string]types.AttributeValue) error {
+	cipher, err := c.attributeCipher(tableName, resultDataPointer)
+	if err != nil {
+		return err
+	}
+	for i := range items {
+		if items[i], err = cipher.open(ctx, items[i], key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *attributeCipher) seal(ctx context.Context, item map[string]types.AttributeValue) error {
+	if a == nil {
+		return nil
+	}
+	sealedItem := make(map[string]types.AttributeValue, len(a.info.encrypted))
+	for _, field := range a.info.encrypted {
+		var plaintext []byte
+		switch value := item[field.name].(type) {
+		case nil, *types.AttributeValueMemberNULL:
+			continue
+		case *types.AttributeValueMemberS:
+			plaintext = append([]byte{encryptedKindString}, value.Value...)
+		case *types.AttributeValueMemberB:
+			plaintext = append([]byte{encryptedKindBinary}, value.Value...)
+		default:
+			return fmt.Errorf("dynamo: encrypted attribute %s must be a string or binary, got %T", field.name, value)
+		}
+		key, aad, err := a.keyOf(ctx, field, item, nil)
+		if err != nil {
+			return err
+		}
+		sealed, err := utilsCrypto.EncryptBytesWithAAD(key, plaintext, aad)
+		if err != nil {
+			return err
+		}
+		sealedItem[field.name] = &types.AttributeValueMemberB{Value: append([]byte{encryptedAttributeVersion}, sealed...)}
+	}
+	maps.Copy(item, sealedItem)
+	return nil
+}
+
+// open returns item with its encrypted attributes decrypted. item itself is
+// left unchanged.
+func (a *attributeCipher) open(ctx context.Context, item map[string]types.AttributeValue, readKey map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+	if a == nil {
+		return item, nil
+	}
+	opened, cloned := item, false
+	for _, field := range a.info.encrypted {
+		var sealed []byte
+		switch value := item[field.name].(type) {
+		case nil, *types.AttributeValueMemberNULL:
+			continue
+		case *types.AttributeValueMemberB:
+			sealed = value.Value
+		}
+		if len(sealed) == 0 || sealed[0] != encryptedAttributeVersion {
+			return nil, fmt.Errorf("%w: attribute %s of %s is not encrypted", ErrAttributeDecryption, field.name, a.tableName)
+		}
+		key, aad, err := a.keyOf(ctx, field, item, readKey)
+		if err != nil {
+			return nil, err
+		}
+		plaintext, err := utilsCrypto.DecryptBytesWithAAD(key, sealed[1:], aad)
+		if err != nil {
+			return nil, fmt.Errorf("%w: attribute %s of %s: %v", ErrAttributeDecryption, field.name, a.tableName, err)
+		}
+		if len(plaintext) == 0 {
+			return nil, fmt.Errorf("%w: attribute %s of %s has no kind", ErrAttributeDecryption, field.name, a.tableName)
+		}
+		if !cloned {
+			opened, cloned = maps.Clone(item), true
+		}
+		switch plaintext[0] {
+		case encryptedKindString:
+			opened[field.name] = &types.AttributeValueMemberS{Value: string(plaintext[1:])}
+		default:
+			opened[field.name] = &types.AttributeValueMemberB{Value: plaintext[1:]}
+		}
+	}
+	return opened, nil
+}
+
+// keyOf returns the key and the additional data of an encrypted attribute.
+// The additional data binds the ciphertext to the table, the attribute and
+// the key of the item.
+func (a *attributeCipher) keyOf(ctx context.Context, field *dynamoStructField, item map[string]types.AttributeValue, readKey map[string]types.AttributeValue) ([]byte, []byte, error) {
+	parts := []string{a.tableName, field.name}
+	var partitionKey string
+	for i, keyField := range []*dynamoStructField{a.info.partitionKey, a.info.sortKey} {
+		if keyField == nil {
+			continue
+		}
+		value, ok := item[keyField.name]
+		if !ok {
+			value, ok = readKey[keyField.name]
+		}
+		plain, typed, valid := keyAttributeString(value)
+		if !ok || !valid {
+			return nil, nil, fmt.Errorf("dynamo: encrypted attribute %s of %s needs the key attribute %s of the item", field.name, a.tableName, keyField.name)
+		}
+		if i == 0 {
+			partitionKey = plain
+		}
+		parts = append(parts, keyField.name, typed)
+	}
+
+	request := EncryptionKeyRequest{Scope: field.encryptScope, TableName: a.tableName, PartitionKey: partitionKey}
+	key, ok := a.keys[request]
+	if !ok {
+		if a.provider == nil {
+			return nil, nil, ErrNoEncryptionKeyProvider
+		}
+		var err error
+		if key, err = a.provider.EncryptionKey(ctx, request); err != nil {
+			return nil, nil, err
+		}
+		a.keys[request] = key
+	}
+
+	var aad []byte
+	for _, part := range parts {
+		aad = binary.BigEndian.AppendUint32(aad, uint32(len(part)))
+		aad = append(aad, part...)
+	}
+	return key, aad, nil
+}
+
+// keyAttributeString returns a key attribute value as a plain string and as
+// a string that also carries its type.
+func keyAttributeString(value types.AttributeValue) (string, string, bool) {
+	switch v := value.(type) {
+	case *types.AttributeValueMemberS:
+		return v.Value, "S" + v.Value, true
+	case *types.AttributeValueMemberN:
+		return v.Value, "N" + v.Value, true
+	case *types.AttributeValueMemberB:
+		encoded := base64.StdEncoding.EncodeToString(v.Value)
+		return encoded, "B" + encoded, true
+	}
+	return "", "", false
+}
+
+// pendingSeal is an item put by a transaction whose encrypted attributes are
+// sealed when the transaction is executed, as keys need its context.
+type pendingSeal struct {
+	cipher *attributeCipher
+	item   map[string]types.AttributeValue
+}
+
+func (x *NoSqlTransaction) addSeal(tableName string, data interface{}, item map[string]types.AttributeValue) error {
+	cipher, err := createAttributeCipher(x.encryption, tableName, data)
+	if err != nil || cipher == nil {
+		return err
+	}
+	x.seals = append(x.seals, pendingSeal{cipher: cipher, item: item})
+	return nil
+}
+
+// sealItems encrypts the items put by the transaction, once.
+func (x *NoSqlTransaction) sealItems(ctx context.Context) error {
+	for len(x.seals) > 0 {
+		if err := x.seals[0].cipher.seal(ctx, x.seals[0].item); err != nil {
+			return err
+		}
+		x.seals = x.seals[1:]
+	}
+	return nil
+}
@@ -0,0 +1,277 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type testCustomer struct {
+	OrgID   string  `dynamodbav:"orgId" dynamo:",pk"`
+	EventID string  `dynamodbav:"eventId" dynamo:",sk"`
+	Status  string  `dynamodbav:"status"`
+	Email   string  `dynamodbav:"email" encrypt:"tenant"`
+	Phone   *string `dynamodbav:"phone" encrypt:"tenant"`
+	Notes   []byte  `dynamodbav:"notes,omitempty" encrypt:"tenant"`
+}
+
+// testKeyProvider derives one key per scope and tenant and records the
+// requests it serves.
+type testKeyProvider struct {
+	mu       sync.Mutex
+	requests map[EncryptionKeyRequest]int
+}
+
+func (p *testKeyProvider) EncryptionKey(ctx context.Context, request EncryptionKeyRequest) ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.requests == nil {
+		p.requests = make(map[EncryptionKeyRequest]int)
+	}
+	p.requests[request]++
+	key := sha256.Sum256([]byte(request.Scope + "/" + request.PartitionKey))
+	return key[:], nil
+}
+
+func createEncryptedTestDynamoClient(t *testing.T) (*DynamoDatabaseClient, *testKeyProvider) {
+	t.Helper()
+	client := createTestDynamoClient(t)
+	provider := &testKeyProvider{}
+	client.SetEncryptionKeyProvider(provider)
+	return client, provider
+}
+
+func rawTestItem(t *testing.T, client *DynamoDatabaseClient, orgID, eventID string) map[string]types.AttributeValue {
+	t.Helper()
+	result, err := client.GetApiClient().GetItem(context.Background(), &dynamodb.GetItemInput{
+		TableName: aws.String("test.events"),
+		Key: map[string]types.AttributeValue{
+			"orgId":   &types.AttributeValueMemberS{Value: orgID},
+			"eventId": &types.AttributeValueMemberS{Value: eventID},
+		},
+	})
+	if err != nil || result.Item == nil {
+		t.Fatalf("GetItem %s/%s failed: %v", orgID, eventID, err)
+	}
+	return result.Item
+}
+
+func TestEncryptTag(t *testing.T) {
+	testCases := []struct {
+		description string
+		item        interface{}
+		expectedErr bool
+	}{
+		{"string, pointer and binary", testCustomer{}, false},
+		{"integer field", struct {
+			OrgID string `dynamo:",pk"`
+			Age   int    `encrypt:"tenant"`
+		}{}, true},
+		{"without partition key", struct {
+			Email string `encrypt:"tenant"`
+		}{}, true},
+		{"encrypted key", struct {
+			OrgID string `dynamo:",pk" encrypt:"tenant"`
+		}{}, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			_, err := getDynamoStructInfo(reflect.TypeOf(tc.item))
+			if (err != nil) != tc.expectedErr {
+				t.Errorf("getDynamoStructInfo -> Expected error: %v // Returned: %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestEncryptedAttributes(t *testing.T) {
+	ctx := context.Background()
+	client, provider := createEncryptedTestDynamoClient(t)
+	phone := "+34 600 000 000"
+	customers := []testCustomer{
+		{OrgID: "org-1", EventID: "cus-1", Status: "open", Email: "ana@example.com", Phone: &phone, Notes: []byte{0, 1, 2}},
+		{OrgID: "org-1", EventID: "cus-2", Status: "open", Email: "luis@example.com"},
+		{OrgID: "org-1", EventID: "cus-3", Status: "open", Email: "eva@example.com"},
+		{OrgID: "org-2", EventID: "cus-4", Status: "open", Email: "ana@example.com"},
+	}
+	if err := client.PutItem(ctx, "events", customers[0]); err != nil {
+		t.Fatalf("PutItem failed: %v", err)
+	}
+	if err := client.PutBatch(ctx, "events", []interface{}{customers[1]}); err != nil {
+		t.Fatalf("PutBatch failed: %v", err)
+	}
+	transaction := CreateNoSqlTransaction(client)
+	for _, customer := range customers[2:] {
+		if err := transaction.AddTransactionPut("events", customer); err != nil {
+			t.Fatalf("AddTransactionPut failed: %v", err)
+		}
+	}
+	if err := client.ExecuteTransaction(ctx, transaction); err != nil {
+		t.Fatalf("ExecuteTransaction failed: %v", err)
+	}
+
+	for _, customer := range customers {
+		item := rawTestItem(t, client, customer.OrgID, customer.EventID)
+		sealed, ok := item["email"].(*types.AttributeValueMemberB)
+		if !ok || bytes.Contains(sealed.Value, []byte(customer.Email)) {
+			t.Errorf("Stored email of %s -> Expected: ciphertext // Returned: %#v", customer.EventID, item["email"])
+		}
+		if customer.Phone == nil && item["phone"] != nil {
+			if _, isNull := item["phone"].(*types.AttributeValueMemberNULL); !isNull {
+				t.Errorf("Stored nil phone of %s -> Expected: NULL // Returned: %#v", customer.EventID, item["phone"])
+			}
+		}
+	}
+	if requested := provider.requests[EncryptionKeyRequest{Scope: "tenant", TableName: "events", PartitionKey: "org-2"}]; requested == 0 {
+		t.Errorf("Key requests -> Expected: the key of org-2 // Returned: %v", provider.requests)
+	}
+
+	orgKey := expression.Key("orgId").Equal(expression.Value("org-1"))
+	expr, err := expression.NewBuilder().WithKeyCondition(orgKey).Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	testCases := []struct {
+		description string
+		read        func() ([]testCustomer, error)
+	}{
+		{"Get", func() ([]testCustomer, error) {
+			var customer testCustomer
+			err := client.Get(ctx, "events", testEventKey("cus-1"), &customer)
+			return []testCustomer{customer}, err
+		}},
+		{"Get projecting the email only", func() ([]testCustomer, error) {
+			var customer testCustomer
+			err := client.GetWithOptions(ctx, "events", testEventKey("cus-1"), &customer, GetOptions{Attributes: []string{"email", "phone", "notes"}})
+			customer.OrgID, customer.EventID, customer.Status = "org-1", "cus-1", "open"
+			return []testCustomer{customer}, err
+		}},
+		{"GetBatch", func() ([]testCustomer, error) {
+			var result []testCustomer
+			err := client.GetBatchWithOptions(ctx, "events", []map[string]types.AttributeValue{testEventKey("cus-1"), testEventKey("cus-2"), testEventKey("cus-3")}, &result, BatchGetOptions{PreserveOrder: true})
+			return result, err
+		}},
+		{"QueryAllItems", func() ([]testCustomer, error) {
+			var result []testCustomer
+			err := client.QueryAllItems(ctx, "events", "", expr, &result)
+			return result, err
+		}},
+		{"QueryAll", func() ([]testCustomer, error) {
+			var result []testCustomer
+			for customer, err := range QueryAll[testCustomer](ctx, client, "events", "", expr, QueryAllOptions{}) {
+				if err != nil {
+					return nil, err
+				}
+				result = append(result, customer)
+			}
+			return result, nil
+		}},
+		{"ScanAll", func() ([]testCustomer, error) {
+			var result []testCustomer
+			for customer, err := range ScanAll[testCustomer](ctx, client, "events", expression.Expression{}, ScanOptions{}) {
+				if err != nil {
+					return nil, err
+				}
+				if customer.OrgID == "org-1" {
+					result = append(result, customer)
+				}
+			}
+			sort.Slice(result, func(i, j int) bool { return result[i].EventID < result[j].EventID })
+			return result, nil
+		}},
+		{"ExecuteReadTransaction", func() ([]testCustomer, error) {
+			var customer testCustomer
+			transaction := CreateNoSqlReadTransaction(client)
+			if err := transaction.AddGet("events", testEventKey("cus-1"), []string{"email", "phone", "notes"}, &customer); err != nil {
+				return nil, err
+			}
+			err := client.ExecuteReadTransaction(ctx, transaction)
+			customer.OrgID, customer.EventID, customer.Status = "org-1", "cus-1", "open"
+			return []testCustomer{customer}, err
+		}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			result, err := tc.read()
+			if err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+			expected := customers[:len(result)]
+			if len(result) == 0 || !reflect.DeepEqual(result, expected) {
+				t.Errorf("Read -> Expected: %+v // Returned: %+v", expected, result)
+			}
+		})
+	}
+}
+
+func TestEncryptedAttributesAreBoundToTheirItem(t *testing.T) {
+	ctx := context.Background()
+	client, _ := createEncryptedTestDynamoClient(t)
+	for _, customer := range []testCustomer{
+		{OrgID: "org-1", EventID: "cus-1", Status: "open", Email: "ana@example.com", Notes: []byte("vip")},
+		{OrgID: "org-1", EventID: "cus-2", Status: "open", Email: "luis@example.com"},
+	} {
+		if err := client.PutItem(ctx, "events", customer); err != nil {
+			t.Fatalf("PutItem failed: %v", err)
+		}
+	}
+	stolen := rawTestItem(t, client, "org-1", "cus-1")
+
+	testCases := []struct {
+		description string
+		tamper      func(item map[string]types.AttributeValue)
+	}{
+		{"email copied from another item", func(item map[string]types.AttributeValue) {
+			item["email"] = stolen["email"]
+		}},
+		{"notes copied into the email", func(item map[string]types.AttributeValue) {
+			item["email"] = stolen["notes"]
+		}},
+		{"plaintext email", func(item map[string]types.AttributeValue) {
+			item["email"] = &types.AttributeValueMemberS{Value: "mallory@example.com"}
+		}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			item := rawTestItem(t, client, "org-1", "cus-2")
+			tc.tamper(item)
+			if _, err := client.GetApiClient().PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String("test.events"), Item: item}); err != nil {
+				t.Fatalf("PutItem failed: %v", err)
+			}
+			var customer testCustomer
+			err := client.Get(ctx, "events", testEventKey("cus-2"), &customer)
+			if !errors.Is(err, ErrAttributeDecryption) {
+				t.Errorf("Get -> Expected: %v // Returned: %+v %v", ErrAttributeDecryption, customer, err)
+			}
+		})
+	}
+}
+
+func TestEncryptedAttributesWithoutProvider(t *testing.T) {
+	ctx := context.Background()
+	client := createTestDynamoClient(t)
+
+	err := client.PutItem(ctx, "events", testCustomer{OrgID: "org-1", EventID: "cus-1", Status: "open", Email: "ana@example.com"})
+	if !errors.Is(err, ErrNoEncryptionKeyProvider) {
+		t.Errorf("PutItem -> Expected: %v // Returned: %v", ErrNoEncryptionKeyProvider, err)
+	}
+	if _, err := CreateUpdatePatchFromStruct(testCustomer{Email: "ana@example.com"}); err == nil {
+		t.Errorf("CreateUpdatePatchFromStruct with an encrypted field -> Expected: error // Returned: nil")
+	}
+
+	seedTestEvents(t, client, 1)
+	var customer testCustomer
+	if err := client.Get(ctx, "events", testEventKey("evt-00"), &customer); err != nil || customer.EventID != "evt-00" {
+		t.Errorf("Get without encrypted attributes -> Expected: evt-00 // Returned: %+v %v", customer, err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/techvuya/vuya-go-utils/awsconfig"
 	paginate "github.com/techvuya/vuya-go-utils/paginate"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -12,38 +13,107 @@ import (
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
-	"github.com/aws/aws-xray-sdk-go/instrumentation/awsv2"
-
-	"github.com/aws/aws-sdk-go-v2/config"
 )
 
 var ErrQueryNoData = errors.New("ErrQueryNoData")
 
+// DynamoApiClient is the subset of the DynamoDB SDK client used by
+// DynamoDatabaseClient. It is satisfied by *dynamodb.Client and by
+// MemoryDynamoClient.
+type DynamoApiClient interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+	BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error)
+	BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
+	TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+	TransactGetItems(ctx context.Context, params *dynamodb.TransactGetItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactGetItemsOutput, error)
+}
+
+// DynamoDatabaseClientInterface defines the operations offered by
+// DynamoDatabaseClient so services can depend on it instead of the concrete type.
+type DynamoDatabaseClientInterface interface {
+	GetTableUrl(tableName string) string
+	Get(ctx context.Context, tableName string, keys map[string]types.AttributeValue, resultDataPointer interface{}) error
+	GetWithOptions(ctx context.Context, tableName string, keys map[string]types.AttributeValue, resultDataPointer interface{}, options GetOptions) error
+	GetBatch(ctx context.Context, tableName string, keys []map[string]types.AttributeValue, resultDataPointer interface{}) error
+	GetBatchWithOptions(ctx context.Context, tableName string, keys []map[string]types.AttributeValue, resultDataPointer interface{}, options BatchGetOptions) error
+	GetBatchTables(ctx context.Context, requests []BatchGetRequest, options BatchGetOptions) error
+	Query(ctx context.Context, tableName string, index string, expr expression.Expression, limitItems *int32, resultDataPointer interface{}, cursorKey string, paginateParams paginate.AgPaginateOptionsRequest) (string, error)
+	QueryPage(ctx context.Context, tableName string, index string, expr expression.Expression, limitItems *int32, resultDataPointer interface{}, paginateParams paginate.AgPaginateOptionsRequest) (string, error)
+	QueryPaginate(ctx context.Context, tableName string, index string, expr expression.Expression, limitItems int32, resultDataPointer *[]CursorItem, cursorKey string, paginateParams paginate.AgPaginateOptionsRequest) (string, error)
+	QueryAllItems(ctx context.Context, tableName string, index string, expr expression.Expression, resultDataPointer interface{}) error
+	QueryCount(ctx context.Context, tableName string, index string, expr expression.Expression) (int32, error)
+	QueryBatchItems(ctx context.Context, tableName string, index string, keys []map[string]types.AttributeValue, resultDataPointer interface{}) error
+	QueryOne(ctx context.Context, tableName, index string, expr expression.Expression, resultDataPointer interface{}) error
+	UpdateItem(ctx context.Context, tableName string, key map[string]types.AttributeValue, updateExpression string, expressionAttributeValues map[string]types.AttributeValue, conditionExpression string) error
+	UpdateItemExpr(ctx context.Context, tableName string, key map[string]types.AttributeValue, expr expression.Expression) error
+	UpdateItemVersioned(ctx context.Context, tableName string, key map[string]types.AttributeValue, item interface{}, update expression.UpdateBuilder, condition expression.ConditionBuilder) error
+	UpdateItemPatch(ctx context.Context, tableName string, key map[string]types.AttributeValue, patch *UpdatePatch, condition expression.ConditionBuilder) error
+	UpdateItemReturning(ctx context.Context, tableName string, key map[string]types.AttributeValue, expr expression.Expression, options ReturnOptions, resultDataPointer interface{}) (bool, error)
+	PutItem(ctx context.Context, tableName string, data interface{}) error
+	PutItemReturning(ctx context.Context, tableName string, data interface{}, condition expression.ConditionBuilder, options ReturnOptions, resultDataPointer interface{}) (bool, error)
+	DeleteItem(ctx context.Context, tableName string, key map[string]types.AttributeValue) error
+	PutBatch(ctx context.Context, tableName string, items []interface{}) error
+	DeleteBatch(ctx context.Context, tableName string, keys []map[string]types.AttributeValue) error
+	WriteBatch(ctx context.Context, requests []BatchWriteRequest, options BatchWriteOptions) error
+	ExecuteTransaction(ctx context.Context, params *NoSqlTransaction) error
+	ExecuteReadTransaction(ctx context.Context, params *NoSqlReadTransaction) error
+	SelectCount(ctx context.Context, params SelectCountParams) (int64, error)
+	Count(ctx context.Context, tableName string, expr expression.Expression, options CountOptions) (int64, error)
+}
+
 type DynamoDatabaseClient struct {
 	dbEnvPrefix  string
-	dynamoClient *dynamodb.Client
+	dynamoClient DynamoApiClient
+	cursorCodec  *CursorCodec
+	encryption   EncryptionKeyProvider
 }
 
-func CreateDynamoDatabaseClient(awsSessionRegion, dbEnvPrefix string) (*DynamoDatabaseClient, error) {
-	dynamoClient, err := generateNewDynamoAccessSession(awsSessionRegion)
+// CreateDynamoDatabaseClient builds a client for the DynamoDB API of
+// awsSessionRegion. X-Ray tracing is on unless awsconfig.WithTracing(false)
+// is passed.
+func CreateDynamoDatabaseClient(awsSessionRegion, dbEnvPrefix string, options ...awsconfig.Option) (*DynamoDatabaseClient, error) {
+	dynamoClient, err := generateNewDynamoAccessSession(awsSessionRegion, options...)
 	if err != nil {
 		return nil, err
 	}
 	return &DynamoDatabaseClient{
-		dynamoClient: dynamoClient,
+		dynamoClient: &capacityObservingClient{DynamoApiClient: &retryingClient{DynamoApiClient: dynamoClient}},
 		dbEnvPrefix:  dbEnvPrefix,
 	}, nil
 }
 
-func generateNewDynamoAccessSession(awsSessionRegion string) (*dynamodb.Client, error) {
-	cfg, err := config.LoadDefaultConfig(context.TODO(), func(o *config.LoadOptions) error {
-		o.Region = awsSessionRegion
-		return nil
-	})
+// CreateDynamoDatabaseClientWithApi builds a client on top of an existing
+// DynamoApiClient, e.g. a MemoryDynamoClient in unit tests.
+func CreateDynamoDatabaseClientWithApi(dynamoClient DynamoApiClient, dbEnvPrefix string) *DynamoDatabaseClient {
+	return &DynamoDatabaseClient{
+		dynamoClient: &capacityObservingClient{DynamoApiClient: &retryingClient{DynamoApiClient: dynamoClient}},
+		dbEnvPrefix:  dbEnvPrefix,
+	}
+}
+
+// GetApiClient returns the underlying DynamoDB API client.
+func (c DynamoDatabaseClient) GetApiClient() DynamoApiClient {
+	apiClient := c.dynamoClient
+	if observed, ok := apiClient.(*capacityObservingClient); ok {
+		apiClient = observed.DynamoApiClient
+	}
+	if retrying, ok := apiClient.(*retryingClient); ok {
+		apiClient = retrying.DynamoApiClient
+	}
+	return apiClient
+}
+
+func generateNewDynamoAccessSession(awsSessionRegion string, options ...awsconfig.Option) (*dynamodb.Client, error) {
+	defaults := []awsconfig.Option{awsconfig.WithRegion(awsSessionRegion), awsconfig.WithTracing(true)}
+	cfg, err := awsconfig.Load(context.TODO(), append(defaults, options...)...)
 	if err != nil {
 		return nil, err
 	}
-	awsv2.AWSV2Instrumentor(&cfg.APIOptions)
 	svc := dynamodb.NewFromConfig(cfg)
 	return svc, nil
 }
@@ -57,57 +127,18 @@ func (c DynamoDatabaseClient) GetTableUrl(tableName string) string {
 }
 
 func (c DynamoDatabaseClient) Get(ctx context.Context, tableName string, keys map[string]types.AttributeValue, resultDataPointer interface{}) error {
-	tableUrl := c.GetTableUrl(tableName)
-	result, err := c.dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
-		TableName:              aws.String(tableUrl),
-		Key:                    keys,
-		ReturnConsumedCapacity: types.ReturnConsumedCapacityTotal,
-	})
-	if err != nil {
-		return err
-	}
-	if result.Item == nil {
-		return ErrQueryNoData
-	}
-
-	err = attributevalue.UnmarshalMap(result.Item, &resultDataPointer)
-	if err != nil {
-		return err
-	}
-	return nil
+	return c.GetWithOptions(ctx, tableName, keys, resultDataPointer, GetOptions{})
 }
 func (c DynamoDatabaseClient) GetBatch(ctx context.Context, tableName string, keys []map[string]types.AttributeValue, resultDataPointer interface{}) error {
-	tableUrl := c.GetTableUrl(tableName)
-	request := map[string]types.KeysAndAttributes{
-		tableUrl: {
-			Keys: keys,
-		},
-	}
-	result, err := c.dynamoClient.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
-		RequestItems: request,
-	})
-	if err != nil {
-		return err
-	}
-	if result.Responses[tableUrl] == nil {
-		return ErrQueryNoData
-	}
-
-	err = attributevalue.UnmarshalListOfMaps(result.Responses[tableUrl], &resultDataPointer)
-	if err != nil {
-		return err
-	}
-	return nil
+	return c.GetBatchWithOptions(ctx, tableName, keys, resultDataPointer, BatchGetOptions{})
 }
 
+// GetResponseCursor returns a single string attribute of lastEvaluatedKey.
+//
+// Deprecated: it cannot represent numeric, binary or multi-attribute keys;
+// use the cursors returned by QueryPage and QueryPaginatePage instead.
 func GetResponseCursor(lastEvaluatedKey map[string]types.AttributeValue, key string) (string, error) {
-	atributeValuex := lastEvaluatedKey[key]
-	var eventIdString string
-	err := attributevalue.Unmarshal(atributeValuex, &eventIdString)
-	if err != nil {
-		return "", err
-	}
-	return eventIdString, nil
+	return getResponseCursor(lastEvaluatedKey, key)
 }
 
 func getResponseCursor(lastEvaluatedKey map[string]types.AttributeValue, key string) (string, error) {
@@ -120,39 +151,33 @@ func getResponseCursor(lastEvaluatedKey map[string]types.AttributeValue, key str
 	return eventIdString, nil
 }
 
+// CreateDynamoPaginateRequest queries the partition keyName = keyValue after
+// the cursorName value cursorValue. Use CreateKeyQuery for sort key
+// conditions and typed values. The cursors returned by QueryPage are not
+// sort key values; pass them in the paginate parameters of QueryPage instead.
 func CreateDynamoPaginateRequest(keyName, keyValue, cursorName, cursorValue, order string) (expression.Expression, error) {
-	var keyEx expression.KeyConditionBuilder
-
-	if cursorValue == "" {
-		keyEx = expression.Key(keyName).Equal(expression.Value(keyValue))
-	} else if order == "DESC" {
-		keyEx = expression.Key(keyName).Equal(expression.Value(keyValue)).And(expression.Key(cursorName).LessThan(expression.Value(cursorValue)))
-	} else {
-		keyEx = expression.Key(keyName).Equal(expression.Value(keyValue)).And(expression.Key(cursorName).GreaterThan(expression.Value(cursorValue)))
-	}
-	expr, err := expression.NewBuilder().WithKeyCondition(keyEx).Build()
-	if err != nil {
-		return expression.Expression{}, err
-	}
-	return expr, nil
+	return createPaginateKeyQuery(keyName, keyValue, cursorName, cursorValue, order).Build()
 }
 
 func CreateDynamoPaginateRequestWithCondition(keyName, keyValue, cursorName, cursorValue, order string, filterCond expression.ConditionBuilder) (expression.Expression, error) {
-	var keyEx expression.KeyConditionBuilder
+	return createPaginateKeyQuery(keyName, keyValue, cursorName, cursorValue, order).Filter(filterCond).Build()
+}
 
-	if cursorValue == "" {
-		keyEx = expression.Key(keyName).Equal(expression.Value(keyValue))
-	} else if order == "DESC" {
-		keyEx = expression.Key(keyName).Equal(expression.Value(keyValue)).And(expression.Key(cursorName).LessThan(expression.Value(cursorValue)))
-	} else {
-		keyEx = expression.Key(keyName).Equal(expression.Value(keyValue)).And(expression.Key(cursorName).GreaterThan(expression.Value(cursorValue)))
-	}
-	expr, err := expression.NewBuilder().WithKeyCondition(keyEx).WithFilter(filterCond).Build()
-	if err != nil {
-		return expression.Expression{}, err
+func createPaginateKeyQuery(keyName, keyValue, cursorName, cursorValue, order string) *KeyQuery {
+	query := CreateKeyQuery(keyName, keyValue).Ascending(order != "DESC")
+	if cursorValue != "" {
+		query.SortKey(cursorName).After(cursorValue)
 	}
-	return expr, nil
+	return query
 }
+
+// Query reads one page of up to limitItems evaluated items into
+// resultDataPointer. With a CursorCodec it behaves as QueryPage and
+// cursorKey is ignored. Without one, paginateParams.Cursor is not read and
+// the returned cursor is the cursorKey attribute of the LastEvaluatedKey.
+//
+// Deprecated: the single attribute cursor breaks on indexes and on numeric
+// or composite keys; use QueryPage with a CursorCodec instead.
 func (c DynamoDatabaseClient) Query(
 	ctx context.Context,
 	tableName string,
@@ -161,6 +186,47 @@ func (c DynamoDatabaseClient) Query(
 	limitItems *int32,
 	resultDataPointer interface{},
 	cursorKey string, paginateParams paginate.AgPaginateOptionsRequest) (string, error) {
+	if c.cursorCodec != nil {
+		return c.QueryPage(ctx, tableName, index, expr, limitItems, resultDataPointer, paginateParams)
+	}
+	paginateParams.Cursor = ""
+	lastEvaluatedKey, err := c.query(ctx, tableName, index, expr, limitItems, resultDataPointer, paginateParams)
+	if err != nil || lastEvaluatedKey == nil || cursorKey == "" {
+		return "", err
+	}
+	return getResponseCursor(lastEvaluatedKey, cursorKey)
+}
+
+// QueryPage reads one page of up to limitItems evaluated items, starting
+// after paginateParams.Cursor. The returned cursor encodes the full
+// LastEvaluatedKey with the CursorCodec of the client and is empty on the
+// last page. A page emptied by the filter still returns a cursor. Without a
+// codec the cursor is always empty, so only the first page can be read.
+func (c DynamoDatabaseClient) QueryPage(
+	ctx context.Context,
+	tableName string,
+	index string,
+	expr expression.Expression,
+	limitItems *int32,
+	resultDataPointer interface{},
+	paginateParams paginate.AgPaginateOptionsRequest) (string, error) {
+	lastEvaluatedKey, err := c.query(ctx, tableName, index, expr, limitItems, resultDataPointer, paginateParams)
+	if err != nil {
+		return "", err
+	}
+	return c.encodeCursor(tableName, index, lastEvaluatedKey)
+}
+
+// query reads one page into resultDataPointer and returns its
+// LastEvaluatedKey.
+func (c DynamoDatabaseClient) query(
+	ctx context.Context,
+	tableName string,
+	index string,
+	expr expression.Expression,
+	limitItems *int32,
+	resultDataPointer interface{},
+	paginateParams paginate.AgPaginateOptionsRequest) (map[string]types.AttributeValue, error) {
 	scanIndexForward := false
 	if paginateParams.GetOrder() == "ASC" {
 		scanIndexForward = true
@@ -174,6 +240,7 @@ func (c DynamoDatabaseClient) Query(
 		ExpressionAttributeValues: expr.Values(),
 		KeyConditionExpression:    expr.KeyCondition(),
 		FilterExpression:          expr.Filter(),
+		ProjectionExpression:      expr.Projection(),
 		Limit:                     limitItems,
 		ScanIndexForward:          &scanIndexForward,
 		ReturnConsumedCapacity:    types.ReturnConsumedCapacityTotal,
@@ -182,35 +249,40 @@ func (c DynamoDatabaseClient) Query(
 	if index != "" {
 		queryParams.IndexName = aws.String(index)
 	}
+	queryParams.FilterExpression, queryParams.ExpressionAttributeNames, queryParams.ExpressionAttributeValues = expiryFilter(ctx, resultDataPointer, queryParams.FilterExpression, queryParams.ExpressionAttributeNames, queryParams.ExpressionAttributeValues)
+	if err := c.applyCursor(&queryParams, paginateParams); err != nil {
+		return nil, err
+	}
 
 	result, err := c.dynamoClient.Query(ctx, &queryParams)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	if result.Items == nil || len(result.Items) == 0 {
-		return "", ErrQueryNoData
+	if len(result.Items) == 0 && result.LastEvaluatedKey == nil {
+		return nil, ErrQueryNoData
 	}
 
-	cursorLastKey := ""
-	if result.LastEvaluatedKey != nil && cursorKey != "" {
-		cursorLastKey, err = getResponseCursor(result.LastEvaluatedKey, cursorKey)
-		if err != nil {
-			return "", err
-		}
+	if err := c.openItems(ctx, tableName, resultDataPointer, result.Items, nil); err != nil {
+		return nil, err
 	}
-
-	err = attributevalue.UnmarshalListOfMaps(result.Items, &resultDataPointer)
+	err = attributevalue.UnmarshalListOfMaps(result.Items, resultDataPointer)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return cursorLastKey, nil
+	return result.LastEvaluatedKey, nil
 }
 
+// CursorItem is implemented by the items read with QueryPaginate.
 type CursorItem interface {
 	GetCursorID() string
 }
 
+// QueryPaginate is Query reading one extra item, so the cursor is empty when
+// the last page is exactly limitItems long. Without a CursorCodec the cursor
+// is the GetCursorID of the last item.
+//
+// Deprecated: use QueryPaginatePage with a CursorCodec instead.
 func (c DynamoDatabaseClient) QueryPaginate(
 	ctx context.Context,
 	tableName string,
@@ -219,63 +291,51 @@ func (c DynamoDatabaseClient) QueryPaginate(
 	limitItems int32,
 	resultDataPointer *[]CursorItem,
 	cursorKey string, paginateParams paginate.AgPaginateOptionsRequest) (string, error) {
-	scanIndexForward := false
-	if paginateParams.GetOrder() == "ASC" {
-		scanIndexForward = true
-	}
-	tableUrl := c.GetTableUrl(tableName)
-
-	limitItemsFormat := limitItems + 1
-
-	queryParams := dynamodb.QueryInput{
-		TableName:                 aws.String(tableUrl),
-		ExpressionAttributeNames:  expr.Names(),
-		ExpressionAttributeValues: expr.Values(),
-		KeyConditionExpression:    expr.KeyCondition(),
-		FilterExpression:          expr.Filter(),
-		Limit:                     &limitItemsFormat,
-		ScanIndexForward:          &scanIndexForward,
-		ReturnConsumedCapacity:    types.ReturnConsumedCapacityTotal,
-	}
+	return QueryPaginate(ctx, &c, tableName, index, expr, limitItems, resultDataPointer, cursorKey, paginateParams)
+}
 
-	if index != "" {
-		queryParams.IndexName = aws.String(index)
+// QueryPaginate is the typed variant of DynamoDatabaseClient.QueryPaginate.
+//
+// Deprecated: use QueryPaginatePage with a CursorCodec instead.
+func QueryPaginate[T CursorItem](
+	ctx context.Context,
+	dbClient *DynamoDatabaseClient,
+	tableName string,
+	index string,
+	expr expression.Expression,
+	limitItems int32,
+	resultDataPointer *[]T,
+	cursorKey string, paginateParams paginate.AgPaginateOptionsRequest) (string, error) {
+	if dbClient.cursorCodec != nil {
+		return QueryPaginatePage(ctx, dbClient, tableName, index, expr, limitItems, resultDataPointer, paginateParams)
 	}
-
-	result, err := c.dynamoClient.Query(ctx, &queryParams)
-	if err != nil {
+	paginateParams.Cursor = ""
+	lastEvaluatedKey, err := queryPaginate(ctx, dbClient, tableName, index, expr, limitItems, resultDataPointer, paginateParams)
+	if err != nil || lastEvaluatedKey == nil || len(*resultDataPointer) == 0 {
 		return "", err
 	}
+	return (*resultDataPointer)[len(*resultDataPointer)-1].GetCursorID(), nil
+}
 
-	if result.Items == nil || len(result.Items) == 0 {
-		return "", ErrQueryNoData
-	}
-
-	cursorLastKey := ""
-	// if result.LastEvaluatedKey != nil && cursorKey != "" {
-	// 	cursorLastKey, err = getResponseCursor(result.LastEvaluatedKey, cursorKey)
-	// 	if err != nil {
-	// 		return "", err
-	// 	}
-	// }
-
-	err = attributevalue.UnmarshalListOfMaps(result.Items, &resultDataPointer)
+// QueryPaginatePage is QueryPage reading one extra item, so the cursor is
+// empty when the last page is exactly limitItems long.
+func QueryPaginatePage[T any](
+	ctx context.Context,
+	dbClient *DynamoDatabaseClient,
+	tableName string,
+	index string,
+	expr expression.Expression,
+	limitItems int32,
+	resultDataPointer *[]T,
+	paginateParams paginate.AgPaginateOptionsRequest) (string, error) {
+	lastEvaluatedKey, err := queryPaginate(ctx, dbClient, tableName, index, expr, limitItems, resultDataPointer, paginateParams)
 	if err != nil {
 		return "", err
 	}
-	responseSize := len(*resultDataPointer)
-
-	if int32(responseSize) > limitItems {
-		*resultDataPointer = (*resultDataPointer)[:limitItems]
-		cursorLastKey = (*resultDataPointer)[len(*resultDataPointer)-1].GetCursorID()
-	} else {
-		cursorLastKey = ""
-	}
-
-	return cursorLastKey, nil
+	return dbClient.encodeCursor(tableName, index, lastEvaluatedKey)
 }
 
-func QueryPaginate[T CursorItem](
+func queryPaginate[T any](
 	ctx context.Context,
 	dbClient *DynamoDatabaseClient,
 	tableName string,
@@ -283,7 +343,7 @@ func QueryPaginate[T CursorItem](
 	expr expression.Expression,
 	limitItems int32,
 	resultDataPointer *[]T,
-	cursorKey string, paginateParams paginate.AgPaginateOptionsRequest) (string, error) {
+	paginateParams paginate.AgPaginateOptionsRequest) (map[string]types.AttributeValue, error) {
 	scanIndexForward := false
 	if paginateParams.GetOrder() == "ASC" {
 		scanIndexForward = true
@@ -299,6 +359,7 @@ func QueryPaginate[T CursorItem](
 		ExpressionAttributeValues: expr.Values(),
 		KeyConditionExpression:    expr.KeyCondition(),
 		FilterExpression:          expr.Filter(),
+		ProjectionExpression:      expr.Projection(),
 		Limit:                     &limitItemsFormat,
 		ScanIndexForward:          &scanIndexForward,
 		ReturnConsumedCapacity:    types.ReturnConsumedCapacityTotal,
@@ -307,40 +368,37 @@ func QueryPaginate[T CursorItem](
 	if index != "" {
 		queryParams.IndexName = aws.String(index)
 	}
+	queryParams.FilterExpression, queryParams.ExpressionAttributeNames, queryParams.ExpressionAttributeValues = expiryFilter(ctx, resultDataPointer, queryParams.FilterExpression, queryParams.ExpressionAttributeNames, queryParams.ExpressionAttributeValues)
+	if err := dbClient.applyCursor(&queryParams, paginateParams); err != nil {
+		return nil, err
+	}
 
 	result, err := dbClient.dynamoClient.Query(ctx, &queryParams)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	if result.Items == nil || len(result.Items) == 0 {
-		return "", ErrQueryNoData
+	if len(result.Items) == 0 && result.LastEvaluatedKey == nil {
+		return nil, ErrQueryNoData
 	}
 
-	cursorLastKey := ""
-	// if result.LastEvaluatedKey != nil && cursorKey != "" {
-	// 	cursorLastKey, err = getResponseCursor(result.LastEvaluatedKey, cursorKey)
-	// 	if err != nil {
-	// 		return "", err
-	// 	}
-	// }
-
-	err = attributevalue.UnmarshalListOfMaps(result.Items, &resultDataPointer)
+	items, lastEvaluatedKey, err := trimPage(result.Items, limitItems, result.LastEvaluatedKey)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	responseSize := len(*resultDataPointer)
 
-	if int32(responseSize) > limitItems {
-		*resultDataPointer = (*resultDataPointer)[:limitItems]
-		cursorLastKey = (*resultDataPointer)[len(*resultDataPointer)-1].GetCursorID()
-	} else {
-		cursorLastKey = ""
+	if err := dbClient.openItems(ctx, tableName, resultDataPointer, items, nil); err != nil {
+		return nil, err
 	}
-
-	return cursorLastKey, nil
+	err = attributevalue.UnmarshalListOfMaps(items, resultDataPointer)
+	if err != nil {
+		return nil, err
+	}
+	return lastEvaluatedKey, nil
 }
 
+// QueryAllItems reads every page of the query into resultDataPointer. Use
+// QueryAll to process large partitions without holding them in memory.
 func (c DynamoDatabaseClient) QueryAllItems(
 	ctx context.Context,
 	tableName string,
@@ -355,12 +413,15 @@ func (c DynamoDatabaseClient) QueryAllItems(
 		ExpressionAttributeNames:  expr.Names(),
 		ExpressionAttributeValues: expr.Values(),
 		KeyConditionExpression:    expr.KeyCondition(),
+		FilterExpression:          expr.Filter(),
+		ProjectionExpression:      expr.Projection(),
 		ReturnConsumedCapacity:    types.ReturnConsumedCapacityTotal,
 	}
 
 	if index != "" {
 		queryParams.IndexName = aws.String(index)
 	}
+	queryParams.FilterExpression, queryParams.ExpressionAttributeNames, queryParams.ExpressionAttributeValues = expiryFilter(ctx, resultDataPointer, queryParams.FilterExpression, queryParams.ExpressionAttributeNames, queryParams.ExpressionAttributeValues)
 
 	var allItems []map[string]types.AttributeValue
 
@@ -376,10 +437,12 @@ func (c DynamoDatabaseClient) QueryAllItems(
 	}
 
 	if len(allItems) == 0 {
-		fmt.Println("@ErrorNoItemsQueryAll")
 		return nil
 	}
 
+	if err := c.openItems(ctx, tableName, resultDataPointer, allItems, nil); err != nil {
+		return err
+	}
 	err := attributevalue.UnmarshalListOfMaps(allItems, resultDataPointer)
 	if err != nil {
 		return err
@@ -388,50 +451,15 @@ func (c DynamoDatabaseClient) QueryAllItems(
 	return nil
 }
 
+// QueryCount returns the number of items matching the key condition and
+// filter of expr. It is Count on a table or index.
 func (c DynamoDatabaseClient) QueryCount(
 	ctx context.Context,
 	tableName string,
 	index string,
 	expr expression.Expression) (int32, error) {
-	var count int32 = 0
-	tableUrl := c.GetTableUrl(tableName)
-	var lastEvaluatedKey map[string]types.AttributeValue
-	var limitItems int32 = 5
-	var consumedCapacity float64 = 0
-	for {
-		queryParams := dynamodb.QueryInput{
-			TableName:                 aws.String(tableUrl),
-			ExpressionAttributeNames:  expr.Names(),
-			ExpressionAttributeValues: expr.Values(),
-			KeyConditionExpression:    expr.KeyCondition(),
-			ReturnConsumedCapacity:    types.ReturnConsumedCapacityTotal,
-			Limit:                     &limitItems,
-		}
-
-		if index != "" {
-			queryParams.IndexName = aws.String(index)
-		}
-
-		if lastEvaluatedKey != nil {
-			queryParams.ExclusiveStartKey = lastEvaluatedKey
-		}
-
-		result, err := c.dynamoClient.Query(ctx, &queryParams)
-		if err != nil {
-			return 0, err
-		}
-
-		consumedCapacity += *result.ConsumedCapacity.CapacityUnits
-
-		count += result.Count
-
-		lastEvaluatedKey = result.LastEvaluatedKey
-		if lastEvaluatedKey == nil {
-			break
-		}
-	}
-
-	return count, nil
+	count, err := c.Count(ctx, tableName, expr, CountOptions{IndexName: index})
+	return int32(count), err
 }
 
 func (c DynamoDatabaseClient) QueryBatchItems(
@@ -440,33 +468,20 @@ func (c DynamoDatabaseClient) QueryBatchItems(
 	index string,
 	keys []map[string]types.AttributeValue,
 	resultDataPointer interface{}) error {
-	tableUrl := c.GetTableUrl(tableName)
-	queryParams := dynamodb.BatchGetItemInput{
-		RequestItems: map[string]types.KeysAndAttributes{
-			tableUrl: {
-				Keys: keys,
-			},
-		},
-		ReturnConsumedCapacity: types.ReturnConsumedCapacityTotal,
-	}
-
-	result, err := c.dynamoClient.BatchGetItem(ctx, &queryParams)
-	if err != nil {
-		return err
-	}
-
-	if result.Responses == nil || len(result.Responses[tableUrl]) == 0 {
-		return ErrQueryNoData
-	}
+	return c.GetBatchWithOptions(ctx, tableName, keys, resultDataPointer, BatchGetOptions{})
+}
 
-	err = attributevalue.UnmarshalListOfMaps(result.Responses[tableUrl], resultDataPointer)
+func (c DynamoDatabaseClient) QueryOne(ctx context.Context, tableName, index string, expr expression.Expression, resultDataPointer interface{}) error {
+	items, err := c.queryOneItems(ctx, tableName, index, expr, resultDataPointer)
 	if err != nil {
 		return err
 	}
-	return nil
+	return c.unmarshalItems(ctx, tableName, items, resultDataPointer)
 }
 
-func (c DynamoDatabaseClient) QueryOne(ctx context.Context, tableName, index string, expr expression.Expression, resultDataPointer interface{}) error {
+// queryOneItems returns the items read by QueryOne, before they are
+// decrypted and unmarshalled.
+func (c DynamoDatabaseClient) queryOneItems(ctx context.Context, tableName, index string, expr expression.Expression, resultDataPointer interface{}) ([]map[string]types.AttributeValue, error) {
 	limitItems := int32(1)
 	tableUrl := c.GetTableUrl(tableName)
 	queryParams := &dynamodb.QueryInput{
@@ -474,6 +489,7 @@ func (c DynamoDatabaseClient) QueryOne(ctx context.Context, tableName, index str
 		ExpressionAttributeNames:  expr.Names(),
 		ExpressionAttributeValues: expr.Values(),
 		KeyConditionExpression:    expr.KeyCondition(),
+		ProjectionExpression:      expr.Projection(),
 		Limit:                     &limitItems,
 		ReturnConsumedCapacity:    types.ReturnConsumedCapacityTotal,
 	}
@@ -481,19 +497,30 @@ func (c DynamoDatabaseClient) QueryOne(ctx context.Context, tableName, index str
 	if index != "" {
 		queryParams.IndexName = aws.String(index)
 	}
-	result, err := c.dynamoClient.Query(ctx, queryParams)
-	if err != nil {
-		return err
-	}
-	if result.Items == nil || len(result.Items) == 0 {
-		return ErrQueryNoData
+	queryParams.FilterExpression, queryParams.ExpressionAttributeNames, queryParams.ExpressionAttributeValues = expiryFilter(ctx, resultDataPointer, queryParams.FilterExpression, queryParams.ExpressionAttributeNames, queryParams.ExpressionAttributeValues)
+	// Limit caps the evaluated items, so an expired first item is filtered
+	// out of its page; the next pages are read until an item is left.
+	for {
+		result, err := c.dynamoClient.Query(ctx, queryParams)
+		if err != nil {
+			return nil, err
+		}
+		if len(result.Items) > 0 {
+			return result.Items, nil
+		}
+		if queryParams.FilterExpression == nil || len(result.LastEvaluatedKey) == 0 {
+			return nil, ErrQueryNoData
+		}
+		queryParams.ExclusiveStartKey = result.LastEvaluatedKey
 	}
+}
 
-	err = attributevalue.UnmarshalListOfMaps(result.Items, &resultDataPointer)
-	if err != nil {
+// unmarshalItems decrypts items and unmarshals them into resultDataPointer.
+func (c DynamoDatabaseClient) unmarshalItems(ctx context.Context, tableName string, items []map[string]types.AttributeValue, resultDataPointer interface{}) error {
+	if err := c.openItems(ctx, tableName, resultDataPointer, items, nil); err != nil {
 		return err
 	}
-	return nil
+	return attributevalue.UnmarshalListOfMaps(items, resultDataPointer)
 }
 
 func (c DynamoDatabaseClient) UpdateItem(
@@ -507,7 +534,6 @@ func (c DynamoDatabaseClient) UpdateItem(
 		Key:                       key,
 		UpdateExpression:          aws.String(updateExpression),
 		ExpressionAttributeValues: expressionAttributeValues,
-		ReturnValues:              types.ReturnValueAllNew,
 	}
 	if conditionExpression != "" {
 		input.ConditionExpression = aws.String(conditionExpression)
@@ -519,6 +545,23 @@ func (c DynamoDatabaseClient) UpdateItem(
 	return nil
 }
 
+func (c DynamoDatabaseClient) UpdateItemExpr(ctx context.Context, tableName string, key map[string]types.AttributeValue, expr expression.Expression) error {
+	tableUrl := c.GetTableUrl(tableName)
+	input := &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(tableUrl),
+		Key:                       key,
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	}
+	_, err := c.dynamoClient.UpdateItem(ctx, input)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (x *NoSqlTransaction) AddTransactionUpdateQuery(ctx context.Context, tableName string, key map[string]types.AttributeValue,
 	updateExpression string, expressionAttributeValues map[string]types.AttributeValue, conditionExpression string) error {
 	tableUrl := x.GetTableUrl(tableName)
@@ -538,17 +581,70 @@ func (x *NoSqlTransaction) AddTransactionUpdateQuery(ctx context.Context, tableN
 	return nil
 }
 
+// PutItem writes data, replacing any existing item with the same key. When
+// data has a field tagged dynamo:",version" the put only succeeds if the
+// stored version still matches (or the item does not exist for version 0),
+// the next version is written, and a stale version returns ErrVersionConflict.
 func (c DynamoDatabaseClient) PutItem(ctx context.Context, tableName string, data interface{}) error {
+	_, err := c.putItem(ctx, tableName, data, expression.ConditionBuilder{}, nil)
+	return err
+}
+
+// putItem writes data guarded by condition and by its version, if any.
+// configure, when set, adjusts the input before it is sent.
+func (c DynamoDatabaseClient) putItem(ctx context.Context, tableName string, data interface{}, condition expression.ConditionBuilder, configure func(*dynamodb.PutItemInput)) (*dynamodb.PutItemOutput, error) {
 	tableUrl := c.GetTableUrl(tableName)
 	av, err := attributevalue.MarshalMap(data)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	applyItemTTL(data, av)
+	if err := c.sealItem(ctx, tableName, data, av); err != nil {
+		return nil, err
+	}
+	version, err := getItemVersion(data)
+	if err != nil {
+		return nil, err
 	}
 	input := &dynamodb.PutItemInput{
 		Item:      av,
 		TableName: aws.String(tableUrl),
 	}
-	_, err = c.dynamoClient.PutItem(ctx, input)
+	if condition.IsSet() {
+		expr, err := expression.NewBuilder().WithCondition(condition).Build()
+		if err != nil {
+			return nil, err
+		}
+		input.ConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues = expr.Condition(), expr.Names(), expr.Values()
+	}
+	if version != nil {
+		version.apply(av)
+		input.ConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues = version.mergeCondition(input.ConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	}
+	if configure != nil {
+		configure(input)
+	}
+	result, err := c.dynamoClient.PutItem(ctx, input)
+	if err != nil {
+		err = c.conditionFailedError(ctx, err, tableName, itemKey(data, av))
+		if version != nil {
+			return nil, version.conflictError(err, tableUrl)
+		}
+		return nil, err
+	}
+	if version != nil {
+		version.commit()
+	}
+	return result, nil
+}
+
+func (c DynamoDatabaseClient) DeleteItem(ctx context.Context, tableName string, key map[string]types.AttributeValue) error {
+	tableUrl := c.GetTableUrl(tableName)
+	input := &dynamodb.DeleteItemInput{
+		TableName: aws.String(tableUrl),
+		Key:       key,
+	}
+	_, err := c.dynamoClient.DeleteItem(ctx, input)
 	if err != nil {
 		return err
 	}
@@ -558,6 +654,12 @@ func (c DynamoDatabaseClient) PutItem(ctx context.Context, tableName string, dat
 type NoSqlTransaction struct {
 	items       []types.TransactWriteItem
 	dbEnvPrefix string
+	versions    map[int]*itemVersion
+	guards      map[int]uniqueGuard
+	encryption  EncryptionKeyProvider
+	seals       []pendingSeal
+
+	clientRequestToken string
 }
 
 func (c NoSqlTransaction) GetTableUrl(tableName string) string {
@@ -571,6 +673,7 @@ func CreateNoSqlTransaction(dynamoClient *DynamoDatabaseClient) *NoSqlTransactio
 	return &NoSqlTransaction{
 		items:       []types.TransactWriteItem{},
 		dbEnvPrefix: dynamoClient.dbEnvPrefix,
+		encryption:  dynamoClient.encryption,
 	}
 }
 
@@ -584,12 +687,25 @@ func (x *NoSqlTransaction) AddTransactionPut(tableName string, data interface{})
 	if err != nil {
 		return err
 	}
+	applyItemTTL(data, dataRaw)
+	if err := x.addSeal(tableName, data, dataRaw); err != nil {
+		return err
+	}
+	version, err := getItemVersion(data)
+	if err != nil {
+		return err
+	}
 	putTx := types.TransactWriteItem{
 		Put: &types.Put{
 			TableName: aws.String(tableUrl),
 			Item:      dataRaw,
 		},
 	}
+	if version != nil {
+		version.apply(dataRaw)
+		putTx.Put.ConditionExpression, putTx.Put.ExpressionAttributeNames, putTx.Put.ExpressionAttributeValues = version.mergeCondition(nil, nil, nil)
+		x.addVersion(version)
+	}
 	x.items = append(x.items, putTx)
 	return nil
 }
@@ -600,13 +716,28 @@ func (x *NoSqlTransaction) AddTransactionPutExpr(tableName string, data interfac
 	if err != nil {
 		return err
 	}
+	applyItemTTL(data, dataRaw)
+	if err := x.addSeal(tableName, data, dataRaw); err != nil {
+		return err
+	}
+	version, err := getItemVersion(data)
+	if err != nil {
+		return err
+	}
 	putTx := types.TransactWriteItem{
 		Put: &types.Put{
-			TableName:           aws.String(tableUrl),
-			Item:                dataRaw,
-			ConditionExpression: expr.Condition(),
+			TableName:                 aws.String(tableUrl),
+			Item:                      dataRaw,
+			ConditionExpression:       expr.Condition(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
 		},
 	}
+	if version != nil {
+		version.apply(dataRaw)
+		putTx.Put.ConditionExpression, putTx.Put.ExpressionAttributeNames, putTx.Put.ExpressionAttributeValues = version.mergeCondition(expr.Condition(), expr.Names(), expr.Values())
+		x.addVersion(version)
+	}
 	x.items = append(x.items, putTx)
 	return nil
 }
@@ -622,20 +753,36 @@ func (x *NoSqlTransaction) AddTransactionDelete(tableName string, key map[string
 	return nil
 }
 
+// SetClientRequestToken makes the transaction idempotent: DynamoDB applies
+// it at most once for every call made with the same token within ten minutes.
+func (x *NoSqlTransaction) SetClientRequestToken(token string) {
+	x.clientRequestToken = token
+}
+
 func (x *NoSqlTransaction) BuildTransaction() *dynamodb.TransactWriteItemsInput {
-	return &dynamodb.TransactWriteItemsInput{
-		TransactItems: x.items,
+	input := &dynamodb.TransactWriteItemsInput{
+		TransactItems:          x.items,
+		ReturnConsumedCapacity: types.ReturnConsumedCapacityTotal,
+	}
+	if x.clientRequestToken != "" {
+		input.ClientRequestToken = aws.String(x.clientRequestToken)
 	}
+	return input
 }
 
+// ExecuteTransaction applies the writes of params atomically. When DynamoDB
+// cancels the transaction the returned *TransactionCanceledError tells which
+// items failed and why. With a retry policy, transactions canceled only by
+// conflicts or throttling are retried.
 func (c DynamoDatabaseClient) ExecuteTransaction(ctx context.Context, params *NoSqlTransaction) error {
-	response, err := c.dynamoClient.TransactWriteItems(ctx, params.BuildTransaction())
-	if err != nil {
+	if err := params.sealItems(ctx); err != nil {
 		return err
 	}
-	fmt.Println("-----------------------")
-	fmt.Println(response)
-	fmt.Println("-----------------------")
+	_, err := c.dynamoClient.TransactWriteItems(ctx, params.BuildTransaction())
+	if err != nil {
+		return params.canceledError(err)
+	}
+	params.commitVersions()
 	return nil
 }
 
@@ -662,49 +809,16 @@ type SelectCountParams struct {
 	FilterExpression expression.ConditionBuilder // Optional, use expression.ConditionBuilder{} if no filter is needed
 }
 
-// selectCount performs a count operation on a DynamoDB table or index
+// SelectCount counts the items of a table or index that pass the filter of
+// params with a scan. See Count for queries and parallel segments.
 func (c DynamoDatabaseClient) SelectCount(ctx context.Context, params SelectCountParams) (int64, error) {
-	var count int64
-	var lastEvaluatedKey map[string]types.AttributeValue
-
-	for {
-		builder := expression.NewBuilder()
-
-		if !params.FilterExpression.IsSet() {
-			builder = builder.WithFilter(params.FilterExpression)
-		}
-
-		expr, err := builder.Build()
+	var expr expression.Expression
+	if params.FilterExpression.IsSet() {
+		var err error
+		expr, err = expression.NewBuilder().WithFilter(params.FilterExpression).Build()
 		if err != nil {
 			return 0, fmt.Errorf("failed to build expression: %w", err)
 		}
-
-		input := &dynamodb.ScanInput{
-			TableName:                 aws.String(params.TableName),
-			IndexName:                 params.IndexName,
-			Select:                    types.SelectCount,
-			ConsistentRead:            aws.Bool(false),
-			ExpressionAttributeNames:  expr.Names(),
-			ExpressionAttributeValues: expr.Values(),
-			FilterExpression:          expr.Filter(),
-		}
-
-		if lastEvaluatedKey != nil {
-			input.ExclusiveStartKey = lastEvaluatedKey
-		}
-
-		result, err := c.dynamoClient.Scan(ctx, input)
-		if err != nil {
-			return 0, fmt.Errorf("failed to scan DynamoDB table: %w", err)
-		}
-
-		count += int64(result.Count)
-
-		lastEvaluatedKey = result.LastEvaluatedKey
-		if lastEvaluatedKey == nil {
-			break
-		}
 	}
-
-	return count, nil
+	return c.Count(ctx, params.TableName, expr, CountOptions{IndexName: aws.ToString(params.IndexName)})
 }
@@ -0,0 +1,451 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var ErrInvalidEntityKey = errors.New("ErrInvalidEntityKey")
+var ErrUnknownEntityType = errors.New("ErrUnknownEntityType")
+
+// KeyValues holds the values of the placeholders of a key pattern, by name.
+type KeyValues map[string]string
+
+// SingleTableSchema describes a table shared by several entity types, where
+// keys are composite strings such as ORG#123 / USER#abc. Entity types are
+// registered once with their key patterns and the schema then builds and
+// parses keys and decodes items into the right Go type using the type
+// discriminator attribute.
+//
+//	schema := CreateSingleTableSchema(TableKeySchema{PartitionKey: "PK", SortKey: "SK"}, "#", "entityType")
+//	schema.AddIndex("GSI1", TableKeySchema{PartitionKey: "GSI1PK", SortKey: "GSI1SK"})
+//	users, err := schema.RegisterEntity(EntityDefinition{
+//		Name:    "User",
+//		Item:    User{},
+//		Keys:    EntityKeys{PartitionKey: "ORG#{orgId}", SortKey: "USER#{userId}"},
+//		Indexes: map[string]EntityKeys{"GSI1": {PartitionKey: "EMAIL#{email}", SortKey: "USER#{userId}"}},
+//	})
+type SingleTableSchema struct {
+	keys          TableKeySchema
+	separator     string
+	typeAttribute string
+	indexes       map[string]TableKeySchema
+	entities      map[string]*EntityType
+}
+
+// CreateSingleTableSchema declares the key attributes of the table, the
+// separator between key segments and the attribute holding the entity type.
+func CreateSingleTableSchema(keys TableKeySchema, separator, typeAttribute string) *SingleTableSchema {
+	return &SingleTableSchema{
+		keys:          keys,
+		separator:     separator,
+		typeAttribute: typeAttribute,
+		indexes:       make(map[string]TableKeySchema),
+		entities:      make(map[string]*EntityType),
+	}
+}
+
+// AddIndex declares an overloaded secondary index shared by entity types.
+func (s *SingleTableSchema) AddIndex(indexName string, keys TableKeySchema) *SingleTableSchema {
+	s.indexes[indexName] = keys
+	return s
+}
+
+// EntityKeys holds the key patterns of an entity type. Segments are joined by
+// the schema separator and a segment written as {name} is replaced by the
+// value of the attribute name of the item.
+type EntityKeys struct {
+	PartitionKey string
+	SortKey      string
+}
+
+// EntityDefinition declares an entity type. Item is a value of the Go type
+// items of this entity are decoded into.
+type EntityDefinition struct {
+	Name    string
+	Item    interface{}
+	Keys    EntityKeys
+	Indexes map[string]EntityKeys
+}
+
+// EntityType builds the keys and items of one registered entity type.
+type EntityType struct {
+	schema   *SingleTableSchema
+	name     string
+	itemType reflect.Type
+	patterns map[string]EntityKeyPatterns
+}
+
+// EntityKeyPatterns are the parsed key patterns of an entity on the table or
+// on one index. SortKey is nil when the table or index has no sort key.
+type EntityKeyPatterns struct {
+	PartitionKey *KeyPattern
+	SortKey      *KeyPattern
+}
+
+// RegisterEntity validates and registers an entity type.
+func (s *SingleTableSchema) RegisterEntity(definition EntityDefinition) (*EntityType, error) {
+	if definition.Name == "" {
+		return nil, errors.New("dynamo: entity name is required")
+	}
+	if _, exists := s.entities[definition.Name]; exists {
+		return nil, fmt.Errorf("dynamo: entity %s is already registered", definition.Name)
+	}
+	itemType := reflect.TypeOf(definition.Item)
+	if itemType == nil {
+		return nil, fmt.Errorf("dynamo: entity %s has no item type", definition.Name)
+	}
+	for itemType.Kind() == reflect.Ptr {
+		itemType = itemType.Elem()
+	}
+
+	entity := &EntityType{
+		schema:   s,
+		name:     definition.Name,
+		itemType: itemType,
+		patterns: make(map[string]EntityKeyPatterns),
+	}
+	patterns, err := s.parseEntityKeys(s.keys, definition.Keys)
+	if err != nil {
+		return nil, fmt.Errorf("dynamo: entity %s: %w", definition.Name, err)
+	}
+	entity.patterns[""] = patterns
+	for indexName, keys := range definition.Indexes {
+		indexKeys, ok := s.indexes[indexName]
+		if !ok {
+			return nil, fmt.Errorf("dynamo: entity %s uses undeclared index %s", definition.Name, indexName)
+		}
+		patterns, err := s.parseEntityKeys(indexKeys, keys)
+		if err != nil {
+			return nil, fmt.Errorf("dynamo: entity %s index %s: %w", definition.Name, indexName, err)
+		}
+		entity.patterns[indexName] = patterns
+	}
+	s.entities[definition.Name] = entity
+	return entity, nil
+}
+
+func (s *SingleTableSchema) parseEntityKeys(attributes TableKeySchema, keys EntityKeys) (EntityKeyPatterns, error) {
+	var patterns EntityKeyPatterns
+	var err error
+	if patterns.PartitionKey, err = parseKeyPattern(attributes.PartitionKey, keys.PartitionKey, s.separator); err != nil {
+		return patterns, err
+	}
+	if attributes.SortKey == "" {
+		if keys.SortKey != "" {
+			return patterns, errors.New("sort key pattern given for a key without sort key")
+		}
+		return patterns, nil
+	}
+	patterns.SortKey, err = parseKeyPattern(attributes.SortKey, keys.SortKey, s.separator)
+	return patterns, err
+}
+
+// Entity returns a registered entity type by name.
+func (s *SingleTableSchema) Entity(name string) (*EntityType, error) {
+	entity, ok := s.entities[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEntityType, name)
+	}
+	return entity, nil
+}
+
+// EntityOf returns the entity type of a stored item.
+func (s *SingleTableSchema) EntityOf(item map[string]types.AttributeValue) (*EntityType, error) {
+	discriminator, ok := item[s.typeAttribute].(*types.AttributeValueMemberS)
+	if !ok {
+		return nil, fmt.Errorf("%w: item has no %s attribute", ErrUnknownEntityType, s.typeAttribute)
+	}
+	return s.Entity(discriminator.Value)
+}
+
+// Unmarshal decodes a stored item into a new value of the Go type registered
+// for its entity type.
+func (s *SingleTableSchema) Unmarshal(item map[string]types.AttributeValue) (interface{}, error) {
+	entity, err := s.EntityOf(item)
+	if err != nil {
+		return nil, err
+	}
+	value := reflect.New(entity.itemType)
+	if err := attributevalue.UnmarshalMap(item, value.Interface()); err != nil {
+		return nil, err
+	}
+	return value.Elem().Interface(), nil
+}
+
+// UnmarshalItems decodes query results of mixed entity types, keeping their
+// order. Use a type switch on the returned values to dispatch them.
+func (s *SingleTableSchema) UnmarshalItems(items []RawItem) ([]interface{}, error) {
+	results := make([]interface{}, len(items))
+	for i, item := range items {
+		result, err := s.Unmarshal(item)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = result
+	}
+	return results, nil
+}
+
+// RawItem keeps an item exactly as stored, so query results can be read with
+// the client and decoded later with SingleTableSchema.UnmarshalItems.
+type RawItem map[string]types.AttributeValue
+
+func (r *RawItem) UnmarshalDynamoDBAttributeValue(av types.AttributeValue) error {
+	m, ok := av.(*types.AttributeValueMemberM)
+	if !ok {
+		return fmt.Errorf("dynamo: expected a map attribute, got %T", av)
+	}
+	*r = m.Value
+	return nil
+}
+
+// Name returns the type discriminator of the entity.
+func (e *EntityType) Name() string {
+	return e.name
+}
+
+// KeyPatterns returns the key patterns of the entity on the table, or on
+// indexName when it is not empty.
+func (e *EntityType) KeyPatterns(indexName string) (EntityKeyPatterns, error) {
+	patterns, ok := e.patterns[indexName]
+	if !ok {
+		return patterns, fmt.Errorf("dynamo: entity %s is not projected on index %s", e.name, indexName)
+	}
+	return patterns, nil
+}
+
+// Key builds the primary key of an entity, e.g. for DynamoDatabaseClient.Get.
+func (e *EntityType) Key(values KeyValues) (map[string]types.AttributeValue, error) {
+	patterns := e.patterns[""]
+	key := make(map[string]types.AttributeValue, 2)
+	pk, err := patterns.PartitionKey.Build(values)
+	if err != nil {
+		return nil, err
+	}
+	key[patterns.PartitionKey.attribute] = &types.AttributeValueMemberS{Value: pk}
+	if patterns.SortKey != nil {
+		sk, err := patterns.SortKey.Build(values)
+		if err != nil {
+			return nil, err
+		}
+		key[patterns.SortKey.attribute] = &types.AttributeValueMemberS{Value: sk}
+	}
+	return key, nil
+}
+
+// KeyCondition builds the key condition selecting this entity on the table or
+// on indexName. The partition key must be complete; the sort key matches
+// exactly when all its values are given and by prefix otherwise, so leaving
+// them out lists every item of the entity in the partition. A sort key that
+// starts with a placeholder needs its value, as its prefix would be empty.
+func (e *EntityType) KeyCondition(indexName string, values KeyValues) (expression.KeyConditionBuilder, error) {
+	patterns, err := e.KeyPatterns(indexName)
+	if err != nil {
+		return expression.KeyConditionBuilder{}, err
+	}
+	pk, err := patterns.PartitionKey.Build(values)
+	if err != nil {
+		return expression.KeyConditionBuilder{}, err
+	}
+	condition := expression.Key(patterns.PartitionKey.attribute).Equal(expression.Value(pk))
+	if patterns.SortKey == nil {
+		return condition, nil
+	}
+	if sk, err := patterns.SortKey.Build(values); err == nil {
+		return condition.And(expression.Key(patterns.SortKey.attribute).Equal(expression.Value(sk))), nil
+	}
+	prefix := patterns.SortKey.Prefix(values)
+	if prefix == "" {
+		return expression.KeyConditionBuilder{}, fmt.Errorf("%w: the %s pattern needs a value for its first placeholder", ErrInvalidEntityKey, patterns.SortKey.attribute)
+	}
+	return condition.And(expression.Key(patterns.SortKey.attribute).BeginsWith(prefix)), nil
+}
+
+// Item marshals item and adds the table and index keys of the entity and its
+// type discriminator. The result can be passed to PutItem, PutBatch or
+// AddTransactionPut, which apply the version, ttl and encrypted fields of
+// item as if it was written directly. Pass versioned items by pointer, so
+// their version advances.
+func (e *EntityType) Item(item interface{}) (*EntityItem, error) {
+	itemType := reflect.TypeOf(item)
+	for itemType != nil && itemType.Kind() == reflect.Ptr {
+		itemType = itemType.Elem()
+	}
+	if itemType != e.itemType {
+		return nil, fmt.Errorf("dynamo: entity %s stores %s, got %T", e.name, e.itemType, item)
+	}
+	av, err := attributevalue.MarshalMap(item)
+	if err != nil {
+		return nil, err
+	}
+	values := make(KeyValues, len(av))
+	for name, value := range av {
+		switch v := value.(type) {
+		case *types.AttributeValueMemberS:
+			values[name] = v.Value
+		case *types.AttributeValueMemberN:
+			values[name] = v.Value
+		}
+	}
+	indexNames := make([]string, 0, len(e.patterns))
+	for indexName := range e.patterns {
+		indexNames = append(indexNames, indexName)
+	}
+	sort.Strings(indexNames)
+	for _, indexName := range indexNames {
+		patterns := e.patterns[indexName]
+		for _, pattern := range []*KeyPattern{patterns.PartitionKey, patterns.SortKey} {
+			if pattern == nil {
+				continue
+			}
+			value, err := pattern.Build(values)
+			if err != nil {
+				return nil, err
+			}
+			av[pattern.attribute] = &types.AttributeValueMemberS{Value: value}
+		}
+	}
+	av[e.schema.typeAttribute] = &types.AttributeValueMemberS{Value: e.name}
+	return &EntityItem{item: av, source: item}, nil
+}
+
+// EntityItem is an item with its entity keys, ready to be written.
+type EntityItem struct {
+	item map[string]types.AttributeValue
+	// source is the struct the item was built from, whose tags apply when
+	// it is written.
+	source interface{}
+}
+
+// entityItemSource returns the struct behind data when it is an
+// *EntityItem, or data itself.
+func entityItemSource(data interface{}) interface{} {
+	if item, ok := data.(*EntityItem); ok {
+		return item.source
+	}
+	return data
+}
+
+func (i *EntityItem) MarshalDynamoDBAttributeValue() (types.AttributeValue, error) {
+	return &types.AttributeValueMemberM{Value: maps.Clone(i.item)}, nil
+}
+
+// Attributes returns the attributes that will be written.
+func (i *EntityItem) Attributes() map[string]types.AttributeValue {
+	return i.item
+}
+
+type keySegment struct {
+	literal     string
+	placeholder string
+}
+
+// KeyPattern builds and parses the composite value of one key attribute.
+type KeyPattern struct {
+	attribute string
+	separator string
+	segments  []keySegment
+}
+
+func parseKeyPattern(attribute, pattern, separator string) (*KeyPattern, error) {
+	if attribute == "" {
+		return nil, errors.New("key attribute name is required")
+	}
+	if pattern == "" {
+		return nil, fmt.Errorf("key pattern for %s is required", attribute)
+	}
+	parsed := &KeyPattern{attribute: attribute, separator: separator}
+	parts := []string{pattern}
+	if separator != "" {
+		parts = strings.Split(pattern, separator)
+	}
+	for _, part := range parts {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") && len(part) > 2 {
+			parsed.segments = append(parsed.segments, keySegment{placeholder: part[1 : len(part)-1]})
+			continue
+		}
+		if strings.ContainsAny(part, "{}") {
+			return nil, fmt.Errorf("key pattern %q: a placeholder must be a whole segment", pattern)
+		}
+		parsed.segments = append(parsed.segments, keySegment{literal: part})
+	}
+	return parsed, nil
+}
+
+// Attribute returns the name of the key attribute.
+func (p *KeyPattern) Attribute() string {
+	return p.attribute
+}
+
+// Build returns the key value for values. Every placeholder needs a non-empty
+// value without the separator.
+func (p *KeyPattern) Build(values KeyValues) (string, error) {
+	parts := make([]string, len(p.segments))
+	for i, segment := range p.segments {
+		if segment.placeholder == "" {
+			parts[i] = segment.literal
+			continue
+		}
+		value, ok := values[segment.placeholder]
+		if !ok || value == "" {
+			return "", fmt.Errorf("%w: %s needs a value for %s", ErrInvalidEntityKey, p.attribute, segment.placeholder)
+		}
+		if p.separator != "" && strings.Contains(value, p.separator) {
+			return "", fmt.Errorf("%w: value of %s contains the separator %q", ErrInvalidEntityKey, segment.placeholder, p.separator)
+		}
+		parts[i] = value
+	}
+	return strings.Join(parts, p.separator), nil
+}
+
+// Prefix returns the key value up to the first placeholder without a value,
+// for begins_with conditions. USER#{userId} gives "USER#" without values.
+func (p *KeyPattern) Prefix(values KeyValues) string {
+	var sb strings.Builder
+	for _, segment := range p.segments {
+		value := segment.literal
+		if segment.placeholder != "" {
+			value = values[segment.placeholder]
+			if value == "" {
+				break
+			}
+		}
+		sb.WriteString(value)
+		sb.WriteString(p.separator)
+	}
+	return sb.String()
+}
+
+// Parse extracts the placeholder values of a key value built by this pattern.
+func (p *KeyPattern) Parse(value string) (KeyValues, error) {
+	parts := []string{value}
+	if p.separator != "" {
+		parts = strings.Split(value, p.separator)
+	}
+	if len(parts) != len(p.segments) {
+		return nil, fmt.Errorf("%w: %q does not match the %s pattern", ErrInvalidEntityKey, value, p.attribute)
+	}
+	values := make(KeyValues)
+	for i, segment := range p.segments {
+		if segment.placeholder == "" {
+			if parts[i] != segment.literal {
+				return nil, fmt.Errorf("%w: %q does not match the %s pattern", ErrInvalidEntityKey, value, p.attribute)
+			}
+			continue
+		}
+		if parts[i] == "" {
+			return nil, fmt.Errorf("%w: %q has an empty %s", ErrInvalidEntityKey, value, segment.placeholder)
+		}
+		values[segment.placeholder] = parts[i]
+	}
+	return values, nil
+}
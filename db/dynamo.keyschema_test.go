@@ -0,0 +1,351 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	paginate "github.com/techvuya/vuya-go-utils/paginate"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type testAppUser struct {
+	OrgID  string `dynamodbav:"orgId"`
+	UserID string `dynamodbav:"userId"`
+	Email  string `dynamodbav:"email"`
+}
+
+type testAppTeam struct {
+	OrgID  string `dynamodbav:"orgId"`
+	TeamID string `dynamodbav:"teamId"`
+	Name   string `dynamodbav:"name"`
+}
+
+func createTestSingleTable(t *testing.T) (*DynamoDatabaseClient, *SingleTableSchema, *EntityType, *EntityType) {
+	t.Helper()
+	memoryClient := CreateMemoryDynamoClient()
+	_, err := memoryClient.CreateTable(context.Background(), &dynamodb.CreateTableInput{
+		TableName: aws.String("test.app"),
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String("PK"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("SK"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("GSI1PK"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("GSI1SK"), AttributeType: types.ScalarAttributeTypeS},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("PK"), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String("SK"), KeyType: types.KeyTypeRange},
+		},
+		GlobalSecondaryIndexes: []types.GlobalSecondaryIndex{
+			{
+				IndexName: aws.String("GSI1"),
+				KeySchema: []types.KeySchemaElement{
+					{AttributeName: aws.String("GSI1PK"), KeyType: types.KeyTypeHash},
+					{AttributeName: aws.String("GSI1SK"), KeyType: types.KeyTypeRange},
+				},
+				Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateTable failed: %v", err)
+	}
+
+	schema := CreateSingleTableSchema(TableKeySchema{PartitionKey: "PK", SortKey: "SK"}, "#", "entityType").
+		AddIndex("GSI1", TableKeySchema{PartitionKey: "GSI1PK", SortKey: "GSI1SK"})
+	users, err := schema.RegisterEntity(EntityDefinition{
+		Name:    "User",
+		Item:    testAppUser{},
+		Keys:    EntityKeys{PartitionKey: "ORG#{orgId}", SortKey: "USER#{userId}"},
+		Indexes: map[string]EntityKeys{"GSI1": {PartitionKey: "EMAIL#{email}", SortKey: "USER#{userId}"}},
+	})
+	if err != nil {
+		t.Fatalf("RegisterEntity failed: %v", err)
+	}
+	teams, err := schema.RegisterEntity(EntityDefinition{
+		Name: "Team",
+		Item: testAppTeam{},
+		Keys: EntityKeys{PartitionKey: "ORG#{orgId}", SortKey: "TEAM#{teamId}"},
+	})
+	if err != nil {
+		t.Fatalf("RegisterEntity failed: %v", err)
+	}
+	return CreateDynamoDatabaseClientWithApi(memoryClient, "test"), schema, users, teams
+}
+
+func TestSingleTableSchemaKeys(t *testing.T) {
+	_, _, users, _ := createTestSingleTable(t)
+	patterns, _ := users.KeyPatterns("")
+
+	testCases := []struct {
+		description string
+		value       string
+		expected    KeyValues
+		valid       bool
+	}{
+		{"Valid sort key", "USER#abc", KeyValues{"userId": "abc"}, true},
+		{"Other prefix", "TEAM#abc", nil, false},
+		{"Extra segment", "USER#abc#x", nil, false},
+		{"Empty value", "USER#", nil, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			values, err := patterns.SortKey.Parse(tc.value)
+			if tc.valid != (err == nil) || (tc.valid && values["userId"] != tc.expected["userId"]) {
+				t.Errorf("Parse(%q) -> Expected: %v // Returned: %v, %v", tc.value, tc.expected, values, err)
+			}
+			if !tc.valid && !errors.Is(err, ErrInvalidEntityKey) {
+				t.Errorf("Parse(%q) -> Expected: ErrInvalidEntityKey // Returned: %v", tc.value, err)
+			}
+		})
+	}
+
+	if _, err := users.Key(KeyValues{"orgId": "1#2", "userId": "abc"}); !errors.Is(err, ErrInvalidEntityKey) {
+		t.Errorf("Key with separator in value -> Expected: ErrInvalidEntityKey // Returned: %v", err)
+	}
+	if prefix := patterns.SortKey.Prefix(nil); prefix != "USER#" {
+		t.Errorf("Prefix -> Expected: USER# // Returned: %s", prefix)
+	}
+
+	schema := CreateSingleTableSchema(TableKeySchema{PartitionKey: "PK", SortKey: "SK"}, "#", "entityType")
+	members, err := schema.RegisterEntity(EntityDefinition{
+		Name: "Member",
+		Item: testAppUser{},
+		Keys: EntityKeys{PartitionKey: "ORG#{orgId}", SortKey: "{userId}#USER"},
+	})
+	if err != nil {
+		t.Fatalf("RegisterEntity failed: %v", err)
+	}
+	if _, err := members.KeyCondition("", KeyValues{"orgId": "1"}); !errors.Is(err, ErrInvalidEntityKey) {
+		t.Errorf("KeyCondition with empty sort key prefix -> Expected: ErrInvalidEntityKey // Returned: %v", err)
+	}
+	if _, err := members.KeyCondition("", KeyValues{"orgId": "1", "userId": "abc"}); err != nil {
+		t.Errorf("KeyCondition with full sort key -> Expected: <nil> // Returned: %v", err)
+	}
+}
+
+func TestSingleTableSchemaDispatch(t *testing.T) {
+	client, schema, users, teams := createTestSingleTable(t)
+	ctx := context.Background()
+	writes := []struct {
+		entity *EntityType
+		item   interface{}
+	}{
+		{users, testAppUser{OrgID: "1", UserID: "abc", Email: "ana@example.com"}},
+		{users, testAppUser{OrgID: "1", UserID: "def", Email: "bob@example.com"}},
+		{teams, testAppTeam{OrgID: "1", TeamID: "core", Name: "Core"}},
+	}
+	for _, write := range writes {
+		item, err := write.entity.Item(write.item)
+		if err != nil {
+			t.Fatalf("Item failed: %v", err)
+		}
+		if err := client.PutItem(ctx, "app", item); err != nil {
+			t.Fatalf("PutItem failed: %v", err)
+		}
+	}
+
+	key, _ := users.Key(KeyValues{"orgId": "1", "userId": "abc"})
+	var user testAppUser
+	if err := client.Get(ctx, "app", key, &user); err != nil || user.Email != "ana@example.com" {
+		t.Errorf("Get user -> Expected: ana@example.com // Returned: %+v, %v", user, err)
+	}
+
+	partition := expression.Key("PK").Equal(expression.Value("ORG#1"))
+	expr, _ := expression.NewBuilder().WithKeyCondition(partition).Build()
+	var items []RawItem
+	if _, err := client.QueryPage(ctx, "app", "", expr, nil, &items, paginate.AgPaginateOptionsRequest{Order: "ASC"}); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	results, err := schema.UnmarshalItems(items)
+	if err != nil {
+		t.Fatalf("UnmarshalItems failed: %v", err)
+	}
+	userCount, teamCount := 0, 0
+	for _, result := range results {
+		switch entity := result.(type) {
+		case testAppUser:
+			userCount++
+		case testAppTeam:
+			teamCount++
+			if entity.Name != "Core" {
+				t.Errorf("Team -> Expected: Core // Returned: %+v", entity)
+			}
+		default:
+			t.Errorf("UnmarshalItems returned unexpected %T", result)
+		}
+	}
+	if userCount != 2 || teamCount != 1 {
+		t.Errorf("UnmarshalItems -> Expected: 2 users and 1 team // Returned: %d users and %d teams", userCount, teamCount)
+	}
+
+	testCases := []struct {
+		description string
+		index       string
+		values      KeyValues
+		expected    int
+	}{
+		{"Users of org", "", KeyValues{"orgId": "1"}, 2},
+		{"One user of org", "", KeyValues{"orgId": "1", "userId": "def"}, 1},
+		{"User by email on overloaded index", "GSI1", KeyValues{"email": "ana@example.com"}, 1},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			condition, err := users.KeyCondition(tc.index, tc.values)
+			if err != nil {
+				t.Fatalf("KeyCondition failed: %v", err)
+			}
+			expr, _ := expression.NewBuilder().WithKeyCondition(condition).Build()
+			var found []testAppUser
+			if _, err := client.QueryPage(ctx, "app", tc.index, expr, nil, &found, paginate.AgPaginateOptionsRequest{}); err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+			if len(found) != tc.expected {
+				t.Errorf("Query -> Expected: %d // Returned: %+v", tc.expected, found)
+			}
+		})
+	}
+
+	if _, err := schema.Unmarshal(map[string]types.AttributeValue{"entityType": &types.AttributeValueMemberS{Value: "Invoice"}}); !errors.Is(err, ErrUnknownEntityType) {
+		t.Errorf("Unmarshal unknown type -> Expected: ErrUnknownEntityType // Returned: %v", err)
+	}
+}
+
+type testAppProfile struct {
+	OrgID  string `dynamodbav:"orgId" dynamo:",pk"`
+	UserID string `dynamodbav:"userId" dynamo:",sk"`
+	Email  string `dynamodbav:"email" encrypt:"tenant"`
+}
+
+func TestEntityItemWrites(t *testing.T) {
+	ctx := context.Background()
+	client, schema, _, _ := createTestSingleTable(t)
+	client.SetEncryptionKeyProvider(&testKeyProvider{})
+	profiles, err := schema.RegisterEntity(EntityDefinition{
+		Name: "Profile",
+		Item: testAppProfile{},
+		Keys: EntityKeys{PartitionKey: "ORG#{orgId}", SortKey: "PROFILE#{userId}"},
+	})
+	if err != nil {
+		t.Fatalf("RegisterEntity failed: %v", err)
+	}
+
+	testCases := []struct {
+		description string
+		write       func(item *EntityItem) error
+	}{
+		{"PutItem", func(item *EntityItem) error {
+			return client.PutItem(ctx, "app", item)
+		}},
+		{"PutBatch", func(item *EntityItem) error {
+			return client.PutBatch(ctx, "app", []interface{}{item})
+		}},
+		{"AddTransactionPut", func(item *EntityItem) error {
+			transaction := CreateNoSqlTransaction(client)
+			if err := transaction.AddTransactionPut("app", item); err != nil {
+				return err
+			}
+			return client.ExecuteTransaction(ctx, transaction)
+		}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			profile := testAppProfile{OrgID: "1", UserID: tc.description, Email: "ana@example.com"}
+			item, err := profiles.Item(profile)
+			if err != nil {
+				t.Fatalf("Item failed: %v", err)
+			}
+			if err := tc.write(item); err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+			key, _ := profiles.Key(KeyValues{"orgId": "1", "userId": tc.description})
+			raw, err := client.GetApiClient().GetItem(ctx, &dynamodb.GetItemInput{TableName: aws.String("test.app"), Key: key})
+			if err != nil || raw.Item == nil {
+				t.Fatalf("GetItem failed: %v", err)
+			}
+			if _, sealed := raw.Item["email"].(*types.AttributeValueMemberB); !sealed {
+				t.Errorf("Stored email -> Expected: ciphertext // Returned: %#v", raw.Item["email"])
+			}
+			var stored testAppProfile
+			if err := client.Get(ctx, "app", key, &stored); err != nil || stored != profile {
+				t.Errorf("Get -> Expected: %+v // Returned: %+v %v", profile, stored, err)
+			}
+		})
+	}
+}
+
+type testAppSession struct {
+	OrgID     string `dynamodbav:"orgId" dynamo:",pk"`
+	SessionID string `dynamodbav:"sessionId" dynamo:",sk"`
+	Revision  int64  `dynamodbav:"rev" dynamo:",version"`
+	ExpiresAt int64  `dynamodbav:"exp" dynamo:",ttl=1h"`
+}
+
+func TestEntityItemVersionAndTTL(t *testing.T) {
+	ctx := context.Background()
+	client, schema, _, _ := createTestSingleTable(t)
+	sessions, err := schema.RegisterEntity(EntityDefinition{
+		Name: "Session",
+		Item: testAppSession{},
+		Keys: EntityKeys{PartitionKey: "ORG#{orgId}", SortKey: "SESSION#{sessionId}"},
+	})
+	if err != nil {
+		t.Fatalf("RegisterEntity failed: %v", err)
+	}
+
+	session := testAppSession{OrgID: "1", SessionID: "s-1"}
+	item, err := sessions.Item(&session)
+	if err != nil {
+		t.Fatalf("Item failed: %v", err)
+	}
+	if err := client.PutItem(ctx, "app", item); err != nil {
+		t.Fatalf("PutItem failed: %v", err)
+	}
+	if session.Revision != 1 {
+		t.Errorf("Revision after create -> Expected: 1 // Returned: %d", session.Revision)
+	}
+	key, _ := sessions.Key(KeyValues{"orgId": "1", "sessionId": "s-1"})
+	var stored testAppSession
+	if err := client.Get(ctx, "app", key, &stored); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if stored.Revision != 1 || stored.ExpiresAt <= time.Now().Unix() {
+		t.Errorf("Stored session -> Expected: revision 1 and a future expiry // Returned: %+v", stored)
+	}
+
+	stale, err := sessions.Item(testAppSession{OrgID: "1", SessionID: "s-1"})
+	if err != nil {
+		t.Fatalf("Item failed: %v", err)
+	}
+	testCases := []struct {
+		description string
+		write       func() error
+		expected    error
+	}{
+		{"PutItem with stale version", func() error {
+			return client.PutItem(ctx, "app", stale)
+		}, ErrVersionConflict},
+		{"AddTransactionPut with stale version", func() error {
+			transaction := CreateNoSqlTransaction(client)
+			if err := transaction.AddTransactionPut("app", stale); err != nil {
+				return err
+			}
+			return client.ExecuteTransaction(ctx, transaction)
+		}, ErrVersionConflict},
+		{"PutBatch of versioned item", func() error {
+			return client.PutBatch(ctx, "app", []interface{}{stale})
+		}, ErrVersionedBatchWrite},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			if err := tc.write(); !errors.Is(err, tc.expected) {
+				t.Errorf("%s -> Expected: %v // Returned: %v", tc.description, tc.expected, err)
+			}
+		})
+	}
+}
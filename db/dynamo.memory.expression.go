@@ -0,0 +1,1474 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// This file holds a small interpreter for the DynamoDB expression language
+// (condition, key condition, filter, update and projection expressions) used
+// by MemoryDynamoClient. It follows the semantics documented by AWS closely
+// enough for unit tests, it is not meant to be a complete validator.
+
+type memoryItem = map[string]types.AttributeValue
+
+type exprTokenKind int
+
+const (
+	exprTokenEOF exprTokenKind = iota
+	exprTokenIdent
+	exprTokenName
+	exprTokenValue
+	exprTokenNumber
+	exprTokenSymbol
+)
+
+type exprToken struct {
+	kind exprTokenKind
+	text string
+}
+
+func tokenizeExpression(input string) ([]exprToken, error) {
+	var tokens []exprToken
+	i := 0
+	for i < len(input) {
+		r, width := utf8.DecodeRuneInString(input[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += width
+		case r == '#' || r == ':':
+			start := i
+			i += width
+			for i < len(input) && isExprIdentByte(input[i]) {
+				i++
+			}
+			if i == start+1 {
+				return nil, fmt.Errorf("invalid token at position %d in expression %q", start, input)
+			}
+			kind := exprTokenName
+			if r == ':' {
+				kind = exprTokenValue
+			}
+			tokens = append(tokens, exprToken{kind: kind, text: input[start:i]})
+		case r >= '0' && r <= '9':
+			start := i
+			for i < len(input) && input[i] >= '0' && input[i] <= '9' {
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: exprTokenNumber, text: input[start:i]})
+		case isExprIdentByte(input[i]):
+			start := i
+			for i < len(input) && isExprIdentByte(input[i]) {
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: exprTokenIdent, text: input[start:i]})
+		case strings.HasPrefix(input[i:], "<>") || strings.HasPrefix(input[i:], "<=") || strings.HasPrefix(input[i:], ">="):
+			tokens = append(tokens, exprToken{kind: exprTokenSymbol, text: input[i : i+2]})
+			i += 2
+		case strings.ContainsRune("()[],.=<>+-", r):
+			tokens = append(tokens, exprToken{kind: exprTokenSymbol, text: string(r)})
+			i += width
+		default:
+			return nil, fmt.Errorf("unexpected character %q in expression %q", r, input)
+		}
+	}
+	tokens = append(tokens, exprToken{kind: exprTokenEOF})
+	return tokens, nil
+}
+
+func isExprIdentByte(b byte) bool {
+	return b == '_' || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9')
+}
+
+type exprPathElement struct {
+	name    string
+	index   int
+	isIndex bool
+}
+
+type exprPath []exprPathElement
+
+func (p exprPath) String() string {
+	var sb strings.Builder
+	for i, element := range p {
+		if element.isIndex {
+			sb.WriteString("[" + strconv.Itoa(element.index) + "]")
+			continue
+		}
+		if i > 0 {
+			sb.WriteString(".")
+		}
+		sb.WriteString(element.name)
+	}
+	return sb.String()
+}
+
+type exprParser struct {
+	source string
+	tokens []exprToken
+	pos    int
+	names  map[string]string
+	values map[string]types.AttributeValue
+}
+
+func newExprParser(source string, names map[string]string, values map[string]types.AttributeValue) (*exprParser, error) {
+	tokens, err := tokenizeExpression(source)
+	if err != nil {
+		return nil, err
+	}
+	return &exprParser{source: source, tokens: tokens, names: names, values: values}, nil
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) peekAt(offset int) exprToken {
+	if p.pos+offset >= len(p.tokens) {
+		return exprToken{kind: exprTokenEOF}
+	}
+	return p.tokens[p.pos+offset]
+}
+
+func (p *exprParser) next() exprToken {
+	token := p.tokens[p.pos]
+	if token.kind != exprTokenEOF {
+		p.pos++
+	}
+	return token
+}
+
+func (p *exprParser) isKeyword(keyword string) bool {
+	token := p.peek()
+	return token.kind == exprTokenIdent && strings.EqualFold(token.text, keyword)
+}
+
+func (p *exprParser) isSymbol(symbol string) bool {
+	token := p.peek()
+	return token.kind == exprTokenSymbol && token.text == symbol
+}
+
+func (p *exprParser) expectSymbol(symbol string) error {
+	if !p.isSymbol(symbol) {
+		return p.errorf("expected %q", symbol)
+	}
+	p.next()
+	return nil
+}
+
+func (p *exprParser) expectEOF() error {
+	if p.peek().kind != exprTokenEOF {
+		return p.errorf("unexpected token")
+	}
+	return nil
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	token := p.peek()
+	near := token.text
+	if token.kind == exprTokenEOF {
+		near = "end of expression"
+	}
+	return fmt.Errorf("invalid expression %q near %q: %s", p.source, near, fmt.Sprintf(format, args...))
+}
+
+func (p *exprParser) parsePath() (exprPath, error) {
+	var path exprPath
+	element, err := p.parsePathName()
+	if err != nil {
+		return nil, err
+	}
+	path = append(path, element)
+	for {
+		switch {
+		case p.isSymbol("."):
+			p.next()
+			element, err := p.parsePathName()
+			if err != nil {
+				return nil, err
+			}
+			path = append(path, element)
+		case p.isSymbol("["):
+			p.next()
+			token := p.next()
+			if token.kind != exprTokenNumber {
+				return nil, p.errorf("expected list index")
+			}
+			index, err := strconv.Atoi(token.text)
+			if err != nil {
+				return nil, p.errorf("invalid list index %q", token.text)
+			}
+			if err := p.expectSymbol("]"); err != nil {
+				return nil, err
+			}
+			path = append(path, exprPathElement{index: index, isIndex: true})
+		default:
+			return path, nil
+		}
+	}
+}
+
+func (p *exprParser) parsePathName() (exprPathElement, error) {
+	token := p.next()
+	switch token.kind {
+	case exprTokenIdent:
+		return exprPathElement{name: token.text}, nil
+	case exprTokenName:
+		name, ok := p.names[token.text]
+		if !ok {
+			return exprPathElement{}, fmt.Errorf("invalid expression %q: attribute name %s is not defined", p.source, token.text)
+		}
+		return exprPathElement{name: name}, nil
+	}
+	return exprPathElement{}, fmt.Errorf("invalid expression %q near %q: expected attribute name", p.source, token.text)
+}
+
+func (p *exprParser) parseValueRef() (types.AttributeValue, error) {
+	token := p.next()
+	if token.kind != exprTokenValue {
+		return nil, fmt.Errorf("invalid expression %q near %q: expected attribute value", p.source, token.text)
+	}
+	value, ok := p.values[token.text]
+	if !ok {
+		return nil, fmt.Errorf("invalid expression %q: attribute value %s is not defined", p.source, token.text)
+	}
+	return value, nil
+}
+
+// Condition expressions
+
+type conditionNode interface {
+	eval(item memoryItem) (bool, error)
+}
+
+type operandNode interface {
+	resolve(item memoryItem) (types.AttributeValue, bool, error)
+}
+
+type pathOperand struct{ path exprPath }
+
+func (o pathOperand) resolve(item memoryItem) (types.AttributeValue, bool, error) {
+	value, ok := lookupPath(item, o.path)
+	return value, ok, nil
+}
+
+type valueOperand struct{ value types.AttributeValue }
+
+func (o valueOperand) resolve(item memoryItem) (types.AttributeValue, bool, error) {
+	return o.value, true, nil
+}
+
+type sizeOperand struct{ path exprPath }
+
+func (o sizeOperand) resolve(item memoryItem) (types.AttributeValue, bool, error) {
+	value, ok := lookupPath(item, o.path)
+	if !ok {
+		return nil, false, nil
+	}
+	var size int
+	switch v := value.(type) {
+	case *types.AttributeValueMemberS:
+		size = utf8.RuneCountInString(v.Value)
+	case *types.AttributeValueMemberB:
+		size = len(v.Value)
+	case *types.AttributeValueMemberSS:
+		size = len(v.Value)
+	case *types.AttributeValueMemberNS:
+		size = len(v.Value)
+	case *types.AttributeValueMemberBS:
+		size = len(v.Value)
+	case *types.AttributeValueMemberL:
+		size = len(v.Value)
+	case *types.AttributeValueMemberM:
+		size = len(v.Value)
+	default:
+		return nil, false, fmt.Errorf("invalid operand type for size function: %s", attributeTypeName(value))
+	}
+	return &types.AttributeValueMemberN{Value: strconv.Itoa(size)}, true, nil
+}
+
+type andCondition struct{ left, right conditionNode }
+
+func (c andCondition) eval(item memoryItem) (bool, error) {
+	left, err := c.left.eval(item)
+	if err != nil || !left {
+		return false, err
+	}
+	return c.right.eval(item)
+}
+
+type orCondition struct{ left, right conditionNode }
+
+func (c orCondition) eval(item memoryItem) (bool, error) {
+	left, err := c.left.eval(item)
+	if err != nil {
+		return false, err
+	}
+	if left {
+		return true, nil
+	}
+	return c.right.eval(item)
+}
+
+type notCondition struct{ inner conditionNode }
+
+func (c notCondition) eval(item memoryItem) (bool, error) {
+	result, err := c.inner.eval(item)
+	return !result, err
+}
+
+type compareCondition struct {
+	operator    string
+	left, right operandNode
+}
+
+func (c compareCondition) eval(item memoryItem) (bool, error) {
+	left, leftOk, err := c.left.resolve(item)
+	if err != nil {
+		return false, err
+	}
+	right, rightOk, err := c.right.resolve(item)
+	if err != nil {
+		return false, err
+	}
+	if !leftOk || !rightOk {
+		return c.operator == "<>", nil
+	}
+	switch c.operator {
+	case "=":
+		return attributeValuesEqual(left, right), nil
+	case "<>":
+		return !attributeValuesEqual(left, right), nil
+	}
+	cmp, comparable := compareAttributeValues(left, right)
+	if !comparable {
+		return false, nil
+	}
+	switch c.operator {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	}
+	return false, fmt.Errorf("unsupported comparator %q", c.operator)
+}
+
+type betweenCondition struct {
+	operand, low, high operandNode
+}
+
+func (c betweenCondition) eval(item memoryItem) (bool, error) {
+	values := make([]types.AttributeValue, 3)
+	for i, operand := range []operandNode{c.operand, c.low, c.high} {
+		value, ok, err := operand.resolve(item)
+		if err != nil || !ok {
+			return false, err
+		}
+		values[i] = value
+	}
+	lowCmp, ok := compareAttributeValues(values[0], values[1])
+	if !ok {
+		return false, nil
+	}
+	highCmp, ok := compareAttributeValues(values[0], values[2])
+	if !ok {
+		return false, nil
+	}
+	return lowCmp >= 0 && highCmp <= 0, nil
+}
+
+type inCondition struct {
+	operand operandNode
+	list    []operandNode
+}
+
+func (c inCondition) eval(item memoryItem) (bool, error) {
+	value, ok, err := c.operand.resolve(item)
+	if err != nil || !ok {
+		return false, err
+	}
+	for _, candidate := range c.list {
+		other, ok, err := candidate.resolve(item)
+		if err != nil {
+			return false, err
+		}
+		if ok && attributeValuesEqual(value, other) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type functionCondition struct {
+	name string
+	path exprPath
+	arg  operandNode
+}
+
+func (c functionCondition) eval(item memoryItem) (bool, error) {
+	value, exists := lookupPath(item, c.path)
+	switch c.name {
+	case "attribute_exists":
+		return exists, nil
+	case "attribute_not_exists":
+		return !exists, nil
+	}
+	if !exists {
+		return false, nil
+	}
+	arg, ok, err := c.arg.resolve(item)
+	if err != nil || !ok {
+		return false, err
+	}
+	switch c.name {
+	case "attribute_type":
+		typeName, ok := arg.(*types.AttributeValueMemberS)
+		if !ok {
+			return false, fmt.Errorf("attribute_type expects a string operand")
+		}
+		return attributeTypeName(value) == typeName.Value, nil
+	case "begins_with":
+		switch v := value.(type) {
+		case *types.AttributeValueMemberS:
+			prefix, ok := arg.(*types.AttributeValueMemberS)
+			return ok && strings.HasPrefix(v.Value, prefix.Value), nil
+		case *types.AttributeValueMemberB:
+			prefix, ok := arg.(*types.AttributeValueMemberB)
+			return ok && bytes.HasPrefix(v.Value, prefix.Value), nil
+		}
+		return false, nil
+	case "contains":
+		return attributeContains(value, arg), nil
+	}
+	return false, fmt.Errorf("unsupported function %q", c.name)
+}
+
+func parseConditionExpression(source string, names map[string]string, values map[string]types.AttributeValue) (conditionNode, error) {
+	parser, err := newExprParser(source, names, values)
+	if err != nil {
+		return nil, err
+	}
+	node, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if err := parser.expectEOF(); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+func (p *exprParser) parseOr() (conditionNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("OR") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orCondition{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (conditionNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("AND") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andCondition{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseNot() (conditionNode, error) {
+	if p.isKeyword("NOT") {
+		p.next()
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notCondition{inner: inner}, nil
+	}
+	return p.parseCondition()
+}
+
+func (p *exprParser) parseCondition() (conditionNode, error) {
+	if p.isSymbol("(") {
+		p.next()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		return node, nil
+	}
+
+	token := p.peek()
+	if token.kind == exprTokenIdent && p.peekAt(1).kind == exprTokenSymbol && p.peekAt(1).text == "(" {
+		name := strings.ToLower(token.text)
+		if name != "size" {
+			return p.parseFunctionCondition(name)
+		}
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if p.isKeyword("BETWEEN") {
+		p.next()
+		low, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if !p.isKeyword("AND") {
+			return nil, p.errorf("expected AND in BETWEEN condition")
+		}
+		p.next()
+		high, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return betweenCondition{operand: left, low: low, high: high}, nil
+	}
+	if p.isKeyword("IN") {
+		p.next()
+		if err := p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		var list []operandNode
+		for {
+			operand, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, operand)
+			if !p.isSymbol(",") {
+				break
+			}
+			p.next()
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		return inCondition{operand: left, list: list}, nil
+	}
+	operator := p.peek()
+	if operator.kind != exprTokenSymbol {
+		return nil, p.errorf("expected comparator")
+	}
+	switch operator.text {
+	case "=", "<>", "<", "<=", ">", ">=":
+	default:
+		return nil, p.errorf("expected comparator")
+	}
+	p.next()
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return compareCondition{operator: operator.text, left: left, right: right}, nil
+}
+
+func (p *exprParser) parseFunctionCondition(name string) (conditionNode, error) {
+	p.next()
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	path, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+	condition := functionCondition{name: name, path: path}
+	switch name {
+	case "attribute_exists", "attribute_not_exists":
+	case "attribute_type", "begins_with", "contains":
+		if err := p.expectSymbol(","); err != nil {
+			return nil, err
+		}
+		arg, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		condition.arg = arg
+	default:
+		return nil, fmt.Errorf("invalid expression %q: unsupported function %q", p.source, name)
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	return condition, nil
+}
+
+func (p *exprParser) parseOperand() (operandNode, error) {
+	token := p.peek()
+	if token.kind == exprTokenValue {
+		value, err := p.parseValueRef()
+		if err != nil {
+			return nil, err
+		}
+		return valueOperand{value: value}, nil
+	}
+	if token.kind == exprTokenIdent && strings.EqualFold(token.text, "size") && p.peekAt(1).text == "(" {
+		p.next()
+		p.next()
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		return sizeOperand{path: path}, nil
+	}
+	path, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+	return pathOperand{path: path}, nil
+}
+
+// Update expressions
+
+type updateActionKind int
+
+const (
+	updateActionSet updateActionKind = iota
+	updateActionRemove
+	updateActionAdd
+	updateActionDelete
+)
+
+type updateAction struct {
+	kind  updateActionKind
+	path  exprPath
+	value setValueNode
+}
+
+type setValueNode interface {
+	resolve(item memoryItem) (types.AttributeValue, error)
+}
+
+type setPathValue struct{ path exprPath }
+
+func (v setPathValue) resolve(item memoryItem) (types.AttributeValue, error) {
+	value, ok := lookupPath(item, v.path)
+	if !ok {
+		return nil, fmt.Errorf("the provided expression refers to an attribute that does not exist in the item: %s", v.path)
+	}
+	return value, nil
+}
+
+type setLiteralValue struct{ value types.AttributeValue }
+
+func (v setLiteralValue) resolve(item memoryItem) (types.AttributeValue, error) {
+	return v.value, nil
+}
+
+type setIfNotExistsValue struct {
+	path     exprPath
+	fallback setValueNode
+}
+
+func (v setIfNotExistsValue) resolve(item memoryItem) (types.AttributeValue, error) {
+	if value, ok := lookupPath(item, v.path); ok {
+		return value, nil
+	}
+	return v.fallback.resolve(item)
+}
+
+type setListAppendValue struct{ left, right setValueNode }
+
+func (v setListAppendValue) resolve(item memoryItem) (types.AttributeValue, error) {
+	left, err := v.left.resolve(item)
+	if err != nil {
+		return nil, err
+	}
+	right, err := v.right.resolve(item)
+	if err != nil {
+		return nil, err
+	}
+	leftList, leftOk := left.(*types.AttributeValueMemberL)
+	rightList, rightOk := right.(*types.AttributeValueMemberL)
+	if !leftOk || !rightOk {
+		return nil, fmt.Errorf("incorrect operand type for list_append: %s, %s", attributeTypeName(left), attributeTypeName(right))
+	}
+	joined := make([]types.AttributeValue, 0, len(leftList.Value)+len(rightList.Value))
+	joined = append(joined, leftList.Value...)
+	joined = append(joined, rightList.Value...)
+	return &types.AttributeValueMemberL{Value: joined}, nil
+}
+
+type setArithmeticValue struct {
+	operator    string
+	left, right setValueNode
+}
+
+func (v setArithmeticValue) resolve(item memoryItem) (types.AttributeValue, error) {
+	left, err := v.left.resolve(item)
+	if err != nil {
+		return nil, err
+	}
+	right, err := v.right.resolve(item)
+	if err != nil {
+		return nil, err
+	}
+	leftNumber, leftOk := left.(*types.AttributeValueMemberN)
+	rightNumber, rightOk := right.(*types.AttributeValueMemberN)
+	if !leftOk || !rightOk {
+		return nil, fmt.Errorf("incorrect operand type for operator %s: %s, %s", v.operator, attributeTypeName(left), attributeTypeName(right))
+	}
+	result, err := addNumberStrings(leftNumber.Value, rightNumber.Value, v.operator == "-")
+	if err != nil {
+		return nil, err
+	}
+	return &types.AttributeValueMemberN{Value: result}, nil
+}
+
+func parseUpdateExpression(source string, names map[string]string, values map[string]types.AttributeValue) ([]updateAction, error) {
+	parser, err := newExprParser(source, names, values)
+	if err != nil {
+		return nil, err
+	}
+	var actions []updateAction
+	seen := map[updateActionKind]bool{}
+	for parser.peek().kind != exprTokenEOF {
+		clause := parser.next()
+		if clause.kind != exprTokenIdent {
+			return nil, fmt.Errorf("invalid update expression %q near %q: expected SET, REMOVE, ADD or DELETE", source, clause.text)
+		}
+		var kind updateActionKind
+		switch strings.ToUpper(clause.text) {
+		case "SET":
+			kind = updateActionSet
+		case "REMOVE":
+			kind = updateActionRemove
+		case "ADD":
+			kind = updateActionAdd
+		case "DELETE":
+			kind = updateActionDelete
+		default:
+			return nil, fmt.Errorf("invalid update expression %q near %q: expected SET, REMOVE, ADD or DELETE", source, clause.text)
+		}
+		if seen[kind] {
+			return nil, fmt.Errorf("invalid update expression %q: the %s section can only be used once", source, strings.ToUpper(clause.text))
+		}
+		seen[kind] = true
+		for {
+			action, err := parser.parseUpdateAction(kind)
+			if err != nil {
+				return nil, err
+			}
+			actions = append(actions, action)
+			if !parser.isSymbol(",") {
+				break
+			}
+			parser.next()
+		}
+	}
+	if len(actions) == 0 {
+		return nil, fmt.Errorf("invalid update expression %q: no actions", source)
+	}
+	return actions, nil
+}
+
+func (p *exprParser) parseUpdateAction(kind updateActionKind) (updateAction, error) {
+	path, err := p.parsePath()
+	if err != nil {
+		return updateAction{}, err
+	}
+	action := updateAction{kind: kind, path: path}
+	switch kind {
+	case updateActionSet:
+		if err := p.expectSymbol("="); err != nil {
+			return updateAction{}, err
+		}
+		value, err := p.parseSetValue()
+		if err != nil {
+			return updateAction{}, err
+		}
+		action.value = value
+	case updateActionAdd, updateActionDelete:
+		value, err := p.parseValueRef()
+		if err != nil {
+			return updateAction{}, err
+		}
+		action.value = setLiteralValue{value: value}
+	}
+	return action, nil
+}
+
+func (p *exprParser) parseSetValue() (setValueNode, error) {
+	left, err := p.parseSetOperand()
+	if err != nil {
+		return nil, err
+	}
+	if p.isSymbol("+") || p.isSymbol("-") {
+		operator := p.next().text
+		right, err := p.parseSetOperand()
+		if err != nil {
+			return nil, err
+		}
+		return setArithmeticValue{operator: operator, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseSetOperand() (setValueNode, error) {
+	token := p.peek()
+	if token.kind == exprTokenValue {
+		value, err := p.parseValueRef()
+		if err != nil {
+			return nil, err
+		}
+		return setLiteralValue{value: value}, nil
+	}
+	if token.kind == exprTokenIdent && p.peekAt(1).text == "(" {
+		name := strings.ToLower(token.text)
+		p.next()
+		p.next()
+		switch name {
+		case "if_not_exists":
+			path, err := p.parsePath()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectSymbol(","); err != nil {
+				return nil, err
+			}
+			fallback, err := p.parseSetValue()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectSymbol(")"); err != nil {
+				return nil, err
+			}
+			return setIfNotExistsValue{path: path, fallback: fallback}, nil
+		case "list_append":
+			left, err := p.parseSetValue()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectSymbol(","); err != nil {
+				return nil, err
+			}
+			right, err := p.parseSetValue()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectSymbol(")"); err != nil {
+				return nil, err
+			}
+			return setListAppendValue{left: left, right: right}, nil
+		}
+		return nil, fmt.Errorf("invalid update expression %q: unsupported function %q", p.source, name)
+	}
+	path, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+	return setPathValue{path: path}, nil
+}
+
+// applyUpdateActions resolves every action against the original item before
+// mutating it, as DynamoDB evaluates all operands on the pre-update image.
+func applyUpdateActions(item memoryItem, actions []updateAction) error {
+	resolved := make([]types.AttributeValue, len(actions))
+	for i, action := range actions {
+		if action.value == nil {
+			continue
+		}
+		value, err := action.value.resolve(item)
+		if err != nil {
+			return err
+		}
+		resolved[i] = value
+	}
+	for i, action := range actions {
+		var err error
+		switch action.kind {
+		case updateActionSet:
+			err = setPath(item, action.path, copyAttributeValue(resolved[i]))
+		case updateActionRemove:
+			removePath(item, action.path)
+		case updateActionAdd:
+			err = addToPath(item, action.path, resolved[i])
+		case updateActionDelete:
+			err = deleteFromPath(item, action.path, resolved[i])
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addToPath(item memoryItem, path exprPath, value types.AttributeValue) error {
+	current, exists := lookupPath(item, path)
+	if !exists {
+		switch value.(type) {
+		case *types.AttributeValueMemberN, *types.AttributeValueMemberSS, *types.AttributeValueMemberNS, *types.AttributeValueMemberBS:
+			return setPath(item, path, copyAttributeValue(value))
+		}
+		return fmt.Errorf("incorrect operand type for ADD: %s", attributeTypeName(value))
+	}
+	switch c := current.(type) {
+	case *types.AttributeValueMemberN:
+		v, ok := value.(*types.AttributeValueMemberN)
+		if !ok {
+			return fmt.Errorf("incorrect operand type for ADD: %s", attributeTypeName(value))
+		}
+		sum, err := addNumberStrings(c.Value, v.Value, false)
+		if err != nil {
+			return err
+		}
+		return setPath(item, path, &types.AttributeValueMemberN{Value: sum})
+	case *types.AttributeValueMemberSS:
+		v, ok := value.(*types.AttributeValueMemberSS)
+		if !ok {
+			return fmt.Errorf("incorrect operand type for ADD: %s", attributeTypeName(value))
+		}
+		return setPath(item, path, &types.AttributeValueMemberSS{Value: unionStrings(c.Value, v.Value)})
+	case *types.AttributeValueMemberNS:
+		v, ok := value.(*types.AttributeValueMemberNS)
+		if !ok {
+			return fmt.Errorf("incorrect operand type for ADD: %s", attributeTypeName(value))
+		}
+		merged := append([]string{}, c.Value...)
+		for _, candidate := range v.Value {
+			if !containsNumberString(merged, candidate) {
+				merged = append(merged, candidate)
+			}
+		}
+		return setPath(item, path, &types.AttributeValueMemberNS{Value: merged})
+	case *types.AttributeValueMemberBS:
+		v, ok := value.(*types.AttributeValueMemberBS)
+		if !ok {
+			return fmt.Errorf("incorrect operand type for ADD: %s", attributeTypeName(value))
+		}
+		merged := copyAttributeValue(c).(*types.AttributeValueMemberBS).Value
+		for _, candidate := range v.Value {
+			if !containsBytes(merged, candidate) {
+				merged = append(merged, append([]byte{}, candidate...))
+			}
+		}
+		return setPath(item, path, &types.AttributeValueMemberBS{Value: merged})
+	}
+	return fmt.Errorf("incorrect operand type for ADD: %s", attributeTypeName(current))
+}
+
+func deleteFromPath(item memoryItem, path exprPath, value types.AttributeValue) error {
+	current, exists := lookupPath(item, path)
+	if !exists {
+		return nil
+	}
+	var remaining types.AttributeValue
+	var empty bool
+	switch c := current.(type) {
+	case *types.AttributeValueMemberSS:
+		v, ok := value.(*types.AttributeValueMemberSS)
+		if !ok {
+			return fmt.Errorf("incorrect operand type for DELETE: %s", attributeTypeName(value))
+		}
+		var kept []string
+		for _, s := range c.Value {
+			if !containsString(v.Value, s) {
+				kept = append(kept, s)
+			}
+		}
+		remaining, empty = &types.AttributeValueMemberSS{Value: kept}, len(kept) == 0
+	case *types.AttributeValueMemberNS:
+		v, ok := value.(*types.AttributeValueMemberNS)
+		if !ok {
+			return fmt.Errorf("incorrect operand type for DELETE: %s", attributeTypeName(value))
+		}
+		var kept []string
+		for _, n := range c.Value {
+			if !containsNumberString(v.Value, n) {
+				kept = append(kept, n)
+			}
+		}
+		remaining, empty = &types.AttributeValueMemberNS{Value: kept}, len(kept) == 0
+	case *types.AttributeValueMemberBS:
+		v, ok := value.(*types.AttributeValueMemberBS)
+		if !ok {
+			return fmt.Errorf("incorrect operand type for DELETE: %s", attributeTypeName(value))
+		}
+		var kept [][]byte
+		for _, b := range c.Value {
+			if !containsBytes(v.Value, b) {
+				kept = append(kept, b)
+			}
+		}
+		remaining, empty = &types.AttributeValueMemberBS{Value: kept}, len(kept) == 0
+	default:
+		return fmt.Errorf("incorrect operand type for DELETE: %s", attributeTypeName(current))
+	}
+	if empty {
+		removePath(item, path)
+		return nil
+	}
+	return setPath(item, path, remaining)
+}
+
+// Projection expressions
+
+func parseProjectionExpression(source string, names map[string]string) ([]exprPath, error) {
+	parser, err := newExprParser(source, names, nil)
+	if err != nil {
+		return nil, err
+	}
+	var paths []exprPath
+	for {
+		path, err := parser.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+		if !parser.isSymbol(",") {
+			break
+		}
+		parser.next()
+	}
+	if err := parser.expectEOF(); err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+func projectItem(item memoryItem, paths []exprPath) memoryItem {
+	projected := memoryItem{}
+	for _, path := range paths {
+		value, ok := lookupPath(item, path)
+		if !ok {
+			continue
+		}
+		mergeProjectedPath(projected, path, copyAttributeValue(value))
+	}
+	return projected
+}
+
+func mergeProjectedPath(target memoryItem, path exprPath, value types.AttributeValue) {
+	head := path[0].name
+	if len(path) == 1 {
+		target[head] = value
+		return
+	}
+	target[head] = mergeProjectedValue(target[head], path[1:], value)
+}
+
+func mergeProjectedValue(current types.AttributeValue, path exprPath, value types.AttributeValue) types.AttributeValue {
+	if len(path) == 0 {
+		return value
+	}
+	element := path[0]
+	if element.isIndex {
+		list, ok := current.(*types.AttributeValueMemberL)
+		if !ok {
+			list = &types.AttributeValueMemberL{}
+		}
+		list.Value = append(list.Value, mergeProjectedValue(nil, path[1:], value))
+		return list
+	}
+	m, ok := current.(*types.AttributeValueMemberM)
+	if !ok {
+		m = &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{}}
+	}
+	m.Value[element.name] = mergeProjectedValue(m.Value[element.name], path[1:], value)
+	return m
+}
+
+// Document paths
+
+func lookupPath(item memoryItem, path exprPath) (types.AttributeValue, bool) {
+	if len(path) == 0 || path[0].isIndex {
+		return nil, false
+	}
+	current, ok := item[path[0].name]
+	if !ok {
+		return nil, false
+	}
+	for _, element := range path[1:] {
+		if element.isIndex {
+			list, ok := current.(*types.AttributeValueMemberL)
+			if !ok || element.index >= len(list.Value) {
+				return nil, false
+			}
+			current = list.Value[element.index]
+			continue
+		}
+		m, ok := current.(*types.AttributeValueMemberM)
+		if !ok {
+			return nil, false
+		}
+		current, ok = m.Value[element.name]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func setPath(item memoryItem, path exprPath, value types.AttributeValue) error {
+	if len(path) == 1 {
+		item[path[0].name] = value
+		return nil
+	}
+	parent, ok := lookupPath(item, path[:len(path)-1])
+	if !ok {
+		return fmt.Errorf("the document path provided in the update expression is invalid for update: %s", path)
+	}
+	last := path[len(path)-1]
+	switch p := parent.(type) {
+	case *types.AttributeValueMemberM:
+		if last.isIndex {
+			break
+		}
+		p.Value[last.name] = value
+		return nil
+	case *types.AttributeValueMemberL:
+		if !last.isIndex {
+			break
+		}
+		if last.index >= len(p.Value) {
+			p.Value = append(p.Value, value)
+		} else {
+			p.Value[last.index] = value
+		}
+		return nil
+	}
+	return fmt.Errorf("the document path provided in the update expression is invalid for update: %s", path)
+}
+
+func removePath(item memoryItem, path exprPath) {
+	if len(path) == 1 {
+		delete(item, path[0].name)
+		return
+	}
+	parent, ok := lookupPath(item, path[:len(path)-1])
+	if !ok {
+		return
+	}
+	last := path[len(path)-1]
+	switch p := parent.(type) {
+	case *types.AttributeValueMemberM:
+		delete(p.Value, last.name)
+	case *types.AttributeValueMemberL:
+		if last.isIndex && last.index < len(p.Value) {
+			p.Value = append(p.Value[:last.index], p.Value[last.index+1:]...)
+		}
+	}
+}
+
+// Attribute value helpers
+
+func attributeTypeName(value types.AttributeValue) string {
+	switch value.(type) {
+	case *types.AttributeValueMemberS:
+		return "S"
+	case *types.AttributeValueMemberN:
+		return "N"
+	case *types.AttributeValueMemberB:
+		return "B"
+	case *types.AttributeValueMemberSS:
+		return "SS"
+	case *types.AttributeValueMemberNS:
+		return "NS"
+	case *types.AttributeValueMemberBS:
+		return "BS"
+	case *types.AttributeValueMemberM:
+		return "M"
+	case *types.AttributeValueMemberL:
+		return "L"
+	case *types.AttributeValueMemberNULL:
+		return "NULL"
+	case *types.AttributeValueMemberBOOL:
+		return "BOOL"
+	}
+	return "UNKNOWN"
+}
+
+// compareAttributeValues orders two scalar values of the same type. The second
+// result is false when the values cannot be ordered.
+func compareAttributeValues(a, b types.AttributeValue) (int, bool) {
+	switch av := a.(type) {
+	case *types.AttributeValueMemberS:
+		bv, ok := b.(*types.AttributeValueMemberS)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(av.Value, bv.Value), true
+	case *types.AttributeValueMemberN:
+		bv, ok := b.(*types.AttributeValueMemberN)
+		if !ok {
+			return 0, false
+		}
+		cmp, err := compareNumberStrings(av.Value, bv.Value)
+		return cmp, err == nil
+	case *types.AttributeValueMemberB:
+		bv, ok := b.(*types.AttributeValueMemberB)
+		if !ok {
+			return 0, false
+		}
+		return bytes.Compare(av.Value, bv.Value), true
+	}
+	return 0, false
+}
+
+func attributeValuesEqual(a, b types.AttributeValue) bool {
+	switch av := a.(type) {
+	case *types.AttributeValueMemberS, *types.AttributeValueMemberN, *types.AttributeValueMemberB:
+		cmp, ok := compareAttributeValues(a, b)
+		return ok && cmp == 0
+	case *types.AttributeValueMemberBOOL:
+		bv, ok := b.(*types.AttributeValueMemberBOOL)
+		return ok && av.Value == bv.Value
+	case *types.AttributeValueMemberNULL:
+		bv, ok := b.(*types.AttributeValueMemberNULL)
+		return ok && av.Value == bv.Value
+	case *types.AttributeValueMemberSS:
+		bv, ok := b.(*types.AttributeValueMemberSS)
+		if !ok || len(av.Value) != len(bv.Value) {
+			return false
+		}
+		for _, s := range av.Value {
+			if !containsString(bv.Value, s) {
+				return false
+			}
+		}
+		return true
+	case *types.AttributeValueMemberNS:
+		bv, ok := b.(*types.AttributeValueMemberNS)
+		if !ok || len(av.Value) != len(bv.Value) {
+			return false
+		}
+		for _, n := range av.Value {
+			if !containsNumberString(bv.Value, n) {
+				return false
+			}
+		}
+		return true
+	case *types.AttributeValueMemberBS:
+		bv, ok := b.(*types.AttributeValueMemberBS)
+		if !ok || len(av.Value) != len(bv.Value) {
+			return false
+		}
+		for _, v := range av.Value {
+			if !containsBytes(bv.Value, v) {
+				return false
+			}
+		}
+		return true
+	case *types.AttributeValueMemberL:
+		bv, ok := b.(*types.AttributeValueMemberL)
+		if !ok || len(av.Value) != len(bv.Value) {
+			return false
+		}
+		for i := range av.Value {
+			if !attributeValuesEqual(av.Value[i], bv.Value[i]) {
+				return false
+			}
+		}
+		return true
+	case *types.AttributeValueMemberM:
+		bv, ok := b.(*types.AttributeValueMemberM)
+		if !ok || len(av.Value) != len(bv.Value) {
+			return false
+		}
+		for key, value := range av.Value {
+			other, ok := bv.Value[key]
+			if !ok || !attributeValuesEqual(value, other) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func attributeContains(value, operand types.AttributeValue) bool {
+	switch v := value.(type) {
+	case *types.AttributeValueMemberS:
+		s, ok := operand.(*types.AttributeValueMemberS)
+		return ok && strings.Contains(v.Value, s.Value)
+	case *types.AttributeValueMemberB:
+		b, ok := operand.(*types.AttributeValueMemberB)
+		return ok && bytes.Contains(v.Value, b.Value)
+	case *types.AttributeValueMemberSS:
+		s, ok := operand.(*types.AttributeValueMemberS)
+		return ok && containsString(v.Value, s.Value)
+	case *types.AttributeValueMemberNS:
+		n, ok := operand.(*types.AttributeValueMemberN)
+		return ok && containsNumberString(v.Value, n.Value)
+	case *types.AttributeValueMemberBS:
+		b, ok := operand.(*types.AttributeValueMemberB)
+		return ok && containsBytes(v.Value, b.Value)
+	case *types.AttributeValueMemberL:
+		for _, element := range v.Value {
+			if attributeValuesEqual(element, operand) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func copyAttributeValue(value types.AttributeValue) types.AttributeValue {
+	switch v := value.(type) {
+	case *types.AttributeValueMemberS:
+		return &types.AttributeValueMemberS{Value: v.Value}
+	case *types.AttributeValueMemberN:
+		return &types.AttributeValueMemberN{Value: v.Value}
+	case *types.AttributeValueMemberB:
+		return &types.AttributeValueMemberB{Value: append([]byte{}, v.Value...)}
+	case *types.AttributeValueMemberBOOL:
+		return &types.AttributeValueMemberBOOL{Value: v.Value}
+	case *types.AttributeValueMemberNULL:
+		return &types.AttributeValueMemberNULL{Value: v.Value}
+	case *types.AttributeValueMemberSS:
+		return &types.AttributeValueMemberSS{Value: append([]string{}, v.Value...)}
+	case *types.AttributeValueMemberNS:
+		return &types.AttributeValueMemberNS{Value: append([]string{}, v.Value...)}
+	case *types.AttributeValueMemberBS:
+		copied := make([][]byte, len(v.Value))
+		for i, b := range v.Value {
+			copied[i] = append([]byte{}, b...)
+		}
+		return &types.AttributeValueMemberBS{Value: copied}
+	case *types.AttributeValueMemberL:
+		copied := make([]types.AttributeValue, len(v.Value))
+		for i, element := range v.Value {
+			copied[i] = copyAttributeValue(element)
+		}
+		return &types.AttributeValueMemberL{Value: copied}
+	case *types.AttributeValueMemberM:
+		return &types.AttributeValueMemberM{Value: copyItem(v.Value)}
+	}
+	return value
+}
+
+func copyItem(item memoryItem) memoryItem {
+	if item == nil {
+		return nil
+	}
+	copied := make(memoryItem, len(item))
+	for key, value := range item {
+		copied[key] = copyAttributeValue(value)
+	}
+	return copied
+}
+
+func parseNumberString(value string) (*big.Rat, error) {
+	number, ok := new(big.Rat).SetString(value)
+	if !ok {
+		return nil, fmt.Errorf("invalid number %q", value)
+	}
+	return number, nil
+}
+
+func compareNumberStrings(a, b string) (int, error) {
+	left, err := parseNumberString(a)
+	if err != nil {
+		return 0, err
+	}
+	right, err := parseNumberString(b)
+	if err != nil {
+		return 0, err
+	}
+	return left.Cmp(right), nil
+}
+
+func canonicalNumberString(value string) (string, error) {
+	number, err := parseNumberString(value)
+	if err != nil {
+		return "", err
+	}
+	return formatRat(number), nil
+}
+
+func addNumberStrings(a, b string, subtract bool) (string, error) {
+	left, err := parseNumberString(a)
+	if err != nil {
+		return "", err
+	}
+	right, err := parseNumberString(b)
+	if err != nil {
+		return "", err
+	}
+	if subtract {
+		return formatRat(new(big.Rat).Sub(left, right)), nil
+	}
+	return formatRat(new(big.Rat).Add(left, right)), nil
+}
+
+// formatRat prints a number parsed from DynamoDB's decimal representation.
+// Those always have a power-of-ten denominator, so 38 digits (DynamoDB's
+// precision) are enough to print them exactly.
+func formatRat(number *big.Rat) string {
+	if number.IsInt() {
+		return number.Num().String()
+	}
+	formatted := number.FloatString(38)
+	formatted = strings.TrimRight(formatted, "0")
+	return strings.TrimSuffix(formatted, ".")
+}
+
+func containsString(values []string, candidate string) bool {
+	for _, value := range values {
+		if value == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+func containsNumberString(values []string, candidate string) bool {
+	for _, value := range values {
+		if cmp, err := compareNumberStrings(value, candidate); err == nil && cmp == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func containsBytes(values [][]byte, candidate []byte) bool {
+	for _, value := range values {
+		if bytes.Equal(value, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+func unionStrings(current, added []string) []string {
+	merged := append([]string{}, current...)
+	for _, value := range added {
+		if !containsString(merged, value) {
+			merged = append(merged, value)
+		}
+	}
+	return merged
+}
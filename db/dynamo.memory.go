@@ -0,0 +1,1208 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+)
+
+// MemoryDynamoClient is an in-memory implementation of DynamoApiClient meant
+// for unit tests. Tables must be created with CreateTable before use; key
+// conditions, filters, condition expressions, update expressions, projections,
+// secondary indexes, Limit/LastEvaluatedKey pagination and transactions
+// behave like the real service.
+type MemoryDynamoClient struct {
+	mu         sync.RWMutex
+	tables     map[string]*memoryTable
+	batchLimit int
+	// transactTokens holds the ClientRequestToken of every applied
+	// transaction; a repeated token is acknowledged without writing again.
+	transactTokens map[string]bool
+}
+
+type memoryKeySchema struct {
+	partitionKey string
+	sortKey      string
+}
+
+func (k memoryKeySchema) attributes() []string {
+	if k.sortKey == "" {
+		return []string{k.partitionKey}
+	}
+	return []string{k.partitionKey, k.sortKey}
+}
+
+type memoryIndex struct {
+	name       string
+	keys       memoryKeySchema
+	projection *types.Projection
+}
+
+type memoryTable struct {
+	keys           memoryKeySchema
+	attributeTypes map[string]types.ScalarAttributeType
+	indexes        map[string]*memoryIndex
+	items          map[string]memoryItem
+	description    types.TableDescription
+	timeToLive     types.TimeToLiveDescription
+}
+
+// CreateMemoryDynamoClient returns an empty in-memory DynamoDB stand-in.
+func CreateMemoryDynamoClient() *MemoryDynamoClient {
+	return &MemoryDynamoClient{
+		tables: make(map[string]*memoryTable),
+	}
+}
+
+// SetBatchProcessingLimit makes every batch call process at most limit keys
+// and report the rest as unprocessed, the way DynamoDB behaves when
+// throttled. Zero disables the limit.
+func (m *MemoryDynamoClient) SetBatchProcessingLimit(limit int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.batchLimit = limit
+}
+
+func newMemoryValidationError(format string, args ...interface{}) error {
+	return &smithy.GenericAPIError{
+		Code:    "ValidationException",
+		Message: fmt.Sprintf(format, args...),
+		Fault:   smithy.FaultClient,
+	}
+}
+
+func newMemoryConditionalCheckFailed(existing memoryItem, returnValues types.ReturnValuesOnConditionCheckFailure) error {
+	err := &types.ConditionalCheckFailedException{Message: aws.String("The conditional request failed")}
+	if returnValues == types.ReturnValuesOnConditionCheckFailureAllOld && existing != nil {
+		err.Item = copyItem(existing)
+	}
+	return err
+}
+
+func memoryKeySchemaFrom(elements []types.KeySchemaElement) (memoryKeySchema, error) {
+	var keys memoryKeySchema
+	for _, element := range elements {
+		switch element.KeyType {
+		case types.KeyTypeHash:
+			keys.partitionKey = aws.ToString(element.AttributeName)
+		case types.KeyTypeRange:
+			keys.sortKey = aws.ToString(element.AttributeName)
+		}
+	}
+	if keys.partitionKey == "" {
+		return keys, newMemoryValidationError("key schema must contain a HASH key")
+	}
+	return keys, nil
+}
+
+// CreateTable registers a table with its key schema and secondary indexes.
+// The table is ACTIVE as soon as the call returns.
+func (m *MemoryDynamoClient) CreateTable(ctx context.Context, params *dynamodb.CreateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	tableName := aws.ToString(params.TableName)
+	if tableName == "" {
+		return nil, newMemoryValidationError("TableName is required")
+	}
+	keys, err := memoryKeySchemaFrom(params.KeySchema)
+	if err != nil {
+		return nil, err
+	}
+	table := &memoryTable{
+		keys:           keys,
+		attributeTypes: make(map[string]types.ScalarAttributeType),
+		indexes:        make(map[string]*memoryIndex),
+		items:          make(map[string]memoryItem),
+	}
+	for _, definition := range params.AttributeDefinitions {
+		table.attributeTypes[aws.ToString(definition.AttributeName)] = definition.AttributeType
+	}
+	for _, attribute := range keys.attributes() {
+		if _, ok := table.attributeTypes[attribute]; !ok {
+			return nil, newMemoryValidationError("missing attribute definition for key attribute %s", attribute)
+		}
+	}
+
+	now := time.Now()
+	description := types.TableDescription{
+		TableName:            aws.String(tableName),
+		TableArn:             aws.String("arn:aws:dynamodb:memory:000000000000:table/" + tableName),
+		TableStatus:          types.TableStatusActive,
+		CreationDateTime:     &now,
+		KeySchema:            params.KeySchema,
+		AttributeDefinitions: params.AttributeDefinitions,
+	}
+	if params.BillingMode != "" {
+		description.BillingModeSummary = &types.BillingModeSummary{BillingMode: params.BillingMode}
+	}
+	description.ProvisionedThroughput = memoryThroughputDescription(params.ProvisionedThroughput)
+	for _, gsi := range params.GlobalSecondaryIndexes {
+		index, err := table.addIndex(aws.ToString(gsi.IndexName), gsi.KeySchema, gsi.Projection)
+		if err != nil {
+			return nil, err
+		}
+		description.GlobalSecondaryIndexes = append(description.GlobalSecondaryIndexes, types.GlobalSecondaryIndexDescription{
+			IndexName:             aws.String(index.name),
+			IndexStatus:           types.IndexStatusActive,
+			KeySchema:             gsi.KeySchema,
+			Projection:            gsi.Projection,
+			ProvisionedThroughput: memoryThroughputDescription(gsi.ProvisionedThroughput),
+		})
+	}
+	for _, lsi := range params.LocalSecondaryIndexes {
+		index, err := table.addIndex(aws.ToString(lsi.IndexName), lsi.KeySchema, lsi.Projection)
+		if err != nil {
+			return nil, err
+		}
+		if index.keys.partitionKey != keys.partitionKey {
+			return nil, newMemoryValidationError("local secondary index %s must use the table partition key", index.name)
+		}
+		description.LocalSecondaryIndexes = append(description.LocalSecondaryIndexes, types.LocalSecondaryIndexDescription{
+			IndexName:  aws.String(index.name),
+			KeySchema:  lsi.KeySchema,
+			Projection: lsi.Projection,
+		})
+	}
+	table.description = description
+	table.timeToLive = types.TimeToLiveDescription{TimeToLiveStatus: types.TimeToLiveStatusDisabled}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.tables[tableName]; exists {
+		return nil, &types.ResourceInUseException{Message: aws.String("Table already exists: " + tableName)}
+	}
+	m.tables[tableName] = table
+	return &dynamodb.CreateTableOutput{TableDescription: &description}, nil
+}
+
+func (t *memoryTable) addIndex(name string, keySchema []types.KeySchemaElement, projection *types.Projection) (*memoryIndex, error) {
+	if name == "" {
+		return nil, newMemoryValidationError("IndexName is required")
+	}
+	if _, exists := t.indexes[name]; exists {
+		return nil, newMemoryValidationError("duplicate index name %s", name)
+	}
+	keys, err := memoryKeySchemaFrom(keySchema)
+	if err != nil {
+		return nil, err
+	}
+	for _, attribute := range keys.attributes() {
+		if _, ok := t.attributeTypes[attribute]; !ok {
+			return nil, newMemoryValidationError("missing attribute definition for index key attribute %s", attribute)
+		}
+	}
+	index := &memoryIndex{name: name, keys: keys, projection: projection}
+	t.indexes[name] = index
+	return index, nil
+}
+
+func (m *MemoryDynamoClient) table(tableName *string) (*memoryTable, error) {
+	table, ok := m.tables[aws.ToString(tableName)]
+	if !ok {
+		return nil, &types.ResourceNotFoundException{Message: aws.String("Requested resource not found: " + aws.ToString(tableName))}
+	}
+	return table, nil
+}
+
+// itemKey validates that key holds exactly the table key attributes and
+// returns its canonical string form.
+func (t *memoryTable) itemKey(key memoryItem) (string, error) {
+	if len(key) != len(t.keys.attributes()) {
+		return "", newMemoryValidationError("The provided key element does not match the schema")
+	}
+	return t.primaryKeyString(key)
+}
+
+func (t *memoryTable) primaryKeyString(item memoryItem) (string, error) {
+	parts := make([]string, 0, 2)
+	for _, attribute := range t.keys.attributes() {
+		value, ok := item[attribute]
+		if !ok {
+			return "", newMemoryValidationError("One or more parameter values were invalid: Missing the key %s in the item", attribute)
+		}
+		part, err := t.keyValueString(attribute, value)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "|"), nil
+}
+
+func (t *memoryTable) keyValueString(attribute string, value types.AttributeValue) (string, error) {
+	expected := t.attributeTypes[attribute]
+	switch v := value.(type) {
+	case *types.AttributeValueMemberS:
+		if expected == types.ScalarAttributeTypeS {
+			if v.Value == "" {
+				return "", newMemoryValidationError("One or more parameter values are not valid. The AttributeValue for a key attribute cannot contain an empty string value. Key: %s", attribute)
+			}
+			return "S:" + v.Value, nil
+		}
+	case *types.AttributeValueMemberN:
+		if expected == types.ScalarAttributeTypeN {
+			canonical, err := canonicalNumberString(v.Value)
+			if err != nil {
+				return "", newMemoryValidationError("%s", err.Error())
+			}
+			return "N:" + canonical, nil
+		}
+	case *types.AttributeValueMemberB:
+		if expected == types.ScalarAttributeTypeB {
+			if len(v.Value) == 0 {
+				return "", newMemoryValidationError("One or more parameter values are not valid. The AttributeValue for a key attribute cannot contain an empty binary value. Key: %s", attribute)
+			}
+			return fmt.Sprintf("B:%x", v.Value), nil
+		}
+	}
+	return "", newMemoryValidationError("One or more parameter values were invalid: Type mismatch for key %s expected: %s actual: %s", attribute, expected, attributeTypeName(value))
+}
+
+func (t *memoryTable) keyOf(item memoryItem) memoryItem {
+	key := memoryItem{}
+	for _, attribute := range t.keys.attributes() {
+		key[attribute] = copyAttributeValue(item[attribute])
+	}
+	return key
+}
+
+// validateItem checks key attributes and the type of any index key attribute
+// present on the item.
+func (t *memoryTable) validateItem(item memoryItem) (string, error) {
+	key, err := t.primaryKeyString(item)
+	if err != nil {
+		return "", err
+	}
+	for _, index := range t.indexes {
+		for _, attribute := range index.keys.attributes() {
+			if value, ok := item[attribute]; ok {
+				if _, err := t.keyValueString(attribute, value); err != nil {
+					return "", err
+				}
+			}
+		}
+	}
+	return key, nil
+}
+
+// readView returns the key schema and the items visible through the table
+// or one of its indexes, with index projections applied.
+func (t *memoryTable) readView(indexName *string) (memoryKeySchema, []memoryItem, error) {
+	if indexName == nil {
+		items := make([]memoryItem, 0, len(t.items))
+		for _, item := range t.items {
+			items = append(items, copyItem(item))
+		}
+		return t.keys, items, nil
+	}
+	index, ok := t.indexes[aws.ToString(indexName)]
+	if !ok {
+		return memoryKeySchema{}, nil, newMemoryValidationError("The table does not have the specified index: %s", aws.ToString(indexName))
+	}
+	var items []memoryItem
+	for _, item := range t.items {
+		complete := true
+		for _, attribute := range index.keys.attributes() {
+			if _, ok := item[attribute]; !ok {
+				complete = false
+			}
+		}
+		if complete {
+			items = append(items, t.projectForIndex(index, item))
+		}
+	}
+	return index.keys, items, nil
+}
+
+func (t *memoryTable) projectForIndex(index *memoryIndex, item memoryItem) memoryItem {
+	if index.projection == nil || index.projection.ProjectionType == types.ProjectionTypeAll || index.projection.ProjectionType == "" {
+		return copyItem(item)
+	}
+	projected := memoryItem{}
+	attributes := append(t.keys.attributes(), index.keys.attributes()...)
+	if index.projection.ProjectionType == types.ProjectionTypeInclude {
+		attributes = append(attributes, index.projection.NonKeyAttributes...)
+	}
+	for _, attribute := range attributes {
+		if value, ok := item[attribute]; ok {
+			projected[attribute] = copyAttributeValue(value)
+		}
+	}
+	return projected
+}
+
+// orderAttributes lists the attributes that define the iteration order of a
+// read, ending with the table key so that ties are resolved deterministically.
+func (t *memoryTable) orderAttributes(view memoryKeySchema, includePartition bool) []string {
+	var attributes []string
+	add := func(name string) {
+		if name != "" && !containsString(attributes, name) {
+			attributes = append(attributes, name)
+		}
+	}
+	if includePartition {
+		add(view.partitionKey)
+	}
+	add(view.sortKey)
+	add(t.keys.partitionKey)
+	add(t.keys.sortKey)
+	return attributes
+}
+
+func (t *memoryTable) lastEvaluatedKey(view memoryKeySchema, item memoryItem) memoryItem {
+	key := t.keyOf(item)
+	for _, attribute := range view.attributes() {
+		key[attribute] = copyAttributeValue(item[attribute])
+	}
+	return key
+}
+
+func compareItemPositions(a, b memoryItem, attributes []string) int {
+	for _, attribute := range attributes {
+		left, leftOk := a[attribute]
+		right, rightOk := b[attribute]
+		if !leftOk || !rightOk {
+			continue
+		}
+		if cmp, ok := compareAttributeValues(left, right); ok && cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+func sortMemoryItems(items []memoryItem, attributes []string, forward bool) {
+	sort.SliceStable(items, func(i, j int) bool {
+		cmp := compareItemPositions(items[i], items[j], attributes)
+		if forward {
+			return cmp < 0
+		}
+		return cmp > 0
+	})
+}
+
+type memoryPage struct {
+	evaluated []memoryItem
+	lastItem  memoryItem
+}
+
+// readPage skips past the exclusive start key and evaluates up to limit
+// items, mirroring how Limit caps evaluated (not returned) items. As in
+// DynamoDB, a page that reaches the limit has a last item even when nothing
+// follows it.
+func readPage(items []memoryItem, attributes []string, forward bool, startKey memoryItem, limit *int32) (memoryPage, error) {
+	start := 0
+	if startKey != nil {
+		start = len(items)
+		for i, item := range items {
+			cmp := compareItemPositions(item, startKey, attributes)
+			if (forward && cmp > 0) || (!forward && cmp < 0) {
+				start = i
+				break
+			}
+		}
+	}
+	remaining := items[start:]
+	if limit == nil {
+		return memoryPage{evaluated: remaining}, nil
+	}
+	if *limit <= 0 {
+		return memoryPage{}, newMemoryValidationError("Limit must be greater than or equal to 1")
+	}
+	if int(*limit) > len(remaining) {
+		return memoryPage{evaluated: remaining}, nil
+	}
+	page := remaining[:*limit]
+	return memoryPage{evaluated: page, lastItem: page[len(page)-1]}, nil
+}
+
+func evaluateCondition(expression *string, names map[string]string, values map[string]types.AttributeValue, item memoryItem) (bool, error) {
+	if aws.ToString(expression) == "" {
+		return true, nil
+	}
+	condition, err := parseConditionExpression(aws.ToString(expression), names, values)
+	if err != nil {
+		return false, newMemoryValidationError("%s", err.Error())
+	}
+	if item == nil {
+		item = memoryItem{}
+	}
+	result, err := condition.eval(item)
+	if err != nil {
+		return false, newMemoryValidationError("%s", err.Error())
+	}
+	return result, nil
+}
+
+func filterItems(items []memoryItem, expression *string, names map[string]string, values map[string]types.AttributeValue) ([]memoryItem, error) {
+	if aws.ToString(expression) == "" {
+		return items, nil
+	}
+	var matched []memoryItem
+	for _, item := range items {
+		ok, err := evaluateCondition(expression, names, values, item)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matched = append(matched, item)
+		}
+	}
+	return matched, nil
+}
+
+func applyProjection(items []memoryItem, expression *string, names map[string]string) ([]memoryItem, error) {
+	if aws.ToString(expression) == "" {
+		return items, nil
+	}
+	paths, err := parseProjectionExpression(aws.ToString(expression), names)
+	if err != nil {
+		return nil, newMemoryValidationError("%s", err.Error())
+	}
+	projected := make([]memoryItem, len(items))
+	for i, item := range items {
+		projected[i] = projectItem(item, paths)
+	}
+	return projected, nil
+}
+
+func attributeValueSize(value types.AttributeValue) int {
+	switch v := value.(type) {
+	case *types.AttributeValueMemberS:
+		return len(v.Value)
+	case *types.AttributeValueMemberN:
+		return len(v.Value)/2 + 1
+	case *types.AttributeValueMemberB:
+		return len(v.Value)
+	case *types.AttributeValueMemberSS:
+		size := 0
+		for _, s := range v.Value {
+			size += len(s)
+		}
+		return size
+	case *types.AttributeValueMemberNS:
+		size := 0
+		for _, n := range v.Value {
+			size += len(n)/2 + 1
+		}
+		return size
+	case *types.AttributeValueMemberBS:
+		size := 0
+		for _, b := range v.Value {
+			size += len(b)
+		}
+		return size
+	case *types.AttributeValueMemberL:
+		size := 3
+		for _, element := range v.Value {
+			size += attributeValueSize(element) + 1
+		}
+		return size
+	case *types.AttributeValueMemberM:
+		return 3 + itemSize(v.Value)
+	}
+	return 1
+}
+
+func itemSize(item memoryItem) int {
+	size := 0
+	for name, value := range item {
+		size += len(name) + attributeValueSize(value)
+	}
+	return size
+}
+
+func readCapacityUnits(items []memoryItem, consistentRead bool) float64 {
+	size := 0
+	for _, item := range items {
+		size += itemSize(item)
+	}
+	units := math.Max(1, math.Ceil(float64(size)/4096))
+	if !consistentRead {
+		units /= 2
+	}
+	return units
+}
+
+func writeCapacityUnits(items ...memoryItem) float64 {
+	units := 0.0
+	for _, item := range items {
+		units += math.Max(1, math.Ceil(float64(itemSize(item))/1024))
+	}
+	return units
+}
+
+func consumedCapacity(tableName *string, indexName *string, mode types.ReturnConsumedCapacity, units float64, read bool) *types.ConsumedCapacity {
+	if mode == "" || mode == types.ReturnConsumedCapacityNone {
+		return nil
+	}
+	capacity := &types.ConsumedCapacity{
+		TableName:     tableName,
+		CapacityUnits: aws.Float64(units),
+	}
+	if read {
+		capacity.ReadCapacityUnits = aws.Float64(units)
+	} else {
+		capacity.WriteCapacityUnits = aws.Float64(units)
+	}
+	if mode == types.ReturnConsumedCapacityIndexes {
+		if indexName != nil {
+			capacity.GlobalSecondaryIndexes = map[string]types.Capacity{
+				aws.ToString(indexName): {CapacityUnits: aws.Float64(units)},
+			}
+		} else {
+			capacity.Table = &types.Capacity{CapacityUnits: aws.Float64(units)}
+		}
+	}
+	return capacity
+}
+
+func (m *MemoryDynamoClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	table, err := m.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	key, err := table.itemKey(params.Key)
+	if err != nil {
+		return nil, err
+	}
+	output := &dynamodb.GetItemOutput{}
+	item, ok := table.items[key]
+	consistent := aws.ToBool(params.ConsistentRead)
+	if !ok {
+		output.ConsumedCapacity = consumedCapacity(params.TableName, nil, params.ReturnConsumedCapacity, readCapacityUnits(nil, consistent), true)
+		return output, nil
+	}
+	projected, err := applyProjection([]memoryItem{copyItem(item)}, params.ProjectionExpression, params.ExpressionAttributeNames)
+	if err != nil {
+		return nil, err
+	}
+	output.Item = projected[0]
+	output.ConsumedCapacity = consumedCapacity(params.TableName, nil, params.ReturnConsumedCapacity, readCapacityUnits([]memoryItem{item}, consistent), true)
+	return output, nil
+}
+
+func (m *MemoryDynamoClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if params.ReturnValues != "" && params.ReturnValues != types.ReturnValueNone && params.ReturnValues != types.ReturnValueAllOld {
+		return nil, newMemoryValidationError("ReturnValues can only be ALL_OLD or NONE for PutItem")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	table, err := m.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	key, err := table.validateItem(params.Item)
+	if err != nil {
+		return nil, err
+	}
+	existing := table.items[key]
+	ok, err := evaluateCondition(params.ConditionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues, existing)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, newMemoryConditionalCheckFailed(existing, params.ReturnValuesOnConditionCheckFailure)
+	}
+	table.items[key] = copyItem(params.Item)
+	output := &dynamodb.PutItemOutput{
+		ConsumedCapacity: consumedCapacity(params.TableName, nil, params.ReturnConsumedCapacity, writeCapacityUnits(params.Item), false),
+	}
+	if params.ReturnValues == types.ReturnValueAllOld && existing != nil {
+		output.Attributes = copyItem(existing)
+	}
+	return output, nil
+}
+
+// prepareUpdate computes the updated image of an item without storing it.
+func (t *memoryTable) prepareUpdate(key memoryItem, existing memoryItem, updateExpression *string, names map[string]string, values map[string]types.AttributeValue) (memoryItem, []exprPath, error) {
+	var updated memoryItem
+	if existing != nil {
+		updated = copyItem(existing)
+	} else {
+		updated = copyItem(key)
+	}
+	if aws.ToString(updateExpression) == "" {
+		return updated, nil, nil
+	}
+	actions, err := parseUpdateExpression(aws.ToString(updateExpression), names, values)
+	if err != nil {
+		return nil, nil, newMemoryValidationError("%s", err.Error())
+	}
+	paths := make([]exprPath, 0, len(actions))
+	for _, action := range actions {
+		if containsString(t.keys.attributes(), action.path[0].name) {
+			return nil, nil, newMemoryValidationError("Cannot update attribute %s. This attribute is part of the key", action.path[0].name)
+		}
+		paths = append(paths, action.path)
+	}
+	if err := applyUpdateActions(updated, actions); err != nil {
+		return nil, nil, newMemoryValidationError("%s", err.Error())
+	}
+	if _, err := t.validateItem(updated); err != nil {
+		return nil, nil, err
+	}
+	return updated, paths, nil
+}
+
+func (m *MemoryDynamoClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	table, err := m.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	key, err := table.itemKey(params.Key)
+	if err != nil {
+		return nil, err
+	}
+	existing := table.items[key]
+	ok, err := evaluateCondition(params.ConditionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues, existing)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, newMemoryConditionalCheckFailed(existing, params.ReturnValuesOnConditionCheckFailure)
+	}
+	updated, paths, err := table.prepareUpdate(params.Key, existing, params.UpdateExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	table.items[key] = updated
+
+	output := &dynamodb.UpdateItemOutput{
+		ConsumedCapacity: consumedCapacity(params.TableName, nil, params.ReturnConsumedCapacity, writeCapacityUnits(updated), false),
+	}
+	switch params.ReturnValues {
+	case types.ReturnValueAllOld:
+		output.Attributes = copyItem(existing)
+	case types.ReturnValueAllNew:
+		output.Attributes = copyItem(updated)
+	case types.ReturnValueUpdatedOld:
+		if existing != nil {
+			output.Attributes = projectItem(existing, paths)
+		}
+	case types.ReturnValueUpdatedNew:
+		output.Attributes = projectItem(updated, paths)
+	}
+	return output, nil
+}
+
+func (m *MemoryDynamoClient) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if params.ReturnValues != "" && params.ReturnValues != types.ReturnValueNone && params.ReturnValues != types.ReturnValueAllOld {
+		return nil, newMemoryValidationError("ReturnValues can only be ALL_OLD or NONE for DeleteItem")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	table, err := m.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	key, err := table.itemKey(params.Key)
+	if err != nil {
+		return nil, err
+	}
+	existing := table.items[key]
+	ok, err := evaluateCondition(params.ConditionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues, existing)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, newMemoryConditionalCheckFailed(existing, params.ReturnValuesOnConditionCheckFailure)
+	}
+	delete(table.items, key)
+	output := &dynamodb.DeleteItemOutput{
+		ConsumedCapacity: consumedCapacity(params.TableName, nil, params.ReturnConsumedCapacity, writeCapacityUnits(existing), false),
+	}
+	if params.ReturnValues == types.ReturnValueAllOld && existing != nil {
+		output.Attributes = copyItem(existing)
+	}
+	return output, nil
+}
+
+func (m *MemoryDynamoClient) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if aws.ToString(params.KeyConditionExpression) == "" {
+		return nil, newMemoryValidationError("KeyConditionExpression is required")
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	table, err := m.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	view, items, err := table.readView(params.IndexName)
+	if err != nil {
+		return nil, err
+	}
+	items, err = filterItems(items, params.KeyConditionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	forward := params.ScanIndexForward == nil || *params.ScanIndexForward
+	attributes := table.orderAttributes(view, false)
+	sortMemoryItems(items, attributes, forward)
+
+	page, err := readPage(items, attributes, forward, params.ExclusiveStartKey, params.Limit)
+	if err != nil {
+		return nil, err
+	}
+	return buildMemoryQueryOutput(table, view, page, params.FilterExpression, params.ProjectionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues, params.Select, params.TableName, params.IndexName, params.ReturnConsumedCapacity, aws.ToBool(params.ConsistentRead))
+}
+
+func buildMemoryQueryOutput(table *memoryTable, view memoryKeySchema, page memoryPage, filterExpression, projectionExpression *string, names map[string]string, values map[string]types.AttributeValue, selectMode types.Select, tableName, indexName *string, capacityMode types.ReturnConsumedCapacity, consistentRead bool) (*dynamodb.QueryOutput, error) {
+	matched, err := filterItems(page.evaluated, filterExpression, names, values)
+	if err != nil {
+		return nil, err
+	}
+	output := &dynamodb.QueryOutput{
+		Count:            int32(len(matched)),
+		ScannedCount:     int32(len(page.evaluated)),
+		ConsumedCapacity: consumedCapacity(tableName, indexName, capacityMode, readCapacityUnits(page.evaluated, consistentRead), true),
+	}
+	if page.lastItem != nil {
+		output.LastEvaluatedKey = table.lastEvaluatedKey(view, page.lastItem)
+	}
+	if selectMode == types.SelectCount {
+		return output, nil
+	}
+	output.Items, err = applyProjection(matched, projectionExpression, names)
+	if err != nil {
+		return nil, err
+	}
+	if output.Items == nil {
+		output.Items = []memoryItem{}
+	}
+	return output, nil
+}
+
+func (m *MemoryDynamoClient) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	segment, totalSegments := aws.ToInt32(params.Segment), aws.ToInt32(params.TotalSegments)
+	if (params.Segment == nil) != (params.TotalSegments == nil) || (params.TotalSegments != nil && (totalSegments < 1 || segment < 0 || segment >= totalSegments)) {
+		return nil, newMemoryValidationError("Segment and TotalSegments must be provided together with 0 <= Segment < TotalSegments")
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	table, err := m.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	view, items, err := table.readView(params.IndexName)
+	if err != nil {
+		return nil, err
+	}
+	if params.TotalSegments != nil {
+		var segmentItems []memoryItem
+		for _, item := range items {
+			partition, err := table.keyValueString(view.partitionKey, item[view.partitionKey])
+			if err != nil {
+				return nil, err
+			}
+			hash := fnv.New32a()
+			hash.Write([]byte(partition))
+			if int32(hash.Sum32()%uint32(totalSegments)) == segment {
+				segmentItems = append(segmentItems, item)
+			}
+		}
+		items = segmentItems
+	}
+	attributes := table.orderAttributes(view, true)
+	sortMemoryItems(items, attributes, true)
+
+	page, err := readPage(items, attributes, true, params.ExclusiveStartKey, params.Limit)
+	if err != nil {
+		return nil, err
+	}
+	queryOutput, err := buildMemoryQueryOutput(table, view, page, params.FilterExpression, params.ProjectionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues, params.Select, params.TableName, params.IndexName, params.ReturnConsumedCapacity, aws.ToBool(params.ConsistentRead))
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.ScanOutput{
+		Items:            queryOutput.Items,
+		Count:            queryOutput.Count,
+		ScannedCount:     queryOutput.ScannedCount,
+		LastEvaluatedKey: queryOutput.LastEvaluatedKey,
+		ConsumedCapacity: queryOutput.ConsumedCapacity,
+	}, nil
+}
+
+func (m *MemoryDynamoClient) BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	total := 0
+	for _, request := range params.RequestItems {
+		total += len(request.Keys)
+	}
+	if total == 0 || total > 100 {
+		return nil, newMemoryValidationError("Too many items requested for the BatchGetItem call")
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	output := &dynamodb.BatchGetItemOutput{
+		Responses:       map[string][]map[string]types.AttributeValue{},
+		UnprocessedKeys: map[string]types.KeysAndAttributes{},
+	}
+	tableNames := make([]string, 0, len(params.RequestItems))
+	for tableName := range params.RequestItems {
+		tableNames = append(tableNames, tableName)
+	}
+	sort.Strings(tableNames)
+	processed := 0
+	for _, tableName := range tableNames {
+		request := params.RequestItems[tableName]
+		table, err := m.table(aws.String(tableName))
+		if err != nil {
+			return nil, err
+		}
+		seen := map[string]bool{}
+		var found []memoryItem
+		for i, key := range request.Keys {
+			keyString, err := table.itemKey(key)
+			if err != nil {
+				return nil, err
+			}
+			if seen[keyString] {
+				return nil, newMemoryValidationError("Provided list of item keys contains duplicates")
+			}
+			seen[keyString] = true
+			if m.batchLimit > 0 && processed >= m.batchLimit {
+				unprocessed := request
+				unprocessed.Keys = request.Keys[i:]
+				output.UnprocessedKeys[tableName] = unprocessed
+				break
+			}
+			processed++
+			if item, ok := table.items[keyString]; ok {
+				found = append(found, copyItem(item))
+			}
+		}
+		units := readCapacityUnits(found, aws.ToBool(request.ConsistentRead))
+		found, err = applyProjection(found, request.ProjectionExpression, request.ExpressionAttributeNames)
+		if err != nil {
+			return nil, err
+		}
+		output.Responses[tableName] = found
+		if capacity := consumedCapacity(aws.String(tableName), nil, params.ReturnConsumedCapacity, units, true); capacity != nil {
+			output.ConsumedCapacity = append(output.ConsumedCapacity, *capacity)
+		}
+	}
+	return output, nil
+}
+
+func (m *MemoryDynamoClient) BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	total := 0
+	for _, requests := range params.RequestItems {
+		total += len(requests)
+	}
+	if total == 0 || total > 25 {
+		return nil, newMemoryValidationError("Too many items requested for the BatchWriteItem call")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tableNames := make([]string, 0, len(params.RequestItems))
+	for tableName := range params.RequestItems {
+		tableNames = append(tableNames, tableName)
+	}
+	sort.Strings(tableNames)
+	type memoryBatchWrite struct {
+		table *memoryTable
+		key   string
+		item  memoryItem
+	}
+	var writes []memoryBatchWrite
+	seen := map[string]bool{}
+	for _, tableName := range tableNames {
+		table, err := m.table(aws.String(tableName))
+		if err != nil {
+			return nil, err
+		}
+		for _, request := range params.RequestItems[tableName] {
+			var write memoryBatchWrite
+			write.table = table
+			switch {
+			case request.PutRequest != nil && request.DeleteRequest == nil:
+				write.key, err = table.validateItem(request.PutRequest.Item)
+				write.item = request.PutRequest.Item
+			case request.DeleteRequest != nil && request.PutRequest == nil:
+				write.key, err = table.itemKey(request.DeleteRequest.Key)
+			default:
+				err = newMemoryValidationError("WriteRequest must contain exactly one of PutRequest or DeleteRequest")
+			}
+			if err != nil {
+				return nil, err
+			}
+			if seen[tableName+"/"+write.key] {
+				return nil, newMemoryValidationError("Provided list of item keys contains duplicates")
+			}
+			seen[tableName+"/"+write.key] = true
+			writes = append(writes, write)
+		}
+	}
+
+	output := &dynamodb.BatchWriteItemOutput{UnprocessedItems: map[string][]types.WriteRequest{}}
+	capacityByTable := map[string]float64{}
+	position := 0
+	for _, tableName := range tableNames {
+		for _, request := range params.RequestItems[tableName] {
+			write := writes[position]
+			position++
+			if m.batchLimit > 0 && position > m.batchLimit {
+				output.UnprocessedItems[tableName] = append(output.UnprocessedItems[tableName], request)
+				continue
+			}
+			if write.item != nil {
+				write.table.items[write.key] = copyItem(write.item)
+				capacityByTable[tableName] += writeCapacityUnits(write.item)
+			} else {
+				capacityByTable[tableName] += writeCapacityUnits(write.table.items[write.key])
+				delete(write.table.items, write.key)
+			}
+		}
+	}
+	for _, tableName := range tableNames {
+		units, ok := capacityByTable[tableName]
+		if !ok {
+			continue
+		}
+		if capacity := consumedCapacity(aws.String(tableName), nil, params.ReturnConsumedCapacity, units, false); capacity != nil {
+			output.ConsumedCapacity = append(output.ConsumedCapacity, *capacity)
+		}
+	}
+	return output, nil
+}
+
+type memoryTransactWrite struct {
+	table    *memoryTable
+	key      string
+	existing memoryItem
+	result   memoryItem
+	remove   bool
+	check    bool
+}
+
+func (m *MemoryDynamoClient) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(params.TransactItems) == 0 || len(params.TransactItems) > 100 {
+		return nil, newMemoryValidationError("TransactItems must contain between 1 and 100 items")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	token := aws.ToString(params.ClientRequestToken)
+	if token != "" && m.transactTokens[token] {
+		return &dynamodb.TransactWriteItemsOutput{}, nil
+	}
+
+	writes := make([]memoryTransactWrite, len(params.TransactItems))
+	reasons := make([]types.CancellationReason, len(params.TransactItems))
+	capacityByTable := map[string]float64{}
+	touched := map[string]bool{}
+	canceled := false
+	for i, transactItem := range params.TransactItems {
+		var (
+			tableName      *string
+			keyItem        memoryItem
+			condition      *string
+			names          map[string]string
+			values         map[string]types.AttributeValue
+			returnOnFailed types.ReturnValuesOnConditionCheckFailure
+		)
+		write := memoryTransactWrite{}
+		switch {
+		case transactItem.Put != nil:
+			put := transactItem.Put
+			tableName, keyItem, condition, names, values, returnOnFailed = put.TableName, put.Item, put.ConditionExpression, put.ExpressionAttributeNames, put.ExpressionAttributeValues, put.ReturnValuesOnConditionCheckFailure
+		case transactItem.Update != nil:
+			update := transactItem.Update
+			tableName, keyItem, condition, names, values, returnOnFailed = update.TableName, update.Key, update.ConditionExpression, update.ExpressionAttributeNames, update.ExpressionAttributeValues, update.ReturnValuesOnConditionCheckFailure
+		case transactItem.Delete != nil:
+			del := transactItem.Delete
+			tableName, keyItem, condition, names, values, returnOnFailed = del.TableName, del.Key, del.ConditionExpression, del.ExpressionAttributeNames, del.ExpressionAttributeValues, del.ReturnValuesOnConditionCheckFailure
+			write.remove = true
+		case transactItem.ConditionCheck != nil:
+			check := transactItem.ConditionCheck
+			tableName, keyItem, condition, names, values, returnOnFailed = check.TableName, check.Key, check.ConditionExpression, check.ExpressionAttributeNames, check.ExpressionAttributeValues, check.ReturnValuesOnConditionCheckFailure
+			write.check = true
+			if aws.ToString(condition) == "" {
+				return nil, newMemoryValidationError("ConditionCheck requires a ConditionExpression")
+			}
+		default:
+			return nil, newMemoryValidationError("TransactItems[%d] must contain exactly one operation", i)
+		}
+		table, err := m.table(tableName)
+		if err != nil {
+			return nil, err
+		}
+		write.table = table
+		if transactItem.Put != nil {
+			write.key, err = table.validateItem(keyItem)
+		} else {
+			write.key, err = table.itemKey(keyItem)
+		}
+		if err != nil {
+			return nil, err
+		}
+		identity := aws.ToString(tableName) + "/" + write.key
+		if touched[identity] {
+			return nil, newMemoryValidationError("Transaction request cannot include multiple operations on one item")
+		}
+		touched[identity] = true
+		write.existing = table.items[write.key]
+
+		ok, err := evaluateCondition(condition, names, values, write.existing)
+		if err != nil {
+			return nil, err
+		}
+		reasons[i] = types.CancellationReason{Code: aws.String("None")}
+		if !ok {
+			canceled = true
+			reasons[i] = types.CancellationReason{
+				Code:    aws.String("ConditionalCheckFailed"),
+				Message: aws.String("The conditional request failed"),
+			}
+			if returnOnFailed == types.ReturnValuesOnConditionCheckFailureAllOld && write.existing != nil {
+				reasons[i].Item = copyItem(write.existing)
+			}
+			continue
+		}
+		switch {
+		case transactItem.Put != nil:
+			write.result = copyItem(keyItem)
+		case transactItem.Update != nil:
+			write.result, _, err = table.prepareUpdate(keyItem, write.existing, transactItem.Update.UpdateExpression, names, values)
+			if err != nil {
+				return nil, err
+			}
+		}
+		writes[i] = write
+		if write.result != nil {
+			capacityByTable[aws.ToString(tableName)] += 2 * writeCapacityUnits(write.result)
+		} else {
+			capacityByTable[aws.ToString(tableName)] += 2 * writeCapacityUnits(write.existing)
+		}
+	}
+
+	if canceled {
+		codes := make([]string, len(reasons))
+		for i, reason := range reasons {
+			codes[i] = aws.ToString(reason.Code)
+		}
+		return nil, &types.TransactionCanceledException{
+			Message:             aws.String("Transaction cancelled, please refer cancellation reasons for specific reasons [" + strings.Join(codes, ", ") + "]"),
+			CancellationReasons: reasons,
+		}
+	}
+
+	for _, write := range writes {
+		switch {
+		case write.check:
+		case write.remove:
+			delete(write.table.items, write.key)
+		default:
+			write.table.items[write.key] = write.result
+		}
+	}
+	if token != "" {
+		if m.transactTokens == nil {
+			m.transactTokens = make(map[string]bool)
+		}
+		m.transactTokens[token] = true
+	}
+	output := &dynamodb.TransactWriteItemsOutput{}
+	for tableName, units := range capacityByTable {
+		if capacity := consumedCapacity(aws.String(tableName), nil, params.ReturnConsumedCapacity, units, false); capacity != nil {
+			output.ConsumedCapacity = append(output.ConsumedCapacity, *capacity)
+		}
+	}
+	return output, nil
+}
+
+func (m *MemoryDynamoClient) TransactGetItems(ctx context.Context, params *dynamodb.TransactGetItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactGetItemsOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(params.TransactItems) == 0 || len(params.TransactItems) > 100 {
+		return nil, newMemoryValidationError("TransactItems must contain between 1 and 100 items")
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	responses := make([]types.ItemResponse, len(params.TransactItems))
+	capacityByTable := map[string]float64{}
+	touched := map[string]bool{}
+	for i, transactItem := range params.TransactItems {
+		get := transactItem.Get
+		if get == nil {
+			return nil, newMemoryValidationError("TransactItems[%d] must contain a Get operation", i)
+		}
+		table, err := m.table(get.TableName)
+		if err != nil {
+			return nil, err
+		}
+		key, err := table.itemKey(get.Key)
+		if err != nil {
+			return nil, err
+		}
+		identity := aws.ToString(get.TableName) + "/" + key
+		if touched[identity] {
+			return nil, newMemoryValidationError("Transaction request cannot include multiple operations on one item")
+		}
+		touched[identity] = true
+
+		item, ok := table.items[key]
+		if !ok {
+			capacityByTable[aws.ToString(get.TableName)] += 2 * readCapacityUnits(nil, true)
+			continue
+		}
+		capacityByTable[aws.ToString(get.TableName)] += 2 * readCapacityUnits([]memoryItem{item}, true)
+		projected, err := applyProjection([]memoryItem{copyItem(item)}, get.ProjectionExpression, get.ExpressionAttributeNames)
+		if err != nil {
+			return nil, err
+		}
+		responses[i].Item = projected[0]
+	}
+
+	output := &dynamodb.TransactGetItemsOutput{Responses: responses}
+	for tableName, units := range capacityByTable {
+		if capacity := consumedCapacity(aws.String(tableName), nil, params.ReturnConsumedCapacity, units, true); capacity != nil {
+			output.ConsumedCapacity = append(output.ConsumedCapacity, *capacity)
+		}
+	}
+	return output, nil
+}
@@ -0,0 +1,200 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	streamtypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+)
+
+// MemoryStreamClient is an in-memory implementation of DynamoStreamApiClient
+// meant for unit tests. Shards and records are added by hand; records get
+// increasing sequence numbers and a closed shard ends its iterators once all
+// of its records were read.
+type MemoryStreamClient struct {
+	mu        sync.Mutex
+	streamArn string
+	shards    []*memoryStreamShard
+	sequence  int
+	// describeLimit is the default page size of DescribeStream.
+	describeLimit int
+}
+
+type memoryStreamShard struct {
+	id      string
+	parent  string
+	records []streamtypes.Record
+	closed  bool
+}
+
+// CreateMemoryStreamClient returns a stream without shards.
+func CreateMemoryStreamClient(streamArn string) *MemoryStreamClient {
+	return &MemoryStreamClient{streamArn: streamArn, describeLimit: 100}
+}
+
+// AddShard opens a shard. parentShardID is empty for a root shard.
+func (m *MemoryStreamClient) AddShard(shardID, parentShardID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.shards = append(m.shards, &memoryStreamShard{id: shardID, parent: parentShardID})
+}
+
+// CloseShard stops shardID from receiving records, as DynamoDB does when it
+// splits a shard.
+func (m *MemoryStreamClient) CloseShard(shardID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if shard := m.shard(shardID); shard != nil {
+		shard.closed = true
+	}
+}
+
+// PutRecords appends records to shardID, filling in their sequence numbers.
+func (m *MemoryStreamClient) PutRecords(shardID string, records ...streamtypes.Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	shard := m.shard(shardID)
+	if shard == nil {
+		return fmt.Errorf("memory stream: unknown shard %s", shardID)
+	}
+	if shard.closed {
+		return fmt.Errorf("memory stream: shard %s is closed", shardID)
+	}
+	for _, record := range records {
+		m.sequence++
+		streamRecord := streamtypes.StreamRecord{}
+		if record.Dynamodb != nil {
+			streamRecord = *record.Dynamodb
+		}
+		streamRecord.SequenceNumber = aws.String(fmt.Sprintf("%021d", m.sequence))
+		if streamRecord.ApproximateCreationDateTime == nil {
+			streamRecord.ApproximateCreationDateTime = aws.Time(time.Now())
+		}
+		record.Dynamodb = &streamRecord
+		if record.EventID == nil {
+			record.EventID = aws.String(strconv.Itoa(m.sequence))
+		}
+		shard.records = append(shard.records, record)
+	}
+	return nil
+}
+
+func (m *MemoryStreamClient) shard(shardID string) *memoryStreamShard {
+	for _, shard := range m.shards {
+		if shard.id == shardID {
+			return shard
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStreamClient) checkStream(streamArn *string) error {
+	if aws.ToString(streamArn) != m.streamArn {
+		return &streamtypes.ResourceNotFoundException{Message: aws.String("Requested resource not found: " + aws.ToString(streamArn))}
+	}
+	return nil
+}
+
+func (m *MemoryStreamClient) DescribeStream(ctx context.Context, params *dynamodbstreams.DescribeStreamInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.DescribeStreamOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkStream(params.StreamArn); err != nil {
+		return nil, err
+	}
+	limit := m.describeLimit
+	if params.Limit != nil && int(*params.Limit) < limit {
+		limit = int(*params.Limit)
+	}
+	start := 0
+	if params.ExclusiveStartShardId != nil {
+		for i, shard := range m.shards {
+			if shard.id == *params.ExclusiveStartShardId {
+				start = i + 1
+			}
+		}
+	}
+	description := &streamtypes.StreamDescription{
+		StreamArn:    aws.String(m.streamArn),
+		StreamStatus: streamtypes.StreamStatusEnabled,
+	}
+	for _, shard := range m.shards[start:min(start+limit, len(m.shards))] {
+		sequenceRange := &streamtypes.SequenceNumberRange{}
+		if len(shard.records) > 0 {
+			sequenceRange.StartingSequenceNumber = shard.records[0].Dynamodb.SequenceNumber
+			if shard.closed {
+				sequenceRange.EndingSequenceNumber = shard.records[len(shard.records)-1].Dynamodb.SequenceNumber
+			}
+		}
+		result := streamtypes.Shard{ShardId: aws.String(shard.id), SequenceNumberRange: sequenceRange}
+		if shard.parent != "" {
+			result.ParentShardId = aws.String(shard.parent)
+		}
+		description.Shards = append(description.Shards, result)
+	}
+	if start+limit < len(m.shards) {
+		description.LastEvaluatedShardId = aws.String(m.shards[start+limit-1].id)
+	}
+	return &dynamodbstreams.DescribeStreamOutput{StreamDescription: description}, nil
+}
+
+func (m *MemoryStreamClient) GetShardIterator(ctx context.Context, params *dynamodbstreams.GetShardIteratorInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetShardIteratorOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkStream(params.StreamArn); err != nil {
+		return nil, err
+	}
+	shard := m.shard(aws.ToString(params.ShardId))
+	if shard == nil {
+		return nil, &streamtypes.ResourceNotFoundException{Message: aws.String("Requested resource not found: shard " + aws.ToString(params.ShardId))}
+	}
+	var position int
+	switch params.ShardIteratorType {
+	case streamtypes.ShardIteratorTypeTrimHorizon:
+		position = 0
+	case streamtypes.ShardIteratorTypeLatest:
+		position = len(shard.records)
+	case streamtypes.ShardIteratorTypeAtSequenceNumber, streamtypes.ShardIteratorTypeAfterSequenceNumber:
+		position = -1
+		for i, record := range shard.records {
+			if aws.ToString(record.Dynamodb.SequenceNumber) == aws.ToString(params.SequenceNumber) {
+				position = i
+			}
+		}
+		if position < 0 {
+			return nil, newMemoryValidationError("sequence number %s is not in shard %s", aws.ToString(params.SequenceNumber), shard.id)
+		}
+		if params.ShardIteratorType == streamtypes.ShardIteratorTypeAfterSequenceNumber {
+			position++
+		}
+	default:
+		return nil, newMemoryValidationError("unsupported shard iterator type %s", params.ShardIteratorType)
+	}
+	return &dynamodbstreams.GetShardIteratorOutput{ShardIterator: aws.String(shard.id + "/" + strconv.Itoa(position))}, nil
+}
+
+func (m *MemoryStreamClient) GetRecords(ctx context.Context, params *dynamodbstreams.GetRecordsInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetRecordsOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	shardID, positionText, found := strings.Cut(aws.ToString(params.ShardIterator), "/")
+	position, err := strconv.Atoi(positionText)
+	shard := m.shard(shardID)
+	if !found || err != nil || shard == nil || position > len(shard.records) {
+		return nil, newMemoryValidationError("invalid shard iterator %s", aws.ToString(params.ShardIterator))
+	}
+	limit := 1000
+	if params.Limit != nil && int(*params.Limit) < limit {
+		limit = int(*params.Limit)
+	}
+	end := min(position+limit, len(shard.records))
+	output := &dynamodbstreams.GetRecordsOutput{Records: append([]streamtypes.Record{}, shard.records[position:end]...)}
+	if !shard.closed || end < len(shard.records) {
+		output.NextShardIterator = aws.String(shard.id + "/" + strconv.Itoa(end))
+	}
+	return output, nil
+}
@@ -0,0 +1,194 @@
+package db
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func memoryThroughputDescription(throughput *types.ProvisionedThroughput) *types.ProvisionedThroughputDescription {
+	if throughput == nil {
+		return nil
+	}
+	return &types.ProvisionedThroughputDescription{
+		ReadCapacityUnits:  throughput.ReadCapacityUnits,
+		WriteCapacityUnits: throughput.WriteCapacityUnits,
+	}
+}
+
+// DescribeTable returns the description of a table. Tables and indexes are
+// always ACTIVE.
+func (m *MemoryDynamoClient) DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	table, err := m.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	description := table.description
+	description.ItemCount = aws.Int64(int64(len(table.items)))
+	description.GlobalSecondaryIndexes = append([]types.GlobalSecondaryIndexDescription{}, table.description.GlobalSecondaryIndexes...)
+	description.LocalSecondaryIndexes = append([]types.LocalSecondaryIndexDescription{}, table.description.LocalSecondaryIndexes...)
+	return &dynamodb.DescribeTableOutput{Table: &description}, nil
+}
+
+// UpdateTable changes the billing mode and throughput of a table and creates,
+// updates or deletes one global secondary index. New indexes are ACTIVE and
+// backfilled immediately.
+func (m *MemoryDynamoClient) UpdateTable(ctx context.Context, params *dynamodb.UpdateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTableOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	table, err := m.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	created := 0
+	for _, update := range params.GlobalSecondaryIndexUpdates {
+		if update.Create != nil {
+			created++
+		}
+	}
+	if created > 1 {
+		return nil, newMemoryValidationError("Subscriber limit exceeded: Only 1 online index can be created or deleted simultaneously per table")
+	}
+
+	description := table.description
+	attributeTypes := make(map[string]types.ScalarAttributeType, len(table.attributeTypes))
+	for name, attributeType := range table.attributeTypes {
+		attributeTypes[name] = attributeType
+	}
+	for _, definition := range params.AttributeDefinitions {
+		name := aws.ToString(definition.AttributeName)
+		if existing, ok := attributeTypes[name]; ok && existing != definition.AttributeType {
+			return nil, newMemoryValidationError("attribute %s is already defined as %s", name, existing)
+		}
+		if _, ok := attributeTypes[name]; !ok {
+			attributeTypes[name] = definition.AttributeType
+			description.AttributeDefinitions = append(description.AttributeDefinitions, definition)
+		}
+	}
+	if params.BillingMode != "" {
+		description.BillingModeSummary = &types.BillingModeSummary{BillingMode: params.BillingMode}
+		if params.BillingMode == types.BillingModePayPerRequest {
+			description.ProvisionedThroughput = nil
+		}
+	}
+	if params.ProvisionedThroughput != nil {
+		description.ProvisionedThroughput = memoryThroughputDescription(params.ProvisionedThroughput)
+	}
+
+	indexes := append([]types.GlobalSecondaryIndexDescription{}, description.GlobalSecondaryIndexes...)
+	table.attributeTypes = attributeTypes
+	for _, update := range params.GlobalSecondaryIndexUpdates {
+		switch {
+		case update.Create != nil:
+			index, err := table.addIndex(aws.ToString(update.Create.IndexName), update.Create.KeySchema, update.Create.Projection)
+			if err != nil {
+				return nil, err
+			}
+			indexes = append(indexes, types.GlobalSecondaryIndexDescription{
+				IndexName:             aws.String(index.name),
+				IndexStatus:           types.IndexStatusActive,
+				KeySchema:             update.Create.KeySchema,
+				Projection:            update.Create.Projection,
+				ProvisionedThroughput: memoryThroughputDescription(update.Create.ProvisionedThroughput),
+			})
+		case update.Delete != nil:
+			name := aws.ToString(update.Delete.IndexName)
+			if _, ok := table.indexes[name]; !ok {
+				return nil, &types.ResourceNotFoundException{Message: aws.String("Requested resource not found: index " + name)}
+			}
+			delete(table.indexes, name)
+			for i := range indexes {
+				if aws.ToString(indexes[i].IndexName) == name {
+					indexes = append(indexes[:i], indexes[i+1:]...)
+					break
+				}
+			}
+		case update.Update != nil:
+			name := aws.ToString(update.Update.IndexName)
+			found := false
+			for i := range indexes {
+				if aws.ToString(indexes[i].IndexName) == name {
+					indexes[i].ProvisionedThroughput = memoryThroughputDescription(update.Update.ProvisionedThroughput)
+					found = true
+				}
+			}
+			if !found {
+				return nil, &types.ResourceNotFoundException{Message: aws.String("Requested resource not found: index " + name)}
+			}
+		}
+	}
+	description.GlobalSecondaryIndexes = indexes
+	table.description = description
+	return &dynamodb.UpdateTableOutput{TableDescription: &description}, nil
+}
+
+func (m *MemoryDynamoClient) DeleteTable(ctx context.Context, params *dynamodb.DeleteTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteTableOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	table, err := m.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	delete(m.tables, aws.ToString(params.TableName))
+	description := table.description
+	description.TableStatus = types.TableStatusDeleting
+	return &dynamodb.DeleteTableOutput{TableDescription: &description}, nil
+}
+
+func (m *MemoryDynamoClient) DescribeTimeToLive(ctx context.Context, params *dynamodb.DescribeTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTimeToLiveOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	table, err := m.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	description := table.timeToLive
+	return &dynamodb.DescribeTimeToLiveOutput{TimeToLiveDescription: &description}, nil
+}
+
+// UpdateTimeToLive enables or disables TTL. Expired items are not deleted by
+// the memory client.
+func (m *MemoryDynamoClient) UpdateTimeToLive(ctx context.Context, params *dynamodb.UpdateTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTimeToLiveOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if params.TimeToLiveSpecification == nil || aws.ToString(params.TimeToLiveSpecification.AttributeName) == "" {
+		return nil, newMemoryValidationError("TimeToLiveSpecification with an AttributeName is required")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	table, err := m.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+	specification := *params.TimeToLiveSpecification
+	enabled := table.timeToLive.TimeToLiveStatus == types.TimeToLiveStatusEnabled
+	switch {
+	case aws.ToBool(specification.Enabled) && enabled:
+		return nil, newMemoryValidationError("TimeToLive is already enabled")
+	case !aws.ToBool(specification.Enabled) && !enabled:
+		return nil, newMemoryValidationError("TimeToLive is already disabled")
+	case aws.ToBool(specification.Enabled):
+		table.timeToLive = types.TimeToLiveDescription{AttributeName: specification.AttributeName, TimeToLiveStatus: types.TimeToLiveStatusEnabled}
+	default:
+		table.timeToLive = types.TimeToLiveDescription{TimeToLiveStatus: types.TimeToLiveStatusDisabled}
+	}
+	return &dynamodb.UpdateTimeToLiveOutput{TimeToLiveSpecification: &specification}, nil
+}
@@ -0,0 +1,155 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ProjectionOf returns the projection of the attributes of the struct that
+// resultDataPointer holds, directly or as the element of a slice. Add it to
+// the expression of a query with expression.Builder.WithProjection, or to a
+// KeyQuery with Project.
+func ProjectionOf(resultDataPointer interface{}) (expression.ProjectionBuilder, error) {
+	names, err := projectedAttributesOf(resultDataPointer)
+	if err != nil {
+		return expression.ProjectionBuilder{}, err
+	}
+	var projection expression.ProjectionBuilder
+	for _, name := range names {
+		projection = projection.AddNames(expression.NameNoDotSplit(name))
+	}
+	return projection, nil
+}
+
+func projectedAttributesOf(resultDataPointer interface{}) ([]string, error) {
+	targetType := reflect.TypeOf(resultDataPointer)
+	for targetType != nil && (targetType.Kind() == reflect.Ptr || targetType.Kind() == reflect.Slice || targetType.Kind() == reflect.Array) {
+		targetType = targetType.Elem()
+	}
+	if targetType == nil || targetType.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("dynamo: cannot derive a projection from %T, it is not a struct or a slice of structs", resultDataPointer)
+	}
+	info, err := getDynamoStructInfo(targetType)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(info.fields))
+	for _, field := range info.fields {
+		names = append(names, field.name)
+	}
+	return names, nil
+}
+
+// readProjection is the ProjectionExpression of a GetItem or BatchGetItem
+// call with the attribute names it uses. The zero value reads whole items.
+type readProjection struct {
+	expression *string
+	names      map[string]string
+}
+
+// buildReadProjection projects attributes, document paths such as
+// "address.city", or, when projectStruct is set, the fields of the struct
+// behind resultDataPointer. keyNames are always added so the items can still
+// be matched to their keys.
+func buildReadProjection(attributes []string, projectStruct bool, resultDataPointer interface{}, keyNames []string) (readProjection, error) {
+	if len(attributes) == 0 && !projectStruct {
+		return readProjection{}, nil
+	}
+	projected := map[string]bool{}
+	var projection expression.ProjectionBuilder
+	add := func(name string, builder expression.NameBuilder) {
+		if !projected[name] {
+			projected[name] = true
+			projection = projection.AddNames(builder)
+		}
+	}
+	for _, attribute := range attributes {
+		add(attribute, expression.Name(attribute))
+	}
+	if projectStruct {
+		names, err := projectedAttributesOf(resultDataPointer)
+		if err != nil {
+			return readProjection{}, err
+		}
+		for _, name := range names {
+			add(name, expression.NameNoDotSplit(name))
+		}
+	}
+	for _, name := range keyNames {
+		add(name, expression.NameNoDotSplit(name))
+	}
+	expr, err := expression.NewBuilder().WithProjection(projection).Build()
+	if err != nil {
+		return readProjection{}, err
+	}
+	return readProjection{expression: expr.Projection(), names: expr.Names()}, nil
+}
+
+// GetOptions configures GetWithOptions.
+type GetOptions struct {
+	ConsistentRead bool
+	// Attributes limits the read to these attributes or document paths.
+	Attributes []string
+	// ProjectStruct limits the read to the fields of resultDataPointer.
+	ProjectStruct bool
+}
+
+// GetWithOptions is Get with a projection and consistent reads. Attribute
+// names are always sent as placeholders, so reserved words are safe. An
+// expired item is reported as ErrQueryNoData, see WithExpiredItems.
+func (c DynamoDatabaseClient) GetWithOptions(ctx context.Context, tableName string, keys map[string]types.AttributeValue, resultDataPointer interface{}, options GetOptions) error {
+	expiry := expiryAttribute(ctx, resultDataPointer)
+	var expiryNames []string
+	if expiry != "" {
+		expiryNames = []string{expiry}
+	}
+	projection, err := buildReadProjection(options.Attributes, options.ProjectStruct, resultDataPointer, expiryNames)
+	if err != nil {
+		return err
+	}
+	input := &dynamodb.GetItemInput{
+		TableName:                aws.String(c.GetTableUrl(tableName)),
+		Key:                      keys,
+		ProjectionExpression:     projection.expression,
+		ExpressionAttributeNames: projection.names,
+		ReturnConsumedCapacity:   types.ReturnConsumedCapacityTotal,
+	}
+	if options.ConsistentRead {
+		input.ConsistentRead = aws.Bool(true)
+	}
+	result, err := c.dynamoClient.GetItem(ctx, input)
+	if err != nil {
+		return err
+	}
+	return c.unmarshalItem(ctx, tableName, keys, result.Item, resultDataPointer)
+}
+
+// unmarshalItem unmarshals an item read by key into resultDataPointer. A
+// missing or expired item is reported as ErrQueryNoData.
+func (c DynamoDatabaseClient) unmarshalItem(ctx context.Context, tableName string, keys map[string]types.AttributeValue, item map[string]types.AttributeValue, resultDataPointer interface{}) error {
+	if item == nil || isExpired(expiryAttribute(ctx, resultDataPointer), item) {
+		return ErrQueryNoData
+	}
+	cipher, err := c.attributeCipher(tableName, resultDataPointer)
+	if err != nil {
+		return err
+	}
+	if item, err = cipher.open(ctx, item, keys); err != nil {
+		return err
+	}
+	return attributevalue.UnmarshalMap(item, resultDataPointer)
+}
+
+// Project limits the query to the attributes of projection, e.g. the one
+// returned by ProjectionOf.
+func (q *KeyQuery) Project(projection expression.ProjectionBuilder) *KeyQuery {
+	q.projection = &projection
+	return q
+}
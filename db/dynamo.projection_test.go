@@ -0,0 +1,133 @@
+package db
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	paginate "github.com/techvuya/vuya-go-utils/paginate"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type testEventStatus struct {
+	EventID string `dynamodbav:"eventId"`
+	Status  string `dynamodbav:"status"`
+}
+
+func TestGetWithOptionsProjection(t *testing.T) {
+	ctx := context.Background()
+	client := createTestDynamoClient(t)
+	seedTestEvents(t, client, 2)
+
+	testCases := []struct {
+		description string
+		options     GetOptions
+		expected    testEvent
+	}{
+		{"whole item", GetOptions{}, testEvent{OrgID: "org-1", EventID: "evt-01", Status: "closed", Amount: 10, CreatedAt: 99}},
+		{"attributes", GetOptions{Attributes: []string{"status", "amount"}}, testEvent{Status: "closed", Amount: 10}},
+		{"consistent read", GetOptions{ConsistentRead: true, Attributes: []string{"createdAt"}}, testEvent{CreatedAt: 99}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			var event testEvent
+			if err := client.GetWithOptions(ctx, "events", testEventKey("evt-01"), &event, tc.options); err != nil {
+				t.Fatalf("GetWithOptions failed: %v", err)
+			}
+			if event != tc.expected {
+				t.Errorf("Item -> Expected: %+v // Returned: %+v", tc.expected, event)
+			}
+		})
+	}
+
+	var status testEventStatus
+	if err := client.GetWithOptions(ctx, "events", testEventKey("evt-01"), &status, GetOptions{ProjectStruct: true}); err != nil {
+		t.Fatalf("GetWithOptions with ProjectStruct failed: %v", err)
+	}
+	if expected := (testEventStatus{EventID: "evt-01", Status: "closed"}); status != expected {
+		t.Errorf("ProjectStruct -> Expected: %+v // Returned: %+v", expected, status)
+	}
+}
+
+func TestGetBatchProjection(t *testing.T) {
+	ctx := context.Background()
+	client := createTestDynamoClient(t)
+	seedTestEvents(t, client, 4)
+
+	keys := []map[string]types.AttributeValue{testEventKey("evt-03"), testEventKey("evt-00"), testEventKey("evt-02")}
+	var events []testEvent
+	options := BatchGetOptions{PreserveOrder: true, Attributes: []string{"amount"}}
+	if err := client.GetBatchWithOptions(ctx, "events", keys, &events, options); err != nil {
+		t.Fatalf("GetBatchWithOptions failed: %v", err)
+	}
+	expected := []testEvent{
+		{OrgID: "org-1", EventID: "evt-03", Amount: 30},
+		{OrgID: "org-1", EventID: "evt-00", Amount: 0},
+		{OrgID: "org-1", EventID: "evt-02", Amount: 20},
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("Items -> Expected: %+v // Returned: %+v", expected, events)
+	}
+
+	var statuses []testEventStatus
+	requests := []BatchGetRequest{{TableName: "events", Keys: keys[:1], ResultDataPointer: &statuses}}
+	if err := client.GetBatchTables(ctx, requests, BatchGetOptions{ProjectStruct: true}); err != nil {
+		t.Fatalf("GetBatchTables failed: %v", err)
+	}
+	if expected := []testEventStatus{{EventID: "evt-03", Status: "closed"}}; !reflect.DeepEqual(statuses, expected) {
+		t.Errorf("ProjectStruct -> Expected: %+v // Returned: %+v", expected, statuses)
+	}
+}
+
+func TestQueryProjection(t *testing.T) {
+	ctx := context.Background()
+	client := createTestDynamoClient(t)
+	seedTestEvents(t, client, 3)
+
+	projection, err := ProjectionOf(&[]testEventStatus{})
+	if err != nil {
+		t.Fatalf("ProjectionOf failed: %v", err)
+	}
+
+	keyCondition := expression.Key("orgId").Equal(expression.Value("org-1"))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCondition).WithProjection(projection).Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	var events []testEvent
+	if err := client.QueryAllItems(ctx, "events", "", expr, &events); err != nil {
+		t.Fatalf("QueryAllItems failed: %v", err)
+	}
+	for _, event := range events {
+		if event.OrgID != "" || event.Amount != 0 || event.Status == "" {
+			t.Errorf("QueryAllItems -> Expected: eventId and status only // Returned: %+v", event)
+		}
+	}
+
+	expr, err = CreateKeyQuery("orgId", "org-1").SortEqual("eventId", "evt-02").Project(projection).Build()
+	if err != nil {
+		t.Fatalf("KeyQuery Build failed: %v", err)
+	}
+	var statuses []testEventStatus
+	if err := client.QueryOne(ctx, "events", "", expr, &statuses); err != nil {
+		t.Fatalf("QueryOne failed: %v", err)
+	}
+	if expected := []testEventStatus{{EventID: "evt-02", Status: "open"}}; !reflect.DeepEqual(statuses, expected) {
+		t.Errorf("QueryOne -> Expected: %+v // Returned: %+v", expected, statuses)
+	}
+
+	var page []testEvent
+	if _, err := client.QueryPage(ctx, "events", "", expr, aws.Int32(5), &page, paginate.AgPaginateOptionsRequest{}); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(page) != 1 || page[0].Amount != 0 || page[0].Status != "open" {
+		t.Errorf("Query -> Expected: projected evt-02 // Returned: %+v", page)
+	}
+
+	if _, err := ProjectionOf(&[]string{}); err == nil {
+		t.Errorf("ProjectionOf non struct -> Expected: error // Returned: nil")
+	}
+}
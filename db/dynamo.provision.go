@@ -0,0 +1,573 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var ErrTableApiNotSupported = errors.New("ErrTableApiNotSupported")
+var ErrTableNotActive = errors.New("ErrTableNotActive")
+
+// DynamoTableApiClient is the subset of the DynamoDB SDK client used to
+// provision tables. It is satisfied by *dynamodb.Client and by
+// MemoryDynamoClient.
+type DynamoTableApiClient interface {
+	CreateTable(ctx context.Context, params *dynamodb.CreateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error)
+	DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error)
+	UpdateTable(ctx context.Context, params *dynamodb.UpdateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTableOutput, error)
+	DescribeTimeToLive(ctx context.Context, params *dynamodb.DescribeTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTimeToLiveOutput, error)
+	UpdateTimeToLive(ctx context.Context, params *dynamodb.UpdateTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTimeToLiveOutput, error)
+}
+
+// KeyAttribute is a key attribute of a table or index.
+type KeyAttribute struct {
+	Name string
+	Type types.ScalarAttributeType
+}
+
+// IndexDefinition declares a global or local secondary index. The projection
+// defaults to ALL. ReadCapacity and WriteCapacity only apply to global
+// indexes of PROVISIONED tables.
+type IndexDefinition struct {
+	Name             string
+	PartitionKey     KeyAttribute
+	SortKey          *KeyAttribute
+	ProjectionType   types.ProjectionType
+	NonKeyAttributes []string
+	ReadCapacity     int64
+	WriteCapacity    int64
+}
+
+// TableDefinition declares a table. Name is the unprefixed table name; the
+// client environment prefix is added when provisioning. BillingMode defaults
+// to PAY_PER_REQUEST.
+type TableDefinition struct {
+	Name          string
+	PartitionKey  KeyAttribute
+	SortKey       *KeyAttribute
+	GlobalIndexes []IndexDefinition
+	LocalIndexes  []IndexDefinition
+	TTLAttribute  string
+	BillingMode   types.BillingMode
+	ReadCapacity  int64
+	WriteCapacity int64
+}
+
+// DefineTable returns the definition of a table storing T, with the key
+// attributes and their types taken from the dynamo struct tags of T.
+func DefineTable[T any](tableName string) (TableDefinition, error) {
+	structType := reflect.TypeOf((*T)(nil)).Elem()
+	info, err := getDynamoStructInfo(structType)
+	if err != nil {
+		return TableDefinition{}, err
+	}
+	if info.partitionKey == nil {
+		return TableDefinition{}, fmt.Errorf("dynamo: %s has no field tagged dynamo:\",pk\"", structType)
+	}
+	definition := TableDefinition{Name: tableName}
+	if definition.PartitionKey, err = keyAttributeOf(structType, info.partitionKey); err != nil {
+		return TableDefinition{}, err
+	}
+	if info.sortKey != nil {
+		sortKey, err := keyAttributeOf(structType, info.sortKey)
+		if err != nil {
+			return TableDefinition{}, err
+		}
+		definition.SortKey = &sortKey
+	}
+	return definition, nil
+}
+
+func keyAttributeOf(structType reflect.Type, field *dynamoStructField) (KeyAttribute, error) {
+	fieldType := structType
+	for fieldType.Kind() == reflect.Ptr {
+		fieldType = fieldType.Elem()
+	}
+	fieldType = fieldType.FieldByIndex(field.index).Type
+	for fieldType.Kind() == reflect.Ptr {
+		fieldType = fieldType.Elem()
+	}
+	switch fieldType.Kind() {
+	case reflect.String:
+		return KeyAttribute{Name: field.name, Type: types.ScalarAttributeTypeS}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return KeyAttribute{Name: field.name, Type: types.ScalarAttributeTypeN}, nil
+	case reflect.Slice:
+		if fieldType.Elem().Kind() == reflect.Uint8 {
+			return KeyAttribute{Name: field.name, Type: types.ScalarAttributeTypeB}, nil
+		}
+	}
+	return KeyAttribute{}, fmt.Errorf("dynamo: key field %s must be a string, number or []byte", field.name)
+}
+
+// TableDifference is one difference between a TableDefinition and the table
+// that exists in DynamoDB.
+type TableDifference struct {
+	Field    string
+	Expected string
+	Actual   string
+}
+
+func (d TableDifference) String() string {
+	return fmt.Sprintf("%s: expected %s, found %s", d.Field, d.Expected, d.Actual)
+}
+
+// ProvisionOptions tunes how long EnsureTable waits for tables and indexes to
+// become ACTIVE. The zero value waits up to 10 minutes, polling every 2s.
+type ProvisionOptions struct {
+	WaitTimeout  time.Duration
+	PollInterval time.Duration
+}
+
+func (o ProvisionOptions) withDefaults() ProvisionOptions {
+	if o.WaitTimeout <= 0 {
+		o.WaitTimeout = 10 * time.Minute
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = 2 * time.Second
+	}
+	return o
+}
+
+func (c DynamoDatabaseClient) tableApi() (DynamoTableApiClient, error) {
+	tableApi, ok := c.GetApiClient().(DynamoTableApiClient)
+	if !ok {
+		return nil, ErrTableApiNotSupported
+	}
+	return tableApi, nil
+}
+
+// EnsureTable creates the table of definition when it does not exist, or
+// brings an existing one in line with it, and waits until the table and its
+// indexes are ACTIVE. Billing mode, throughput, missing global indexes and
+// TTL are updated in place. Differences that DynamoDB cannot change on an
+// existing table (key schema, local indexes, index keys), global indexes
+// that are not declared and TTL enabled on another attribute are left alone
+// and returned.
+func (c DynamoDatabaseClient) EnsureTable(ctx context.Context, definition TableDefinition, options ProvisionOptions) ([]TableDifference, error) {
+	options = options.withDefaults()
+	tableApi, err := c.tableApi()
+	if err != nil {
+		return nil, err
+	}
+	tableUrl := c.GetTableUrl(definition.Name)
+
+	_, err = tableApi.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(tableUrl)})
+	var notFound *types.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		if _, err := tableApi.CreateTable(ctx, definition.createTableInput(tableUrl)); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	table, err := c.waitForTable(ctx, tableApi, tableUrl, options)
+	if err != nil {
+		return nil, err
+	}
+
+	if update := definition.tableUpdate(tableUrl, table); update != nil {
+		if _, err := tableApi.UpdateTable(ctx, update); err != nil {
+			return nil, err
+		}
+		if table, err = c.waitForTable(ctx, tableApi, tableUrl, options); err != nil {
+			return nil, err
+		}
+	}
+	// DynamoDB creates one global index per UpdateTable call.
+	for _, index := range definition.GlobalIndexes {
+		if findGlobalIndex(table, index.Name) != nil {
+			continue
+		}
+		if _, err := tableApi.UpdateTable(ctx, definition.createIndexInput(tableUrl, index)); err != nil {
+			return nil, err
+		}
+		if table, err = c.waitForTable(ctx, tableApi, tableUrl, options); err != nil {
+			return nil, err
+		}
+	}
+
+	timeToLive, err := tableApi.DescribeTimeToLive(ctx, &dynamodb.DescribeTimeToLiveInput{TableName: aws.String(tableUrl)})
+	if err != nil {
+		return nil, err
+	}
+	differences := definition.differences(table, nil)
+	if difference := definition.timeToLiveDifference(timeToLive.TimeToLiveDescription); difference != nil {
+		applied, err := c.updateTimeToLive(ctx, tableApi, tableUrl, definition.TTLAttribute, timeToLive.TimeToLiveDescription)
+		if err != nil {
+			return nil, err
+		}
+		if !applied {
+			differences = append(differences, *difference)
+		}
+	}
+	return differences, nil
+}
+
+// TableDrift compares definition with the table that exists in DynamoDB
+// without changing anything.
+func (c DynamoDatabaseClient) TableDrift(ctx context.Context, definition TableDefinition) ([]TableDifference, error) {
+	tableApi, err := c.tableApi()
+	if err != nil {
+		return nil, err
+	}
+	tableUrl := c.GetTableUrl(definition.Name)
+	described, err := tableApi.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(tableUrl)})
+	if err != nil {
+		return nil, err
+	}
+	timeToLive, err := tableApi.DescribeTimeToLive(ctx, &dynamodb.DescribeTimeToLiveInput{TableName: aws.String(tableUrl)})
+	if err != nil {
+		return nil, err
+	}
+	return definition.differences(described.Table, timeToLive.TimeToLiveDescription), nil
+}
+
+func (c DynamoDatabaseClient) waitForTable(ctx context.Context, tableApi DynamoTableApiClient, tableUrl string, options ProvisionOptions) (*types.TableDescription, error) {
+	deadline := time.Now().Add(options.WaitTimeout)
+	for {
+		described, err := tableApi.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(tableUrl)})
+		if err != nil {
+			return nil, err
+		}
+		if tableIsActive(described.Table) {
+			return described.Table, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%w: %s is %s after %s", ErrTableNotActive, tableUrl, described.Table.TableStatus, options.WaitTimeout)
+		}
+		if err := sleepWithContext(ctx, options.PollInterval); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func tableIsActive(table *types.TableDescription) bool {
+	if table == nil || table.TableStatus != types.TableStatusActive {
+		return false
+	}
+	for _, index := range table.GlobalSecondaryIndexes {
+		if index.IndexStatus != types.IndexStatusActive {
+			return false
+		}
+	}
+	return true
+}
+
+// updateTimeToLive enables TTL on attribute, or disables it when attribute
+// is empty, and reports whether it did. DynamoDB takes one TTL change at a
+// time and rejects another one for about an hour, so TTL is not moved from
+// one attribute to another, nor changed while a change is in progress.
+func (c DynamoDatabaseClient) updateTimeToLive(ctx context.Context, tableApi DynamoTableApiClient, tableUrl, attribute string, current *types.TimeToLiveDescription) (bool, error) {
+	status := types.TimeToLiveStatusDisabled
+	if current != nil && current.TimeToLiveStatus != "" {
+		status = current.TimeToLiveStatus
+	}
+	specification := &types.TimeToLiveSpecification{AttributeName: aws.String(attribute), Enabled: aws.Bool(true)}
+	switch {
+	case status == types.TimeToLiveStatusDisabled && attribute != "":
+	case status == types.TimeToLiveStatusEnabled && attribute == "":
+		specification = &types.TimeToLiveSpecification{AttributeName: current.AttributeName, Enabled: aws.Bool(false)}
+	default:
+		return false, nil
+	}
+	_, err := tableApi.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+		TableName:               aws.String(tableUrl),
+		TimeToLiveSpecification: specification,
+	})
+	return err == nil, err
+}
+
+func (d TableDefinition) billingMode() types.BillingMode {
+	if d.BillingMode == "" {
+		return types.BillingModePayPerRequest
+	}
+	return d.BillingMode
+}
+
+func (d TableDefinition) throughput(readCapacity, writeCapacity int64) *types.ProvisionedThroughput {
+	if d.billingMode() != types.BillingModeProvisioned {
+		return nil
+	}
+	return &types.ProvisionedThroughput{
+		ReadCapacityUnits:  aws.Int64(readCapacity),
+		WriteCapacityUnits: aws.Int64(writeCapacity),
+	}
+}
+
+func keySchema(partitionKey KeyAttribute, sortKey *KeyAttribute) []types.KeySchemaElement {
+	schema := []types.KeySchemaElement{{AttributeName: aws.String(partitionKey.Name), KeyType: types.KeyTypeHash}}
+	if sortKey != nil {
+		schema = append(schema, types.KeySchemaElement{AttributeName: aws.String(sortKey.Name), KeyType: types.KeyTypeRange})
+	}
+	return schema
+}
+
+func (index IndexDefinition) projection() *types.Projection {
+	projection := &types.Projection{ProjectionType: index.ProjectionType}
+	if projection.ProjectionType == "" {
+		projection.ProjectionType = types.ProjectionTypeAll
+	}
+	if projection.ProjectionType == types.ProjectionTypeInclude {
+		projection.NonKeyAttributes = index.NonKeyAttributes
+	}
+	return projection
+}
+
+// attributeDefinitions lists every key attribute of the table and of the
+// given indexes once.
+func (d TableDefinition) attributeDefinitions(globalIndexes []IndexDefinition, localIndexes []IndexDefinition) []types.AttributeDefinition {
+	seen := map[string]bool{}
+	var definitions []types.AttributeDefinition
+	add := func(attribute *KeyAttribute) {
+		if attribute == nil || seen[attribute.Name] {
+			return
+		}
+		seen[attribute.Name] = true
+		definitions = append(definitions, types.AttributeDefinition{AttributeName: aws.String(attribute.Name), AttributeType: attribute.Type})
+	}
+	add(&d.PartitionKey)
+	add(d.SortKey)
+	for _, indexes := range [][]IndexDefinition{globalIndexes, localIndexes} {
+		for i := range indexes {
+			add(&indexes[i].PartitionKey)
+			add(indexes[i].SortKey)
+		}
+	}
+	return definitions
+}
+
+func (d TableDefinition) createTableInput(tableUrl string) *dynamodb.CreateTableInput {
+	input := &dynamodb.CreateTableInput{
+		TableName:             aws.String(tableUrl),
+		KeySchema:             keySchema(d.PartitionKey, d.SortKey),
+		AttributeDefinitions:  d.attributeDefinitions(d.GlobalIndexes, d.LocalIndexes),
+		BillingMode:           d.billingMode(),
+		ProvisionedThroughput: d.throughput(d.ReadCapacity, d.WriteCapacity),
+	}
+	for _, index := range d.GlobalIndexes {
+		input.GlobalSecondaryIndexes = append(input.GlobalSecondaryIndexes, types.GlobalSecondaryIndex{
+			IndexName:             aws.String(index.Name),
+			KeySchema:             keySchema(index.PartitionKey, index.SortKey),
+			Projection:            index.projection(),
+			ProvisionedThroughput: d.throughput(index.ReadCapacity, index.WriteCapacity),
+		})
+	}
+	for _, index := range d.LocalIndexes {
+		input.LocalSecondaryIndexes = append(input.LocalSecondaryIndexes, types.LocalSecondaryIndex{
+			IndexName:  aws.String(index.Name),
+			KeySchema:  keySchema(index.PartitionKey, index.SortKey),
+			Projection: index.projection(),
+		})
+	}
+	return input
+}
+
+func (d TableDefinition) createIndexInput(tableUrl string, index IndexDefinition) *dynamodb.UpdateTableInput {
+	return &dynamodb.UpdateTableInput{
+		TableName:            aws.String(tableUrl),
+		AttributeDefinitions: d.attributeDefinitions([]IndexDefinition{index}, nil),
+		GlobalSecondaryIndexUpdates: []types.GlobalSecondaryIndexUpdate{{
+			Create: &types.CreateGlobalSecondaryIndexAction{
+				IndexName:             aws.String(index.Name),
+				KeySchema:             keySchema(index.PartitionKey, index.SortKey),
+				Projection:            index.projection(),
+				ProvisionedThroughput: d.throughput(index.ReadCapacity, index.WriteCapacity),
+			},
+		}},
+	}
+}
+
+// tableUpdate returns the UpdateTable call fixing the billing mode and
+// throughput of the table and its existing indexes, or nil when they match.
+func (d TableDefinition) tableUpdate(tableUrl string, table *types.TableDescription) *dynamodb.UpdateTableInput {
+	input := &dynamodb.UpdateTableInput{TableName: aws.String(tableUrl)}
+	changed := false
+	if tableBillingMode(table) != d.billingMode() {
+		input.BillingMode = d.billingMode()
+		changed = true
+	}
+	if d.billingMode() == types.BillingModeProvisioned {
+		if !throughputMatches(table.ProvisionedThroughput, d.ReadCapacity, d.WriteCapacity) {
+			input.ProvisionedThroughput = d.throughput(d.ReadCapacity, d.WriteCapacity)
+			changed = true
+		}
+		for _, index := range d.GlobalIndexes {
+			existing := findGlobalIndex(table, index.Name)
+			if existing == nil || throughputMatches(existing.ProvisionedThroughput, index.ReadCapacity, index.WriteCapacity) {
+				continue
+			}
+			input.GlobalSecondaryIndexUpdates = append(input.GlobalSecondaryIndexUpdates, types.GlobalSecondaryIndexUpdate{
+				Update: &types.UpdateGlobalSecondaryIndexAction{
+					IndexName:             aws.String(index.Name),
+					ProvisionedThroughput: d.throughput(index.ReadCapacity, index.WriteCapacity),
+				},
+			})
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return input
+}
+
+func tableBillingMode(table *types.TableDescription) types.BillingMode {
+	if table.BillingModeSummary != nil && table.BillingModeSummary.BillingMode != "" {
+		return table.BillingModeSummary.BillingMode
+	}
+	// Tables created as PROVISIONED may not report a billing mode summary.
+	return types.BillingModeProvisioned
+}
+
+func throughputMatches(throughput *types.ProvisionedThroughputDescription, readCapacity, writeCapacity int64) bool {
+	return throughput != nil &&
+		aws.ToInt64(throughput.ReadCapacityUnits) == readCapacity &&
+		aws.ToInt64(throughput.WriteCapacityUnits) == writeCapacity
+}
+
+func findGlobalIndex(table *types.TableDescription, name string) *types.GlobalSecondaryIndexDescription {
+	for i := range table.GlobalSecondaryIndexes {
+		if aws.ToString(table.GlobalSecondaryIndexes[i].IndexName) == name {
+			return &table.GlobalSecondaryIndexes[i]
+		}
+	}
+	return nil
+}
+
+func (d TableDefinition) timeToLiveDifference(timeToLive *types.TimeToLiveDescription) *TableDifference {
+	actual := ""
+	if timeToLive != nil && (timeToLive.TimeToLiveStatus == types.TimeToLiveStatusEnabled || timeToLive.TimeToLiveStatus == types.TimeToLiveStatusEnabling) {
+		actual = aws.ToString(timeToLive.AttributeName)
+	}
+	if actual == d.TTLAttribute {
+		return nil
+	}
+	return &TableDifference{Field: "TimeToLive", Expected: describeOrNone(d.TTLAttribute), Actual: describeOrNone(actual)}
+}
+
+func describeOrNone(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return value
+}
+
+func describeKeySchema(schema []types.KeySchemaElement, attributeTypes map[string]types.ScalarAttributeType) string {
+	parts := make([]string, 0, len(schema))
+	for _, element := range schema {
+		name := aws.ToString(element.AttributeName)
+		part := fmt.Sprintf("%s %s", element.KeyType, name)
+		if attributeType, ok := attributeTypes[name]; ok {
+			part += " " + string(attributeType)
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func describeProjection(projection *types.Projection) string {
+	if projection == nil {
+		return "none"
+	}
+	if len(projection.NonKeyAttributes) == 0 {
+		return string(projection.ProjectionType)
+	}
+	attributes := append([]string{}, projection.NonKeyAttributes...)
+	sort.Strings(attributes)
+	return string(projection.ProjectionType) + " " + strings.Join(attributes, ",")
+}
+
+// differences lists every difference between the definition and the
+// described table. timeToLive is only compared when it is not nil.
+func (d TableDefinition) differences(table *types.TableDescription, timeToLive *types.TimeToLiveDescription) []TableDifference {
+	var differences []TableDifference
+	add := func(field, expected, actual string) {
+		if expected != actual {
+			differences = append(differences, TableDifference{Field: field, Expected: expected, Actual: actual})
+		}
+	}
+	actualTypes := make(map[string]types.ScalarAttributeType, len(table.AttributeDefinitions))
+	for _, definition := range table.AttributeDefinitions {
+		actualTypes[aws.ToString(definition.AttributeName)] = definition.AttributeType
+	}
+	expectedTypes := make(map[string]types.ScalarAttributeType)
+	for _, definition := range d.attributeDefinitions(d.GlobalIndexes, d.LocalIndexes) {
+		expectedTypes[aws.ToString(definition.AttributeName)] = definition.AttributeType
+	}
+
+	add("KeySchema", describeKeySchema(keySchema(d.PartitionKey, d.SortKey), expectedTypes), describeKeySchema(table.KeySchema, actualTypes))
+	add("BillingMode", string(d.billingMode()), string(tableBillingMode(table)))
+	if d.billingMode() == types.BillingModeProvisioned && !throughputMatches(table.ProvisionedThroughput, d.ReadCapacity, d.WriteCapacity) {
+		add("ProvisionedThroughput", fmt.Sprintf("%d/%d", d.ReadCapacity, d.WriteCapacity), describeThroughput(table.ProvisionedThroughput))
+	}
+
+	declared := map[string]bool{}
+	for _, index := range d.GlobalIndexes {
+		declared[index.Name] = true
+		field := "GlobalIndex " + index.Name
+		existing := findGlobalIndex(table, index.Name)
+		if existing == nil {
+			add(field, "present", "missing")
+			continue
+		}
+		add(field+" KeySchema", describeKeySchema(keySchema(index.PartitionKey, index.SortKey), expectedTypes), describeKeySchema(existing.KeySchema, actualTypes))
+		add(field+" Projection", describeProjection(index.projection()), describeProjection(existing.Projection))
+		if d.billingMode() == types.BillingModeProvisioned && !throughputMatches(existing.ProvisionedThroughput, index.ReadCapacity, index.WriteCapacity) {
+			add(field+" ProvisionedThroughput", fmt.Sprintf("%d/%d", index.ReadCapacity, index.WriteCapacity), describeThroughput(existing.ProvisionedThroughput))
+		}
+	}
+	for _, index := range table.GlobalSecondaryIndexes {
+		if name := aws.ToString(index.IndexName); !declared[name] {
+			add("GlobalIndex "+name, "absent", "present")
+		}
+	}
+
+	declared = map[string]bool{}
+	for _, index := range d.LocalIndexes {
+		declared[index.Name] = true
+		field := "LocalIndex " + index.Name
+		var existing *types.LocalSecondaryIndexDescription
+		for i := range table.LocalSecondaryIndexes {
+			if aws.ToString(table.LocalSecondaryIndexes[i].IndexName) == index.Name {
+				existing = &table.LocalSecondaryIndexes[i]
+			}
+		}
+		if existing == nil {
+			add(field, "present", "missing")
+			continue
+		}
+		add(field+" KeySchema", describeKeySchema(keySchema(index.PartitionKey, index.SortKey), expectedTypes), describeKeySchema(existing.KeySchema, actualTypes))
+		add(field+" Projection", describeProjection(index.projection()), describeProjection(existing.Projection))
+	}
+	for _, index := range table.LocalSecondaryIndexes {
+		if name := aws.ToString(index.IndexName); !declared[name] {
+			add("LocalIndex "+name, "absent", "present")
+		}
+	}
+
+	if timeToLive != nil {
+		if difference := d.timeToLiveDifference(timeToLive); difference != nil {
+			differences = append(differences, *difference)
+		}
+	}
+	return differences
+}
+
+func describeThroughput(throughput *types.ProvisionedThroughputDescription) string {
+	if throughput == nil {
+		return "none"
+	}
+	return fmt.Sprintf("%d/%d", aws.ToInt64(throughput.ReadCapacityUnits), aws.ToInt64(throughput.WriteCapacityUnits))
+}
@@ -0,0 +1,174 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type testProvisionedItem struct {
+	OrgID   string `dynamodbav:"orgId" dynamo:",pk"`
+	Created int64  `dynamodbav:"created" dynamo:",sk"`
+	Name    string `dynamodbav:"name"`
+}
+
+func TestDefineTable(t *testing.T) {
+	definition, err := DefineTable[testProvisionedItem]("items")
+	if err != nil {
+		t.Fatalf("DefineTable failed: %v", err)
+	}
+	if definition.PartitionKey != (KeyAttribute{Name: "orgId", Type: types.ScalarAttributeTypeS}) {
+		t.Errorf("PartitionKey -> Expected: orgId S // Returned: %v", definition.PartitionKey)
+	}
+	if definition.SortKey == nil || *definition.SortKey != (KeyAttribute{Name: "created", Type: types.ScalarAttributeTypeN}) {
+		t.Errorf("SortKey -> Expected: created N // Returned: %v", definition.SortKey)
+	}
+
+	if _, err := DefineTable[testAppUser]("users"); err == nil {
+		t.Errorf("DefineTable without pk -> Expected: error // Returned: nil")
+	}
+}
+
+func TestEnsureTable(t *testing.T) {
+	ctx := context.Background()
+	memoryClient := CreateMemoryDynamoClient()
+	client := CreateDynamoDatabaseClientWithApi(memoryClient, "test")
+	options := ProvisionOptions{PollInterval: 1}
+
+	definition, err := DefineTable[testProvisionedItem]("items")
+	if err != nil {
+		t.Fatalf("DefineTable failed: %v", err)
+	}
+	definition.TTLAttribute = "expiresAt"
+
+	t.Run("creates the table", func(t *testing.T) {
+		differences, err := client.EnsureTable(ctx, definition, options)
+		if err != nil {
+			t.Fatalf("EnsureTable failed: %v", err)
+		}
+		if len(differences) != 0 {
+			t.Errorf("Differences -> Expected: none // Returned: %v", differences)
+		}
+		described, err := memoryClient.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String("test.items")})
+		if err != nil {
+			t.Fatalf("DescribeTable failed: %v", err)
+		}
+		if mode := tableBillingMode(described.Table); mode != types.BillingModePayPerRequest {
+			t.Errorf("BillingMode -> Expected: %v // Returned: %v", types.BillingModePayPerRequest, mode)
+		}
+		timeToLive, err := memoryClient.DescribeTimeToLive(ctx, &dynamodb.DescribeTimeToLiveInput{TableName: aws.String("test.items")})
+		if err != nil {
+			t.Fatalf("DescribeTimeToLive failed: %v", err)
+		}
+		if timeToLive.TimeToLiveDescription.TimeToLiveStatus != types.TimeToLiveStatusEnabled || aws.ToString(timeToLive.TimeToLiveDescription.AttributeName) != "expiresAt" {
+			t.Errorf("TimeToLive -> Expected: expiresAt ENABLED // Returned: %v %v", aws.ToString(timeToLive.TimeToLiveDescription.AttributeName), timeToLive.TimeToLiveDescription.TimeToLiveStatus)
+		}
+	})
+
+	t.Run("is idempotent", func(t *testing.T) {
+		differences, err := client.EnsureTable(ctx, definition, options)
+		if err != nil {
+			t.Fatalf("EnsureTable failed: %v", err)
+		}
+		if len(differences) != 0 {
+			t.Errorf("Differences -> Expected: none // Returned: %v", differences)
+		}
+	})
+
+	t.Run("adds indexes and updates throughput", func(t *testing.T) {
+		updated := definition
+		updated.BillingMode = types.BillingModeProvisioned
+		updated.ReadCapacity, updated.WriteCapacity = 5, 5
+		updated.GlobalIndexes = []IndexDefinition{
+			{Name: "byName", PartitionKey: KeyAttribute{Name: "name", Type: types.ScalarAttributeTypeS}, ReadCapacity: 1, WriteCapacity: 1},
+			{Name: "byCreated", PartitionKey: KeyAttribute{Name: "created", Type: types.ScalarAttributeTypeN}, ProjectionType: types.ProjectionTypeKeysOnly, ReadCapacity: 1, WriteCapacity: 1},
+		}
+		differences, err := client.EnsureTable(ctx, updated, options)
+		if err != nil {
+			t.Fatalf("EnsureTable failed: %v", err)
+		}
+		if len(differences) != 0 {
+			t.Errorf("Differences -> Expected: none // Returned: %v", differences)
+		}
+		described, err := memoryClient.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String("test.items")})
+		if err != nil {
+			t.Fatalf("DescribeTable failed: %v", err)
+		}
+		if len(described.Table.GlobalSecondaryIndexes) != 2 {
+			t.Errorf("GlobalSecondaryIndexes -> Expected: 2 // Returned: %d", len(described.Table.GlobalSecondaryIndexes))
+		}
+		if !throughputMatches(described.Table.ProvisionedThroughput, 5, 5) {
+			t.Errorf("ProvisionedThroughput -> Expected: 5/5 // Returned: %s", describeThroughput(described.Table.ProvisionedThroughput))
+		}
+	})
+
+	t.Run("reports drift it cannot fix", func(t *testing.T) {
+		drifted := definition
+		drifted.PartitionKey = KeyAttribute{Name: "tenantId", Type: types.ScalarAttributeTypeS}
+		drifted.TTLAttribute = ""
+		differences, err := client.TableDrift(ctx, drifted)
+		if err != nil {
+			t.Fatalf("TableDrift failed: %v", err)
+		}
+		fields := map[string]bool{}
+		for _, difference := range differences {
+			fields[difference.Field] = true
+		}
+		for _, field := range []string{"KeySchema", "BillingMode", "GlobalIndex byName", "GlobalIndex byCreated", "TimeToLive"} {
+			if !fields[field] {
+				t.Errorf("%s -> Expected: difference // Returned: %v", field, differences)
+			}
+		}
+
+		differences, err = client.EnsureTable(ctx, drifted, options)
+		if err != nil {
+			t.Fatalf("EnsureTable failed: %v", err)
+		}
+		fields = map[string]bool{}
+		for _, difference := range differences {
+			fields[difference.Field] = true
+		}
+		if !fields["KeySchema"] || !fields["GlobalIndex byName"] {
+			t.Errorf("Differences -> Expected: KeySchema and extra indexes // Returned: %v", differences)
+		}
+		if fields["BillingMode"] || fields["TimeToLive"] {
+			t.Errorf("Differences -> Expected: billing mode and TTL fixed // Returned: %v", differences)
+		}
+	})
+	t.Run("reports TTL moved to another attribute", func(t *testing.T) {
+		if _, err := client.EnsureTable(ctx, definition, options); err != nil {
+			t.Fatalf("EnsureTable failed: %v", err)
+		}
+		moved := definition
+		moved.TTLAttribute = "validUntil"
+		differences, err := client.EnsureTable(ctx, moved, options)
+		if err != nil {
+			t.Fatalf("EnsureTable failed: %v", err)
+		}
+		expected := TableDifference{Field: "TimeToLive", Expected: "validUntil", Actual: "expiresAt"}
+		if !slices.Contains(differences, expected) {
+			t.Errorf("Differences -> Expected: %v // Returned: %v", expected, differences)
+		}
+		timeToLive, err := memoryClient.DescribeTimeToLive(ctx, &dynamodb.DescribeTimeToLiveInput{TableName: aws.String("test.items")})
+		if err != nil {
+			t.Fatalf("DescribeTimeToLive failed: %v", err)
+		}
+		if aws.ToString(timeToLive.TimeToLiveDescription.AttributeName) != "expiresAt" || timeToLive.TimeToLiveDescription.TimeToLiveStatus != types.TimeToLiveStatusEnabled {
+			t.Errorf("TimeToLive -> Expected: expiresAt ENABLED // Returned: %v %v", aws.ToString(timeToLive.TimeToLiveDescription.AttributeName), timeToLive.TimeToLiveDescription.TimeToLiveStatus)
+		}
+	})
+}
+
+func TestTableDriftMissingTable(t *testing.T) {
+	client := CreateDynamoDatabaseClientWithApi(CreateMemoryDynamoClient(), "test")
+	_, err := client.TableDrift(context.Background(), TableDefinition{Name: "missing", PartitionKey: KeyAttribute{Name: "id", Type: types.ScalarAttributeTypeS}})
+	var notFound *types.ResourceNotFoundException
+	if !errors.As(err, &notFound) {
+		t.Errorf("TableDrift -> Expected: ResourceNotFoundException // Returned: %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"context"
+	"iter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// QueryAllOptions configures QueryAll. The zero value reads every matching
+// item in ascending sort key order.
+type QueryAllOptions struct {
+	// MaxItems stops the iteration after this many items. Zero means no limit.
+	MaxItems int
+	// PageSize is the Limit of every Query call. Zero lets DynamoDB decide.
+	PageSize       int32
+	Descending     bool
+	ConsistentRead bool
+}
+
+// QueryAll yields every item matching the key condition and filter of expr,
+// one page at a time, so large partitions are processed in constant memory.
+// The iteration stops at the first error, which is yielded with the zero
+// value of T, and when ctx is cancelled.
+func QueryAll[T any](ctx context.Context, dbClient *DynamoDatabaseClient, tableName string, index string, expr expression.Expression, options QueryAllOptions) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var empty T
+		queryParams := dynamodb.QueryInput{
+			TableName:                 aws.String(dbClient.GetTableUrl(tableName)),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			KeyConditionExpression:    expr.KeyCondition(),
+			FilterExpression:          expr.Filter(),
+			ProjectionExpression:      expr.Projection(),
+			ScanIndexForward:          aws.Bool(!options.Descending),
+			ReturnConsumedCapacity:    types.ReturnConsumedCapacityTotal,
+		}
+		if index != "" {
+			queryParams.IndexName = aws.String(index)
+		}
+		queryParams.FilterExpression, queryParams.ExpressionAttributeNames, queryParams.ExpressionAttributeValues = expiryFilter(ctx, (*T)(nil), queryParams.FilterExpression, queryParams.ExpressionAttributeNames, queryParams.ExpressionAttributeValues)
+		if options.ConsistentRead {
+			queryParams.ConsistentRead = aws.Bool(true)
+		}
+		cipher, err := dbClient.attributeCipher(tableName, (*T)(nil))
+		if err != nil {
+			yield(empty, err)
+			return
+		}
+
+		yielded := 0
+		for {
+			if err := ctx.Err(); err != nil {
+				yield(empty, err)
+				return
+			}
+			queryParams.Limit = nil
+			if options.PageSize > 0 {
+				queryParams.Limit = aws.Int32(options.PageSize)
+			}
+			if remaining := options.MaxItems - yielded; options.MaxItems > 0 && (options.PageSize <= 0 || int32(remaining) < options.PageSize) {
+				queryParams.Limit = aws.Int32(int32(remaining))
+			}
+			result, err := dbClient.dynamoClient.Query(ctx, &queryParams)
+			if err != nil {
+				yield(empty, err)
+				return
+			}
+			for _, item := range result.Items {
+				var value T
+				if item, err = cipher.open(ctx, item, nil); err != nil {
+					yield(empty, err)
+					return
+				}
+				if err := attributevalue.UnmarshalMap(item, &value); err != nil {
+					yield(empty, err)
+					return
+				}
+				if !yield(value, nil) {
+					return
+				}
+				yielded++
+				if options.MaxItems > 0 && yielded >= options.MaxItems {
+					return
+				}
+			}
+			if len(result.LastEvaluatedKey) == 0 {
+				return
+			}
+			queryParams.ExclusiveStartKey = result.LastEvaluatedKey
+		}
+	}
+}
+
+// QueryAll is the Table variant of the QueryAll function.
+func (t *Table[T]) QueryAll(ctx context.Context, index string, expr expression.Expression, options QueryAllOptions) iter.Seq2[T, error] {
+	return QueryAll[T](ctx, t.client, t.tableName, index, expr, options)
+}
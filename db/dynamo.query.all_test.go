@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+)
+
+func TestQueryAllStreamsPages(t *testing.T) {
+	client := createTestDynamoClient(t)
+	seedTestEvents(t, client, 20)
+
+	expr, _ := expression.NewBuilder().
+		WithKeyCondition(expression.Key("orgId").Equal(expression.Value("org-1"))).
+		WithFilter(expression.Name("amount").GreaterThanEqual(expression.Value(100))).
+		Build()
+
+	testCases := []struct {
+		description string
+		options     QueryAllOptions
+		expected    []string
+	}{
+		{"Filtered pages", QueryAllOptions{PageSize: 3}, []string{"evt-10", "evt-11", "evt-12", "evt-13", "evt-14", "evt-15", "evt-16", "evt-17", "evt-18", "evt-19"}},
+		{"Max items", QueryAllOptions{PageSize: 4, MaxItems: 3}, []string{"evt-10", "evt-11", "evt-12"}},
+		{"Descending", QueryAllOptions{Descending: true, MaxItems: 2}, []string{"evt-19", "evt-18"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			var returned []string
+			for event, err := range QueryAll[testEvent](context.Background(), client, "events", "", expr, tc.options) {
+				if err != nil {
+					t.Fatalf("QueryAll failed: %v", err)
+				}
+				returned = append(returned, event.EventID)
+			}
+			if len(returned) != len(tc.expected) {
+				t.Fatalf("QueryAll -> Expected: %v // Returned: %v", tc.expected, returned)
+			}
+			for i := range tc.expected {
+				if returned[i] != tc.expected[i] {
+					t.Fatalf("QueryAll -> Expected: %v // Returned: %v", tc.expected, returned)
+				}
+			}
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	count := 0
+	var lastErr error
+	for _, err := range QueryAll[testEvent](ctx, client, "events", "", expr, QueryAllOptions{PageSize: 2}) {
+		if err != nil {
+			lastErr = err
+			break
+		}
+		count++
+		cancel()
+	}
+	if !errors.Is(lastErr, context.Canceled) || count != 2 {
+		t.Errorf("QueryAll after cancel -> Expected: context.Canceled after the first page // Returned: %d items, %v", count, lastErr)
+	}
+}
@@ -0,0 +1,472 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	paginate "github.com/techvuya/vuya-go-utils/paginate"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// maxSortKeyBytes is the maximum size of a sort key value.
+const maxSortKeyBytes = 1024
+
+type sortOperator int
+
+const (
+	sortNone sortOperator = iota
+	sortEqual
+	sortLessThan
+	sortLessThanEqual
+	sortGreaterThan
+	sortGreaterThanEqual
+	sortBetween
+	sortBeginsWith
+)
+
+// KeyQuery builds the key condition of a query on one partition. The sort
+// key condition can be combined with a cursor: the query then only matches
+// the items after the cursor in the direction of the query, which DynamoDB
+// only accepts as a single sort key condition, so both are merged into one.
+// Values are typed, numbers are compared as numbers.
+type KeyQuery struct {
+	partitionKey   string
+	partitionValue interface{}
+	sortKey        string
+	operator       sortOperator
+	sortValues     []interface{}
+	cursor         interface{}
+	ascending      bool
+	filter         expression.ConditionBuilder
+	projection     *expression.ProjectionBuilder
+}
+
+// CreateKeyQuery starts a query on the partition where partitionKey equals
+// partitionValue. Results are in descending order unless Paginate or
+// Ascending say otherwise, as in Query.
+func CreateKeyQuery(partitionKey string, partitionValue interface{}) *KeyQuery {
+	return &KeyQuery{partitionKey: partitionKey, partitionValue: partitionValue}
+}
+
+func (q *KeyQuery) sort(sortKey string, operator sortOperator, values ...interface{}) *KeyQuery {
+	q.sortKey, q.operator, q.sortValues = sortKey, operator, values
+	return q
+}
+
+// SortKey names the sort key used by the cursor when there is no sort key
+// condition.
+func (q *KeyQuery) SortKey(sortKey string) *KeyQuery {
+	return q.sort(sortKey, sortNone)
+}
+
+func (q *KeyQuery) SortEqual(sortKey string, value interface{}) *KeyQuery {
+	return q.sort(sortKey, sortEqual, value)
+}
+
+func (q *KeyQuery) SortLessThan(sortKey string, value interface{}) *KeyQuery {
+	return q.sort(sortKey, sortLessThan, value)
+}
+
+func (q *KeyQuery) SortLessThanEqual(sortKey string, value interface{}) *KeyQuery {
+	return q.sort(sortKey, sortLessThanEqual, value)
+}
+
+func (q *KeyQuery) SortGreaterThan(sortKey string, value interface{}) *KeyQuery {
+	return q.sort(sortKey, sortGreaterThan, value)
+}
+
+func (q *KeyQuery) SortGreaterThanEqual(sortKey string, value interface{}) *KeyQuery {
+	return q.sort(sortKey, sortGreaterThanEqual, value)
+}
+
+// SortBetween matches sort keys from lower to upper, both included.
+func (q *KeyQuery) SortBetween(sortKey string, lower, upper interface{}) *KeyQuery {
+	return q.sort(sortKey, sortBetween, lower, upper)
+}
+
+// SortBeginsWith matches string or binary sort keys starting with prefix.
+func (q *KeyQuery) SortBeginsWith(sortKey string, prefix interface{}) *KeyQuery {
+	return q.sort(sortKey, sortBeginsWith, prefix)
+}
+
+// Filter adds a filter on non-key attributes.
+func (q *KeyQuery) Filter(condition expression.ConditionBuilder) *KeyQuery {
+	q.filter = condition
+	return q
+}
+
+// Ascending sets the direction of the query.
+func (q *KeyQuery) Ascending(ascending bool) *KeyQuery {
+	q.ascending = ascending
+	return q
+}
+
+// After only matches the items past the sort key value cursor, in the
+// direction of the query.
+func (q *KeyQuery) After(cursor interface{}) *KeyQuery {
+	q.cursor = cursor
+	return q
+}
+
+// Paginate takes the direction from paginateParams. Pass the same
+// paginateParams to Query, which resumes after their cursor with the typed
+// ExclusiveStartKey it holds.
+func (q *KeyQuery) Paginate(paginateParams paginate.AgPaginateOptionsRequest) *KeyQuery {
+	q.ascending = paginateParams.GetOrder() == "ASC"
+	q.cursor = nil
+	return q
+}
+
+// ScanIndexForward reports the direction of the query, to pass to Query
+// through its paginate parameters.
+func (q *KeyQuery) ScanIndexForward() bool {
+	return q.ascending
+}
+
+// Build returns the key condition, filter and projection of the query. It returns
+// ErrQueryNoData when the cursor is past the end of the sort key condition.
+func (q *KeyQuery) Build() (expression.Expression, error) {
+	keyCondition, err := q.keyCondition()
+	if err != nil {
+		return expression.Expression{}, err
+	}
+	builder := expression.NewBuilder().WithKeyCondition(keyCondition)
+	if q.filter.IsSet() {
+		builder = builder.WithFilter(q.filter)
+	}
+	if q.projection != nil {
+		builder = builder.WithProjection(*q.projection)
+	}
+	return builder.Build()
+}
+
+func (q *KeyQuery) keyCondition() (expression.KeyConditionBuilder, error) {
+	partition := expression.Key(q.partitionKey).Equal(expression.Value(q.partitionValue))
+	values := make([]types.AttributeValue, len(q.sortValues))
+	for i, value := range q.sortValues {
+		av, err := attributevalue.Marshal(value)
+		if err != nil {
+			return expression.KeyConditionBuilder{}, err
+		}
+		values[i] = av
+	}
+	var cursor types.AttributeValue
+	if q.cursor != nil {
+		var err error
+		if cursor, err = attributevalue.Marshal(q.cursor); err != nil {
+			return expression.KeyConditionBuilder{}, err
+		}
+	}
+	if q.sortKey == "" {
+		if cursor != nil {
+			return expression.KeyConditionBuilder{}, fmt.Errorf("dynamo: a cursor needs the sort key name, use SortKey")
+		}
+		return partition, nil
+	}
+	key := expression.Key(q.sortKey)
+	if cursor == nil {
+		if q.operator == sortNone {
+			return partition, nil
+		}
+		return partition.And(sortCondition(key, q.operator, values)), nil
+	}
+
+	bounds, err := sortBoundsOf(q.operator, values)
+	if err != nil {
+		return expression.KeyConditionBuilder{}, err
+	}
+	var restricted bool
+	if q.ascending {
+		restricted = bounds.restrictLower(sortBound{value: cursor})
+	} else {
+		restricted = bounds.restrictUpper(sortBound{value: cursor})
+	}
+	if !restricted {
+		// The cursor is before the start of the range.
+		return partition.And(sortCondition(key, q.operator, values)), nil
+	}
+	condition, err := bounds.condition(key)
+	if err != nil {
+		return expression.KeyConditionBuilder{}, err
+	}
+	return partition.And(condition), nil
+}
+
+func sortCondition(key expression.KeyBuilder, operator sortOperator, values []types.AttributeValue) expression.KeyConditionBuilder {
+	switch operator {
+	case sortLessThan:
+		return key.LessThan(expression.Value(values[0]))
+	case sortLessThanEqual:
+		return key.LessThanEqual(expression.Value(values[0]))
+	case sortGreaterThan:
+		return key.GreaterThan(expression.Value(values[0]))
+	case sortGreaterThanEqual:
+		return key.GreaterThanEqual(expression.Value(values[0]))
+	case sortBetween:
+		return key.Between(expression.Value(values[0]), expression.Value(values[1]))
+	case sortBeginsWith:
+		if prefix, ok := values[0].(*types.AttributeValueMemberS); ok {
+			return key.BeginsWith(prefix.Value)
+		}
+		// The expression package only builds begins_with for strings.
+		return key.Between(expression.Value(values[0]), expression.Value(prefixEnd(values[0])))
+	}
+	return key.Equal(expression.Value(values[0]))
+}
+
+type sortBound struct {
+	value     types.AttributeValue
+	inclusive bool
+}
+
+// sortBounds is the range of sort keys matched by a condition. A nil bound
+// is open.
+type sortBounds struct {
+	lower *sortBound
+	upper *sortBound
+}
+
+func sortBoundsOf(operator sortOperator, values []types.AttributeValue) (sortBounds, error) {
+	switch operator {
+	case sortEqual:
+		return sortBounds{lower: &sortBound{values[0], true}, upper: &sortBound{values[0], true}}, nil
+	case sortLessThan:
+		return sortBounds{upper: &sortBound{values[0], false}}, nil
+	case sortLessThanEqual:
+		return sortBounds{upper: &sortBound{values[0], true}}, nil
+	case sortGreaterThan:
+		return sortBounds{lower: &sortBound{values[0], false}}, nil
+	case sortGreaterThanEqual:
+		return sortBounds{lower: &sortBound{values[0], true}}, nil
+	case sortBetween:
+		return sortBounds{lower: &sortBound{values[0], true}, upper: &sortBound{values[1], true}}, nil
+	case sortBeginsWith:
+		if _, ok := values[0].(*types.AttributeValueMemberN); ok {
+			return sortBounds{}, fmt.Errorf("dynamo: begins_with needs a string or binary prefix")
+		}
+		return sortBounds{lower: &sortBound{values[0], true}, upper: &sortBound{prefixEnd(values[0]), true}}, nil
+	}
+	return sortBounds{}, nil
+}
+
+// restrictLower raises the lower bound to bound and reports whether the
+// range changed.
+func (b *sortBounds) restrictLower(bound sortBound) bool {
+	if b.lower != nil {
+		cmp, _ := compareAttributeValues(bound.value, b.lower.value)
+		if cmp < 0 || (cmp == 0 && (bound.inclusive || !b.lower.inclusive)) {
+			return false
+		}
+	}
+	b.lower = &bound
+	return true
+}
+
+// restrictUpper lowers the upper bound to bound and reports whether the
+// range changed.
+func (b *sortBounds) restrictUpper(bound sortBound) bool {
+	if b.upper != nil {
+		cmp, _ := compareAttributeValues(bound.value, b.upper.value)
+		if cmp > 0 || (cmp == 0 && (bound.inclusive || !b.upper.inclusive)) {
+			return false
+		}
+	}
+	b.upper = &bound
+	return true
+}
+
+// condition expresses the range as a single sort key condition. When both
+// bounds are set, exclusive ones are replaced by the closest value inside
+// the range so the range fits a BETWEEN.
+func (b sortBounds) condition(key expression.KeyBuilder) (expression.KeyConditionBuilder, error) {
+	switch {
+	case b.lower == nil && b.upper.inclusive:
+		return key.LessThanEqual(expression.Value(b.upper.value)), nil
+	case b.lower == nil:
+		return key.LessThan(expression.Value(b.upper.value)), nil
+	case b.upper == nil && b.lower.inclusive:
+		return key.GreaterThanEqual(expression.Value(b.lower.value)), nil
+	case b.upper == nil:
+		return key.GreaterThan(expression.Value(b.lower.value)), nil
+	}
+
+	lower, upper := b.lower.value, b.upper.value
+	var ok bool
+	if !b.lower.inclusive {
+		if lower, ok = adjacentSortValue(lower, true); !ok {
+			return expression.KeyConditionBuilder{}, ErrQueryNoData
+		}
+	}
+	if !b.upper.inclusive {
+		if upper, ok = adjacentSortValue(upper, false); !ok {
+			return expression.KeyConditionBuilder{}, ErrQueryNoData
+		}
+	}
+	cmp, comparable := compareAttributeValues(lower, upper)
+	if !comparable {
+		return expression.KeyConditionBuilder{}, fmt.Errorf("dynamo: sort key values and cursor have different types")
+	}
+	if cmp > 0 {
+		return expression.KeyConditionBuilder{}, ErrQueryNoData
+	}
+	if cmp == 0 {
+		return key.Equal(expression.Value(lower)), nil
+	}
+	return key.Between(expression.Value(lower), expression.Value(upper)), nil
+}
+
+// prefixEnd returns the largest sort key starting with prefix: the prefix
+// padded with the largest character up to the sort key size limit.
+func prefixEnd(prefix types.AttributeValue) types.AttributeValue {
+	switch prefix := prefix.(type) {
+	case *types.AttributeValueMemberS:
+		return &types.AttributeValueMemberS{Value: padString(prefix.Value)}
+	case *types.AttributeValueMemberB:
+		return &types.AttributeValueMemberB{Value: padBytes(prefix.Value)}
+	}
+	return prefix
+}
+
+func padString(value string) string {
+	var sb strings.Builder
+	sb.WriteString(value)
+	for sb.Len()+utf8.RuneLen(utf8.MaxRune) <= maxSortKeyBytes {
+		sb.WriteRune(utf8.MaxRune)
+	}
+	return sb.String()
+}
+
+func padBytes(value []byte) []byte {
+	padded := append([]byte{}, value...)
+	for len(padded) < maxSortKeyBytes {
+		padded = append(padded, 0xff)
+	}
+	return padded
+}
+
+// adjacentSortValue returns the sort key value right after (next) or right
+// before value, so an exclusive bound can be written as an inclusive one.
+// Strings and binaries compare byte by byte and numbers have at most 38
+// significant digits, so no stored sort key can fall in between.
+func adjacentSortValue(value types.AttributeValue, next bool) (types.AttributeValue, bool) {
+	switch value := value.(type) {
+	case *types.AttributeValueMemberS:
+		if next {
+			return &types.AttributeValueMemberS{Value: value.Value + "\x00"}, true
+		}
+		if value.Value == "" {
+			return nil, false
+		}
+		if strings.HasSuffix(value.Value, "\x00") {
+			return &types.AttributeValueMemberS{Value: strings.TrimSuffix(value.Value, "\x00")}, true
+		}
+		last, size := utf8.DecodeLastRuneInString(value.Value)
+		last--
+		if last >= 0xd800 && last <= 0xdfff {
+			last = 0xd7ff
+		}
+		return &types.AttributeValueMemberS{Value: padString(value.Value[:len(value.Value)-size] + string(last))}, true
+	case *types.AttributeValueMemberB:
+		if next {
+			return &types.AttributeValueMemberB{Value: append(append([]byte{}, value.Value...), 0)}, true
+		}
+		if len(value.Value) == 0 {
+			return nil, false
+		}
+		if value.Value[len(value.Value)-1] == 0 {
+			return &types.AttributeValueMemberB{Value: bytes.Clone(value.Value[:len(value.Value)-1])}, true
+		}
+		previous := bytes.Clone(value.Value)
+		previous[len(previous)-1]--
+		return &types.AttributeValueMemberB{Value: padBytes(previous)}, true
+	case *types.AttributeValueMemberN:
+		adjacent, err := adjacentNumber(value.Value, next)
+		if err != nil {
+			return nil, false
+		}
+		return &types.AttributeValueMemberN{Value: adjacent}, true
+	}
+	return nil, false
+}
+
+// adjacentNumber returns the closest number with 38 significant digits
+// above (next) or below value.
+func adjacentNumber(value string, next bool) (string, error) {
+	negative, digits, exponent, err := parseDecimal(value)
+	if err != nil {
+		return "", err
+	}
+	if digits.Sign() == 0 {
+		if next {
+			return "1E-130", nil
+		}
+		return "-1E-130", nil
+	}
+	// leading is the exponent of the first significant digit.
+	leading := len(digits.String()) - 1 + exponent
+	step := leading - 37
+	awayFromZero := next != negative
+	if !awayFromZero && isPowerOfTen(digits) {
+		// Below a power of ten the digits are one decade finer.
+		step--
+	}
+	scale := min(exponent, step)
+	magnitude := new(big.Int).Mul(digits, pow10(exponent-scale))
+	if awayFromZero {
+		magnitude.Add(magnitude, pow10(step-scale))
+	} else {
+		magnitude.Sub(magnitude, pow10(step-scale))
+	}
+	sign := ""
+	if negative && magnitude.Sign() != 0 {
+		sign = "-"
+	}
+	return sign + magnitude.String() + "E" + strconv.Itoa(scale), nil
+}
+
+// parseDecimal splits a DynamoDB number into its sign, its digits without
+// leading zeros and the exponent of the last digit.
+func parseDecimal(value string) (bool, *big.Int, int, error) {
+	text := strings.TrimSpace(value)
+	negative := strings.HasPrefix(text, "-")
+	text = strings.TrimLeft(text, "+-")
+	exponent := 0
+	if i := strings.IndexAny(text, "eE"); i >= 0 {
+		parsed, err := strconv.Atoi(text[i+1:])
+		if err != nil {
+			return false, nil, 0, fmt.Errorf("dynamo: invalid number %q", value)
+		}
+		exponent, text = parsed, text[:i]
+	}
+	integer, fraction, _ := strings.Cut(text, ".")
+	exponent -= len(fraction)
+	digits, ok := new(big.Int).SetString(integer+fraction, 10)
+	if !ok {
+		return false, nil, 0, fmt.Errorf("dynamo: invalid number %q", value)
+	}
+	// Drop trailing zeros so the exponent is the one of the last significant digit.
+	ten := big.NewInt(10)
+	for digits.Sign() != 0 {
+		quotient, remainder := new(big.Int).QuoRem(digits, ten, new(big.Int))
+		if remainder.Sign() != 0 {
+			break
+		}
+		digits, exponent = quotient, exponent+1
+	}
+	return negative, digits, exponent, nil
+}
+
+func isPowerOfTen(digits *big.Int) bool {
+	return strings.TrimRight(digits.String(), "0") == "1"
+}
+
+func pow10(exponent int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exponent)), nil)
+}
@@ -0,0 +1,168 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	paginate "github.com/techvuya/vuya-go-utils/paginate"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestAdjacentNumber(t *testing.T) {
+	testCases := []struct {
+		value    string
+		next     bool
+		expected string
+	}{
+		{"15", true, "15000000000000000000000000000000000001E-36"},
+		{"15", false, "14999999999999999999999999999999999999E-36"},
+		{"100", false, "99999999999999999999999999999999999999E-36"},
+		{"-100", true, "-99999999999999999999999999999999999999E-36"},
+		{"-1.5", false, "-15000000000000000000000000000000000001E-37"},
+		{"0", true, "1E-130"},
+		{"0", false, "-1E-130"},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s-%v", tc.value, tc.next), func(t *testing.T) {
+			result, err := adjacentNumber(tc.value, tc.next)
+			if err != nil {
+				t.Fatalf("adjacentNumber failed: %v", err)
+			}
+			if cmp, _ := compareNumberStrings(result, tc.expected); cmp != 0 {
+				t.Errorf("adjacentNumber -> Expected: %s // Returned: %s", tc.expected, result)
+			}
+		})
+	}
+}
+
+// collectKeyQueryPages follows the cursor of Query until the last page.
+func collectKeyQueryPages(t *testing.T, client *DynamoDatabaseClient, index string, query func(paginate.AgPaginateOptionsRequest) *KeyQuery, order string) []string {
+	t.Helper()
+	var ids []string
+	params := paginate.AgPaginateOptionsRequest{Order: order}
+	for page := 0; page < 20; page++ {
+		expr, err := query(params).Build()
+		if errors.Is(err, ErrQueryNoData) {
+			return ids
+		}
+		if err != nil {
+			t.Fatalf("Build failed: %v", err)
+		}
+		var events []testEvent
+		cursor, err := client.QueryPage(context.Background(), "events", index, expr, aws.Int32(3), &events, params)
+		if errors.Is(err, ErrQueryNoData) {
+			return ids
+		}
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		for _, event := range events {
+			ids = append(ids, event.EventID)
+		}
+		if cursor == "" {
+			return ids
+		}
+		params.Cursor = cursor
+	}
+	t.Fatalf("Query did not reach the last page")
+	return nil
+}
+
+func TestKeyQueryPagination(t *testing.T) {
+	client := createTestDynamoClient(t)
+	seedTestEvents(t, client, 12)
+	codec, _ := CreateCursorCodec([]byte("0123456789abcdef0123456789abcdef"))
+	client.SetCursorCodec(codec)
+
+	testCases := []struct {
+		description string
+		index       string
+		query       func(paginate.AgPaginateOptionsRequest) *KeyQuery
+		order       string
+		expected    []string
+	}{
+		{
+			description: "begins_with ascending",
+			query: func(params paginate.AgPaginateOptionsRequest) *KeyQuery {
+				return CreateKeyQuery("orgId", "org-1").SortBeginsWith("eventId", "evt-0").Paginate(params)
+			},
+			order:    "asc",
+			expected: []string{"evt-00", "evt-01", "evt-02", "evt-03", "evt-04", "evt-05", "evt-06", "evt-07", "evt-08", "evt-09"},
+		},
+		{
+			description: "begins_with descending",
+			query: func(params paginate.AgPaginateOptionsRequest) *KeyQuery {
+				return CreateKeyQuery("orgId", "org-1").SortBeginsWith("eventId", "evt-0").Paginate(params)
+			},
+			order:    "desc",
+			expected: []string{"evt-09", "evt-08", "evt-07", "evt-06", "evt-05", "evt-04", "evt-03", "evt-02", "evt-01", "evt-00"},
+		},
+		{
+			description: "between descending",
+			query: func(params paginate.AgPaginateOptionsRequest) *KeyQuery {
+				return CreateKeyQuery("orgId", "org-1").SortBetween("eventId", "evt-02", "evt-08").Paginate(params)
+			},
+			order:    "desc",
+			expected: []string{"evt-08", "evt-07", "evt-06", "evt-05", "evt-04", "evt-03", "evt-02"},
+		},
+		{
+			description: "typed number between on an index",
+			index:       "status-createdAt",
+			query: func(params paginate.AgPaginateOptionsRequest) *KeyQuery {
+				return CreateKeyQuery("status", "open").SortBetween("createdAt", 90, 98).Paginate(params)
+			},
+			order:    "asc",
+			expected: []string{"evt-10", "evt-08", "evt-06", "evt-04", "evt-02"},
+		},
+		{
+			description: "numeric sort key without condition",
+			index:       "status-createdAt",
+			query: func(params paginate.AgPaginateOptionsRequest) *KeyQuery {
+				return CreateKeyQuery("status", "open").SortKey("createdAt").Paginate(params)
+			},
+			order:    "asc",
+			expected: []string{"evt-10", "evt-08", "evt-06", "evt-04", "evt-02", "evt-00"},
+		},
+		{
+			description: "greater than or equal descending",
+			index:       "status-createdAt",
+			query: func(params paginate.AgPaginateOptionsRequest) *KeyQuery {
+				return CreateKeyQuery("status", "closed").SortGreaterThanEqual("createdAt", 93).Paginate(params)
+			},
+			order:    "desc",
+			expected: []string{"evt-01", "evt-03", "evt-05", "evt-07"},
+		},
+		{
+			description: "less than or equal ascending",
+			index:       "status-createdAt",
+			query: func(params paginate.AgPaginateOptionsRequest) *KeyQuery {
+				return CreateKeyQuery("status", "closed").SortLessThanEqual("createdAt", 93).Paginate(params)
+			},
+			order:    "asc",
+			expected: []string{"evt-11", "evt-09", "evt-07"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			ids := collectKeyQueryPages(t, client, tc.index, tc.query, tc.order)
+			if !reflect.DeepEqual(ids, tc.expected) {
+				t.Errorf("Items -> Expected: %v // Returned: %v", tc.expected, ids)
+			}
+		})
+	}
+}
+
+func TestKeyQueryCursorPastRange(t *testing.T) {
+	_, err := CreateKeyQuery("orgId", "org-1").SortBetween("eventId", "evt-02", "evt-04").Ascending(true).After("evt-04").Build()
+	if !errors.Is(err, ErrQueryNoData) {
+		t.Errorf("Build -> Expected: ErrQueryNoData // Returned: %v", err)
+	}
+	if _, err := CreateKeyQuery("orgId", "org-1").After("evt-04").Build(); err == nil {
+		t.Errorf("Cursor without sort key -> Expected: error // Returned: nil")
+	}
+}
@@ -0,0 +1,339 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+)
+
+// Error classes reported by ClassifyError. Errors returned by a client with a
+// retry policy wrap their class, and ErrThrottled as well when DynamoDB
+// throttled the call, so they can be told apart with errors.Is. Fatal errors
+// of the first attempt are returned as they are.
+var (
+	ErrRetryable       = errors.New("ErrRetryable")
+	ErrThrottled       = errors.New("ErrThrottled")
+	ErrConditionFailed = errors.New("ErrConditionFailed")
+	ErrFatal           = errors.New("ErrFatal")
+)
+
+var throttlingErrorCodes = map[string]bool{
+	"ProvisionedThroughputExceededException": true,
+	"ProvisionedThroughputExceeded":          true,
+	"RequestLimitExceeded":                   true,
+	"ThrottlingException":                    true,
+	"ThrottlingError":                        true,
+}
+
+var retryableErrorCodes = map[string]bool{
+	"TransactionConflictException":   true,
+	"TransactionConflict":            true,
+	"TransactionInProgressException": true,
+	"InternalServerError":            true,
+	"ServiceUnavailable":             true,
+}
+
+// ClassifyError returns ErrRetryable, ErrConditionFailed or ErrFatal for an
+// error of the DynamoDB API, or nil for a nil error. A canceled transaction
+// is a condition failure when any of its conditions failed and retryable
+// when it was only canceled by conflicts or throttling.
+func ClassifyError(err error) error {
+	class, _ := classifyError(err)
+	return class
+}
+
+// IsThrottled reports whether DynamoDB rejected the call because of its
+// throughput limits.
+func IsThrottled(err error) bool {
+	_, throttled := classifyError(err)
+	return throttled
+}
+
+func classifyError(err error) (error, bool) {
+	if err == nil {
+		return nil, false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return ErrFatal, false
+	}
+	var canceledErr *types.TransactionCanceledException
+	if errors.As(err, &canceledErr) {
+		retryable, throttled := len(canceledErr.CancellationReasons) > 0, false
+		for _, reason := range canceledErr.CancellationReasons {
+			code := aws.ToString(reason.Code)
+			switch {
+			case code == "" || code == "None":
+			case code == "ConditionalCheckFailed":
+				return ErrConditionFailed, false
+			case throttlingErrorCodes[code]:
+				throttled = true
+			case !retryableErrorCodes[code]:
+				retryable = false
+			}
+		}
+		if retryable {
+			return ErrRetryable, throttled
+		}
+		return ErrFatal, false
+	}
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		return ErrConditionFailed, false
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		code := apiErr.ErrorCode()
+		if throttlingErrorCodes[code] {
+			return ErrRetryable, true
+		}
+		if retryableErrorCodes[code] || apiErr.ErrorFault() == smithy.FaultServer {
+			return ErrRetryable, false
+		}
+		return ErrFatal, false
+	}
+	var retryableErr interface{ RetryableError() bool }
+	if errors.As(err, &retryableErr) && retryableErr.RetryableError() {
+		return ErrRetryable, false
+	}
+	return ErrFatal, false
+}
+
+// RetryPolicy retries the calls of a DynamoDatabaseClient that fail with a
+// retryable error, waiting an exponential backoff with full jitter between
+// attempts. It comes on top of the retries of the AWS SDK itself. The zero
+// value uses the defaults below.
+type RetryPolicy struct {
+	// MaxAttempts bounds the calls made for one operation, the first one
+	// included (default 5). Use 1 to disable retries.
+	MaxAttempts int
+	// BaseDelay and MaxDelay bound the backoff (defaults 50ms and 2s).
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Operations overrides the policy of single API operations, keyed by
+	// their name, e.g. "TransactWriteItems".
+	Operations map[string]RetryPolicy
+	// RetryNonIdempotent retries the writes that are not idempotent, those
+	// with a condition and the updates with ADD, list_append or arithmetic,
+	// after server errors too. Such an error does not tell whether the write
+	// was applied, and a conditional write fails its own condition when it
+	// was, so by default they are only retried when DynamoDB rejected them.
+	// Transactions with a ClientRequestToken are always retried.
+	RetryNonIdempotent bool
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 5
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = 50 * time.Millisecond
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = 2 * time.Second
+	}
+	return p
+}
+
+// forOperation returns the policy that applies to operation.
+func (p RetryPolicy) forOperation(operation string) RetryPolicy {
+	if override, ok := p.Operations[operation]; ok {
+		return override.withDefaults()
+	}
+	return p.withDefaults()
+}
+
+// SetRetryPolicy configures the retry policy of every call of the client.
+// Use nil to disable it.
+func (c *DynamoDatabaseClient) SetRetryPolicy(policy *RetryPolicy) {
+	observed, ok := c.dynamoClient.(*capacityObservingClient)
+	if !ok {
+		observed = &capacityObservingClient{DynamoApiClient: c.dynamoClient}
+		c.dynamoClient = observed
+	}
+	retrying, ok := observed.DynamoApiClient.(*retryingClient)
+	if !ok {
+		retrying = &retryingClient{DynamoApiClient: observed.DynamoApiClient}
+		observed.DynamoApiClient = retrying
+	}
+	retrying.policy = policy
+}
+
+type retryPolicyContextKey struct{}
+
+// WithRetryPolicy overrides the retry policy of the client for the calls
+// made with the returned context.
+func WithRetryPolicy(ctx context.Context, policy RetryPolicy) context.Context {
+	return context.WithValue(ctx, retryPolicyContextKey{}, policy)
+}
+
+// RetryError is returned by a client with a retry policy when an operation
+// fails. It wraps the error of the last attempt and its class, and the error
+// of the context when it was done before the next attempt.
+type RetryError struct {
+	Operation string
+	Attempts  int
+	Err       error
+
+	class       error
+	throttled   bool
+	interrupted error
+}
+
+func (e *RetryError) Error() string {
+	if e.interrupted != nil {
+		return fmt.Sprintf("%s: %s interrupted after %d attempts: %v: %v", e.class, e.Operation, e.Attempts, e.interrupted, e.Err)
+	}
+	return fmt.Sprintf("%s: %s failed after %d attempts: %v", e.class, e.Operation, e.Attempts, e.Err)
+}
+
+func (e *RetryError) Unwrap() []error {
+	errs := []error{e.class}
+	if e.throttled {
+		errs = append(errs, ErrThrottled)
+	}
+	if e.interrupted != nil {
+		errs = append(errs, e.interrupted)
+	}
+	return append(errs, e.Err)
+}
+
+// retryingClient wraps the API client and applies the retry policy of the
+// client, or of the call context, to every call.
+type retryingClient struct {
+	DynamoApiClient
+	policy *RetryPolicy
+}
+
+func (r *retryingClient) policyFor(ctx context.Context, operation string) (RetryPolicy, bool) {
+	if policy, ok := ctx.Value(retryPolicyContextKey{}).(RetryPolicy); ok {
+		return policy.forOperation(operation), true
+	}
+	if r.policy != nil {
+		return r.policy.forOperation(operation), true
+	}
+	return RetryPolicy{}, false
+}
+
+// nonIdempotentUpdate matches the update expressions that change an item
+// again when applied twice.
+var nonIdempotentUpdate = regexp.MustCompile(`(?i)(^|\s)ADD\s|list_append\s*\(|[+-]`)
+
+// idempotentWrite reports whether a write with the given condition and
+// update expressions has the same outcome when applied twice.
+func idempotentWrite(condition, update *string) bool {
+	return aws.ToString(condition) == "" && !nonIdempotentUpdate.MatchString(aws.ToString(update))
+}
+
+// idempotentTransaction reports whether params may be applied twice, as it
+// has a ClientRequestToken or only idempotent writes.
+func idempotentTransaction(params *dynamodb.TransactWriteItemsInput) bool {
+	if aws.ToString(params.ClientRequestToken) != "" {
+		return true
+	}
+	for _, item := range params.TransactItems {
+		switch {
+		case item.Put != nil && !idempotentWrite(item.Put.ConditionExpression, nil),
+			item.Update != nil && !idempotentWrite(item.Update.ConditionExpression, item.Update.UpdateExpression),
+			item.Delete != nil && !idempotentWrite(item.Delete.ConditionExpression, nil):
+			return false
+		}
+	}
+	return true
+}
+
+// retryCall calls call under the retry policy of operation. idempotent tells
+// whether params may be applied twice, so it can be retried after errors that
+// do not tell whether it was applied.
+func retryCall[Input, Output any](ctx context.Context, r *retryingClient, operation string, params *Input, idempotent bool, optFns []func(*dynamodb.Options), call func(context.Context, *Input, ...func(*dynamodb.Options)) (*Output, error)) (*Output, error) {
+	policy, ok := r.policyFor(ctx, operation)
+	if !ok {
+		return call(ctx, params, optFns...)
+	}
+	for attempt := 1; ; attempt++ {
+		output, err := call(ctx, params, optFns...)
+		if err == nil {
+			return output, nil
+		}
+		class, throttled := classifyError(err)
+		if class == ErrFatal && attempt == 1 {
+			return nil, err
+		}
+		retryErr := &RetryError{Operation: operation, Attempts: attempt, Err: err, class: class, throttled: throttled}
+		if class != ErrRetryable || attempt >= policy.MaxAttempts {
+			return nil, retryErr
+		}
+		if !idempotent && !policy.RetryNonIdempotent && !throttled && !isTransactionConflict(err) {
+			return nil, retryErr
+		}
+		if sleepErr := sleepWithContext(ctx, backoffDelay(attempt-1, policy.BaseDelay, policy.MaxDelay)); sleepErr != nil {
+			retryErr.interrupted = sleepErr
+			return nil, retryErr
+		}
+	}
+}
+
+// isTransactionConflict reports whether err rejected a call because of a
+// transaction in progress, or canceled a transaction, so the call was not
+// applied.
+func isTransactionConflict(err error) bool {
+	var canceledErr *types.TransactionCanceledException
+	if errors.As(err, &canceledErr) {
+		return true
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "TransactionConflictException", "TransactionConflict", "TransactionInProgressException":
+			return true
+		}
+	}
+	return false
+}
+
+func (r *retryingClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return retryCall(ctx, r, "GetItem", params, true, optFns, r.DynamoApiClient.GetItem)
+}
+
+func (r *retryingClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	return retryCall(ctx, r, "PutItem", params, idempotentWrite(params.ConditionExpression, nil), optFns, r.DynamoApiClient.PutItem)
+}
+
+func (r *retryingClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	idempotent := idempotentWrite(params.ConditionExpression, params.UpdateExpression)
+	return retryCall(ctx, r, "UpdateItem", params, idempotent, optFns, r.DynamoApiClient.UpdateItem)
+}
+
+func (r *retryingClient) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	return retryCall(ctx, r, "DeleteItem", params, idempotentWrite(params.ConditionExpression, nil), optFns, r.DynamoApiClient.DeleteItem)
+}
+
+func (r *retryingClient) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	return retryCall(ctx, r, "Query", params, true, optFns, r.DynamoApiClient.Query)
+}
+
+func (r *retryingClient) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	return retryCall(ctx, r, "Scan", params, true, optFns, r.DynamoApiClient.Scan)
+}
+
+func (r *retryingClient) BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	return retryCall(ctx, r, "BatchGetItem", params, true, optFns, r.DynamoApiClient.BatchGetItem)
+}
+
+func (r *retryingClient) BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	return retryCall(ctx, r, "BatchWriteItem", params, true, optFns, r.DynamoApiClient.BatchWriteItem)
+}
+
+func (r *retryingClient) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	return retryCall(ctx, r, "TransactWriteItems", params, idempotentTransaction(params), optFns, r.DynamoApiClient.TransactWriteItems)
+}
+
+func (r *retryingClient) TransactGetItems(ctx context.Context, params *dynamodb.TransactGetItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactGetItemsOutput, error) {
+	return retryCall(ctx, r, "TransactGetItems", params, true, optFns, r.DynamoApiClient.TransactGetItems)
+}
@@ -0,0 +1,334 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+)
+
+// flakyDynamoClient fails the next writes with the queued errors before
+// handing them to the wrapped client.
+type flakyDynamoClient struct {
+	DynamoApiClient
+	mu    sync.Mutex
+	errs  []error
+	calls int
+}
+
+func (f *flakyDynamoClient) fail(errs ...error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errs, f.calls = errs, 0
+}
+
+func (f *flakyDynamoClient) next() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if len(f.errs) == 0 {
+		return nil
+	}
+	err := f.errs[0]
+	f.errs = f.errs[1:]
+	return err
+}
+
+func (f *flakyDynamoClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	if err := f.next(); err != nil {
+		return nil, err
+	}
+	return f.DynamoApiClient.PutItem(ctx, params, optFns...)
+}
+
+func (f *flakyDynamoClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	if err := f.next(); err != nil {
+		return nil, err
+	}
+	return f.DynamoApiClient.UpdateItem(ctx, params, optFns...)
+}
+
+func (f *flakyDynamoClient) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	if err := f.next(); err != nil {
+		return nil, err
+	}
+	return f.DynamoApiClient.TransactWriteItems(ctx, params, optFns...)
+}
+
+func createFlakyTestDynamoClient(t *testing.T) (*DynamoDatabaseClient, *flakyDynamoClient) {
+	t.Helper()
+	flaky := &flakyDynamoClient{DynamoApiClient: createTestDynamoClient(t).GetApiClient()}
+	return CreateDynamoDatabaseClientWithApi(flaky, "test"), flaky
+}
+
+func canceledByReasons(codes ...string) error {
+	reasons := make([]types.CancellationReason, len(codes))
+	for i, code := range codes {
+		reasons[i] = types.CancellationReason{Code: aws.String(code)}
+	}
+	return &types.TransactionCanceledException{CancellationReasons: reasons}
+}
+
+func TestClassifyError(t *testing.T) {
+	testCases := []struct {
+		description       string
+		err               error
+		expectedClass     error
+		expectedThrottled bool
+	}{
+		{"nil", nil, nil, false},
+		{"provisioned throughput", &types.ProvisionedThroughputExceededException{}, ErrRetryable, true},
+		{"request limit", &types.RequestLimitExceeded{}, ErrRetryable, true},
+		{"throttling", &smithy.GenericAPIError{Code: "ThrottlingException"}, ErrRetryable, true},
+		{"internal server error", &types.InternalServerError{}, ErrRetryable, false},
+		{"condition failed", &types.ConditionalCheckFailedException{}, ErrConditionFailed, false},
+		{"transaction conflict", canceledByReasons("None", "TransactionConflict"), ErrRetryable, false},
+		{"transaction throttled", canceledByReasons("ThrottlingError", "None"), ErrRetryable, true},
+		{"transaction condition failed", canceledByReasons("TransactionConflict", "ConditionalCheckFailed"), ErrConditionFailed, false},
+		{"transaction validation", canceledByReasons("ValidationError"), ErrFatal, false},
+		{"validation", &smithy.GenericAPIError{Code: "ValidationException", Fault: smithy.FaultClient}, ErrFatal, false},
+		{"context canceled", context.Canceled, ErrFatal, false},
+		{"unknown", errors.New("boom"), ErrFatal, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			if class := ClassifyError(tc.err); class != tc.expectedClass {
+				t.Errorf("ClassifyError -> Expected: %v // Returned: %v", tc.expectedClass, class)
+			}
+			if throttled := IsThrottled(tc.err); throttled != tc.expectedThrottled {
+				t.Errorf("IsThrottled -> Expected: %v // Returned: %v", tc.expectedThrottled, throttled)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	throttled := &types.ProvisionedThroughputExceededException{Message: aws.String("slow down")}
+	policy := &RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    time.Millisecond,
+		Operations:  map[string]RetryPolicy{"TransactWriteItems": {MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}},
+	}
+
+	testCases := []struct {
+		description      string
+		policy           *RetryPolicy
+		ctxPolicy        *RetryPolicy
+		errs             []error
+		expectedCalls    int
+		expectedClass    error
+		expectedAttempts int
+	}{
+		{"no policy", nil, nil, []error{throttled}, 1, nil, 0},
+		{"recovers", policy, nil, []error{throttled, throttled}, 3, nil, 0},
+		{"exhausted", policy, nil, []error{throttled, throttled, throttled}, 3, ErrRetryable, 3},
+		{"fatal after a retry", policy, nil, []error{throttled, &smithy.GenericAPIError{Code: "ValidationException"}}, 2, ErrFatal, 2},
+		{"context override", policy, &RetryPolicy{MaxAttempts: 1}, []error{throttled}, 1, ErrRetryable, 1},
+		{"context policy without client policy", nil, &RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}, []error{throttled}, 2, nil, 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			client, flaky := createFlakyTestDynamoClient(t)
+			client.SetRetryPolicy(tc.policy)
+			ctx := context.Background()
+			if tc.ctxPolicy != nil {
+				ctx = WithRetryPolicy(ctx, *tc.ctxPolicy)
+			}
+			flaky.fail(tc.errs...)
+			err := client.PutItem(ctx, "events", testEvent{OrgID: "org-1", EventID: "evt-1", Status: "open"})
+			if flaky.calls != tc.expectedCalls {
+				t.Errorf("Calls -> Expected: %d // Returned: %d", tc.expectedCalls, flaky.calls)
+			}
+			if tc.policy == nil && tc.ctxPolicy == nil {
+				if err != error(throttled) {
+					t.Errorf("Error without policy -> Expected: %v // Returned: %v", throttled, err)
+				}
+				return
+			}
+			if tc.expectedClass == nil {
+				if err != nil {
+					t.Errorf("PutItem -> Expected: nil // Returned: %v", err)
+				}
+				return
+			}
+			var retryErr *RetryError
+			if !errors.As(err, &retryErr) || !errors.Is(err, tc.expectedClass) {
+				t.Fatalf("PutItem -> Expected: %v // Returned: %v", tc.expectedClass, err)
+			}
+			if retryErr.Attempts != tc.expectedAttempts || retryErr.Operation != "PutItem" {
+				t.Errorf("RetryError -> Expected: PutItem %d attempts // Returned: %s %d attempts", tc.expectedAttempts, retryErr.Operation, retryErr.Attempts)
+			}
+			var sdkErr *types.ProvisionedThroughputExceededException
+			if errors.Is(err, ErrThrottled) != errors.As(err, &sdkErr) {
+				t.Errorf("ErrThrottled -> Expected: only for throttling // Returned: %v", err)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyErrors(t *testing.T) {
+	client, flaky := createFlakyTestDynamoClient(t)
+	client.SetRetryPolicy(&RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	seedTestEvents(t, client, 1)
+
+	fatal := &smithy.GenericAPIError{Code: "ValidationException", Fault: smithy.FaultClient}
+	flaky.fail(fatal)
+	err := client.PutItem(context.Background(), "events", testEvent{OrgID: "org-1", EventID: "evt-1", Status: "open"})
+	if err != error(fatal) {
+		t.Errorf("Fatal first attempt -> Expected: %v // Returned: %v", fatal, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	flaky.fail(&types.InternalServerError{})
+	err = client.PutItem(ctx, "events", testEvent{OrgID: "org-1", EventID: "evt-1", Status: "open"})
+	var retryErr *RetryError
+	if !errors.Is(err, context.Canceled) || !errors.Is(err, ErrRetryable) || !errors.As(err, &retryErr) || flaky.calls != 1 {
+		t.Errorf("Canceled during backoff -> Expected: context.Canceled after 1 call // Returned: %v after %d calls", err, flaky.calls)
+	}
+}
+
+func TestRetryNonIdempotentUpdate(t *testing.T) {
+	set := expression.Set(expression.Name("status"), expression.Value("closed"))
+	add := expression.Add(expression.Name("amount"), expression.Value(1))
+	plus := expression.Set(expression.Name("amount"), expression.Name("amount").Plus(expression.Value(1)))
+	appended := expression.Set(expression.Name("tags"), expression.ListAppend(expression.Name("tags"), expression.Value([]string{"vip"})))
+	serverErr := &types.InternalServerError{}
+	throttled := &types.ProvisionedThroughputExceededException{}
+
+	testCases := []struct {
+		description   string
+		update        expression.UpdateBuilder
+		err           error
+		optIn         bool
+		expectedCalls int
+	}{
+		{"idempotent after a server error", set, serverErr, false, 2},
+		{"ADD after a server error", add, serverErr, false, 1},
+		{"arithmetic after a server error", plus, serverErr, false, 1},
+		{"list_append after a server error", appended, serverErr, false, 1},
+		{"ADD after throttling", add, throttled, false, 2},
+		{"ADD after a transaction conflict", add, &smithy.GenericAPIError{Code: "TransactionConflictException"}, false, 2},
+		{"ADD after a server error opted in", add, serverErr, true, 2},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			client, flaky := createFlakyTestDynamoClient(t)
+			client.SetRetryPolicy(&RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, RetryNonIdempotent: tc.optIn})
+			expr, err := expression.NewBuilder().WithUpdate(tc.update).Build()
+			if err != nil {
+				t.Fatalf("Build failed: %v", err)
+			}
+			flaky.fail(tc.err)
+			err = client.UpdateItemExpr(context.Background(), "events", testEventKey("evt-1"), expr)
+			if flaky.calls != tc.expectedCalls {
+				t.Errorf("Calls -> Expected: %d // Returned: %d", tc.expectedCalls, flaky.calls)
+			}
+			if tc.expectedCalls == 1 && !errors.Is(err, ErrRetryable) {
+				t.Errorf("UpdateItemExpr -> Expected: %v // Returned: %v", ErrRetryable, err)
+			}
+		})
+	}
+}
+
+func TestRetryConditionalWrites(t *testing.T) {
+	serverErr := &types.InternalServerError{}
+	throttled := &types.ProvisionedThroughputExceededException{}
+	transaction := func(client *DynamoDatabaseClient, item interface{}, token string) *NoSqlTransaction {
+		transaction := CreateNoSqlTransaction(client)
+		transaction.AddTransactionPut("events", item)
+		if token != "" {
+			transaction.SetClientRequestToken(token)
+		}
+		return transaction
+	}
+
+	testCases := []struct {
+		description   string
+		write         func(ctx context.Context, client *DynamoDatabaseClient) error
+		err           error
+		expectedCalls int
+	}{
+		{"put after a server error", func(ctx context.Context, client *DynamoDatabaseClient) error {
+			return client.PutItem(ctx, "events", testEvent{OrgID: "org-1", EventID: "evt-1", Status: "open"})
+		}, serverErr, 2},
+		{"versioned put after a server error", func(ctx context.Context, client *DynamoDatabaseClient) error {
+			return client.PutItem(ctx, "events", &testVersionedEvent{OrgID: "org-1", EventID: "evt-1", Status: "open"})
+		}, serverErr, 1},
+		{"versioned put after throttling", func(ctx context.Context, client *DynamoDatabaseClient) error {
+			return client.PutItem(ctx, "events", &testVersionedEvent{OrgID: "org-1", EventID: "evt-1", Status: "open"})
+		}, throttled, 2},
+		{"transaction after a server error", func(ctx context.Context, client *DynamoDatabaseClient) error {
+			return client.ExecuteTransaction(ctx, transaction(client, testEvent{OrgID: "org-1", EventID: "evt-1", Status: "open"}, ""))
+		}, serverErr, 2},
+		{"versioned transaction after a server error", func(ctx context.Context, client *DynamoDatabaseClient) error {
+			return client.ExecuteTransaction(ctx, transaction(client, &testVersionedEvent{OrgID: "org-1", EventID: "evt-1", Status: "open"}, ""))
+		}, serverErr, 1},
+		{"versioned transaction with a token after a server error", func(ctx context.Context, client *DynamoDatabaseClient) error {
+			return client.ExecuteTransaction(ctx, transaction(client, &testVersionedEvent{OrgID: "org-1", EventID: "evt-1", Status: "open"}, "token-1"))
+		}, serverErr, 2},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			client, flaky := createFlakyTestDynamoClient(t)
+			client.SetRetryPolicy(&RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+			flaky.fail(tc.err)
+			err := tc.write(context.Background(), client)
+			if flaky.calls != tc.expectedCalls {
+				t.Errorf("Calls -> Expected: %d // Returned: %d", tc.expectedCalls, flaky.calls)
+			}
+			if tc.expectedCalls == 1 && !errors.Is(err, ErrRetryable) {
+				t.Errorf("%s -> Expected: %v // Returned: %v", tc.description, ErrRetryable, err)
+			}
+			if tc.expectedCalls == 2 && err != nil {
+				t.Errorf("%s -> Expected: nil // Returned: %v", tc.description, err)
+			}
+		})
+	}
+}
+
+func TestExecuteTransactionRetry(t *testing.T) {
+	ctx := context.Background()
+	client, flaky := createFlakyTestDynamoClient(t)
+	client.SetRetryPolicy(&RetryPolicy{
+		BaseDelay:  time.Millisecond,
+		MaxDelay:   time.Millisecond,
+		Operations: map[string]RetryPolicy{"TransactWriteItems": {MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}},
+	})
+
+	newTransaction := func(eventID string) *NoSqlTransaction {
+		transaction := CreateNoSqlTransaction(client)
+		transaction.AddTransactionPut("events", testEvent{OrgID: "org-1", EventID: eventID, Status: "open"})
+		transaction.AddTransactionUniqueGuard(CreateUniqueConstraint("events", "name", "orgId", "eventId"), eventID, "retry")
+		return transaction
+	}
+
+	flaky.fail(canceledByReasons("None", "TransactionConflict"))
+	if err := client.ExecuteTransaction(ctx, newTransaction("evt-1")); err != nil {
+		t.Fatalf("ExecuteTransaction after a conflict -> Expected: nil // Returned: %v", err)
+	}
+	if flaky.calls != 2 {
+		t.Errorf("Calls -> Expected: 2 // Returned: %d", flaky.calls)
+	}
+
+	flaky.fail(canceledByReasons("TransactionConflict", "None"), canceledByReasons("TransactionConflict", "None"))
+	err := client.ExecuteTransaction(ctx, newTransaction("evt-2"))
+	var canceledErr *TransactionCanceledError
+	if !errors.Is(err, ErrRetryable) || !errors.As(err, &canceledErr) || flaky.calls != 2 {
+		t.Errorf("ExecuteTransaction with conflicts -> Expected: ErrRetryable after 2 calls // Returned: %v after %d calls", err, flaky.calls)
+	}
+
+	flaky.fail()
+	err = client.ExecuteTransaction(ctx, newTransaction("evt-3"))
+	if !errors.Is(err, ErrConditionFailed) || !errors.Is(err, ErrUniqueViolation) || flaky.calls != 1 {
+		t.Errorf("ExecuteTransaction with a failed condition -> Expected: ErrConditionFailed after 1 call // Returned: %v after %d calls", err, flaky.calls)
+	}
+}
@@ -0,0 +1,280 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ScanOptions configures ScanAll. The zero value scans the base table with a
+// single segment.
+type ScanOptions struct {
+	// IndexName scans a secondary index instead of the base table.
+	IndexName string
+	// Segments is the TotalSegments of the parallel scan (default 1).
+	Segments int32
+	// Concurrency is the number of segments scanned at once (default Segments).
+	Concurrency int
+	// PageSize is the Limit of every Scan call. Zero lets DynamoDB decide.
+	PageSize       int32
+	ConsistentRead bool
+	// Checkpoint resumes a previous scan with the same number of segments.
+	// Finished segments are skipped and the others restart after their
+	// last checkpointed page.
+	Checkpoint *ScanCheckpoint
+	// OnCheckpoint is called every time all the items of a page have been
+	// yielded, with the progress of the segment that page belongs to. Store
+	// it to resume the scan later; resuming may yield the items of pages
+	// that were in flight again.
+	OnCheckpoint func(ScanSegmentCheckpoint)
+}
+
+// ScanCheckpoint is the progress of every segment of a parallel scan.
+type ScanCheckpoint struct {
+	Segments []ScanSegmentCheckpoint `json:"segments"`
+}
+
+// ScanSegmentCheckpoint is the progress of one scan segment. It can be
+// stored as JSON.
+type ScanSegmentCheckpoint struct {
+	Segment          int32
+	LastEvaluatedKey map[string]types.AttributeValue
+	Done             bool
+}
+
+type scanSegmentCheckpointJSON struct {
+	Segment          int32                      `json:"segment"`
+	LastEvaluatedKey map[string]cursorAttribute `json:"lastEvaluatedKey,omitempty"`
+	Done             bool                       `json:"done,omitempty"`
+}
+
+func (s ScanSegmentCheckpoint) MarshalJSON() ([]byte, error) {
+	key, err := marshalKeyAttributes(s.LastEvaluatedKey)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(scanSegmentCheckpointJSON{Segment: s.Segment, LastEvaluatedKey: key, Done: s.Done})
+}
+
+func (s *ScanSegmentCheckpoint) UnmarshalJSON(data []byte) error {
+	var raw scanSegmentCheckpointJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	key, err := unmarshalKeyAttributes(raw.LastEvaluatedKey)
+	if err != nil {
+		return err
+	}
+	if len(key) == 0 {
+		key = nil
+	}
+	*s = ScanSegmentCheckpoint{Segment: raw.Segment, LastEvaluatedKey: key, Done: raw.Done}
+	return nil
+}
+
+// Update records the progress of one segment in the checkpoint.
+func (c *ScanCheckpoint) Update(progress ScanSegmentCheckpoint) {
+	for i := range c.Segments {
+		if c.Segments[i].Segment == progress.Segment {
+			c.Segments[i] = progress
+			return
+		}
+	}
+	c.Segments = append(c.Segments, progress)
+}
+
+func (c *ScanCheckpoint) segment(segment int32) ScanSegmentCheckpoint {
+	if c != nil {
+		for _, progress := range c.Segments {
+			if progress.Segment == segment {
+				return progress
+			}
+		}
+	}
+	return ScanSegmentCheckpoint{Segment: segment}
+}
+
+func (c *ScanCheckpoint) segmentsOutOfRange(segments int32) []ScanSegmentCheckpoint {
+	if c == nil {
+		return nil
+	}
+	var outOfRange []ScanSegmentCheckpoint
+	for _, progress := range c.Segments {
+		if progress.Segment < 0 || progress.Segment >= segments {
+			outOfRange = append(outOfRange, progress)
+		}
+	}
+	return outOfRange
+}
+
+func (o ScanOptions) withDefaults() ScanOptions {
+	if o.Segments <= 0 {
+		o.Segments = 1
+	}
+	if o.Concurrency <= 0 || o.Concurrency > int(o.Segments) {
+		o.Concurrency = int(o.Segments)
+	}
+	return o
+}
+
+type scanPage struct {
+	items    []map[string]types.AttributeValue
+	progress ScanSegmentCheckpoint
+	err      error
+}
+
+// ScanAll walks a whole table or index with parallel Scan segments and yields
+// every item that passes the filter of expr, projected with its projection.
+// Items of different segments are interleaved. The iteration stops at the
+// first error, which is yielded with the zero value of T; breaking out of the
+// loop or cancelling ctx stops the running segments.
+func ScanAll[T any](ctx context.Context, dbClient *DynamoDatabaseClient, tableName string, expr expression.Expression, options ScanOptions) iter.Seq2[T, error] {
+	options = options.withDefaults()
+	return func(yield func(T, error) bool) {
+		var empty T
+		if outOfRange := options.Checkpoint.segmentsOutOfRange(options.Segments); len(outOfRange) > 0 {
+			yield(empty, fmt.Errorf("dynamo: checkpoint segment %d does not fit %d segments", outOfRange[0].Segment, options.Segments))
+			return
+		}
+
+		// Read the starting point of every segment before the scan runs, so
+		// the checkpoint can be updated by OnCheckpoint while it is used.
+		starts := make([]ScanSegmentCheckpoint, 0, options.Segments)
+		for segment := int32(0); segment < options.Segments; segment++ {
+			if progress := options.Checkpoint.segment(segment); !progress.Done {
+				starts = append(starts, progress)
+			}
+		}
+
+		cipher, err := dbClient.attributeCipher(tableName, (*T)(nil))
+		if err != nil {
+			yield(empty, err)
+			return
+		}
+		ctx, cancel := context.WithCancel(ctx)
+		pages := make(chan scanPage, options.Concurrency)
+		defer func() {
+			cancel()
+			for range pages {
+			}
+		}()
+
+		go func() {
+			var wg sync.WaitGroup
+			semaphore := make(chan struct{}, options.Concurrency)
+			for _, progress := range starts {
+				select {
+				case semaphore <- struct{}{}:
+				case <-ctx.Done():
+				}
+				if ctx.Err() != nil {
+					break
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer func() { <-semaphore }()
+					dbClient.scanSegment(ctx, tableName, expr, options, (*T)(nil), progress, pages)
+				}()
+			}
+			wg.Wait()
+			close(pages)
+		}()
+
+		for page := range pages {
+			if page.err != nil {
+				yield(empty, page.err)
+				return
+			}
+			for _, item := range page.items {
+				var result T
+				item, err := cipher.open(ctx, item, nil)
+				if err != nil {
+					yield(empty, err)
+					return
+				}
+				if err := attributevalue.UnmarshalMap(item, &result); err != nil {
+					yield(empty, err)
+					return
+				}
+				if !yield(result, nil) {
+					return
+				}
+			}
+			if options.OnCheckpoint != nil {
+				options.OnCheckpoint(page.progress)
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			yield(empty, err)
+		}
+	}
+}
+
+// scanSegment reads one segment page by page and sends every page, with the
+// progress reached after it, to pages. resultDataPointer only tells the type
+// of the items.
+func (c DynamoDatabaseClient) scanSegment(ctx context.Context, tableName string, expr expression.Expression, options ScanOptions, resultDataPointer interface{}, progress ScanSegmentCheckpoint, pages chan<- scanPage) {
+	input := &dynamodb.ScanInput{
+		TableName:                 aws.String(c.GetTableUrl(tableName)),
+		FilterExpression:          expr.Filter(),
+		ProjectionExpression:      expr.Projection(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		ReturnConsumedCapacity:    types.ReturnConsumedCapacityTotal,
+	}
+	if options.IndexName != "" {
+		input.IndexName = aws.String(options.IndexName)
+	}
+	input.FilterExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues = expiryFilter(ctx, resultDataPointer, input.FilterExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	if options.Segments > 1 {
+		input.Segment = aws.Int32(progress.Segment)
+		input.TotalSegments = aws.Int32(options.Segments)
+	}
+	if options.PageSize > 0 {
+		input.Limit = aws.Int32(options.PageSize)
+	}
+	if options.ConsistentRead {
+		input.ConsistentRead = aws.Bool(true)
+	}
+
+	send := func(page scanPage) bool {
+		select {
+		case pages <- page:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	for {
+		input.ExclusiveStartKey = progress.LastEvaluatedKey
+		result, err := c.dynamoClient.Scan(ctx, input)
+		if err != nil {
+			if ctx.Err() == nil {
+				send(scanPage{err: err})
+			}
+			return
+		}
+		progress = ScanSegmentCheckpoint{
+			Segment:          progress.Segment,
+			LastEvaluatedKey: result.LastEvaluatedKey,
+			Done:             len(result.LastEvaluatedKey) == 0,
+		}
+		if !send(scanPage{items: result.Items, progress: progress}) || progress.Done {
+			return
+		}
+	}
+}
+
+// ScanAll is the Table variant of the ScanAll function.
+func (t *Table[T]) ScanAll(ctx context.Context, expr expression.Expression, options ScanOptions) iter.Seq2[T, error] {
+	return ScanAll[T](ctx, t.client, t.tableName, expr, options)
+}
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+)
+
+func TestScanAllWithSegmentsAndCheckpoint(t *testing.T) {
+	client := createTestDynamoClient(t)
+	seedTestEvents(t, client, 30)
+
+	expr, _ := expression.NewBuilder().
+		WithFilter(expression.Name("status").Equal(expression.Value("open"))).
+		WithProjection(expression.NamesList(expression.Name("eventId"), expression.Name("status"))).
+		Build()
+
+	var checkpoint ScanCheckpoint
+	options := ScanOptions{Segments: 4, Concurrency: 2, PageSize: 3, OnCheckpoint: checkpoint.Update}
+	seen := map[string]int{}
+	for event, err := range ScanAll[testEvent](context.Background(), client, "events", expr, options) {
+		if err != nil {
+			t.Fatalf("ScanAll failed: %v", err)
+		}
+		if event.Status != "open" || event.Amount != 0 {
+			t.Errorf("ScanAll item -> Expected: projected open event // Returned: %+v", event)
+		}
+		seen[event.EventID]++
+		if len(seen) == 5 {
+			break
+		}
+	}
+
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		t.Fatalf("Marshal checkpoint failed: %v", err)
+	}
+	var resumed ScanCheckpoint
+	if err := json.Unmarshal(data, &resumed); err != nil {
+		t.Fatalf("Unmarshal checkpoint failed: %v", err)
+	}
+
+	options = ScanOptions{Segments: 4, PageSize: 3, Checkpoint: &resumed, OnCheckpoint: resumed.Update}
+	for event, err := range ScanAll[testEvent](context.Background(), client, "events", expr, options) {
+		if err != nil {
+			t.Fatalf("Resumed ScanAll failed: %v", err)
+		}
+		seen[event.EventID]++
+	}
+	if len(seen) != 15 {
+		t.Errorf("ScanAll distinct items -> Expected: 15 // Returned: %d", len(seen))
+	}
+	if len(resumed.Segments) != 4 {
+		t.Fatalf("Checkpoint segments -> Expected: 4 // Returned: %+v", resumed.Segments)
+	}
+	for _, progress := range resumed.Segments {
+		if !progress.Done {
+			t.Errorf("Segment %d -> Expected: done // Returned: %+v", progress.Segment, progress)
+		}
+	}
+
+	options = ScanOptions{Segments: 2, Checkpoint: &resumed}
+	for _, err := range ScanAll[testEvent](context.Background(), client, "events", expr, options) {
+		if err == nil {
+			t.Errorf("ScanAll with a checkpoint of 4 segments over 2 -> Expected: error")
+		}
+		break
+	}
+}
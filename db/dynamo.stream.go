@@ -0,0 +1,451 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	streamtypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/techvuya/vuya-go-utils/awsconfig"
+)
+
+var ErrStreamHandlerFailed = errors.New("ErrStreamHandlerFailed")
+
+// DynamoStreamApiClient is the part of the DynamoDB Streams API used by
+// StreamConsumer. *dynamodbstreams.Client and MemoryStreamClient implement it.
+type DynamoStreamApiClient interface {
+	DescribeStream(ctx context.Context, params *dynamodbstreams.DescribeStreamInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.DescribeStreamOutput, error)
+	GetShardIterator(ctx context.Context, params *dynamodbstreams.GetShardIteratorInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetShardIteratorOutput, error)
+	GetRecords(ctx context.Context, params *dynamodbstreams.GetRecordsInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetRecordsOutput, error)
+}
+
+// CreateDynamoStreamApiClient builds a client for the DynamoDB Streams API of
+// awsSessionRegion, with the same defaults as CreateDynamoDatabaseClient.
+func CreateDynamoStreamApiClient(awsSessionRegion string, options ...awsconfig.Option) (*dynamodbstreams.Client, error) {
+	defaults := []awsconfig.Option{awsconfig.WithRegion(awsSessionRegion), awsconfig.WithTracing(true)}
+	cfg, err := awsconfig.Load(context.TODO(), append(defaults, options...)...)
+	if err != nil {
+		return nil, err
+	}
+	return dynamodbstreams.NewFromConfig(cfg), nil
+}
+
+// StreamEventType is the kind of change of a StreamEvent.
+type StreamEventType string
+
+const (
+	StreamEventInsert StreamEventType = "INSERT"
+	StreamEventModify StreamEventType = "MODIFY"
+	StreamEventRemove StreamEventType = "REMOVE"
+)
+
+// StreamEvent is a stream record decoded into T. NewImage and OldImage are nil
+// when the record does not carry them, which depends on the event type and on
+// the StreamViewType of the table.
+type StreamEvent[T any] struct {
+	Type           StreamEventType
+	EventID        string
+	ShardID        string
+	SequenceNumber string
+	CreatedAt      time.Time
+	Keys           map[string]types.AttributeValue
+	NewImage       *T
+	OldImage       *T
+}
+
+// StreamHandler processes one event. Returning an error retries the event;
+// the handler must therefore be idempotent.
+type StreamHandler[T any] func(ctx context.Context, event StreamEvent[T]) error
+
+// StreamCheckpointStore keeps the sequence number of the last processed
+// record of every shard. GetCheckpoint returns "" for a shard never seen.
+type StreamCheckpointStore interface {
+	GetCheckpoint(ctx context.Context, streamArn, shardID string) (string, error)
+	SetCheckpoint(ctx context.Context, streamArn, shardID, sequenceNumber string) error
+}
+
+// StreamConsumerOptions tunes a StreamConsumer. The zero value uses the
+// defaults below.
+type StreamConsumerOptions struct {
+	// StartingPosition is where shards without a checkpoint are read from,
+	// TRIM_HORIZON (default) or LATEST.
+	StartingPosition streamtypes.ShardIteratorType
+	// BatchSize is the Limit of every GetRecords call (default 100).
+	BatchSize int32
+	// PollInterval is the wait after a GetRecords call that returned no
+	// records (default 1s).
+	PollInterval time.Duration
+	// DiscoveryInterval is how often new shards are looked up (default 30s).
+	DiscoveryInterval time.Duration
+	// MaxRetries bounds the retries of a failing handler call (default 5).
+	// Once exhausted Run stops without checkpointing the event.
+	MaxRetries int
+	// BaseDelay and MaxDelay bound the backoff between handler retries
+	// (defaults 100ms and 5s).
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+func (o StreamConsumerOptions) withDefaults() StreamConsumerOptions {
+	if o.StartingPosition == "" {
+		o.StartingPosition = streamtypes.ShardIteratorTypeTrimHorizon
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = 100
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = time.Second
+	}
+	if o.DiscoveryInterval <= 0 {
+		o.DiscoveryInterval = 30 * time.Second
+	}
+	if o.MaxRetries <= 0 {
+		o.MaxRetries = 5
+	}
+	if o.BaseDelay <= 0 {
+		o.BaseDelay = 100 * time.Millisecond
+	}
+	if o.MaxDelay <= 0 {
+		o.MaxDelay = 5 * time.Second
+	}
+	return o
+}
+
+// StreamConsumer delivers the records of a DynamoDB stream to a handler as
+// typed events, at least once. Shards are read concurrently, a child shard
+// only after its parent, so the changes of one item arrive in order.
+type StreamConsumer[T any] struct {
+	client      DynamoStreamApiClient
+	streamArn   string
+	checkpoints StreamCheckpointStore
+	handler     StreamHandler[T]
+	options     StreamConsumerOptions
+	encryption  EncryptionKeyProvider
+	tableName   string
+}
+
+// CreateStreamConsumer returns a consumer of streamArn that decodes every
+// image into T.
+func CreateStreamConsumer[T any](client DynamoStreamApiClient, streamArn string, checkpoints StreamCheckpointStore, handler StreamHandler[T], options StreamConsumerOptions) *StreamConsumer[T] {
+	return &StreamConsumer[T]{
+		client:      client,
+		streamArn:   streamArn,
+		checkpoints: checkpoints,
+		handler:     handler,
+		options:     options.withDefaults(),
+	}
+}
+
+// SetEncryptionKeyProvider opens the fields of T tagged encrypt:"<scope>"
+// in the images of the stream, as DynamoDatabaseClient.SetEncryptionKeyProvider
+// does on reads. tableName is the table of the stream, without the
+// environment prefix, as the values were sealed with it.
+func (s *StreamConsumer[T]) SetEncryptionKeyProvider(provider EncryptionKeyProvider, tableName string) {
+	s.encryption, s.tableName = provider, tableName
+}
+
+type streamShardState int
+
+const (
+	streamShardRunning streamShardState = iota + 1
+	streamShardFinished
+)
+
+// Run consumes the stream until ctx is canceled or an error stops it. On
+// cancellation every shard checkpoints the events already handled and Run
+// returns nil.
+func (s *StreamConsumer[T]) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	states := make(map[string]streamShardState)
+	finished := make(chan string)
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+	}
+
+	ticker := time.NewTicker(s.options.DiscoveryInterval)
+	defer ticker.Stop()
+	for {
+		shards, err := s.describeShards(ctx)
+		if err != nil && ctx.Err() == nil {
+			fail(err)
+		}
+		known := make(map[string]bool, len(shards))
+		for _, shard := range shards {
+			known[aws.ToString(shard.ShardId)] = true
+		}
+		for _, shard := range shards {
+			shardID, parentID := aws.ToString(shard.ShardId), aws.ToString(shard.ParentShardId)
+			if states[shardID] != 0 || (parentID != "" && known[parentID] && states[parentID] != streamShardFinished) {
+				continue
+			}
+			states[shardID] = streamShardRunning
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := s.consumeShard(ctx, shardID); err != nil {
+					fail(err)
+					return
+				}
+				select {
+				case finished <- shardID:
+				case <-ctx.Done():
+				}
+			}()
+		}
+
+		discover := false
+		for !discover {
+			select {
+			case shardID := <-finished:
+				states[shardID] = streamShardFinished
+				discover = true
+			case <-ticker.C:
+				discover = true
+			case <-ctx.Done():
+				wg.Wait()
+				mu.Lock()
+				defer mu.Unlock()
+				return firstErr
+			}
+		}
+	}
+}
+
+func (s *StreamConsumer[T]) describeShards(ctx context.Context) ([]streamtypes.Shard, error) {
+	var shards []streamtypes.Shard
+	input := &dynamodbstreams.DescribeStreamInput{StreamArn: aws.String(s.streamArn)}
+	for {
+		result, err := s.client.DescribeStream(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		if result.StreamDescription == nil {
+			return shards, nil
+		}
+		shards = append(shards, result.StreamDescription.Shards...)
+		if result.StreamDescription.LastEvaluatedShardId == nil {
+			return shards, nil
+		}
+		input.ExclusiveStartShardId = result.StreamDescription.LastEvaluatedShardId
+	}
+}
+
+func (s *StreamConsumer[T]) shardIterator(ctx context.Context, shardID, checkpoint string) (*string, error) {
+	input := &dynamodbstreams.GetShardIteratorInput{
+		StreamArn:         aws.String(s.streamArn),
+		ShardId:           aws.String(shardID),
+		ShardIteratorType: s.options.StartingPosition,
+	}
+	if checkpoint != "" {
+		input.ShardIteratorType = streamtypes.ShardIteratorTypeAfterSequenceNumber
+		input.SequenceNumber = aws.String(checkpoint)
+	}
+	result, err := s.client.GetShardIterator(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	return result.ShardIterator, nil
+}
+
+// consumeShard reads shardID until it is closed and fully processed, or
+// until ctx is canceled.
+func (s *StreamConsumer[T]) consumeShard(ctx context.Context, shardID string) error {
+	checkpoint, err := s.checkpoints.GetCheckpoint(ctx, s.streamArn, shardID)
+	if err != nil {
+		return err
+	}
+	iterator, err := s.shardIterator(ctx, shardID, checkpoint)
+	for iterator != nil && err == nil {
+		var result *dynamodbstreams.GetRecordsOutput
+		result, err = s.client.GetRecords(ctx, &dynamodbstreams.GetRecordsInput{
+			ShardIterator: iterator,
+			Limit:         aws.Int32(s.options.BatchSize),
+		})
+		var expiredErr *streamtypes.ExpiredIteratorException
+		if errors.As(err, &expiredErr) {
+			iterator, err = s.shardIterator(ctx, shardID, checkpoint)
+			continue
+		}
+		if err != nil {
+			break
+		}
+
+		handled := checkpoint
+		for _, record := range result.Records {
+			if err = s.handle(ctx, shardID, record); err != nil {
+				break
+			}
+			if record.Dynamodb != nil {
+				handled = aws.ToString(record.Dynamodb.SequenceNumber)
+			}
+		}
+		if handled != checkpoint {
+			// Checkpoint what was handled even when ctx is being canceled.
+			if setErr := s.checkpoints.SetCheckpoint(context.WithoutCancel(ctx), s.streamArn, shardID, handled); setErr != nil {
+				return setErr
+			}
+			checkpoint = handled
+		}
+		if err != nil {
+			break
+		}
+		iterator = result.NextShardIterator
+		if iterator != nil && len(result.Records) == 0 {
+			err = sleepWithContext(ctx, s.options.PollInterval)
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// handle delivers record to the handler, retrying with backoff.
+func (s *StreamConsumer[T]) handle(ctx context.Context, shardID string, record streamtypes.Record) error {
+	cipher, err := createAttributeCipher(s.encryption, s.tableName, new(T))
+	if err != nil {
+		return err
+	}
+	event, err := decodeStreamRecord[T](ctx, cipher, shardID, record)
+	if err != nil {
+		return err
+	}
+	for attempt := 0; ; attempt++ {
+		err := s.handler(ctx, event)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if attempt >= s.options.MaxRetries {
+			return fmt.Errorf("%w: shard %s sequence %s: %w", ErrStreamHandlerFailed, shardID, event.SequenceNumber, err)
+		}
+		if err := sleepWithContext(ctx, backoffDelay(attempt, s.options.BaseDelay, s.options.MaxDelay)); err != nil {
+			return err
+		}
+	}
+}
+
+// decodeStreamRecord decodes record, opening the encrypted attributes of its
+// images with cipher.
+func decodeStreamRecord[T any](ctx context.Context, cipher *attributeCipher, shardID string, record streamtypes.Record) (StreamEvent[T], error) {
+	event := StreamEvent[T]{
+		Type:    StreamEventType(record.EventName),
+		EventID: aws.ToString(record.EventID),
+		ShardID: shardID,
+	}
+	if record.Dynamodb == nil {
+		return event, nil
+	}
+	event.SequenceNumber = aws.ToString(record.Dynamodb.SequenceNumber)
+	event.CreatedAt = aws.ToTime(record.Dynamodb.ApproximateCreationDateTime)
+	keys, err := attributevalue.FromDynamoDBStreamsMap(record.Dynamodb.Keys)
+	if err != nil {
+		return event, err
+	}
+	event.Keys = keys
+	if event.NewImage, err = decodeStreamImage[T](ctx, cipher, record.Dynamodb.NewImage, keys); err != nil {
+		return event, err
+	}
+	if event.OldImage, err = decodeStreamImage[T](ctx, cipher, record.Dynamodb.OldImage, keys); err != nil {
+		return event, err
+	}
+	return event, nil
+}
+
+func decodeStreamImage[T any](ctx context.Context, cipher *attributeCipher, image map[string]streamtypes.AttributeValue, keys map[string]types.AttributeValue) (*T, error) {
+	if image == nil {
+		return nil, nil
+	}
+	item, err := attributevalue.FromDynamoDBStreamsMap(image)
+	if err != nil {
+		return nil, err
+	}
+	if item, err = cipher.open(ctx, item, keys); err != nil {
+		return nil, err
+	}
+	result := new(T)
+	if err := attributevalue.UnmarshalMap(item, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// MemoryStreamCheckpointStore keeps checkpoints in memory, for tests and for
+// consumers that may replay the stream after a restart.
+type MemoryStreamCheckpointStore struct {
+	mu          sync.Mutex
+	checkpoints map[string]string
+}
+
+// CreateMemoryStreamCheckpointStore returns an empty checkpoint store.
+func CreateMemoryStreamCheckpointStore() *MemoryStreamCheckpointStore {
+	return &MemoryStreamCheckpointStore{checkpoints: make(map[string]string)}
+}
+
+func (m *MemoryStreamCheckpointStore) GetCheckpoint(ctx context.Context, streamArn, shardID string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.checkpoints[streamArn+"/"+shardID], nil
+}
+
+func (m *MemoryStreamCheckpointStore) SetCheckpoint(ctx context.Context, streamArn, shardID, sequenceNumber string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.checkpoints[streamArn+"/"+shardID] = sequenceNumber
+	return nil
+}
+
+// DynamoStreamCheckpointStore keeps checkpoints in a DynamoDB table whose
+// partition key is streamArn and sort key shardId, both strings.
+type DynamoStreamCheckpointStore struct {
+	client    DynamoDatabaseClientInterface
+	tableName string
+}
+
+type streamCheckpoint struct {
+	StreamArn      string `dynamodbav:"streamArn"`
+	ShardID        string `dynamodbav:"shardId"`
+	SequenceNumber string `dynamodbav:"sequenceNumber"`
+}
+
+// CreateDynamoStreamCheckpointStore returns a store writing to tableName.
+func CreateDynamoStreamCheckpointStore(client DynamoDatabaseClientInterface, tableName string) *DynamoStreamCheckpointStore {
+	return &DynamoStreamCheckpointStore{client: client, tableName: tableName}
+}
+
+func (d *DynamoStreamCheckpointStore) GetCheckpoint(ctx context.Context, streamArn, shardID string) (string, error) {
+	key, err := attributevalue.MarshalMap(map[string]string{"streamArn": streamArn, "shardId": shardID})
+	if err != nil {
+		return "", err
+	}
+	var checkpoint streamCheckpoint
+	err = d.client.Get(ctx, d.tableName, key, &checkpoint)
+	if errors.Is(err, ErrQueryNoData) {
+		return "", nil
+	}
+	return checkpoint.SequenceNumber, err
+}
+
+func (d *DynamoStreamCheckpointStore) SetCheckpoint(ctx context.Context, streamArn, shardID, sequenceNumber string) error {
+	return d.client.PutItem(ctx, d.tableName, streamCheckpoint{StreamArn: streamArn, ShardID: shardID, SequenceNumber: sequenceNumber})
+}
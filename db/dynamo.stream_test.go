@@ -0,0 +1,226 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	streamtypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+)
+
+const testStreamArn = "arn:aws:dynamodb:us-east-1:000000000000:table/test.events/stream/1"
+
+func testStreamImage(eventID, status string) map[string]streamtypes.AttributeValue {
+	if status == "" {
+		return nil
+	}
+	return map[string]streamtypes.AttributeValue{
+		"orgId":   &streamtypes.AttributeValueMemberS{Value: "org-1"},
+		"eventId": &streamtypes.AttributeValueMemberS{Value: eventID},
+		"status":  &streamtypes.AttributeValueMemberS{Value: status},
+	}
+}
+
+func testStreamRecord(eventName streamtypes.OperationType, eventID, newStatus, oldStatus string) streamtypes.Record {
+	return streamtypes.Record{
+		EventName: eventName,
+		Dynamodb: &streamtypes.StreamRecord{
+			Keys: map[string]streamtypes.AttributeValue{
+				"orgId":   &streamtypes.AttributeValueMemberS{Value: "org-1"},
+				"eventId": &streamtypes.AttributeValueMemberS{Value: eventID},
+			},
+			NewImage: testStreamImage(eventID, newStatus),
+			OldImage: testStreamImage(eventID, oldStatus),
+		},
+	}
+}
+
+var testStreamOptions = StreamConsumerOptions{
+	BatchSize:         2,
+	PollInterval:      2 * time.Millisecond,
+	DiscoveryInterval: 5 * time.Millisecond,
+	MaxRetries:        2,
+	BaseDelay:         time.Millisecond,
+	MaxDelay:          time.Millisecond,
+}
+
+// streamEventCollector records the events it handles and cancels the
+// consumer once it has seen the expected number of them.
+type streamEventCollector struct {
+	mu       sync.Mutex
+	events   []string
+	expected int
+	cancel   context.CancelFunc
+	fail     func(StreamEvent[testEvent]) bool
+}
+
+func (c *streamEventCollector) handle(ctx context.Context, event StreamEvent[testEvent]) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fail != nil && c.fail(event) {
+		return errors.New("handler failed")
+	}
+	description := string(event.Type) + " " + event.ShardID
+	if event.OldImage != nil {
+		description += " " + event.OldImage.Status
+	}
+	if event.NewImage != nil {
+		description += " " + event.NewImage.Status
+	}
+	c.events = append(c.events, description)
+	if len(c.events) == c.expected {
+		c.cancel()
+	}
+	return nil
+}
+
+func runTestStreamConsumer(t *testing.T, client *MemoryStreamClient, checkpoints StreamCheckpointStore, collector *streamEventCollector) error {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	collector.cancel = cancel
+	consumer := CreateStreamConsumer(client, testStreamArn, checkpoints, collector.handle, testStreamOptions)
+	err := consumer.Run(ctx)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		t.Fatalf("Run did not deliver the expected events: %v", collector.events)
+	}
+	return err
+}
+
+func TestStreamConsumer(t *testing.T) {
+	client := CreateMemoryStreamClient(testStreamArn)
+	client.AddShard("shard-1", "")
+	client.PutRecords("shard-1",
+		testStreamRecord(streamtypes.OperationTypeInsert, "evt-1", "open", ""),
+		testStreamRecord(streamtypes.OperationTypeModify, "evt-1", "closed", "open"),
+		testStreamRecord(streamtypes.OperationTypeInsert, "evt-2", "open", ""),
+	)
+	client.CloseShard("shard-1")
+	client.AddShard("shard-2", "shard-1")
+	client.PutRecords("shard-2", testStreamRecord(streamtypes.OperationTypeRemove, "evt-1", "", "closed"))
+	checkpoints := CreateMemoryStreamCheckpointStore()
+
+	failures := 0
+	collector := &streamEventCollector{expected: 4, fail: func(event StreamEvent[testEvent]) bool {
+		if event.Type == StreamEventModify && failures == 0 {
+			failures++
+			return true
+		}
+		return false
+	}}
+	if err := runTestStreamConsumer(t, client, checkpoints, collector); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	expected := []string{"INSERT shard-1 open", "MODIFY shard-1 open closed", "INSERT shard-1 open", "REMOVE shard-2 closed"}
+	if !reflect.DeepEqual(collector.events, expected) {
+		t.Errorf("Events -> Expected: %v // Returned: %v", expected, collector.events)
+	}
+
+	client.PutRecords("shard-2", testStreamRecord(streamtypes.OperationTypeInsert, "evt-3", "open", ""))
+	collector = &streamEventCollector{expected: 1}
+	if err := runTestStreamConsumer(t, client, checkpoints, collector); err != nil {
+		t.Fatalf("Run after restart failed: %v", err)
+	}
+	expected = []string{"INSERT shard-2 open"}
+	if !reflect.DeepEqual(collector.events, expected) {
+		t.Errorf("Events after restart -> Expected: %v // Returned: %v", expected, collector.events)
+	}
+}
+
+func TestStreamConsumerHandlerFailure(t *testing.T) {
+	client := CreateMemoryStreamClient(testStreamArn)
+	client.AddShard("shard-1", "")
+	client.PutRecords("shard-1",
+		testStreamRecord(streamtypes.OperationTypeInsert, "evt-1", "open", ""),
+		testStreamRecord(streamtypes.OperationTypeInsert, "evt-2", "broken", ""),
+	)
+	checkpoints := CreateMemoryStreamCheckpointStore()
+
+	collector := &streamEventCollector{expected: -1, fail: func(event StreamEvent[testEvent]) bool {
+		return event.NewImage.Status == "broken"
+	}}
+	err := runTestStreamConsumer(t, client, checkpoints, collector)
+	if !errors.Is(err, ErrStreamHandlerFailed) {
+		t.Fatalf("Run -> Expected: ErrStreamHandlerFailed // Returned: %v", err)
+	}
+	checkpoint, _ := checkpoints.GetCheckpoint(context.Background(), testStreamArn, "shard-1")
+	if expected := "000000000000000000001"; checkpoint != expected {
+		t.Errorf("Checkpoint -> Expected: %s // Returned: %s", expected, checkpoint)
+	}
+}
+
+func TestStreamConsumerEncryptedImages(t *testing.T) {
+	dbClient, provider := createEncryptedTestDynamoClient(t)
+	phone := "+34 600 000 000"
+	customer := testCustomer{OrgID: "org-1", EventID: "cus-1", Status: "open", Email: "ana@example.com", Phone: &phone}
+	if err := dbClient.PutItem(context.Background(), "events", customer); err != nil {
+		t.Fatalf("PutItem failed: %v", err)
+	}
+	image := make(map[string]streamtypes.AttributeValue)
+	for name, value := range rawTestItem(t, dbClient, "org-1", "cus-1") {
+		switch v := value.(type) {
+		case *types.AttributeValueMemberS:
+			image[name] = &streamtypes.AttributeValueMemberS{Value: v.Value}
+		case *types.AttributeValueMemberB:
+			image[name] = &streamtypes.AttributeValueMemberB{Value: v.Value}
+		case *types.AttributeValueMemberNULL:
+			image[name] = &streamtypes.AttributeValueMemberNULL{Value: v.Value}
+		}
+	}
+	client := CreateMemoryStreamClient(testStreamArn)
+	client.AddShard("shard-1", "")
+	client.PutRecords("shard-1", streamtypes.Record{
+		EventName: streamtypes.OperationTypeInsert,
+		Dynamodb: &streamtypes.StreamRecord{
+			Keys: map[string]streamtypes.AttributeValue{
+				"orgId":   &streamtypes.AttributeValueMemberS{Value: "org-1"},
+				"eventId": &streamtypes.AttributeValueMemberS{Value: "cus-1"},
+			},
+			NewImage: image,
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var received *testCustomer
+	consumer := CreateStreamConsumer(client, testStreamArn, CreateMemoryStreamCheckpointStore(), func(ctx context.Context, event StreamEvent[testCustomer]) error {
+		received = event.NewImage
+		cancel()
+		return nil
+	}, testStreamOptions)
+	consumer.SetEncryptionKeyProvider(provider, "events")
+	if err := consumer.Run(ctx); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if received == nil || !reflect.DeepEqual(*received, customer) {
+		t.Errorf("NewImage -> Expected: %+v // Returned: %+v", customer, received)
+	}
+}
+
+func TestDynamoStreamCheckpointStore(t *testing.T) {
+	ctx := context.Background()
+	client := CreateDynamoDatabaseClientWithApi(CreateMemoryDynamoClient(), "test")
+	definition := TableDefinition{
+		Name:         "checkpoints",
+		PartitionKey: KeyAttribute{Name: "streamArn", Type: types.ScalarAttributeTypeS},
+		SortKey:      &KeyAttribute{Name: "shardId", Type: types.ScalarAttributeTypeS},
+	}
+	if _, err := client.EnsureTable(ctx, definition, ProvisionOptions{}); err != nil {
+		t.Fatalf("EnsureTable failed: %v", err)
+	}
+	store := CreateDynamoStreamCheckpointStore(client, "checkpoints")
+
+	if checkpoint, err := store.GetCheckpoint(ctx, testStreamArn, "shard-1"); err != nil || checkpoint != "" {
+		t.Errorf("GetCheckpoint of a new shard -> Expected: empty // Returned: %q %v", checkpoint, err)
+	}
+	if err := store.SetCheckpoint(ctx, testStreamArn, "shard-1", "42"); err != nil {
+		t.Fatalf("SetCheckpoint failed: %v", err)
+	}
+	if checkpoint, err := store.GetCheckpoint(ctx, testStreamArn, "shard-1"); err != nil || checkpoint != "42" {
+		t.Errorf("GetCheckpoint -> Expected: 42 // Returned: %q %v", checkpoint, err)
+	}
+}
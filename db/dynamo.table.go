@@ -0,0 +1,182 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	paginate "github.com/techvuya/vuya-go-utils/paginate"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// TableKeySchema names the key attributes of a table.
+type TableKeySchema struct {
+	PartitionKey string
+	SortKey      string
+}
+
+// Table is a typed repository bound to one table. The key schema is read
+// from the dynamo struct tags of T, so results and keys are checked against
+// the item type at compile time instead of going through interface{}.
+//
+// A Table reads and writes through the underlying *DynamoDatabaseClient, so
+// with a CachedDynamoClient it neither reads from the cache nor invalidates
+// it; its writes are only seen by cached reads when their entries expire.
+type Table[T any] struct {
+	client    *DynamoDatabaseClient
+	tableName string
+	keys      TableKeySchema
+	info      *dynamoStructInfo
+}
+
+// CreateTypedTable binds T to tableName. T must be a struct with a field
+// tagged dynamo:",pk" and, for composite keys, one tagged dynamo:",sk".
+func CreateTypedTable[T any](client *DynamoDatabaseClient, tableName string) (*Table[T], error) {
+	info, err := getDynamoStructInfo(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return nil, err
+	}
+	if info.partitionKey == nil {
+		return nil, fmt.Errorf("dynamo: %T has no field tagged dynamo:\",pk\"", *new(T))
+	}
+	keys := TableKeySchema{PartitionKey: info.partitionKey.name}
+	if info.sortKey != nil {
+		keys.SortKey = info.sortKey.name
+	}
+	return &Table[T]{
+		client:    client,
+		tableName: tableName,
+		keys:      keys,
+		info:      info,
+	}, nil
+}
+
+// TableName returns the unprefixed table name.
+func (t *Table[T]) TableName() string {
+	return t.tableName
+}
+
+// TableUrl returns the table name with the client environment prefix.
+func (t *Table[T]) TableUrl() string {
+	return t.client.GetTableUrl(t.tableName)
+}
+
+// KeySchema returns the key attributes derived from the struct tags of T.
+func (t *Table[T]) KeySchema() TableKeySchema {
+	return t.keys
+}
+
+// Key builds the primary key of an item. sortKey must be nil for tables
+// without a sort key.
+func (t *Table[T]) Key(partitionKey, sortKey interface{}) (map[string]types.AttributeValue, error) {
+	key := make(map[string]types.AttributeValue, 2)
+	pk, err := marshalKeyValue(t.keys.PartitionKey, partitionKey)
+	if err != nil {
+		return nil, err
+	}
+	key[t.keys.PartitionKey] = pk
+	if t.keys.SortKey == "" {
+		if sortKey != nil {
+			return nil, fmt.Errorf("dynamo: table %s has no sort key", t.tableName)
+		}
+		return key, nil
+	}
+	sk, err := marshalKeyValue(t.keys.SortKey, sortKey)
+	if err != nil {
+		return nil, err
+	}
+	key[t.keys.SortKey] = sk
+	return key, nil
+}
+
+// KeyOf extracts the primary key of item using its tagged key fields.
+func (t *Table[T]) KeyOf(item T) (map[string]types.AttributeValue, error) {
+	value := reflect.ValueOf(item)
+	pk, ok := t.info.partitionKey.fieldValue(value)
+	if !ok {
+		return nil, fmt.Errorf("dynamo: partition key %s is not set", t.keys.PartitionKey)
+	}
+	if t.info.sortKey == nil {
+		return t.Key(pk.Interface(), nil)
+	}
+	sk, ok := t.info.sortKey.fieldValue(value)
+	if !ok {
+		return nil, fmt.Errorf("dynamo: sort key %s is not set", t.keys.SortKey)
+	}
+	return t.Key(pk.Interface(), sk.Interface())
+}
+
+func marshalKeyValue(attributeName string, value interface{}) (types.AttributeValue, error) {
+	if value == nil {
+		return nil, fmt.Errorf("dynamo: key attribute %s is required", attributeName)
+	}
+	av, err := attributevalue.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		if v.Value == "" {
+			return nil, fmt.Errorf("dynamo: key attribute %s cannot be empty", attributeName)
+		}
+		return av, nil
+	case *types.AttributeValueMemberN, *types.AttributeValueMemberB:
+		return av, nil
+	}
+	return nil, fmt.Errorf("dynamo: key attribute %s must be a string, number or binary value", attributeName)
+}
+
+// Get returns the item stored under the given key or ErrQueryNoData.
+func (t *Table[T]) Get(ctx context.Context, partitionKey, sortKey interface{}) (T, error) {
+	var result T
+	key, err := t.Key(partitionKey, sortKey)
+	if err != nil {
+		return result, err
+	}
+	if err := t.client.Get(ctx, t.tableName, key, &result); err != nil {
+		var empty T
+		return empty, err
+	}
+	return result, nil
+}
+
+// Put writes item, replacing any existing item with the same key. Versioned
+// items are checked as described in DynamoDatabaseClient.PutItem and item
+// receives the stored version, so it can be put again.
+func (t *Table[T]) Put(ctx context.Context, item *T) error {
+	return t.client.PutItem(ctx, t.tableName, item)
+}
+
+// Delete removes the item stored under the given key.
+func (t *Table[T]) Delete(ctx context.Context, partitionKey, sortKey interface{}) error {
+	key, err := t.Key(partitionKey, sortKey)
+	if err != nil {
+		return err
+	}
+	return t.client.DeleteItem(ctx, t.tableName, key)
+}
+
+// Update applies the update (and optional condition) of expr to the item
+// stored under the given key.
+func (t *Table[T]) Update(ctx context.Context, partitionKey, sortKey interface{}, expr expression.Expression) error {
+	key, err := t.Key(partitionKey, sortKey)
+	if err != nil {
+		return err
+	}
+	return t.client.UpdateItemExpr(ctx, t.tableName, key, expr)
+}
+
+// Query runs expr against the table or one of its indexes and returns the
+// cursor of the next page. Like DynamoDatabaseClient.QueryPage it returns
+// ErrQueryNoData when nothing matches.
+func (t *Table[T]) Query(ctx context.Context, index string, expr expression.Expression, limitItems *int32, paginateParams paginate.AgPaginateOptionsRequest) ([]T, string, error) {
+	var results []T
+	cursor, err := t.client.QueryPage(ctx, t.tableName, index, expr, limitItems, &results, paginateParams)
+	if err != nil {
+		return nil, "", err
+	}
+	return results, cursor, nil
+}
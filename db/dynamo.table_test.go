@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	paginate "github.com/techvuya/vuya-go-utils/paginate"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+)
+
+type testTableEvent struct {
+	OrgID   string `dynamodbav:"orgId" dynamo:",pk"`
+	EventID string `dynamodbav:"eventId" dynamo:",sk"`
+	Status  string `dynamodbav:"status"`
+	Amount  int    `dynamodbav:"amount"`
+}
+
+func TestTypedTable(t *testing.T) {
+	client := createTestDynamoClient(t)
+	table, err := CreateTypedTable[testTableEvent](client, "events")
+	if err != nil {
+		t.Fatalf("CreateTypedTable failed: %v", err)
+	}
+	if table.KeySchema() != (TableKeySchema{PartitionKey: "orgId", SortKey: "eventId"}) {
+		t.Errorf("KeySchema -> Returned: %+v", table.KeySchema())
+	}
+	if table.TableUrl() != "test.events" {
+		t.Errorf("TableUrl -> Expected: test.events // Returned: %s", table.TableUrl())
+	}
+
+	ctx := context.Background()
+	for _, id := range []string{"evt-1", "evt-2", "evt-3"} {
+		if err := table.Put(ctx, &testTableEvent{OrgID: "org-1", EventID: id, Status: "open", Amount: 1}); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+
+	event, err := table.Get(ctx, "org-1", "evt-2")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if event.EventID != "evt-2" || event.Amount != 1 {
+		t.Errorf("Get returned unexpected item: %+v", event)
+	}
+
+	update, _ := expression.NewBuilder().WithUpdate(expression.Add(expression.Name("amount"), expression.Value(4))).Build()
+	if err := table.Update(ctx, "org-1", "evt-2", update); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	event, _ = table.Get(ctx, "org-1", "evt-2")
+	if event.Amount != 5 {
+		t.Errorf("Update amount -> Expected: 5 // Returned: %d", event.Amount)
+	}
+
+	if err := table.Delete(ctx, "org-1", "evt-1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := table.Get(ctx, "org-1", "evt-1"); !errors.Is(err, ErrQueryNoData) {
+		t.Errorf("Get after Delete -> Expected: ErrQueryNoData // Returned: %v", err)
+	}
+
+	keyCondition := expression.Key("orgId").Equal(expression.Value("org-1"))
+	expr, _ := expression.NewBuilder().WithKeyCondition(keyCondition).Build()
+	events, _, err := table.Query(ctx, "", expr, nil, paginate.AgPaginateOptionsRequest{Order: "ASC"})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(events) != 2 || events[0].EventID != "evt-2" {
+		t.Errorf("Query returned unexpected items: %+v", events)
+	}
+
+	key, err := table.KeyOf(events[1])
+	if err != nil {
+		t.Fatalf("KeyOf failed: %v", err)
+	}
+	if len(key) != 2 {
+		t.Errorf("KeyOf -> Expected 2 attributes // Returned: %v", key)
+	}
+	if _, err := table.Key("org-1", nil); err == nil {
+		t.Errorf("Key without sort key was expected to return an error")
+	}
+}
+
+func TestTypedTableVersionedPut(t *testing.T) {
+	ctx := context.Background()
+	table, err := CreateTypedTable[testVersionedEvent](createTestDynamoClient(t), "events")
+	if err != nil {
+		t.Fatalf("CreateTypedTable failed: %v", err)
+	}
+	event := testVersionedEvent{OrgID: "org-1", EventID: "evt-1", Status: "open"}
+	for _, status := range []string{"open", "closed", "archived"} {
+		event.Status = status
+		if err := table.Put(ctx, &event); err != nil {
+			t.Fatalf("Put %s failed: %v", status, err)
+		}
+	}
+	stored, err := table.Get(ctx, "org-1", "evt-1")
+	if err != nil || stored.Version != 3 || event.Version != 3 || stored.Status != "archived" {
+		t.Errorf("Item after puts -> Expected: archived v3 // Returned: %+v (caller v%d) %v", stored, event.Version, err)
+	}
+}
+
+func TestTypedTableVersionedPatch(t *testing.T) {
+	ctx := context.Background()
+	table, err := CreateTypedTable[testVersionedEvent](createTestDynamoClient(t), "events")
+	if err != nil {
+		t.Fatalf("CreateTypedTable failed: %v", err)
+	}
+	event := testVersionedEvent{OrgID: "org-1", EventID: "evt-1", Status: "open"}
+	if err := table.Patch(ctx, &event); err != nil {
+		t.Fatalf("Patch of a new item failed: %v", err)
+	}
+	stale := event
+	event.Status = "closed"
+	if err := table.Patch(ctx, &event); err != nil {
+		t.Fatalf("Patch failed: %v", err)
+	}
+	stale.Status = "archived"
+	if err := table.Patch(ctx, &stale); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("Patch with a stale version -> Expected: ErrVersionConflict // Returned: %v", err)
+	}
+	stored, err := table.Get(ctx, "org-1", "evt-1")
+	if err != nil || stored.Version != 2 || event.Version != 2 || stored.Status != "closed" {
+		t.Errorf("Item after patches -> Expected: closed v2 // Returned: %+v (caller v%d) %v", stored, event.Version, err)
+	}
+}
@@ -0,0 +1,221 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Struct tag used to describe how a field takes part in DynamoDB operations.
+// The attribute name always comes from the dynamodbav tag (or the field
+// name); the dynamo tag only carries options, e.g.
+//
+//	OrgID string `dynamodbav:"orgId" dynamo:",pk"`
+//	ID    string `dynamodbav:"id" dynamo:",sk"`
+//	Rev   int64  `dynamodbav:"rev" dynamo:",version"`
+//	Exp   int64  `dynamodbav:"exp" dynamo:",ttl=24h"`
+//
+// Attributes holding sensitive data are encrypted with the key of a scope
+// named by the encrypt tag, see EncryptionKeyProvider:
+//
+//	Email string `dynamodbav:"email" encrypt:"tenant"`
+const dynamoTagName = "dynamo"
+
+const encryptTagName = "encrypt"
+
+const (
+	dynamoTagPartitionKey = "pk"
+	dynamoTagSortKey      = "sk"
+	dynamoTagVersion      = "version"
+	dynamoTagTTL          = "ttl"
+)
+
+type dynamoStructField struct {
+	index   []int
+	name    string
+	options []string
+	// encryptScope is the key scope of an encrypted field, "" otherwise.
+	encryptScope string
+}
+
+func (f dynamoStructField) hasOption(option string) bool {
+	for _, o := range f.options {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// optionValue returns the value of an option written as name=value, or ""
+// when it is written as name alone.
+func (f dynamoStructField) optionValue(option string) (string, bool) {
+	for _, o := range f.options {
+		name, value, _ := strings.Cut(o, "=")
+		if name == option {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+type dynamoStructInfo struct {
+	fields       []dynamoStructField
+	partitionKey *dynamoStructField
+	sortKey      *dynamoStructField
+	version      *dynamoStructField
+	ttl          *dynamoStructField
+	// ttlDuration is how long after a put the item expires, zero when the
+	// expiry is always set by the caller.
+	ttlDuration time.Duration
+	encrypted   []*dynamoStructField
+}
+
+var dynamoStructInfoCache sync.Map
+
+// getDynamoStructInfo returns the cached attribute metadata of a struct type.
+func getDynamoStructInfo(structType reflect.Type) (*dynamoStructInfo, error) {
+	for structType.Kind() == reflect.Ptr {
+		structType = structType.Elem()
+	}
+	if structType.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("dynamo: %s is not a struct type", structType)
+	}
+	if cached, ok := dynamoStructInfoCache.Load(structType); ok {
+		return cached.(*dynamoStructInfo), nil
+	}
+	info := &dynamoStructInfo{}
+	collectDynamoStructFields(structType, nil, info)
+	for i := range info.fields {
+		field := &info.fields[i]
+		if field.hasOption(dynamoTagPartitionKey) {
+			if info.partitionKey != nil {
+				return nil, fmt.Errorf("dynamo: %s has more than one partition key field", structType)
+			}
+			info.partitionKey = field
+		}
+		if field.hasOption(dynamoTagSortKey) {
+			if info.sortKey != nil {
+				return nil, fmt.Errorf("dynamo: %s has more than one sort key field", structType)
+			}
+			info.sortKey = field
+		}
+		if field.hasOption(dynamoTagVersion) {
+			if info.version != nil {
+				return nil, fmt.Errorf("dynamo: %s has more than one version field", structType)
+			}
+			if !isIntegerKind(structType.FieldByIndex(field.index).Type.Kind()) {
+				return nil, fmt.Errorf("dynamo: version field %s of %s must be an integer", field.name, structType)
+			}
+			info.version = field
+		}
+		if duration, ok := field.optionValue(dynamoTagTTL); ok {
+			if info.ttl != nil {
+				return nil, fmt.Errorf("dynamo: %s has more than one ttl field", structType)
+			}
+			if !isIntegerKind(structType.FieldByIndex(field.index).Type.Kind()) {
+				return nil, fmt.Errorf("dynamo: ttl field %s of %s must be an integer", field.name, structType)
+			}
+			if duration != "" {
+				parsed, err := time.ParseDuration(duration)
+				if err != nil || parsed <= 0 {
+					return nil, fmt.Errorf("dynamo: ttl field %s of %s has an invalid duration %q", field.name, structType, duration)
+				}
+				info.ttlDuration = parsed
+			}
+			info.ttl = field
+		}
+		if field.encryptScope != "" {
+			if field.hasOption(dynamoTagPartitionKey) || field.hasOption(dynamoTagSortKey) || field.hasOption(dynamoTagVersion) || field == info.ttl {
+				return nil, fmt.Errorf("dynamo: key, version and ttl fields of %s cannot be encrypted", structType)
+			}
+			if !isEncryptableType(structType.FieldByIndex(field.index).Type) {
+				return nil, fmt.Errorf("dynamo: encrypted field %s of %s must be a string or []byte", field.name, structType)
+			}
+			info.encrypted = append(info.encrypted, field)
+		}
+	}
+	if len(info.encrypted) > 0 && info.partitionKey == nil {
+		return nil, fmt.Errorf("dynamo: %s has encrypted fields but no field tagged dynamo:\",pk\"", structType)
+	}
+	cached, _ := dynamoStructInfoCache.LoadOrStore(structType, info)
+	return cached.(*dynamoStructInfo), nil
+}
+
+func isIntegerKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+func isEncryptableType(fieldType reflect.Type) bool {
+	if fieldType.Kind() == reflect.Ptr {
+		fieldType = fieldType.Elem()
+	}
+	return fieldType.Kind() == reflect.String || (fieldType.Kind() == reflect.Slice && fieldType.Elem().Kind() == reflect.Uint8)
+}
+
+func collectDynamoStructFields(structType reflect.Type, parentIndex []int, info *dynamoStructInfo) {
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		index := append(append([]int{}, parentIndex...), i)
+
+		avTag := field.Tag.Get("dynamodbav")
+		name, _, _ := strings.Cut(avTag, ",")
+		if name == "-" {
+			continue
+		}
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			collectDynamoStructFields(fieldType, index, info)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		var options []string
+		if dynamoTag, ok := field.Tag.Lookup(dynamoTagName); ok {
+			parts := strings.Split(dynamoTag, ",")
+			for _, option := range parts[1:] {
+				if option = strings.TrimSpace(option); option != "" {
+					options = append(options, option)
+				}
+			}
+		}
+		info.fields = append(info.fields, dynamoStructField{index: index, name: name, options: options, encryptScope: field.Tag.Get(encryptTagName)})
+	}
+}
+
+// fieldValue returns the value of a field, or false when it sits behind a nil
+// embedded pointer.
+func (f dynamoStructField) fieldValue(structValue reflect.Value) (reflect.Value, bool) {
+	for structValue.Kind() == reflect.Ptr {
+		if structValue.IsNil() {
+			return reflect.Value{}, false
+		}
+		structValue = structValue.Elem()
+	}
+	for i, index := range f.index {
+		if i > 0 {
+			for structValue.Kind() == reflect.Ptr {
+				if structValue.IsNil() {
+					return reflect.Value{}, false
+				}
+				structValue = structValue.Elem()
+			}
+		}
+		structValue = structValue.Field(index)
+	}
+	return structValue, true
+}
@@ -0,0 +1,129 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// TransactionOperation is the kind of write added to a NoSqlTransaction.
+type TransactionOperation string
+
+const (
+	TransactionOperationPut            TransactionOperation = "Put"
+	TransactionOperationUpdate         TransactionOperation = "Update"
+	TransactionOperationDelete         TransactionOperation = "Delete"
+	TransactionOperationConditionCheck TransactionOperation = "ConditionCheck"
+)
+
+// TransactionItemFailure is the cancellation reason of one transaction item.
+// Index is the position of the item in the NoSqlTransaction and TableName is
+// the full table name, including the environment prefix. Item holds the
+// stored item when the write asked for ReturnValuesOnConditionCheckFailure.
+type TransactionItemFailure struct {
+	Index     int
+	TableName string
+	Operation TransactionOperation
+	Code      string
+	Message   string
+	Item      map[string]types.AttributeValue
+}
+
+// TransactionCanceledError is returned by ExecuteTransaction when DynamoDB
+// cancels the transaction. Failures lists only the items that caused the
+// cancellation. The SDK exception stays reachable with errors.As,
+// errors.Is(err, ErrVersionConflict) reports a failed version check and
+// errors.As(err, *UniqueViolationError) a value that is already taken and
+// errors.As(err, *UniqueOwnerError) a released value held by another entity.
+type TransactionCanceledError struct {
+	Failures []TransactionItemFailure
+	Err      error
+
+	versionConflict bool
+	violations      []error
+}
+
+func (e *TransactionCanceledError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("transaction canceled")
+	for i, failure := range e.Failures {
+		if i == 0 {
+			sb.WriteString(": ")
+		} else {
+			sb.WriteString("; ")
+		}
+		fmt.Fprintf(&sb, "item %d (%s %s) %s", failure.Index, failure.Operation, failure.TableName, failure.Code)
+		if failure.Message != "" {
+			fmt.Fprintf(&sb, " %s", failure.Message)
+		}
+	}
+	return sb.String()
+}
+
+func (e *TransactionCanceledError) Unwrap() []error {
+	errs := []error{e.Err}
+	if e.versionConflict {
+		errs = append(errs, ErrVersionConflict)
+	}
+	return append(errs, e.violations...)
+}
+
+// ConditionFailed reports whether the condition of the given item failed.
+func (e *TransactionCanceledError) ConditionFailed(index int) bool {
+	for _, failure := range e.Failures {
+		if failure.Index == index && failure.Code == "ConditionalCheckFailed" {
+			return true
+		}
+	}
+	return false
+}
+
+func transactionItemTarget(item types.TransactWriteItem) (string, TransactionOperation) {
+	switch {
+	case item.Put != nil:
+		return aws.ToString(item.Put.TableName), TransactionOperationPut
+	case item.Update != nil:
+		return aws.ToString(item.Update.TableName), TransactionOperationUpdate
+	case item.Delete != nil:
+		return aws.ToString(item.Delete.TableName), TransactionOperationDelete
+	case item.ConditionCheck != nil:
+		return aws.ToString(item.ConditionCheck.TableName), TransactionOperationConditionCheck
+	}
+	return "", ""
+}
+
+// canceledError maps the cancellation reasons of a failed TransactWriteItems
+// call back to the items of the transaction. Other errors are returned as is.
+func (x *NoSqlTransaction) canceledError(err error) error {
+	var canceledErr *types.TransactionCanceledException
+	if !errors.As(err, &canceledErr) {
+		return err
+	}
+	result := &TransactionCanceledError{Err: err}
+	for i, reason := range canceledErr.CancellationReasons {
+		code := aws.ToString(reason.Code)
+		if code == "" || code == "None" {
+			continue
+		}
+		failure := TransactionItemFailure{
+			Index:   i,
+			Code:    code,
+			Message: aws.ToString(reason.Message),
+			Item:    reason.Item,
+		}
+		if i < len(x.items) {
+			failure.TableName, failure.Operation = transactionItemTarget(x.items[i])
+		}
+		if _, versioned := x.versions[i]; versioned && code == "ConditionalCheckFailed" {
+			result.versionConflict = true
+		}
+		if guard, guarded := x.guards[i]; guarded && code == "ConditionalCheckFailed" {
+			result.violations = append(result.violations, guard.error())
+		}
+		result.Failures = append(result.Failures, failure)
+	}
+	return result
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestTransactionCanceledError(t *testing.T) {
+	client := createTestDynamoClient(t)
+	seedTestEvents(t, client, 2)
+
+	exists := expression.AttributeExists(expression.Name("eventId"))
+	existsExpr, _ := expression.NewBuilder().WithCondition(exists).Build()
+	update, _ := expression.NewBuilder().
+		WithUpdate(expression.Set(expression.Name("status"), expression.Value("closed"))).
+		WithCondition(expression.Name("status").Equal(expression.Value("archived"))).
+		Build()
+
+	transaction := CreateNoSqlTransaction(client)
+	transaction.AddTransactionPutExpr("events", testEvent{OrgID: "org-1", EventID: "evt-00", Status: "open"}, existsExpr)
+	transaction.AddTransactionUpdate(context.Background(), "events", testEventKey("evt-01"), update)
+	transaction.AddTransactionDelete("events", testEventKey("evt-99"))
+	err := client.ExecuteTransaction(context.Background(), transaction)
+
+	var canceledErr *TransactionCanceledError
+	if !errors.As(err, &canceledErr) {
+		t.Fatalf("ExecuteTransaction -> Expected: TransactionCanceledError // Returned: %v", err)
+	}
+	var sdkErr *types.TransactionCanceledException
+	if !errors.As(err, &sdkErr) {
+		t.Errorf("ExecuteTransaction -> Expected: wrapped TransactionCanceledException // Returned: %v", err)
+	}
+	if errors.Is(err, ErrVersionConflict) {
+		t.Errorf("Unversioned items must not report ErrVersionConflict: %v", err)
+	}
+	if len(canceledErr.Failures) != 1 {
+		t.Fatalf("Failures -> Expected: 1 // Returned: %+v", canceledErr.Failures)
+	}
+	failure := canceledErr.Failures[0]
+	expected := TransactionItemFailure{Index: 1, TableName: "test.events", Operation: TransactionOperationUpdate, Code: "ConditionalCheckFailed"}
+	if failure.Index != expected.Index || failure.TableName != expected.TableName || failure.Operation != expected.Operation || failure.Code != expected.Code {
+		t.Errorf("Failure -> Expected: %+v // Returned: %+v", expected, failure)
+	}
+	if !canceledErr.ConditionFailed(1) || canceledErr.ConditionFailed(0) {
+		t.Errorf("ConditionFailed -> Expected: only item 1 // Returned: %+v", canceledErr.Failures)
+	}
+}
+
+func TestTransactionClientRequestToken(t *testing.T) {
+	client := createTestDynamoClient(t)
+
+	newTransaction := func() *NoSqlTransaction {
+		transaction := CreateNoSqlTransaction(client)
+		transaction.SetClientRequestToken("create-evt-60")
+		transaction.AddTransactionPut("events", testEvent{OrgID: "org-1", EventID: "evt-60", Status: "open"})
+		return transaction
+	}
+	if err := client.ExecuteTransaction(context.Background(), newTransaction()); err != nil {
+		t.Fatalf("ExecuteTransaction failed: %v", err)
+	}
+	if err := client.DeleteItem(context.Background(), "events", testEventKey("evt-60")); err != nil {
+		t.Fatalf("DeleteItem failed: %v", err)
+	}
+	if err := client.ExecuteTransaction(context.Background(), newTransaction()); err != nil {
+		t.Fatalf("Retried ExecuteTransaction failed: %v", err)
+	}
+	var event testEvent
+	if err := client.Get(context.Background(), "events", testEventKey("evt-60"), &event); !errors.Is(err, ErrQueryNoData) {
+		t.Errorf("Retried transaction with the same token -> Expected: not applied again // Returned: %+v, %v", event, err)
+	}
+}
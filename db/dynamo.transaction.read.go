@@ -0,0 +1,108 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const transactGetMaxItems = 100
+
+// NoSqlReadTransaction reads items from one or more tables as a single
+// consistent snapshot with TransactGetItems.
+type NoSqlReadTransaction struct {
+	items       []types.TransactGetItem
+	targets     []interface{}
+	tables      []string
+	found       []bool
+	dbEnvPrefix string
+}
+
+func (c NoSqlReadTransaction) GetTableUrl(tableName string) string {
+	if c.dbEnvPrefix == "" {
+		return tableName
+	}
+
+	return c.dbEnvPrefix + "." + tableName
+}
+
+func CreateNoSqlReadTransaction(dynamoClient *DynamoDatabaseClient) *NoSqlReadTransaction {
+	return &NoSqlReadTransaction{
+		items:       []types.TransactGetItem{},
+		dbEnvPrefix: dynamoClient.dbEnvPrefix,
+	}
+}
+
+// AddGet reads the item stored under key into resultDataPointer. projection
+// lists the attributes to read; use nil to read the whole item.
+func (x *NoSqlReadTransaction) AddGet(tableName string, key map[string]types.AttributeValue, projection []string, resultDataPointer interface{}) error {
+	if len(x.items) == transactGetMaxItems {
+		return fmt.Errorf("dynamo: a read transaction accepts at most %d items", transactGetMaxItems)
+	}
+	get := &types.Get{
+		TableName: aws.String(x.GetTableUrl(tableName)),
+		Key:       key,
+	}
+	if len(projection) > 0 {
+		names := make([]expression.NameBuilder, len(projection))
+		for i, name := range projection {
+			names[i] = expression.Name(name)
+		}
+		expr, err := expression.NewBuilder().WithProjection(expression.NamesList(names[0], names[1:]...)).Build()
+		if err != nil {
+			return err
+		}
+		get.ProjectionExpression = expr.Projection()
+		get.ExpressionAttributeNames = expr.Names()
+	}
+	x.items = append(x.items, types.TransactGetItem{Get: get})
+	x.targets = append(x.targets, resultDataPointer)
+	x.tables = append(x.tables, tableName)
+	return nil
+}
+
+// Found reports whether the i-th get of an executed transaction returned an
+// item. The target of a missing item is left untouched.
+func (x *NoSqlReadTransaction) Found(i int) bool {
+	return i >= 0 && i < len(x.found) && x.found[i]
+}
+
+func (x *NoSqlReadTransaction) BuildTransaction() *dynamodb.TransactGetItemsInput {
+	return &dynamodb.TransactGetItemsInput{
+		TransactItems:          x.items,
+		ReturnConsumedCapacity: types.ReturnConsumedCapacityTotal,
+	}
+}
+
+// ExecuteReadTransaction runs the gets of params as one TransactGetItems call
+// and unmarshals every item found into its target.
+func (c DynamoDatabaseClient) ExecuteReadTransaction(ctx context.Context, params *NoSqlReadTransaction) error {
+	response, err := c.dynamoClient.TransactGetItems(ctx, params.BuildTransaction())
+	if err != nil {
+		return err
+	}
+	params.found = make([]bool, len(params.items))
+	for i, itemResponse := range response.Responses {
+		if i >= len(params.targets) || itemResponse.Item == nil {
+			continue
+		}
+		cipher, err := c.attributeCipher(params.tables[i], params.targets[i])
+		if err != nil {
+			return err
+		}
+		item, err := cipher.open(ctx, itemResponse.Item, params.items[i].Get.Key)
+		if err != nil {
+			return err
+		}
+		if err := attributevalue.UnmarshalMap(item, params.targets[i]); err != nil {
+			return err
+		}
+		params.found[i] = true
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+)
+
+func TestExecuteReadTransaction(t *testing.T) {
+	client := createTestDynamoClient(t)
+	createTestUsersTable(t, client)
+	seedTestEvents(t, client, 3)
+	if err := client.PutItem(context.Background(), "users", testUser{UserID: "user-1", Name: "Ana"}); err != nil {
+		t.Fatalf("PutItem failed: %v", err)
+	}
+	userKey, _ := attributevalue.MarshalMap(map[string]string{"userId": "user-1"})
+
+	var event, missing testEvent
+	var user testUser
+	tx := CreateNoSqlReadTransaction(client)
+	if err := tx.AddGet("events", testEventKey("evt-01"), nil, &event); err != nil {
+		t.Fatalf("AddGet failed: %v", err)
+	}
+	if err := tx.AddGet("users", userKey, []string{"name"}, &user); err != nil {
+		t.Fatalf("AddGet failed: %v", err)
+	}
+	if err := tx.AddGet("events", testEventKey("evt-99"), nil, &missing); err != nil {
+		t.Fatalf("AddGet failed: %v", err)
+	}
+	if err := client.ExecuteReadTransaction(context.Background(), tx); err != nil {
+		t.Fatalf("ExecuteReadTransaction failed: %v", err)
+	}
+
+	testCases := []struct {
+		description string
+		index       int
+		found       bool
+		valid       bool
+	}{
+		{"Full item", 0, true, event.EventID == "evt-01" && event.Amount == 10},
+		{"Projected item", 1, true, user.Name == "Ana" && user.UserID == ""},
+		{"Missing item", 2, false, missing == testEvent{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			if tx.Found(tc.index) != tc.found {
+				t.Errorf("Found(%d) -> Expected: %v // Returned: %v", tc.index, tc.found, tx.Found(tc.index))
+			}
+			if !tc.valid {
+				t.Errorf("Target %d -> Returned: event %+v user %+v missing %+v", tc.index, event, user, missing)
+			}
+		})
+	}
+}
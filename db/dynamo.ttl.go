@@ -0,0 +1,117 @@
+package db
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Placeholders of the expiry filter. Like the version placeholders they
+// cannot collide with the ones generated by the expression package.
+const (
+	ttlFilterName  = "#dynamoTTL"
+	ttlFilterValue = ":dynamoNow"
+)
+
+type expiredItemsContextKey struct{}
+
+// WithExpiredItems returns a context whose reads also return items whose
+// ttl has passed but that DynamoDB has not deleted yet. By default reads into
+// a struct with a field tagged dynamo:",ttl" skip them.
+func WithExpiredItems(ctx context.Context) context.Context {
+	return context.WithValue(ctx, expiredItemsContextKey{}, true)
+}
+
+// itemStructInfo returns the struct metadata of the items behind data,
+// directly, as the element of a slice or as the source of an *EntityItem, or
+// nil when they are not structs.
+func itemStructInfo(data interface{}) (*dynamoStructInfo, error) {
+	dataType := reflect.TypeOf(entityItemSource(data))
+	for dataType != nil && (dataType.Kind() == reflect.Ptr || dataType.Kind() == reflect.Slice || dataType.Kind() == reflect.Array) {
+		dataType = dataType.Elem()
+	}
+	if dataType == nil || dataType.Kind() != reflect.Struct {
+		return nil, nil
+	}
+	return getDynamoStructInfo(dataType)
+}
+
+// ttlInfoOf returns the struct metadata of the items behind data when they
+// have a ttl field.
+func ttlInfoOf(data interface{}) *dynamoStructInfo {
+	info, err := itemStructInfo(data)
+	if err != nil || info == nil || info.ttl == nil {
+		return nil
+	}
+	return info
+}
+
+// applyItemTTL fills in the expiry of a marshalled item about to be put. An
+// expiry set by the caller is kept; a zero one becomes now plus the duration
+// of the tag, or is left out when the tag has none.
+func applyItemTTL(data interface{}, item map[string]types.AttributeValue) {
+	info := ttlInfoOf(data)
+	if info == nil {
+		return
+	}
+	if expiry, ok := item[info.ttl.name].(*types.AttributeValueMemberN); ok && expiry.Value != "0" {
+		return
+	}
+	if info.ttlDuration == 0 {
+		delete(item, info.ttl.name)
+		return
+	}
+	item[info.ttl.name] = &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Add(info.ttlDuration).Unix(), 10)}
+}
+
+// expiryAttribute returns the ttl attribute of the items read into
+// resultDataPointer, or "" when expired items must not be filtered.
+func expiryAttribute(ctx context.Context, resultDataPointer interface{}) string {
+	if includeExpired, _ := ctx.Value(expiredItemsContextKey{}).(bool); includeExpired {
+		return ""
+	}
+	info := ttlInfoOf(resultDataPointer)
+	if info == nil {
+		return ""
+	}
+	return info.ttl.name
+}
+
+// expiryFilter adds the "not expired" check to the filter of a query or scan
+// into resultDataPointer.
+func expiryFilter(ctx context.Context, resultDataPointer interface{}, filter *string, names map[string]string, values map[string]types.AttributeValue) (*string, map[string]string, map[string]types.AttributeValue) {
+	attribute := expiryAttribute(ctx, resultDataPointer)
+	if attribute == "" {
+		return filter, names, values
+	}
+	mergedNames := map[string]string{ttlFilterName: attribute}
+	for placeholder, name := range names {
+		mergedNames[placeholder] = name
+	}
+	mergedValues := map[string]types.AttributeValue{ttlFilterValue: &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)}}
+	for placeholder, value := range values {
+		mergedValues[placeholder] = value
+	}
+	expiryCondition := "(attribute_not_exists(" + ttlFilterName + ") OR " + ttlFilterName + " > " + ttlFilterValue + ")"
+	if filter != nil && *filter != "" {
+		expiryCondition = "(" + *filter + ") AND " + expiryCondition
+	}
+	return aws.String(expiryCondition), mergedNames, mergedValues
+}
+
+// isExpired reports whether an item read by key has an expiry in the past.
+func isExpired(attribute string, item map[string]types.AttributeValue) bool {
+	if attribute == "" {
+		return false
+	}
+	expiry, ok := item[attribute].(*types.AttributeValueMemberN)
+	if !ok {
+		return false
+	}
+	seconds, err := strconv.ParseInt(expiry.Value, 10, 64)
+	return err == nil && seconds <= time.Now().Unix()
+}
@@ -0,0 +1,227 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type testSession struct {
+	OrgID     string `dynamodbav:"orgId"`
+	EventID   string `dynamodbav:"eventId"`
+	Status    string `dynamodbav:"status"`
+	ExpiresAt int64  `dynamodbav:"expiresAt" dynamo:",ttl=1h"`
+}
+
+type testCode struct {
+	OrgID     string `dynamodbav:"orgId"`
+	EventID   string `dynamodbav:"eventId"`
+	Status    string `dynamodbav:"status"`
+	ExpiresAt int64  `dynamodbav:"expiresAt" dynamo:",ttl"`
+}
+
+type testEventExpiry struct {
+	EventID   string `dynamodbav:"eventId"`
+	ExpiresAt *int64 `dynamodbav:"expiresAt"`
+}
+
+func TestTTLTag(t *testing.T) {
+	testCases := []struct {
+		description string
+		item        interface{}
+		expectedErr bool
+	}{
+		{"duration", testSession{}, false},
+		{"no duration", testCode{}, false},
+		{"string field", struct {
+			Expiry string `dynamo:",ttl"`
+		}{}, true},
+		{"invalid duration", struct {
+			Expiry int64 `dynamo:",ttl=soon"`
+		}{}, true},
+		{"two ttl fields", struct {
+			Expiry  int64 `dynamo:",ttl"`
+			Expiry2 int64 `dynamo:",ttl"`
+		}{}, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			_, err := getDynamoStructInfo(reflect.TypeOf(tc.item))
+			if (err != nil) != tc.expectedErr {
+				t.Errorf("getDynamoStructInfo -> Expected error: %v // Returned: %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestTTLWrites(t *testing.T) {
+	ctx := context.Background()
+	client := createTestDynamoClient(t)
+	past := time.Now().Add(-time.Minute).Unix()
+
+	transaction := CreateNoSqlTransaction(client)
+	transaction.AddTransactionPut("events", testSession{OrgID: "org-1", EventID: "evt-tx", Status: "open"})
+	if err := client.ExecuteTransaction(ctx, transaction); err != nil {
+		t.Fatalf("ExecuteTransaction failed: %v", err)
+	}
+	writes := []struct {
+		eventID string
+		item    interface{}
+	}{
+		{"evt-put", testSession{OrgID: "org-1", EventID: "evt-put", Status: "open"}},
+		{"evt-set", testSession{OrgID: "org-1", EventID: "evt-set", Status: "open", ExpiresAt: past}},
+		{"evt-code", testCode{OrgID: "org-1", EventID: "evt-code", Status: "open"}},
+	}
+	for _, write := range writes {
+		if err := client.PutItem(ctx, "events", write.item); err != nil {
+			t.Fatalf("PutItem %s failed: %v", write.eventID, err)
+		}
+	}
+
+	inAnHour := time.Now().Add(time.Hour).Unix()
+	testCases := []struct {
+		eventID     string
+		expectedMin int64
+		expectedMax int64
+	}{
+		{"evt-tx", inAnHour - 5, inAnHour},
+		{"evt-put", inAnHour - 5, inAnHour},
+		{"evt-set", past, past},
+		{"evt-code", 0, 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.eventID, func(t *testing.T) {
+			var item testEventExpiry
+			if err := client.Get(ctx, "events", testEventKey(tc.eventID), &item); err != nil {
+				t.Fatalf("Get failed: %v", err)
+			}
+			var expiresAt int64
+			if item.ExpiresAt != nil {
+				expiresAt = *item.ExpiresAt
+			}
+			if expiresAt < tc.expectedMin || expiresAt > tc.expectedMax {
+				t.Errorf("expiresAt -> Expected: %d..%d // Returned: %d", tc.expectedMin, tc.expectedMax, expiresAt)
+			}
+			if tc.expectedMax == 0 && item.ExpiresAt != nil {
+				t.Errorf("expiresAt without duration -> Expected: not stored // Returned: %d", *item.ExpiresAt)
+			}
+		})
+	}
+}
+
+func TestTTLReads(t *testing.T) {
+	ctx := context.Background()
+	client := createTestDynamoClient(t)
+	past := time.Now().Add(-time.Minute).Unix()
+	for _, session := range []testSession{
+		{OrgID: "org-1", EventID: "evt-1", Status: "open"},
+		{OrgID: "org-1", EventID: "evt-2", Status: "open", ExpiresAt: past},
+		{OrgID: "org-1", EventID: "evt-3", Status: "closed"},
+	} {
+		if err := client.PutItem(ctx, "events", session); err != nil {
+			t.Fatalf("PutItem failed: %v", err)
+		}
+	}
+	expr, err := expression.NewBuilder().
+		WithKeyCondition(expression.Key("orgId").Equal(expression.Value("org-1"))).
+		WithFilter(expression.Name("status").Equal(expression.Value("open"))).
+		Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	keys := []map[string]types.AttributeValue{testEventKey("evt-1"), testEventKey("evt-2"), testEventKey("evt-3")}
+	fromExpired, err := expression.NewBuilder().
+		WithKeyCondition(expression.Key("orgId").Equal(expression.Value("org-1")).And(expression.Key("eventId").GreaterThanEqual(expression.Value("evt-2")))).
+		Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	testCases := []struct {
+		description string
+		read        func(ctx context.Context) ([]string, error)
+		expected    []string
+		expectedAll []string
+	}{
+		{"Get", func(ctx context.Context) ([]string, error) {
+			var session testSession
+			err := client.Get(ctx, "events", testEventKey("evt-2"), &session)
+			return []string{session.EventID}, err
+		}, nil, []string{"evt-2"}},
+		{"GetWithOptions", func(ctx context.Context) ([]string, error) {
+			var session testSession
+			err := client.GetWithOptions(ctx, "events", testEventKey("evt-2"), &session, GetOptions{Attributes: []string{"eventId", "status"}})
+			return []string{session.EventID}, err
+		}, nil, []string{"evt-2"}},
+		{"GetBatch", func(ctx context.Context) ([]string, error) {
+			var sessions []testSession
+			err := client.GetBatchWithOptions(ctx, "events", keys, &sessions, BatchGetOptions{PreserveOrder: true, Attributes: []string{"status"}})
+			return testSessionIDs(sessions), err
+		}, []string{"evt-1", "evt-3"}, []string{"evt-1", "evt-2", "evt-3"}},
+		{"QueryOne past an expired item", func(ctx context.Context) ([]string, error) {
+			var sessions []testSession
+			err := client.QueryOne(ctx, "events", "", fromExpired, &sessions)
+			return testSessionIDs(sessions), err
+		}, []string{"evt-3"}, []string{"evt-2"}},
+		{"QueryAllItems with filter", func(ctx context.Context) ([]string, error) {
+			var sessions []testSession
+			err := client.QueryAllItems(ctx, "events", "", expr, &sessions)
+			return testSessionIDs(sessions), err
+		}, []string{"evt-1"}, []string{"evt-1", "evt-2"}},
+		{"QueryAll", func(ctx context.Context) ([]string, error) {
+			var ids []string
+			for session, err := range QueryAll[testSession](ctx, client, "events", "", expr, QueryAllOptions{}) {
+				if err != nil {
+					return nil, err
+				}
+				ids = append(ids, session.EventID)
+			}
+			return ids, nil
+		}, []string{"evt-1"}, []string{"evt-1", "evt-2"}},
+		{"ScanAll", func(ctx context.Context) ([]string, error) {
+			var ids []string
+			for session, err := range ScanAll[testSession](ctx, client, "events", expression.Expression{}, ScanOptions{}) {
+				if err != nil {
+					return nil, err
+				}
+				ids = append(ids, session.EventID)
+			}
+			return ids, nil
+		}, []string{"evt-1", "evt-3"}, []string{"evt-1", "evt-2", "evt-3"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			ids, err := tc.read(ctx)
+			if tc.expected == nil {
+				if !errors.Is(err, ErrQueryNoData) {
+					t.Errorf("Expired read -> Expected: ErrQueryNoData // Returned: %v %v", ids, err)
+				}
+			} else if err != nil || !reflect.DeepEqual(ids, tc.expected) {
+				t.Errorf("Read -> Expected: %v // Returned: %v %v", tc.expected, ids, err)
+			}
+
+			ids, err = tc.read(WithExpiredItems(ctx))
+			if err != nil || !reflect.DeepEqual(ids, tc.expectedAll) {
+				t.Errorf("Read WithExpiredItems -> Expected: %v // Returned: %v %v", tc.expectedAll, ids, err)
+			}
+		})
+	}
+
+	var events []testEvent
+	if err := client.QueryAllItems(ctx, "events", "", expr, &events); err != nil || len(events) != 2 {
+		t.Errorf("Query into a type without ttl -> Expected: 2 items // Returned: %+v %v", events, err)
+	}
+}
+
+func testSessionIDs(sessions []testSession) []string {
+	ids := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		ids = append(ids, session.EventID)
+	}
+	return ids
+}
@@ -0,0 +1,154 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var ErrUniqueViolation = errors.New("ErrUniqueViolation")
+var ErrUniqueNotOwned = errors.New("ErrUniqueNotOwned")
+
+// uniqueOwnerAttribute holds, on every guard item, the key of the entity
+// that claimed the value.
+const uniqueOwnerAttribute = "uniqueOwner"
+
+// UniqueConstraint describes where the guard items of a unique field live.
+// Every taken value is stored as its own item, keyed "<Field>#<value>" in
+// PartitionKey and, when the table has one, "<Field>" in SortKey. The guard
+// items can share the table of the entity as long as those keys cannot
+// collide with real items. Guard items also store the key of their owner in
+// the uniqueOwner attribute, so only the owner can release them.
+type UniqueConstraint struct {
+	TableName    string
+	Field        string
+	PartitionKey string
+	SortKey      string
+}
+
+// CreateUniqueConstraint returns the constraint of field, guarded in
+// tableName. Leave sortKey empty for tables without a sort key.
+func CreateUniqueConstraint(tableName, field, partitionKey, sortKey string) UniqueConstraint {
+	return UniqueConstraint{
+		TableName:    tableName,
+		Field:        field,
+		PartitionKey: partitionKey,
+		SortKey:      sortKey,
+	}
+}
+
+// Key returns the key of the guard item of value.
+func (u UniqueConstraint) Key(value string) map[string]types.AttributeValue {
+	key := map[string]types.AttributeValue{
+		u.PartitionKey: &types.AttributeValueMemberS{Value: u.Field + "#" + value},
+	}
+	if u.SortKey != "" {
+		key[u.SortKey] = &types.AttributeValueMemberS{Value: u.Field}
+	}
+	return key
+}
+
+// UniqueViolationError is returned, wrapped in a TransactionCanceledError,
+// when a guard item of the transaction already exists.
+type UniqueViolationError struct {
+	Field string
+	Value string
+}
+
+func (e *UniqueViolationError) Error() string {
+	return fmt.Sprintf("%s: %s %q is already taken", ErrUniqueViolation, e.Field, e.Value)
+}
+
+func (e *UniqueViolationError) Unwrap() error {
+	return ErrUniqueViolation
+}
+
+// UniqueOwnerError is returned, wrapped in a TransactionCanceledError, when
+// a released value is not held by the releasing entity.
+type UniqueOwnerError struct {
+	Field string
+	Value string
+	Owner string
+}
+
+func (e *UniqueOwnerError) Error() string {
+	return fmt.Sprintf("%s: %s %q is not held by %q", ErrUniqueNotOwned, e.Field, e.Value, e.Owner)
+}
+
+func (e *UniqueOwnerError) Unwrap() error {
+	return ErrUniqueNotOwned
+}
+
+type uniqueGuard struct {
+	field   string
+	value   string
+	owner   string
+	release bool
+}
+
+// error returns the typed error of a failed guard condition.
+func (g uniqueGuard) error() error {
+	if g.release {
+		return &UniqueOwnerError{Field: g.field, Value: g.value, Owner: g.owner}
+	}
+	return &UniqueViolationError{Field: g.field, Value: g.value}
+}
+
+func (x *NoSqlTransaction) addUniqueGuard(guard uniqueGuard) {
+	if x.guards == nil {
+		x.guards = make(map[int]uniqueGuard)
+	}
+	x.guards[len(x.items)] = guard
+}
+
+// AddTransactionUniqueGuard claims value for the constraint on behalf of
+// owner, the key of the entity, e.g. its ID. The transaction fails with
+// ErrUniqueViolation when the value is already taken. Empty values are not
+// guarded. Normalize values, e.g. lowercase emails, before calling.
+func (x *NoSqlTransaction) AddTransactionUniqueGuard(constraint UniqueConstraint, owner, value string) {
+	if value == "" {
+		return
+	}
+	item := constraint.Key(value)
+	item[uniqueOwnerAttribute] = &types.AttributeValueMemberS{Value: owner}
+	x.addUniqueGuard(uniqueGuard{field: constraint.Field, value: value, owner: owner})
+	x.items = append(x.items, types.TransactWriteItem{
+		Put: &types.Put{
+			TableName:                aws.String(x.GetTableUrl(constraint.TableName)),
+			Item:                     item,
+			ConditionExpression:      aws.String("attribute_not_exists(#uniqueKey)"),
+			ExpressionAttributeNames: map[string]string{"#uniqueKey": constraint.PartitionKey},
+		},
+	})
+}
+
+// AddTransactionUniqueRelease frees value so another entity can claim it,
+// e.g. when owner, the entity that held it, is deleted. The transaction
+// fails with ErrUniqueNotOwned when value is not held by owner.
+func (x *NoSqlTransaction) AddTransactionUniqueRelease(constraint UniqueConstraint, owner, value string) {
+	if value == "" {
+		return
+	}
+	x.addUniqueGuard(uniqueGuard{field: constraint.Field, value: value, owner: owner, release: true})
+	x.items = append(x.items, types.TransactWriteItem{
+		Delete: &types.Delete{
+			TableName:                 aws.String(x.GetTableUrl(constraint.TableName)),
+			Key:                       constraint.Key(value),
+			ConditionExpression:       aws.String("#uniqueOwner = :uniqueOwner"),
+			ExpressionAttributeNames:  map[string]string{"#uniqueOwner": uniqueOwnerAttribute},
+			ExpressionAttributeValues: map[string]types.AttributeValue{":uniqueOwner": &types.AttributeValueMemberS{Value: owner}},
+		},
+	})
+}
+
+// AddTransactionUniqueChange moves the claim of owner from oldValue to
+// newValue. Nothing is added when the value did not change.
+func (x *NoSqlTransaction) AddTransactionUniqueChange(constraint UniqueConstraint, owner, oldValue, newValue string) {
+	if oldValue == newValue {
+		return
+	}
+	x.AddTransactionUniqueRelease(constraint, owner, oldValue)
+	x.AddTransactionUniqueGuard(constraint, owner, newValue)
+}
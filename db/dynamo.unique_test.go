@@ -0,0 +1,95 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestUniqueConstraintGuards(t *testing.T) {
+	ctx := context.Background()
+	client := createTestDynamoClient(t)
+	email := CreateUniqueConstraint("events", "email", "orgId", "eventId")
+
+	create := func(eventID, value string) error {
+		transaction := CreateNoSqlTransaction(client)
+		if err := transaction.AddTransactionPut("events", testEvent{OrgID: "org-1", EventID: eventID, Status: value}); err != nil {
+			return err
+		}
+		transaction.AddTransactionUniqueGuard(email, eventID, value)
+		return client.ExecuteTransaction(ctx, transaction)
+	}
+	change := func(eventID, oldValue, newValue string) error {
+		transaction := CreateNoSqlTransaction(client)
+		if err := transaction.AddTransactionPut("events", testEvent{OrgID: "org-1", EventID: eventID, Status: newValue}); err != nil {
+			return err
+		}
+		transaction.AddTransactionUniqueChange(email, eventID, oldValue, newValue)
+		return client.ExecuteTransaction(ctx, transaction)
+	}
+	remove := func(eventID, value string) error {
+		transaction := CreateNoSqlTransaction(client)
+		if err := transaction.AddTransactionDelete("events", testEventKey(eventID)); err != nil {
+			return err
+		}
+		transaction.AddTransactionUniqueRelease(email, eventID, value)
+		return client.ExecuteTransaction(ctx, transaction)
+	}
+
+	testCases := []struct {
+		description   string
+		write         func() error
+		expectedErr   error
+		expectedValue string
+	}{
+		{"create a", func() error { return create("evt-a", "a@example.com") }, nil, ""},
+		{"create b with a taken value", func() error { return create("evt-b", "a@example.com") }, ErrUniqueViolation, "a@example.com"},
+		{"change a to the same value", func() error { return change("evt-a", "a@example.com", "a@example.com") }, nil, ""},
+		{"change a to a new value", func() error { return change("evt-a", "a@example.com", "c@example.com") }, nil, ""},
+		{"create b with the released value", func() error { return create("evt-b", "a@example.com") }, nil, ""},
+		{"change b to a taken value", func() error { return change("evt-b", "a@example.com", "c@example.com") }, ErrUniqueViolation, "c@example.com"},
+		{"remove b releasing the value of a", func() error { return remove("evt-b", "c@example.com") }, ErrUniqueNotOwned, "c@example.com"},
+		{"remove a", func() error { return remove("evt-a", "c@example.com") }, nil, ""},
+		{"change b to the released value", func() error { return change("evt-b", "a@example.com", "c@example.com") }, nil, ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			err := tc.write()
+			if tc.expectedErr == nil {
+				if err != nil {
+					t.Fatalf("Write -> Expected: nil // Returned: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("Write -> Expected: %v // Returned: %v", tc.expectedErr, err)
+			}
+			var violation *UniqueViolationError
+			var ownerErr *UniqueOwnerError
+			switch {
+			case errors.As(err, &violation):
+				if violation.Field != "email" || violation.Value != tc.expectedValue {
+					t.Errorf("Violation -> Expected: email %s // Returned: %+v", tc.expectedValue, violation)
+				}
+			case errors.As(err, &ownerErr):
+				if ownerErr.Field != "email" || ownerErr.Value != tc.expectedValue || ownerErr.Owner != "evt-b" {
+					t.Errorf("Owner error -> Expected: email %s of evt-b // Returned: %+v", tc.expectedValue, ownerErr)
+				}
+			default:
+				t.Errorf("Write -> Expected: a typed error naming the field // Returned: %v", err)
+			}
+			var canceledErr *TransactionCanceledError
+			if !errors.As(err, &canceledErr) {
+				t.Errorf("Write -> Expected: TransactionCanceledError // Returned: %v", err)
+			}
+		})
+	}
+
+	var event testEvent
+	if err := client.Get(ctx, "events", testEventKey("evt-b"), &event); err != nil || event.Status != "c@example.com" {
+		t.Errorf("Entity b -> Expected: c@example.com // Returned: %+v %v", event, err)
+	}
+	if err := client.Get(ctx, "events", email.Key("a@example.com"), &event); !errors.Is(err, ErrQueryNoData) {
+		t.Errorf("Released guard -> Expected: ErrQueryNoData // Returned: %v", err)
+	}
+}
@@ -0,0 +1,306 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var ErrEmptyUpdate = errors.New("ErrEmptyUpdate")
+
+// UpdatePatch builds the update expression of a partial update. Paths are
+// document paths such as "address.city" or "tags[0]"; every name in them is
+// replaced by a placeholder, so reserved words need no escaping. A path can
+// only be changed once per patch, and not together with a path inside it,
+// e.g. "address" and "address.city", which DynamoDB rejects as overlapping.
+type UpdatePatch struct {
+	update expression.UpdateBuilder
+	paths  []claimedPath
+	err    error
+}
+
+type claimedPath struct {
+	path     string
+	elements []string
+}
+
+// CreateUpdatePatch returns an empty patch.
+func CreateUpdatePatch() *UpdatePatch {
+	return &UpdatePatch{}
+}
+
+// CreateUpdatePatchFromStruct sets every attribute of item except its key
+// and version fields. Attributes marshalled as NULL, e.g. nil pointers, empty
+// fields tagged omitempty and a zero ttl field are left unchanged, so a
+// struct of pointers describes exactly the fields to update. Encrypted fields
+// can only be written by a put and must be left NULL.
+func CreateUpdatePatchFromStruct(item interface{}) (*UpdatePatch, error) {
+	itemType := reflect.TypeOf(item)
+	if itemType == nil {
+		return nil, fmt.Errorf("dynamo: cannot build an update from nil")
+	}
+	info, err := getDynamoStructInfo(itemType)
+	if err != nil {
+		return nil, err
+	}
+	attributes, err := attributevalue.MarshalMap(item)
+	if err != nil {
+		return nil, err
+	}
+	skip := map[string]bool{}
+	for _, field := range []*dynamoStructField{info.partitionKey, info.sortKey, info.version} {
+		if field != nil {
+			skip[field.name] = true
+		}
+	}
+	for _, field := range info.encrypted {
+		if _, isNull := attributes[field.name].(*types.AttributeValueMemberNULL); !isNull && attributes[field.name] != nil {
+			return nil, fmt.Errorf("dynamo: encrypted field %s of %T cannot be set by an update, put the item instead", field.name, item)
+		}
+	}
+
+	patch := CreateUpdatePatch()
+	for _, name := range sortedAttributeNames(attributes) {
+		value := attributes[name]
+		if _, isNull := value.(*types.AttributeValueMemberNULL); isNull || skip[name] {
+			continue
+		}
+		if expiry, ok := value.(*types.AttributeValueMemberN); ok && info.ttl != nil && name == info.ttl.name && expiry.Value == "0" {
+			continue
+		}
+		patch.setName(name, []string{name}, expression.NameNoDotSplit(name), expression.Value(value))
+	}
+	return patch, patch.err
+}
+
+// CreateUpdatePatchFromMap sets every path of patch to its value, or removes
+// it when the value is nil.
+func CreateUpdatePatchFromMap(patch map[string]interface{}) (*UpdatePatch, error) {
+	result := CreateUpdatePatch()
+	paths := make([]string, 0, len(patch))
+	for path := range patch {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if patch[path] == nil {
+			result.Remove(path)
+		} else {
+			result.Set(path, patch[path])
+		}
+	}
+	return result, result.err
+}
+
+func sortedAttributeNames(attributes map[string]types.AttributeValue) []string {
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// documentPath splits a document path into its attribute names and list
+// indexes, e.g. "tags[0].name" into "tags", "[0]" and "name".
+func documentPath(path string) []string {
+	var elements []string
+	for _, name := range strings.Split(path, ".") {
+		if i := strings.IndexByte(name, '['); i > 0 {
+			name, elements = name[i:], append(elements, name[:i])
+		}
+		for strings.HasPrefix(name, "[") {
+			end := strings.IndexByte(name, ']')
+			if end < 0 {
+				break
+			}
+			name, elements = name[end+1:], append(elements, name[:end+1])
+		}
+		if name != "" {
+			elements = append(elements, name)
+		}
+	}
+	return elements
+}
+
+// claim records that the document path of elements is changed by the patch.
+// It fails when the path, a path inside it or a path around it is already
+// changed.
+func (p *UpdatePatch) claim(path string, elements []string) bool {
+	if p.err != nil {
+		return false
+	}
+	for _, claimed := range p.paths {
+		shortest := min(len(claimed.elements), len(elements))
+		if slices.Equal(claimed.elements[:shortest], elements[:shortest]) {
+			p.err = fmt.Errorf("dynamo: path %s overlaps path %s of the same update", path, claimed.path)
+			return false
+		}
+	}
+	p.paths = append(p.paths, claimedPath{path: path, elements: elements})
+	return true
+}
+
+func (p *UpdatePatch) claimPath(path string) bool {
+	return p.claim(path, documentPath(path))
+}
+
+func (p *UpdatePatch) setName(path string, elements []string, name expression.NameBuilder, value expression.OperandBuilder) *UpdatePatch {
+	if p.claim(path, elements) {
+		p.update = p.update.Set(name, value)
+	}
+	return p
+}
+
+// Set stores value at path.
+func (p *UpdatePatch) Set(path string, value interface{}) *UpdatePatch {
+	return p.setName(path, documentPath(path), expression.Name(path), expression.Value(value))
+}
+
+// SetIfNotExists stores value at path unless the attribute already exists.
+func (p *UpdatePatch) SetIfNotExists(path string, value interface{}) *UpdatePatch {
+	return p.setName(path, documentPath(path), expression.Name(path), expression.IfNotExists(expression.Name(path), expression.Value(value)))
+}
+
+// Append adds the elements of values, a slice, at the end of the list at
+// path. A missing list is created.
+func (p *UpdatePatch) Append(path string, values interface{}) *UpdatePatch {
+	list := expression.IfNotExists(expression.Name(path), expression.Value([]interface{}{}))
+	return p.setName(path, documentPath(path), expression.Name(path), expression.ListAppend(list, expression.Value(values)))
+}
+
+// Prepend adds the elements of values, a slice, at the start of the list at
+// path. A missing list is created.
+func (p *UpdatePatch) Prepend(path string, values interface{}) *UpdatePatch {
+	list := expression.IfNotExists(expression.Name(path), expression.Value([]interface{}{}))
+	return p.setName(path, documentPath(path), expression.Name(path), expression.ListAppend(expression.Value(values), list))
+}
+
+// Remove deletes the attribute at path.
+func (p *UpdatePatch) Remove(path string) *UpdatePatch {
+	if p.claimPath(path) {
+		p.update = p.update.Remove(expression.Name(path))
+	}
+	return p
+}
+
+// Add increments the number at path by value, or adds the elements of value
+// to the set at path. Missing attributes start from zero or an empty set.
+func (p *UpdatePatch) Add(path string, value interface{}) *UpdatePatch {
+	if p.claimPath(path) {
+		p.update = p.update.Add(expression.Name(path), expression.Value(value))
+	}
+	return p
+}
+
+// Delete removes the elements of value from the set at path.
+func (p *UpdatePatch) Delete(path string, value interface{}) *UpdatePatch {
+	if p.claimPath(path) {
+		p.update = p.update.Delete(expression.Name(path), expression.Value(value))
+	}
+	return p
+}
+
+// IsEmpty reports whether the patch changes nothing.
+func (p *UpdatePatch) IsEmpty() bool {
+	return len(p.paths) == 0
+}
+
+// UpdateBuilder returns the patch as an expression.UpdateBuilder, e.g. to
+// pass it to UpdateItemVersioned.
+func (p *UpdatePatch) UpdateBuilder() (expression.UpdateBuilder, error) {
+	if p.err != nil {
+		return expression.UpdateBuilder{}, p.err
+	}
+	if p.IsEmpty() {
+		return expression.UpdateBuilder{}, ErrEmptyUpdate
+	}
+	return p.update, nil
+}
+
+// Expression builds the update expression of the patch. condition is
+// optional, use expression.ConditionBuilder{} if no condition is needed.
+func (p *UpdatePatch) Expression(condition expression.ConditionBuilder) (expression.Expression, error) {
+	update, err := p.UpdateBuilder()
+	if err != nil {
+		return expression.Expression{}, err
+	}
+	builder := expression.NewBuilder().WithUpdate(update)
+	if condition.IsSet() {
+		builder = builder.WithCondition(condition)
+	}
+	return builder.Build()
+}
+
+// UpdateItemPatch applies patch to the item stored under key. condition is
+// optional, use expression.ConditionBuilder{} if no condition is needed. An
+// empty patch returns ErrEmptyUpdate.
+func (c DynamoDatabaseClient) UpdateItemPatch(ctx context.Context, tableName string, key map[string]types.AttributeValue, patch *UpdatePatch, condition expression.ConditionBuilder) error {
+	expr, err := patch.Expression(condition)
+	if err != nil {
+		return err
+	}
+	_, err = c.dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(c.GetTableUrl(tableName)),
+		Key:                       key,
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+	return err
+}
+
+// AddTransactionUpdatePatch is the transactional variant of
+// DynamoDatabaseClient.UpdateItemPatch.
+func (x *NoSqlTransaction) AddTransactionUpdatePatch(tableName string, key map[string]types.AttributeValue, patch *UpdatePatch, condition expression.ConditionBuilder) error {
+	expr, err := patch.Expression(condition)
+	if err != nil {
+		return err
+	}
+	x.items = append(x.items, types.TransactWriteItem{
+		Update: &types.Update{
+			TableName:                 aws.String(x.GetTableUrl(tableName)),
+			Key:                       key,
+			UpdateExpression:          expr.Update(),
+			ConditionExpression:       expr.Condition(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+		},
+	})
+	return nil
+}
+
+// Patch stores the non-key fields of item that are set, see
+// CreateUpdatePatchFromStruct, in the item with the same key, creating it
+// when it does not exist. Versioned items are updated with
+// UpdateItemVersioned, so a stale version returns ErrVersionConflict and item
+// receives the stored version.
+func (t *Table[T]) Patch(ctx context.Context, item *T) error {
+	key, err := t.KeyOf(*item)
+	if err != nil {
+		return err
+	}
+	patch, err := CreateUpdatePatchFromStruct(*item)
+	if err != nil {
+		return err
+	}
+	if t.info.version == nil {
+		return t.client.UpdateItemPatch(ctx, t.tableName, key, patch, expression.ConditionBuilder{})
+	}
+	update, err := patch.UpdateBuilder()
+	if err != nil {
+		return err
+	}
+	return t.client.UpdateItemVersioned(ctx, t.tableName, key, item, update, expression.ConditionBuilder{})
+}
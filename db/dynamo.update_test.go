@@ -0,0 +1,149 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+)
+
+type testPatchEvent struct {
+	OrgID   string            `dynamodbav:"orgId" dynamo:",pk"`
+	EventID string            `dynamodbav:"eventId" dynamo:",sk"`
+	Status  *string           `dynamodbav:"status"`
+	Amount  *int              `dynamodbav:"amount"`
+	Name    string            `dynamodbav:"name,omitempty"`
+	Labels  map[string]string `dynamodbav:"labels,omitempty"`
+}
+
+type testPatchedEvent struct {
+	OrgID   string            `dynamodbav:"orgId"`
+	EventID string            `dynamodbav:"eventId"`
+	Status  string            `dynamodbav:"status"`
+	Amount  int               `dynamodbav:"amount"`
+	Name    string            `dynamodbav:"name"`
+	Size    int               `dynamodbav:"size"`
+	Tags    []string          `dynamodbav:"tags"`
+	Labels  map[string]string `dynamodbav:"labels"`
+	Owner   string            `dynamodbav:"owner"`
+}
+
+func TestUpdateItemPatch(t *testing.T) {
+	ctx := context.Background()
+	closed := "closed"
+
+	testCases := []struct {
+		description string
+		patch       func() (*UpdatePatch, error)
+		expected    testPatchedEvent
+	}{
+		{
+			description: "struct with unset pointers",
+			patch: func() (*UpdatePatch, error) {
+				return CreateUpdatePatchFromStruct(testPatchEvent{OrgID: "org-1", EventID: "evt-1", Status: &closed})
+			},
+			expected: testPatchedEvent{Status: "closed", Amount: 10, Name: "first", Size: 3, Tags: []string{"a"}, Labels: map[string]string{"env": "dev"}},
+		},
+		{
+			description: "map with nested path and removal",
+			patch: func() (*UpdatePatch, error) {
+				return CreateUpdatePatchFromMap(map[string]interface{}{"labels.env": "prod", "name": nil, "size": 7})
+			},
+			expected: testPatchedEvent{Status: "open", Amount: 10, Size: 7, Tags: []string{"a"}, Labels: map[string]string{"env": "prod"}},
+		},
+		{
+			description: "builder with reserved words, ADD and list_append",
+			patch: func() (*UpdatePatch, error) {
+				return CreateUpdatePatch().
+					Add("size", 2).
+					Append("tags", []string{"b", "c"}).
+					Prepend("history", []string{"created"}).
+					SetIfNotExists("owner", "system").
+					SetIfNotExists("status", "ignored"), nil
+			},
+			expected: testPatchedEvent{Status: "open", Amount: 10, Name: "first", Size: 5, Tags: []string{"a", "b", "c"}, Labels: map[string]string{"env": "dev"}, Owner: "system"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			client := createTestDynamoClient(t)
+			seed := map[string]interface{}{
+				"orgId": "org-1", "eventId": "evt-1", "status": "open", "amount": 10, "name": "first",
+				"size": 3, "tags": []string{"a"}, "labels": map[string]string{"env": "dev"},
+			}
+			if err := client.PutItem(ctx, "events", seed); err != nil {
+				t.Fatalf("PutItem failed: %v", err)
+			}
+			patch, err := tc.patch()
+			if err != nil {
+				t.Fatalf("patch failed: %v", err)
+			}
+			if err := client.UpdateItemPatch(ctx, "events", testEventKey("evt-1"), patch, expression.ConditionBuilder{}); err != nil {
+				t.Fatalf("UpdateItemPatch failed: %v", err)
+			}
+			var result testPatchedEvent
+			if err := client.Get(ctx, "events", testEventKey("evt-1"), &result); err != nil {
+				t.Fatalf("Get failed: %v", err)
+			}
+			tc.expected.OrgID, tc.expected.EventID = "org-1", "evt-1"
+			if !reflect.DeepEqual(result, tc.expected) {
+				t.Errorf("Item -> Expected: %+v // Returned: %+v", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestUpdatePatchErrors(t *testing.T) {
+	if _, err := CreateUpdatePatch().Expression(expression.ConditionBuilder{}); !errors.Is(err, ErrEmptyUpdate) {
+		t.Errorf("Empty patch -> Expected: ErrEmptyUpdate // Returned: %v", err)
+	}
+	if _, err := CreateUpdatePatchFromStruct(testPatchEvent{OrgID: "org-1", EventID: "evt-1"}); err != nil {
+		t.Errorf("Struct with only keys -> Expected: nil // Returned: %v", err)
+	}
+
+	testCases := []struct {
+		description string
+		patch       *UpdatePatch
+		expectedErr bool
+	}{
+		{"path changed twice", CreateUpdatePatch().Set("status", "open").Remove("status"), true},
+		{"attribute and a path inside it", CreateUpdatePatch().Set("labels", map[string]string{}).Set("labels.env", "prod"), true},
+		{"path inside an attribute and the attribute", CreateUpdatePatch().Remove("labels.env").Remove("labels"), true},
+		{"list and one of its elements", CreateUpdatePatch().Append("tags", []string{"b"}).Set("tags[0]", "a"), true},
+		{"sibling paths", CreateUpdatePatch().Set("labels.env", "prod").Set("labels.envs", "all").Set("tags[0]", "a").Set("tags[1]", "b"), false},
+		{"attributes with a common prefix", CreateUpdatePatch().Set("size", 1).Set("sizes", 2), false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			_, err := tc.patch.Expression(expression.ConditionBuilder{})
+			if (err != nil) != tc.expectedErr {
+				t.Errorf("Expression -> Expected error: %v // Returned: %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestTransactionUpdatePatch(t *testing.T) {
+	ctx := context.Background()
+	client := createTestDynamoClient(t)
+	seedTestEvents(t, client, 1)
+
+	tx := CreateNoSqlTransaction(client)
+	patch := CreateUpdatePatch().Set("status", "closed").Add("amount", 5)
+	if err := tx.AddTransactionUpdatePatch("events", testEventKey("evt-00"), patch, expression.Name("status").Equal(expression.Value("open"))); err != nil {
+		t.Fatalf("AddTransactionUpdatePatch failed: %v", err)
+	}
+	if err := client.ExecuteTransaction(ctx, tx); err != nil {
+		t.Fatalf("ExecuteTransaction failed: %v", err)
+	}
+	var result testEvent
+	if err := client.Get(ctx, "events", testEventKey("evt-00"), &result); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if result.Status != "closed" || result.Amount != 5 {
+		t.Errorf("Item -> Expected: closed 5 // Returned: %s %d", result.Status, result.Amount)
+	}
+}
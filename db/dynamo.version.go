@@ -0,0 +1,235 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var ErrVersionConflict = errors.New("ErrVersionConflict")
+
+// Placeholders of the version condition. They are chosen so they cannot
+// collide with the #0/:0 placeholders generated by the expression package.
+const (
+	versionConditionName  = "#dynamoVersion"
+	versionConditionValue = ":dynamoVersion"
+)
+
+// itemVersion is the optimistic locking state of an item whose struct has a
+// field tagged dynamo:",version". A zero version means the item must not
+// exist yet; every successful write stores the next version.
+type itemVersion struct {
+	name    string
+	current int64
+	// target is the version field of the caller's struct when it was passed
+	// by pointer, so it can be advanced once the write succeeds.
+	target reflect.Value
+}
+
+// getItemVersion returns the version state of data, or of the source of an
+// *EntityItem, or nil when its type has no version field.
+func getItemVersion(data interface{}) (*itemVersion, error) {
+	data = entityItemSource(data)
+	if data == nil {
+		return nil, nil
+	}
+	value := reflect.ValueOf(data)
+	structType := value.Type()
+	for structType.Kind() == reflect.Ptr {
+		structType = structType.Elem()
+	}
+	if structType.Kind() != reflect.Struct {
+		return nil, nil
+	}
+	info, err := getDynamoStructInfo(structType)
+	if err != nil {
+		return nil, err
+	}
+	if info.version == nil {
+		return nil, nil
+	}
+	version := &itemVersion{name: info.version.name}
+	field, ok := info.version.fieldValue(value)
+	if !ok {
+		return version, nil
+	}
+	switch field.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		version.current = int64(field.Uint())
+	default:
+		version.current = field.Int()
+	}
+	if field.CanSet() {
+		version.target = field
+	}
+	return version, nil
+}
+
+func (v *itemVersion) next() int64 {
+	return v.current + 1
+}
+
+// apply stores the next version in a marshalled item.
+func (v *itemVersion) apply(item map[string]types.AttributeValue) {
+	item[v.name] = &types.AttributeValueMemberN{Value: strconv.FormatInt(v.next(), 10)}
+}
+
+// commit advances the caller's version field after a successful write.
+func (v *itemVersion) commit() {
+	if !v.target.IsValid() {
+		return
+	}
+	switch v.target.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.target.SetUint(uint64(v.next()))
+	default:
+		v.target.SetInt(v.next())
+	}
+}
+
+func (v *itemVersion) condition() expression.ConditionBuilder {
+	if v.current == 0 {
+		return expression.AttributeNotExists(expression.Name(v.name))
+	}
+	return expression.Name(v.name).Equal(expression.Value(v.current))
+}
+
+// mergeCondition adds the version check to an already built condition, as
+// used by puts whose condition comes from a prebuilt expression.
+func (v *itemVersion) mergeCondition(condition *string, names map[string]string, values map[string]types.AttributeValue) (*string, map[string]string, map[string]types.AttributeValue) {
+	mergedNames := map[string]string{versionConditionName: v.name}
+	for placeholder, name := range names {
+		mergedNames[placeholder] = name
+	}
+	mergedValues := make(map[string]types.AttributeValue, len(values)+1)
+	for placeholder, value := range values {
+		mergedValues[placeholder] = value
+	}
+
+	versionCondition := "attribute_not_exists(" + versionConditionName + ")"
+	if v.current != 0 {
+		versionCondition = versionConditionName + " = " + versionConditionValue
+		mergedValues[versionConditionValue] = &types.AttributeValueMemberN{Value: strconv.FormatInt(v.current, 10)}
+	}
+	if len(mergedValues) == 0 {
+		mergedValues = nil
+	}
+	if condition != nil && *condition != "" {
+		versionCondition = "(" + *condition + ") AND (" + versionCondition + ")"
+	}
+	return aws.String(versionCondition), mergedNames, mergedValues
+}
+
+// updateExpression sets the next version in update and guards it with the
+// version check, combined with condition when it is set.
+func (v *itemVersion) updateExpression(update expression.UpdateBuilder, condition expression.ConditionBuilder) (expression.Expression, error) {
+	update = update.Set(expression.Name(v.name), expression.Value(v.next()))
+	versionCondition := v.condition()
+	if condition.IsSet() {
+		versionCondition = condition.And(versionCondition)
+	}
+	return expression.NewBuilder().WithUpdate(update).WithCondition(versionCondition).Build()
+}
+
+// conflictError turns a failed version check into ErrVersionConflict, still
+// wrapping the original error.
+func (v *itemVersion) conflictError(err error, tableUrl string) error {
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		return fmt.Errorf("%w: %s expected version %d: %w", ErrVersionConflict, tableUrl, v.current, err)
+	}
+	return err
+}
+
+// UpdateItemVersioned applies update to the item stored under key only if its
+// stored version still matches the version field of item, and increments the
+// version in the same write. item must be a struct with a field tagged
+// dynamo:",version"; when it is a pointer its version field is advanced on
+// success. condition is optional, use expression.ConditionBuilder{} if no
+// extra condition is needed. A stale version returns ErrVersionConflict.
+func (c DynamoDatabaseClient) UpdateItemVersioned(ctx context.Context, tableName string, key map[string]types.AttributeValue, item interface{}, update expression.UpdateBuilder, condition expression.ConditionBuilder) error {
+	version, err := getItemVersion(item)
+	if err != nil {
+		return err
+	}
+	if version == nil {
+		return fmt.Errorf("dynamo: %T has no field tagged dynamo:\",version\"", item)
+	}
+	expr, err := version.updateExpression(update, condition)
+	if err != nil {
+		return err
+	}
+	tableUrl := c.GetTableUrl(tableName)
+	_, err = c.dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(tableUrl),
+		Key:                       key,
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		return version.conflictError(err, tableUrl)
+	}
+	version.commit()
+	return nil
+}
+
+// AddTransactionUpdateVersioned is the transactional variant of
+// DynamoDatabaseClient.UpdateItemVersioned.
+func (x *NoSqlTransaction) AddTransactionUpdateVersioned(tableName string, key map[string]types.AttributeValue, item interface{}, update expression.UpdateBuilder, condition expression.ConditionBuilder) error {
+	version, err := getItemVersion(item)
+	if err != nil {
+		return err
+	}
+	if version == nil {
+		return fmt.Errorf("dynamo: %T has no field tagged dynamo:\",version\"", item)
+	}
+	expr, err := version.updateExpression(update, condition)
+	if err != nil {
+		return err
+	}
+	x.addVersion(version)
+	x.items = append(x.items, types.TransactWriteItem{
+		Update: &types.Update{
+			TableName:                 aws.String(x.GetTableUrl(tableName)),
+			Key:                       key,
+			UpdateExpression:          expr.Update(),
+			ConditionExpression:       expr.Condition(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+		},
+	})
+	return nil
+}
+
+// addVersion records the version of the item about to be appended.
+func (x *NoSqlTransaction) addVersion(version *itemVersion) {
+	if x.versions == nil {
+		x.versions = make(map[int]*itemVersion)
+	}
+	x.versions[len(x.items)] = version
+}
+
+func (x *NoSqlTransaction) commitVersions() {
+	for _, version := range x.versions {
+		version.commit()
+	}
+}
+
+// UpdateVersioned applies update to the stored copy of item when its version
+// still matches, then advances the version of item.
+func (t *Table[T]) UpdateVersioned(ctx context.Context, item *T, update expression.UpdateBuilder) error {
+	key, err := t.KeyOf(*item)
+	if err != nil {
+		return err
+	}
+	return t.client.UpdateItemVersioned(ctx, t.tableName, key, item, update, expression.ConditionBuilder{})
+}
@@ -0,0 +1,126 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+)
+
+type testVersionedEvent struct {
+	OrgID   string `dynamodbav:"orgId" dynamo:",pk"`
+	EventID string `dynamodbav:"eventId" dynamo:",sk"`
+	Status  string `dynamodbav:"status"`
+	Version int64  `dynamodbav:"version" dynamo:",version"`
+}
+
+func TestVersionedPutAndUpdate(t *testing.T) {
+	client := createTestDynamoClient(t)
+	ctx := context.Background()
+
+	event := testVersionedEvent{OrgID: "org-1", EventID: "evt-1", Status: "open"}
+	if err := client.PutItem(ctx, "events", &event); err != nil {
+		t.Fatalf("PutItem failed: %v", err)
+	}
+	if event.Version != 1 {
+		t.Errorf("Version after create -> Expected: 1 // Returned: %d", event.Version)
+	}
+
+	stale := testVersionedEvent{OrgID: "org-1", EventID: "evt-1", Status: "stale"}
+	if err := client.PutItem(ctx, "events", stale); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("PutItem of a new item over an existing one -> Expected: ErrVersionConflict // Returned: %v", err)
+	}
+
+	stale = event
+	update := expression.Set(expression.Name("status"), expression.Value("closed"))
+	if err := client.UpdateItemVersioned(ctx, "events", testEventKey("evt-1"), &event, update, expression.ConditionBuilder{}); err != nil {
+		t.Fatalf("UpdateItemVersioned failed: %v", err)
+	}
+	if event.Version != 2 {
+		t.Errorf("Version after update -> Expected: 2 // Returned: %d", event.Version)
+	}
+
+	testCases := []struct {
+		description string
+		write       func() error
+	}{
+		{"Put with stale version", func() error {
+			return client.PutItem(ctx, "events", stale)
+		}},
+		{"Update with stale version", func() error {
+			return client.UpdateItemVersioned(ctx, "events", testEventKey("evt-1"), &stale, update, expression.ConditionBuilder{})
+		}},
+		{"Transaction put with stale version", func() error {
+			tx := CreateNoSqlTransaction(client)
+			if err := tx.AddTransactionPut("events", stale); err != nil {
+				return err
+			}
+			return client.ExecuteTransaction(ctx, tx)
+		}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			if err := tc.write(); !errors.Is(err, ErrVersionConflict) {
+				t.Errorf("%s -> Expected: ErrVersionConflict // Returned: %v", tc.description, err)
+			}
+		})
+	}
+	if stale.Version != 1 {
+		t.Errorf("Version after conflicts -> Expected: 1 // Returned: %d", stale.Version)
+	}
+
+	tx := CreateNoSqlTransaction(client)
+	event.Status = "archived"
+	if err := tx.AddTransactionPut("events", &event); err != nil {
+		t.Fatalf("AddTransactionPut failed: %v", err)
+	}
+	if err := client.ExecuteTransaction(ctx, tx); err != nil {
+		t.Fatalf("ExecuteTransaction failed: %v", err)
+	}
+	var stored testVersionedEvent
+	if err := client.Get(ctx, "events", testEventKey("evt-1"), &stored); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if stored.Version != 3 || event.Version != 3 || stored.Status != "archived" {
+		t.Errorf("Item after transaction -> Expected: archived v3 // Returned: %+v (caller v%d)", stored, event.Version)
+	}
+}
+
+func TestVersionedBatchWrite(t *testing.T) {
+	client := createTestDynamoClient(t)
+	ctx := context.Background()
+	event := testVersionedEvent{OrgID: "org-1", EventID: "evt-1", Status: "open"}
+
+	testCases := []struct {
+		description string
+		write       func() error
+	}{
+		{"PutBatch", func() error {
+			return client.PutBatch(ctx, "events", []interface{}{event, testEvent{OrgID: "org-1", EventID: "evt-2", Status: "open"}})
+		}},
+		{"generic PutBatch", func() error {
+			return PutBatch(ctx, client, "events", []*testVersionedEvent{&event}, BatchWriteOptions{})
+		}},
+		{"Table.PutBatch", func() error {
+			table, err := CreateTypedTable[testVersionedEvent](client, "events")
+			if err != nil {
+				return err
+			}
+			return table.PutBatch(ctx, []testVersionedEvent{event})
+		}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			if err := tc.write(); !errors.Is(err, ErrVersionedBatchWrite) {
+				t.Errorf("%s -> Expected: ErrVersionedBatchWrite // Returned: %v", tc.description, err)
+			}
+		})
+	}
+	if err := client.Get(ctx, "events", testEventKey("evt-1"), &event); !errors.Is(err, ErrQueryNoData) {
+		t.Errorf("Versioned item -> Expected: not written // Returned: %v", err)
+	}
+	if err := client.Get(ctx, "events", testEventKey("evt-2"), &event); err != nil {
+		t.Errorf("Unversioned item of the batch -> Expected: written // Returned: %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ReturnOptions selects the item images returned by a write.
+type ReturnOptions struct {
+	// ReturnValues is NONE, ALL_OLD, UPDATED_OLD, UPDATED_NEW or ALL_NEW.
+	// Puts only support NONE and ALL_OLD.
+	ReturnValues types.ReturnValue
+	// ReturnItemOnConditionFailure asks DynamoDB for the stored item when
+	// the condition of the write fails. It is returned in the
+	// *ConditionFailedError of the write.
+	ReturnItemOnConditionFailure bool
+}
+
+func (o ReturnOptions) onConditionCheckFailure() types.ReturnValuesOnConditionCheckFailure {
+	if o.ReturnItemOnConditionFailure {
+		return types.ReturnValuesOnConditionCheckFailureAllOld
+	}
+	return ""
+}
+
+// ConditionFailedError is returned by the Returning writes when their
+// condition fails. Item is the stored item, as stored, when it exists and
+// the write asked for it. The SDK exception stays reachable with errors.As.
+type ConditionFailedError struct {
+	TableName string
+	Item      map[string]types.AttributeValue
+	Err       error
+
+	// client, ctx, tableName and key are those of the write, used to open
+	// the encrypted attributes of Item.
+	client    DynamoDatabaseClient
+	ctx       context.Context
+	tableName string
+	key       map[string]types.AttributeValue
+}
+
+func (e *ConditionFailedError) Error() string {
+	return fmt.Sprintf("condition failed on %s: %v", e.TableName, e.Err)
+}
+
+func (e *ConditionFailedError) Unwrap() error {
+	return e.Err
+}
+
+// UnmarshalItem unmarshals the stored item into resultDataPointer and
+// reports whether there was one. Encrypted attributes are decrypted with the
+// context of the write.
+func (e *ConditionFailedError) UnmarshalItem(resultDataPointer interface{}) (bool, error) {
+	return e.client.unmarshalReturnedAttributes(e.ctx, e.tableName, e.key, e.Item, resultDataPointer)
+}
+
+// conditionFailedError wraps a failed condition of a write of the item
+// stored under key in a *ConditionFailedError.
+func (c DynamoDatabaseClient) conditionFailedError(ctx context.Context, err error, tableName string, key map[string]types.AttributeValue) error {
+	var conditionErr *types.ConditionalCheckFailedException
+	if !errors.As(err, &conditionErr) {
+		return err
+	}
+	return &ConditionFailedError{
+		TableName: c.GetTableUrl(tableName),
+		Item:      conditionErr.Item,
+		Err:       err,
+		client:    c,
+		ctx:       ctx,
+		tableName: tableName,
+		key:       key,
+	}
+}
+
+// unmarshalReturnedAttributes reports whether a write of the item stored
+// under key returned attributes and unmarshals them into resultDataPointer.
+func (c DynamoDatabaseClient) unmarshalReturnedAttributes(ctx context.Context, tableName string, key map[string]types.AttributeValue, attributes map[string]types.AttributeValue, resultDataPointer interface{}) (bool, error) {
+	if len(attributes) == 0 || resultDataPointer == nil {
+		return len(attributes) > 0, nil
+	}
+	cipher, err := c.attributeCipher(tableName, resultDataPointer)
+	if err != nil {
+		return true, err
+	}
+	if attributes, err = cipher.open(ctx, attributes, key); err != nil {
+		return true, err
+	}
+	return true, attributevalue.UnmarshalMap(attributes, resultDataPointer)
+}
+
+// UpdateItemReturning applies expr to the item stored under key and
+// unmarshals the image selected by options into resultDataPointer. It
+// reports whether DynamoDB returned an image; UPDATED_OLD or ALL_OLD return
+// none when the item did not exist. A failed condition returns a
+// *ConditionFailedError.
+func (c DynamoDatabaseClient) UpdateItemReturning(ctx context.Context, tableName string, key map[string]types.AttributeValue, expr expression.Expression, options ReturnOptions, resultDataPointer interface{}) (bool, error) {
+	tableUrl := c.GetTableUrl(tableName)
+	result, err := c.dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                           aws.String(tableUrl),
+		Key:                                 key,
+		UpdateExpression:                    expr.Update(),
+		ConditionExpression:                 expr.Condition(),
+		ExpressionAttributeNames:            expr.Names(),
+		ExpressionAttributeValues:           expr.Values(),
+		ReturnValues:                        options.ReturnValues,
+		ReturnValuesOnConditionCheckFailure: options.onConditionCheckFailure(),
+	})
+	if err != nil {
+		return false, c.conditionFailedError(ctx, err, tableName, key)
+	}
+	return c.unmarshalReturnedAttributes(ctx, tableName, key, result.Attributes, resultDataPointer)
+}
+
+// PutItemReturning writes data when condition holds and unmarshals the item
+// it replaced into resultDataPointer when options ask for ALL_OLD. It
+// reports whether an item was replaced, with NONE too, as the replaced item
+// is always requested. condition is optional, use
+// expression.ConditionBuilder{} if no condition is needed. Versioned items
+// are checked as in PutItem.
+func (c DynamoDatabaseClient) PutItemReturning(ctx context.Context, tableName string, data interface{}, condition expression.ConditionBuilder, options ReturnOptions, resultDataPointer interface{}) (bool, error) {
+	if options.ReturnValues != "" && options.ReturnValues != types.ReturnValueNone && options.ReturnValues != types.ReturnValueAllOld {
+		return false, fmt.Errorf("dynamo: PutItem can only return %s or %s, not %s", types.ReturnValueNone, types.ReturnValueAllOld, options.ReturnValues)
+	}
+	var key map[string]types.AttributeValue
+	result, err := c.putItem(ctx, tableName, data, condition, func(input *dynamodb.PutItemInput) {
+		input.ReturnValues = types.ReturnValueAllOld
+		input.ReturnValuesOnConditionCheckFailure = options.onConditionCheckFailure()
+		key = itemKey(data, input.Item)
+	})
+	if err != nil {
+		return false, err
+	}
+	if options.ReturnValues != types.ReturnValueAllOld {
+		return len(result.Attributes) > 0, nil
+	}
+	return c.unmarshalReturnedAttributes(ctx, tableName, key, result.Attributes, resultDataPointer)
+}
+
+// itemKey returns the key attributes of item, the marshalled form of data,
+// or nil when data has no field tagged dynamo:",pk".
+func itemKey(data interface{}, item map[string]types.AttributeValue) map[string]types.AttributeValue {
+	info, err := itemStructInfo(data)
+	if err != nil || info == nil || info.partitionKey == nil {
+		return nil
+	}
+	key := map[string]types.AttributeValue{info.partitionKey.name: item[info.partitionKey.name]}
+	if info.sortKey != nil {
+		key[info.sortKey.name] = item[info.sortKey.name]
+	}
+	return key
+}
@@ -0,0 +1,183 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestUpdateItemReturning(t *testing.T) {
+	ctx := context.Background()
+
+	testCases := []struct {
+		returnValues   types.ReturnValue
+		expectedFound  bool
+		expectedStatus string
+	}{
+		{types.ReturnValueAllOld, true, "open"},
+		{types.ReturnValueAllNew, true, "closed"},
+		{types.ReturnValueUpdatedOld, true, "open"},
+		{types.ReturnValueUpdatedNew, true, "closed"},
+		{types.ReturnValueNone, false, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.returnValues), func(t *testing.T) {
+			client := createTestDynamoClient(t)
+			seedTestEvents(t, client, 1)
+			expr, err := expression.NewBuilder().WithUpdate(expression.Set(expression.Name("status"), expression.Value("closed"))).Build()
+			if err != nil {
+				t.Fatalf("Build failed: %v", err)
+			}
+			var result testEvent
+			found, err := client.UpdateItemReturning(ctx, "events", testEventKey("evt-00"), expr, ReturnOptions{ReturnValues: tc.returnValues}, &result)
+			if err != nil {
+				t.Fatalf("UpdateItemReturning failed: %v", err)
+			}
+			if found != tc.expectedFound {
+				t.Errorf("Found -> Expected: %v // Returned: %v", tc.expectedFound, found)
+			}
+			if result.Status != tc.expectedStatus {
+				t.Errorf("Status -> Expected: %s // Returned: %s", tc.expectedStatus, result.Status)
+			}
+		})
+	}
+}
+
+func TestPutItemReturning(t *testing.T) {
+	ctx := context.Background()
+	client := createTestDynamoClient(t)
+	options := ReturnOptions{ReturnValues: types.ReturnValueAllOld, ReturnItemOnConditionFailure: true}
+
+	var previous testEvent
+	found, err := client.PutItemReturning(ctx, "events", testEvent{OrgID: "org-1", EventID: "evt-1", Status: "open"}, expression.ConditionBuilder{}, options, &previous)
+	if err != nil || found {
+		t.Fatalf("PutItemReturning of a new item -> Expected: not found // Returned: %v %v", found, err)
+	}
+
+	found, err = client.PutItemReturning(ctx, "events", testEvent{OrgID: "org-1", EventID: "evt-1", Status: "closed"}, expression.ConditionBuilder{}, options, &previous)
+	if err != nil || !found || previous.Status != "open" {
+		t.Errorf("PutItemReturning over an item -> Expected: open // Returned: %v %v %s", found, err, previous.Status)
+	}
+
+	condition := expression.Name("status").Equal(expression.Value("open"))
+	_, err = client.PutItemReturning(ctx, "events", testEvent{OrgID: "org-1", EventID: "evt-1", Status: "archived"}, condition, options, &previous)
+	var conditionErr *ConditionFailedError
+	if !errors.As(err, &conditionErr) {
+		t.Fatalf("PutItemReturning with failed condition -> Expected: ConditionFailedError // Returned: %v", err)
+	}
+	var current testEvent
+	if found, err := conditionErr.UnmarshalItem(&current); err != nil || !found || current.Status != "closed" {
+		t.Errorf("UnmarshalItem -> Expected: closed // Returned: %v %v %s", found, err, current.Status)
+	}
+	var sdkErr *types.ConditionalCheckFailedException
+	if !errors.As(err, &sdkErr) {
+		t.Errorf("ConditionFailedError -> Expected: wraps ConditionalCheckFailedException // Returned: %v", err)
+	}
+
+	previous = testEvent{}
+	found, err = client.PutItemReturning(ctx, "events", testEvent{OrgID: "org-1", EventID: "evt-1", Status: "open"}, expression.ConditionBuilder{}, ReturnOptions{}, &previous)
+	if err != nil || !found || previous.Status != "" {
+		t.Errorf("PutItemReturning without ALL_OLD -> Expected: found, nothing unmarshalled // Returned: %v %v %+v", found, err, previous)
+	}
+
+	if _, err := client.PutItemReturning(ctx, "events", testEvent{OrgID: "org-1", EventID: "evt-1"}, expression.ConditionBuilder{}, ReturnOptions{ReturnValues: types.ReturnValueAllNew}, &previous); err == nil {
+		t.Errorf("PutItemReturning with ALL_NEW -> Expected: error // Returned: nil")
+	}
+}
+
+func TestPutItemReturningEncrypted(t *testing.T) {
+	ctx := context.Background()
+	client, _ := createEncryptedTestDynamoClient(t)
+	options := ReturnOptions{ReturnValues: types.ReturnValueAllOld}
+	customer := testCustomer{OrgID: "org-1", EventID: "cus-1", Status: "open", Email: "ana@example.com"}
+	if _, err := client.PutItemReturning(ctx, "events", customer, expression.ConditionBuilder{}, options, nil); err != nil {
+		t.Fatalf("PutItemReturning failed: %v", err)
+	}
+	var previous testCustomer
+	found, err := client.PutItemReturning(ctx, "events", testCustomer{OrgID: "org-1", EventID: "cus-1", Status: "closed", Email: "eva@example.com"}, expression.ConditionBuilder{}, options, &previous)
+	if err != nil || !found || !reflect.DeepEqual(previous, customer) {
+		t.Errorf("PutItemReturning over an encrypted item -> Expected: %+v // Returned: %v %v %+v", customer, found, err, previous)
+	}
+
+	stored := testCustomer{OrgID: "org-1", EventID: "cus-1", Status: "closed", Email: "eva@example.com"}
+	failing := expression.Name("status").Equal(expression.Value("open"))
+	update, err := expression.NewBuilder().
+		WithUpdate(expression.Set(expression.Name("status"), expression.Value("archived"))).
+		WithCondition(failing).
+		Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	failureOptions := ReturnOptions{ReturnItemOnConditionFailure: true}
+	testCases := []struct {
+		description string
+		write       func() error
+	}{
+		{"PutItemReturning", func() error {
+			_, err := client.PutItemReturning(ctx, "events", customer, failing, failureOptions, nil)
+			return err
+		}},
+		{"UpdateItemReturning", func() error {
+			_, err := client.UpdateItemReturning(ctx, "events", testEventKey("cus-1"), update, failureOptions, nil)
+			return err
+		}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			var conditionErr *ConditionFailedError
+			if err := tc.write(); !errors.As(err, &conditionErr) {
+				t.Fatalf("%s -> Expected: ConditionFailedError // Returned: %v", tc.description, err)
+			}
+			var current testCustomer
+			found, err := conditionErr.UnmarshalItem(&current)
+			if err != nil || !found || !reflect.DeepEqual(current, stored) {
+				t.Errorf("UnmarshalItem of an encrypted item -> Expected: %+v // Returned: %v %v %+v", stored, found, err, current)
+			}
+		})
+	}
+}
+
+func TestUpdateItemReturningConditionFailure(t *testing.T) {
+	ctx := context.Background()
+	client := createTestDynamoClient(t)
+	seedTestEvents(t, client, 1)
+
+	expr, err := expression.NewBuilder().
+		WithUpdate(expression.Set(expression.Name("status"), expression.Value("closed"))).
+		WithCondition(expression.Name("status").Equal(expression.Value("closed"))).
+		Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	testCases := []struct {
+		description   string
+		options       ReturnOptions
+		expectedFound bool
+	}{
+		{"with item", ReturnOptions{ReturnItemOnConditionFailure: true}, true},
+		{"without item", ReturnOptions{}, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			_, err := client.UpdateItemReturning(ctx, "events", testEventKey("evt-00"), expr, tc.options, nil)
+			var conditionErr *ConditionFailedError
+			if !errors.As(err, &conditionErr) {
+				t.Fatalf("UpdateItemReturning -> Expected: ConditionFailedError // Returned: %v", err)
+			}
+			var current testEvent
+			found, err := conditionErr.UnmarshalItem(&current)
+			if err != nil || found != tc.expectedFound {
+				t.Errorf("UnmarshalItem -> Expected: %v // Returned: %v %v", tc.expectedFound, found, err)
+			}
+			if found && current.Status != "open" {
+				t.Errorf("Current status -> Expected: open // Returned: %s", current.Status)
+			}
+		})
+	}
+}
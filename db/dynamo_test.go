@@ -0,0 +1,267 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	paginate "github.com/techvuya/vuya-go-utils/paginate"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type testEvent struct {
+	OrgID     string `dynamodbav:"orgId"`
+	EventID   string `dynamodbav:"eventId"`
+	Status    string `dynamodbav:"status"`
+	Amount    int    `dynamodbav:"amount"`
+	CreatedAt int64  `dynamodbav:"createdAt"`
+}
+
+func (e testEvent) GetCursorID() string {
+	return e.EventID
+}
+
+func createTestDynamoClient(t *testing.T) *DynamoDatabaseClient {
+	t.Helper()
+	memoryClient := CreateMemoryDynamoClient()
+	_, err := memoryClient.CreateTable(context.Background(), &dynamodb.CreateTableInput{
+		TableName: aws.String("test.events"),
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String("orgId"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("eventId"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("status"), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String("createdAt"), AttributeType: types.ScalarAttributeTypeN},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("orgId"), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String("eventId"), KeyType: types.KeyTypeRange},
+		},
+		GlobalSecondaryIndexes: []types.GlobalSecondaryIndex{
+			{
+				IndexName: aws.String("status-createdAt"),
+				KeySchema: []types.KeySchemaElement{
+					{AttributeName: aws.String("status"), KeyType: types.KeyTypeHash},
+					{AttributeName: aws.String("createdAt"), KeyType: types.KeyTypeRange},
+				},
+				Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateTable failed: %v", err)
+	}
+	return CreateDynamoDatabaseClientWithApi(memoryClient, "test")
+}
+
+func seedTestEvents(t *testing.T, client *DynamoDatabaseClient, count int) {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		status := "open"
+		if i%2 == 1 {
+			status = "closed"
+		}
+		event := testEvent{
+			OrgID:     "org-1",
+			EventID:   fmt.Sprintf("evt-%02d", i),
+			Status:    status,
+			Amount:    i * 10,
+			CreatedAt: int64(100 - i),
+		}
+		if err := client.PutItem(context.Background(), "events", event); err != nil {
+			t.Fatalf("PutItem failed: %v", err)
+		}
+	}
+}
+
+func TestMemoryDynamoGetAndPut(t *testing.T) {
+	client := createTestDynamoClient(t)
+	seedTestEvents(t, client, 3)
+
+	key, _ := attributevalue.MarshalMap(map[string]string{"orgId": "org-1", "eventId": "evt-01"})
+	var event testEvent
+	if err := client.Get(context.Background(), "events", key, &event); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if event.Amount != 10 || event.Status != "closed" {
+		t.Errorf("Get returned unexpected item: %+v", event)
+	}
+
+	missing, _ := attributevalue.MarshalMap(map[string]string{"orgId": "org-1", "eventId": "evt-99"})
+	if err := client.Get(context.Background(), "events", missing, &event); !errors.Is(err, ErrQueryNoData) {
+		t.Errorf("Get on missing item -> Expected: ErrQueryNoData // Returned: %v", err)
+	}
+}
+
+func TestMemoryDynamoQuery(t *testing.T) {
+	client := createTestDynamoClient(t)
+	seedTestEvents(t, client, 10)
+
+	testCases := []struct {
+		description   string
+		index         string
+		keyCondition  expression.KeyConditionBuilder
+		filter        *expression.ConditionBuilder
+		order         string
+		expectedFirst string
+		expectedCount int
+	}{
+		{
+			"Table query descending",
+			"",
+			expression.Key("orgId").Equal(expression.Value("org-1")),
+			nil,
+			"DESC",
+			"evt-09",
+			10,
+		},
+		{
+			"Table query ascending with begins_with",
+			"",
+			expression.Key("orgId").Equal(expression.Value("org-1")).And(expression.Key("eventId").BeginsWith("evt-0")),
+			nil,
+			"ASC",
+			"evt-00",
+			10,
+		},
+		{
+			"Table query with between and filter",
+			"",
+			expression.Key("orgId").Equal(expression.Value("org-1")).And(expression.Key("eventId").Between(expression.Value("evt-02"), expression.Value("evt-07"))),
+			conditionPointer(expression.Name("amount").GreaterThanEqual(expression.Value(50))),
+			"ASC",
+			"evt-05",
+			3,
+		},
+		{
+			"GSI query ascending on numeric sort key",
+			"status-createdAt",
+			expression.Key("status").Equal(expression.Value("open")).And(expression.Key("createdAt").LessThan(expression.Value(97))),
+			nil,
+			"ASC",
+			"evt-08",
+			3,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			builder := expression.NewBuilder().WithKeyCondition(tc.keyCondition)
+			if tc.filter != nil {
+				builder = builder.WithFilter(*tc.filter)
+			}
+			expr, err := builder.Build()
+			if err != nil {
+				t.Fatalf("Build failed: %v", err)
+			}
+			var events []testEvent
+			_, err = client.QueryPage(context.Background(), "events", tc.index, expr, nil, &events, paginate.AgPaginateOptionsRequest{Order: tc.order})
+			if err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+			if len(events) != tc.expectedCount {
+				t.Fatalf("Query count -> Expected: %d // Returned: %d", tc.expectedCount, len(events))
+			}
+			if events[0].EventID != tc.expectedFirst {
+				t.Errorf("Query first item -> Expected: %s // Returned: %s", tc.expectedFirst, events[0].EventID)
+			}
+		})
+	}
+}
+
+func conditionPointer(condition expression.ConditionBuilder) *expression.ConditionBuilder {
+	return &condition
+}
+
+func TestMemoryDynamoQueryLimitAndLastEvaluatedKey(t *testing.T) {
+	client := createTestDynamoClient(t)
+	seedTestEvents(t, client, 5)
+
+	expr, _ := expression.NewBuilder().WithKeyCondition(expression.Key("orgId").Equal(expression.Value("org-1"))).Build()
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(client.GetTableUrl("events")),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		Limit:                     aws.Int32(2),
+	}
+	var seen []string
+	for {
+		output, err := client.GetApiClient().Query(context.Background(), input)
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		for _, item := range output.Items {
+			seen = append(seen, item["eventId"].(*types.AttributeValueMemberS).Value)
+		}
+		if output.LastEvaluatedKey == nil {
+			break
+		}
+		input.ExclusiveStartKey = output.LastEvaluatedKey
+	}
+	expected := []string{"evt-00", "evt-01", "evt-02", "evt-03", "evt-04"}
+	if fmt.Sprint(seen) != fmt.Sprint(expected) {
+		t.Errorf("Paged query -> Expected: %v // Returned: %v", expected, seen)
+	}
+}
+
+func TestMemoryDynamoUpdateItem(t *testing.T) {
+	client := createTestDynamoClient(t)
+	seedTestEvents(t, client, 1)
+
+	key, _ := attributevalue.MarshalMap(map[string]string{"orgId": "org-1", "eventId": "evt-00"})
+	values, _ := attributevalue.MarshalMap(map[string]interface{}{":inc": 5, ":status": "open"})
+	err := client.UpdateItem(context.Background(), "events", key, "SET amount = amount + :inc", values, "#status = :status")
+	if err == nil {
+		t.Fatalf("UpdateItem with undefined attribute name was expected to fail")
+	}
+	err = client.UpdateItem(context.Background(), "events", key, "SET amount = amount + :inc", values, "status = :status")
+	if err != nil {
+		t.Fatalf("UpdateItem failed: %v", err)
+	}
+	var event testEvent
+	if err := client.Get(context.Background(), "events", key, &event); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if event.Amount != 5 {
+		t.Errorf("UpdateItem amount -> Expected: 5 // Returned: %d", event.Amount)
+	}
+
+	closedValues, _ := attributevalue.MarshalMap(map[string]interface{}{":inc": 5, ":status": "closed"})
+	err = client.UpdateItem(context.Background(), "events", key, "SET amount = amount + :inc", closedValues, "status = :status")
+	var conditionErr *types.ConditionalCheckFailedException
+	if !errors.As(err, &conditionErr) {
+		t.Errorf("UpdateItem with failing condition -> Expected: ConditionalCheckFailedException // Returned: %v", err)
+	}
+}
+
+func TestMemoryDynamoTransaction(t *testing.T) {
+	client := createTestDynamoClient(t)
+	seedTestEvents(t, client, 1)
+
+	notExists := expression.AttributeNotExists(expression.Name("eventId"))
+	expr, _ := expression.NewBuilder().WithCondition(notExists).Build()
+
+	transaction := CreateNoSqlTransaction(client)
+	transaction.AddTransactionPutExpr("events", testEvent{OrgID: "org-1", EventID: "evt-50", Status: "open"}, expr)
+	transaction.AddTransactionPutExpr("events", testEvent{OrgID: "org-1", EventID: "evt-00", Status: "open"}, expr)
+	err := client.ExecuteTransaction(context.Background(), transaction)
+	var canceledErr *types.TransactionCanceledException
+	if !errors.As(err, &canceledErr) {
+		t.Fatalf("ExecuteTransaction -> Expected: TransactionCanceledException // Returned: %v", err)
+	}
+	if aws.ToString(canceledErr.CancellationReasons[1].Code) != "ConditionalCheckFailed" {
+		t.Errorf("Cancellation reason -> Expected: ConditionalCheckFailed // Returned: %s", aws.ToString(canceledErr.CancellationReasons[1].Code))
+	}
+
+	key, _ := attributevalue.MarshalMap(map[string]string{"orgId": "org-1", "eventId": "evt-50"})
+	var event testEvent
+	if err := client.Get(context.Background(), "events", key, &event); !errors.Is(err, ErrQueryNoData) {
+		t.Errorf("Canceled transaction must not write items, Get returned: %v", err)
+	}
+}